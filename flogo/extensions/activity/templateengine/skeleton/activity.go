@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html"
+	htmltemplate "html/template"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -36,6 +37,11 @@ type Settings struct {
 	TemplateCacheSize int    `md:"templateCacheSize"`
 	EnableSafeMode    bool   `md:"enableSafeMode"`
 	TemplatePath      string `md:"templatePath"`
+	RenderTimeout     int    `md:"renderTimeout"`     // milliseconds
+	MaxOutputSize     int    `md:"maxOutputSize"`     // bytes
+	MaxLoopIterations int    `md:"maxLoopIterations"` // across all loops of a render
+	MaxTemplateDepth  int    `md:"maxTemplateDepth"`  // nested templates and partials
+	DefaultLocale     string `md:"defaultLocale"`     // locale when none is given, and the last fallback for messages
 }
 
 type Input struct {
@@ -47,6 +53,11 @@ type Input struct {
 	TemplateVariables map[string]interface{} `md:"templateVariables"`
 	EscapeHtml        bool                   `md:"escapeHtml"`
 	StrictMode        bool                   `md:"strictMode"`
+	ValidateOnly      bool                   `md:"validateOnly"`
+	DataSchema        map[string]interface{} `md:"dataSchema"`
+	Locale            string                 `md:"locale"`
+	EmailHeaders      map[string]interface{} `md:"emailHeaders"`
+	InlineImages      []interface{}          `md:"inlineImages"`
 }
 
 type Output struct {
@@ -56,15 +67,50 @@ type Output struct {
 	TemplateUsed   string   `md:"templateUsed"`
 	ProcessingTime int64    `md:"processingTime"`
 	VariablesUsed  []string `md:"variablesUsed"`
+	// Variables are full dotted paths; items[].sku is a field of the elements of items
+	VariablesResolved  []string `md:"variablesResolved"`
+	VariablesMissing   []string `md:"variablesMissing"`
+	VariablesDefaulted []string `md:"variablesDefaulted"`
+	// ValidationIssues lists the issues found in validate-only mode
+	ValidationIssues []interface{} `md:"validationIssues"`
+	// TemplateLocale is the locale of the localized template file used, if any
+	TemplateLocale string `md:"templateLocale"`
+	// Email holds the subject, text, html and headers of the message in email mode
+	Email map[string]interface{} `md:"email"`
 }
 
 // Activity is the template engine activity
 type Activity struct {
-	settings            *Settings
-	logger              log.Logger
-	templateCache       sync.Map
-	templateBasePath    string
-	currentTemplateType string // Track the current template being processed
+	settings         *Settings
+	logger           log.Logger
+	cache            templateCache // compiled templates
+	files            fileCache     // OOTB template files
+	templateBasePath string
+	reloadInterval   time.Duration // how often the template path is checked for changes
+	limits           renderLimits
+
+	templatesMu      sync.RWMutex
+	templates        *templateSet
+	templatesChecked time.Time
+	templateReloads  int64
+}
+
+// templateReloadInterval is how often the template path is checked for changed files
+const templateReloadInterval = time.Second
+
+// renderContext holds the state of a single evaluation. An activity is shared by all
+// flows that use it, so per-call state is never stored on the Activity, and cached
+// templates are not modified after they are compiled.
+type renderContext struct {
+	templateType string                 // the OOTB template name, or "custom"
+	data         map[string]interface{} // template data merged with the additional and system variables
+	strict       bool                   // fail on missing variables
+	escapeHTML   bool                   // render Go templates with html/template
+	outputFormat string
+	locale       string // the locale messages and formats are rendered for, empty for none
+	entry        string // the Go template to render, one the content defines; empty for the content
+	plainText    bool   // render plain text, so Handlebars and Mustache do not escape HTML
+	cacheHit     bool   // set when the compiled template came from the cache
 }
 
 // safeLog safely logs messages when logger is available
@@ -98,10 +144,19 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 	templateBasePath := GetTemplateBasePath(s.TemplatePath)
 
 	act := &Activity{
-		settings:            s,
-		logger:              logger,
-		templateBasePath:    templateBasePath,
-		currentTemplateType: "", // Initialize empty, will be set during processing
+		settings:         s,
+		logger:           logger,
+		cache:            templateCache{capacity: s.TemplateCacheSize},
+		templateBasePath: templateBasePath,
+		reloadInterval:   templateReloadInterval,
+		limits:           newRenderLimits(s),
+	}
+
+	// Load all templates under the template path, so templates can use each other
+	act.templates, err = act.loadTemplateSet()
+	act.templatesChecked = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates from %s: %v", templateBasePath, err)
 	}
 
 	if logger != nil {
@@ -210,6 +265,11 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	templateVariables, _ := ctx.GetInput("templateVariables").(map[string]interface{})
 	escapeHtml, _ := ctx.GetInput("escapeHtml").(bool)
 	strictMode, _ := ctx.GetInput("strictMode").(bool)
+	validateOnly, _ := ctx.GetInput("validateOnly").(bool)
+	dataSchema, _ := ctx.GetInput("dataSchema").(map[string]interface{})
+	locale, _ := ctx.GetInput("locale").(string)
+	emailHeaders, _ := ctx.GetInput("emailHeaders").(map[string]interface{})
+	inlineImages, _ := ctx.GetInput("inlineImages").([]interface{})
 
 	// Add trace tags for observability
 	if tracingCtx != nil {
@@ -219,6 +279,8 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 			"template.enable_formatting": enableFormatting,
 			"template.escape_html":       escapeHtml,
 			"template.strict_mode":       strictMode,
+			"template.validate_only":     validateOnly,
+			"template.locale":            locale,
 			"template.safe_mode":         a.settings.EnableSafeMode,
 			"template.engine":            a.settings.TemplateEngine,
 		})
@@ -234,6 +296,7 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	output := &Output{
 		Success: false,
 	}
+	var rc *renderContext
 
 	defer func() {
 		output.ProcessingTime = time.Since(startTime).Nanoseconds() / 1000000 // Convert to milliseconds
@@ -251,6 +314,12 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 			if len(output.VariablesUsed) > 0 {
 				metricsTags["template.variables_used_count"] = len(output.VariablesUsed)
 			}
+			if len(output.VariablesMissing) > 0 {
+				metricsTags["template.variables_missing_count"] = len(output.VariablesMissing)
+			}
+			if rc != nil {
+				metricsTags["template.cache_hit"] = rc.cacheHit
+			}
 			if output.Error != "" {
 				metricsTags["template.error"] = output.Error
 				// Log error details for observability
@@ -269,8 +338,14 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		ctx.SetOutput("success", output.Success)
 		ctx.SetOutput("error", output.Error)
 		ctx.SetOutput("templateUsed", output.TemplateUsed)
+		ctx.SetOutput("templateLocale", output.TemplateLocale)
 		ctx.SetOutput("processingTime", output.ProcessingTime)
 		ctx.SetOutput("variablesUsed", output.VariablesUsed)
+		ctx.SetOutput("variablesResolved", output.VariablesResolved)
+		ctx.SetOutput("variablesMissing", output.VariablesMissing)
+		ctx.SetOutput("variablesDefaulted", output.VariablesDefaulted)
+		ctx.SetOutput("validationIssues", output.ValidationIssues)
+		ctx.SetOutput("email", output.Email)
 
 		// Log completion with processing time
 		if output.Success {
@@ -279,8 +354,39 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		}
 	}()
 
-	// Determine which template to use
-	templateContent, err := a.getTemplate(templateType, template)
+	// The locale selects localized template files, messages and formats
+	if locale == "" {
+		locale = a.settings.DefaultLocale
+	}
+	locale, err = normalizeLocale(locale)
+	if err != nil {
+		output.Error = fmt.Sprintf("Failed to resolve locale: %v", err)
+		a.safeLog("error", output.Error)
+		return true, nil
+	}
+	email := outputFormat == "email"
+	var parts []string
+	if email {
+		parts = emailParts
+	}
+	templateType, output.TemplateLocale = a.localizedTemplate(templateType, locale, parts...)
+
+	// In email mode the subject, text and html parts may be sibling template files
+	var partTemplates map[string]string
+	if email {
+		partTemplates, err = a.emailPartTemplates(templateType)
+		if err != nil {
+			output.Error = fmt.Sprintf("Failed to get template: %v", err)
+			a.safeLog("error", output.Error)
+			return true, nil
+		}
+	}
+
+	// Determine which template to use. The part files may make up the whole email.
+	var templateContent string
+	if _, statErr := os.Stat(filepath.Join(a.templateBasePath, templateType+".tmpl")); len(partTemplates) == 0 || statErr == nil {
+		templateContent, err = a.getTemplate(templateType, template)
+	}
 	if err != nil {
 		output.Error = fmt.Sprintf("Failed to get template: %v", err)
 		a.safeLog("error", output.Error)
@@ -305,6 +411,20 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 		mergedData[k] = v
 	}
 
+	// In validate-only mode the template is checked against the schema or the sample
+	// data, and not rendered
+	if validateOnly {
+		var sample map[string]interface{}
+		if len(mergedData) > 0 {
+			sample = mergedData
+		}
+		if dataSchema != nil {
+			sample = templateVariables
+		}
+		a.validateTemplate(output, templateContent, dataSchema, sample)
+		return true, nil
+	}
+
 	// Add system variables
 	mergedData["_timestamp"] = time.Now().Format(time.RFC3339)
 	mergedData["_date"] = time.Now().Format("2006-01-02")
@@ -313,23 +433,49 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 
 	a.safeLog("debug", "Template data merged - Total variables: %d", len(mergedData))
 
+	rc = &renderContext{
+		templateType: "custom",
+		data:         mergedData,
+		strict:       strictMode,
+		escapeHTML:   escapeHtml,
+		outputFormat: outputFormat,
+		locale:       locale,
+	}
+	if templateType != "" {
+		rc.templateType = templateType
+	}
+	// Render HTML with context-aware escaping when requested. When formatting wraps the
+	// output in an HTML document, the formatter escapes the rendered text instead.
+	if outputFormat == "html" {
+		rc.escapeHTML = !enableFormatting
+	}
+
+	// Render the email parts and the MIME message
+	if email {
+		message, references, err := a.renderEmail(rc, templateContent, partTemplates, emailHeaders, inlineImages)
+		if err != nil {
+			output.Error = fmt.Sprintf("Email rendering failed: %v", err)
+			a.safeLog("error", output.Error)
+			return true, nil
+		}
+		output.Result = message.mime
+		output.Email = message.fields()
+		output.Success = true
+		a.reportVariables(output, references, rc.data)
+		return true, nil
+	}
+
 	// Process the template
-	result, variablesUsed, err := a.processTemplate(templateContent, mergedData, strictMode)
+	result, references, err := a.processTemplate(rc, templateContent)
 	if err != nil {
 		output.Error = fmt.Sprintf("Template processing failed: %v", err)
 		a.safeLog("error", output.Error)
 		return true, nil
 	}
 
-	// Apply HTML escaping if requested
-	if escapeHtml {
-		result = html.EscapeString(result)
-		a.safeLog("debug", "HTML escaping applied to output")
-	}
-
 	// Apply formatting if enabled
 	if enableFormatting {
-		result, err = a.formatOutput(result, outputFormat)
+		result, err = a.formatOutput(result, rc.outputFormat, rc.templateType)
 		if err != nil {
 			a.safeLog("warn", "Output formatting failed: %v", err)
 		} else {
@@ -339,16 +485,82 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 
 	output.Result = result
 	output.Success = true
-	output.VariablesUsed = variablesUsed
+	a.reportVariables(output, references, rc.data)
 
 	return true, nil
 }
 
+// reportVariables reports the variables the template referenced, as found in the data
+// it rendered
+func (a *Activity) reportVariables(output *Output, references *templateReferences, data map[string]interface{}) {
+	variables := references.report(data)
+	output.VariablesUsed = variables.used
+	output.VariablesResolved = variables.resolved
+	output.VariablesMissing = variables.missing
+	output.VariablesDefaulted = variables.defaulted
+	if len(variables.missing) > 0 {
+		a.safeLog("debug", "Template referenced missing variables: %s", strings.Join(variables.missing, ", "))
+	}
+}
+
+// validateTemplate validates a template and reports the issues in the output. The
+// result lists one issue per line; validation fails if any issue is an error.
+func (a *Activity) validateTemplate(output *Output, templateContent string, schema, sample map[string]interface{}) {
+	validation := a.ValidateTemplate(templateContent, schema, sample)
+
+	lines := make([]string, 0, len(validation.Issues))
+	errorCount := 0
+	output.ValidationIssues = make([]interface{}, 0, len(validation.Issues))
+	for _, issue := range validation.Issues {
+		lines = append(lines, issue.String())
+		if issue.Severity == SeverityError {
+			errorCount++
+		}
+		var fields map[string]interface{}
+		encoded, _ := json.Marshal(issue)
+		_ = json.Unmarshal(encoded, &fields)
+		output.ValidationIssues = append(output.ValidationIssues, fields)
+	}
+
+	output.Result = strings.Join(lines, "\n")
+	output.Success = validation.Valid
+	output.VariablesUsed = a.templateReferences(templateContent).paths()
+	if !validation.Valid {
+		output.Error = fmt.Sprintf("template validation failed with %d errors", errorCount)
+		a.safeLog("error", "%s:\n%s", output.Error, output.Result)
+		return
+	}
+	a.safeLog("info", "Template validation passed with %d warnings", len(validation.Issues))
+}
+
+// localizedTemplate returns the template type of the most specific template file for
+// the locale: email-welcome.de-CH.tmpl, then email-welcome.de.tmpl, then the default
+// email-welcome.tmpl. A locale also matches when it only has files for one of the
+// parts, such as email-welcome.de.subject.tmpl. It also returns the locale of the
+// file, empty for the default.
+func (a *Activity) localizedTemplate(templateType, locale string, parts ...string) (string, string) {
+	if locale == "" || templateType == "" || templateType == "custom" {
+		return templateType, ""
+	}
+	name := strings.TrimSuffix(templateType, ".tmpl")
+	for _, tag := range localeChain(locale) {
+		localized := name + "." + tag
+		for _, file := range append([]string{""}, parts...) {
+			if file != "" {
+				file = "." + file
+			}
+			if _, err := os.Stat(filepath.Join(a.templateBasePath, localized+file+".tmpl")); err == nil {
+				a.safeLog("debug", "Using template '%s' for locale '%s'", localized, locale)
+				return localized, tag
+			}
+		}
+	}
+	return templateType, ""
+}
+
 // getTemplate returns the template content based on type or custom template
 func (a *Activity) getTemplate(templateType, customTemplate string) (string, error) {
-	// Track current template type for metadata
 	if templateType == "" || templateType == "custom" {
-		a.currentTemplateType = "custom"
 		if customTemplate == "" {
 			return "", fmt.Errorf("no template provided")
 		}
@@ -356,9 +568,6 @@ func (a *Activity) getTemplate(templateType, customTemplate string) (string, err
 		return customTemplate, nil
 	}
 
-	// Set current template type for OOTB templates
-	a.currentTemplateType = templateType
-
 	// Load OOTB template from file system using detected base path
 	templatePath := filepath.Join(a.templateBasePath, templateType+".tmpl")
 
@@ -377,8 +586,8 @@ func (a *Activity) getTemplate(templateType, customTemplate string) (string, err
 		a.safeLog("debug", "Using alternative path: %s", templatePath)
 	}
 
-	// Read template content from file
-	content, err := ioutil.ReadFile(templatePath)
+	// Read template content from file, or from memory if the file has not changed
+	content, err := a.files.read(templatePath)
 	if err != nil {
 		a.safeLog("error", "Failed to read template file %s: %v", templatePath, err)
 		return "", fmt.Errorf("failed to read template file %s: %v", templatePath, err)
@@ -386,73 +595,98 @@ func (a *Activity) getTemplate(templateType, customTemplate string) (string, err
 
 	a.safeLog("info", "Loaded template '%s' from: %s", templateType, templatePath)
 	a.safeLog("debug", "Template content: %d bytes", len(content))
-	return string(content), nil
+	return content, nil
 }
 
-// processTemplate processes the template using the specified engine
-func (a *Activity) processTemplate(templateContent string, data map[string]interface{}, strictMode bool) (string, []string, error) {
+// processTemplate processes the template using the specified engine. Go templates are
+// rendered with html/template when escapeHTML is set; the Handlebars and Mustache
+// engines escape {{value}}, unless rendering plain text, and leave {{{value}}} raw.
+func (a *Activity) processTemplate(rc *renderContext, templateContent string) (string, *templateReferences, error) {
 	switch a.settings.TemplateEngine {
-	case "handlebars", "handlebars-basic", "mustache", "mustache-basic":
-		return a.processHandlebarsTemplate(templateContent, data, strictMode)
+	case "handlebars":
+		return a.processHandlebarsTemplate(rc, templateContent)
+	case "mustache":
+		return a.processMustacheTemplate(rc, templateContent)
+	case "handlebars-basic", "mustache-basic":
+		return a.processBasicHandlebarsTemplate(rc, templateContent)
 	default:
-		return a.processGoTemplate(templateContent, data, strictMode)
+		return a.processGoTemplate(rc, templateContent)
 	}
 }
 
-// processGoTemplate processes templates using Go's text/template
-func (a *Activity) processGoTemplate(templateContent string, data map[string]interface{}, strictMode bool) (string, []string, error) {
-	// Generate cache key from template content
-	cacheKey := fmt.Sprintf("%x", templateContent)
+// processGoTemplate processes templates using Go's text/template, or html/template
+// for context-aware HTML escaping
+func (a *Activity) processGoTemplate(rc *renderContext, templateContent string) (string, *templateReferences, error) {
+	// Templates are compiled together with the shared templates, so the cache key
+	// includes the version of the template set as well as the compile options
+	set := a.templateSet()
+	kind := fmt.Sprintf("go:%d", set.version)
+	if rc.escapeHTML {
+		kind += ":html"
+	}
+	if rc.strict {
+		kind += ":strict"
+	}
+	if rc.locale != "" {
+		kind += ":" + rc.locale
+	}
+	entry := "main"
+	if rc.entry != "" {
+		entry = rc.entry
+		kind += ":" + entry
+	}
+	cacheKey := templateCacheKey(kind, templateContent)
 
 	// Try to get cached template
-	var parsedTemplate *template.Template
-	if cached, ok := a.templateCache.Load(cacheKey); ok {
-		parsedTemplate = cached.(*template.Template)
+	var parsedTemplate *goTemplate
+	if cached, ok := a.cache.get(cacheKey); ok {
+		parsedTemplate = cached.(*goTemplate)
+		rc.cacheHit = true
 		a.safeLog("debug", "Using cached compiled template")
 	} else {
-		// Create new template with custom functions
-		tmpl := template.New("main")
-
-		if !a.settings.EnableSafeMode {
-			// Full function set when safe mode is disabled
-			a.safeLog("debug", "Loading full template function set (safe mode disabled)")
-			tmpl = tmpl.Funcs(a.getTemplateFunctions())
-		} else {
-			// Essential functions even in safe mode for OOTB templates
-			a.safeLog("debug", "Loading essential template functions (safe mode enabled)")
-			tmpl = tmpl.Funcs(a.getEssentialTemplateFunctions())
+		// Compile with the shared templates, so {{template "name" .}} and {{block}} work
+		a.safeLog("debug", "Compiling template (%d characters, HTML escaping: %t)", len(templateContent), rc.escapeHTML)
+		options := compileOptions{
+			escapeHTML: rc.escapeHTML,
+			strict:     rc.strict,
+			localizer:  set.localizer(rc.locale, a.settings.DefaultLocale, rc.strict),
+			entry:      rc.entry,
 		}
-
-		// Parse template
-		a.safeLog("debug", "Compiling template (%d characters)", len(templateContent))
+		var tmpl executableTemplate
 		var err error
-		parsedTemplate, err = tmpl.Parse(templateContent)
+		if a.limits.enabled() {
+			tmpl, err = newSandboxedTemplate(a.limits, func(sb *sandbox) (executableTemplate, error) {
+				return set.compile("main", templateContent, options, sb)
+			})
+		} else {
+			tmpl, err = set.compile("main", templateContent, options, nil)
+		}
 		if err != nil {
 			a.safeLog("error", "Template compilation failed: %v", err)
-			return "", nil, fmt.Errorf("template parsing failed: %v", err)
+			return "", nil, err
 		}
+		parsedTemplate = &goTemplate{tmpl: tmpl, references: goReferences(set, templateContent, entry)}
 
 		a.safeLog("debug", "Template compiled successfully")
-		// Cache the parsed template if cache size allows
 		a.cacheTemplate(cacheKey, parsedTemplate)
 	}
 
-	// Execute template with strict mode handling
+	// Execute template; strict mode templates are compiled with missingkey=error
 	var buf bytes.Buffer
-	if strictMode {
-		// In strict mode, use missingkey=error option
+	if rc.strict {
 		a.safeLog("debug", "Executing template in strict mode (will fail on undefined variables)")
-		parsedTemplate = parsedTemplate.Option("missingkey=error")
 	} else {
-		// In non-strict mode, use missingkey=zero (default)
 		a.safeLog("debug", "Executing template in permissive mode")
-		parsedTemplate = parsedTemplate.Option("missingkey=zero")
 	}
 
-	a.safeLog("debug", "Executing template with %d data variables", len(data))
-	err := parsedTemplate.Execute(&buf, data)
+	a.safeLog("debug", "Executing template with %d data variables", len(rc.data))
+	err := parsedTemplate.tmpl.Execute(&buf, rc.data)
 	if err != nil {
-		if strictMode {
+		if limitErr, ok := asRenderLimitError(err); ok {
+			a.safeLog("error", "Template execution stopped: %v", limitErr)
+			return "", nil, limitErr
+		}
+		if rc.strict {
 			a.safeLog("error", "Strict mode execution failed: %v", err)
 			return "", nil, fmt.Errorf("strict mode: template execution failed due to missing variables: %v", err)
 		}
@@ -460,36 +694,84 @@ func (a *Activity) processGoTemplate(templateContent string, data map[string]int
 		return "", nil, fmt.Errorf("template execution failed: %v", err)
 	}
 
-	// Extract variables used
-	variablesUsed := a.extractVariablesFromTemplate(templateContent)
-
 	resultLength := buf.Len()
 	a.safeLog("debug", "Template execution completed - Generated %d characters, Variables detected: %d",
-		resultLength, len(variablesUsed))
+		resultLength, len(parsedTemplate.references.refs))
 
-	return buf.String(), variablesUsed, nil
+	return buf.String(), parsedTemplate.references, nil
 }
 
-// cacheTemplate stores a compiled template in the cache
-func (a *Activity) cacheTemplate(key string, tmpl *template.Template) {
-	// Count current cache size
-	cacheSize := 0
-	a.templateCache.Range(func(_, _ interface{}) bool {
-		cacheSize++
-		return true
-	})
+// templateSet returns the templates loaded from the template path. The path is checked
+// for added, changed and removed files at most once per reload interval, and reloaded
+// when it changed.
+func (a *Activity) templateSet() *templateSet {
+	a.templatesMu.RLock()
+	set, checked := a.templates, a.templatesChecked
+	a.templatesMu.RUnlock()
+	if set != nil && (set.modTimes == nil || time.Since(checked) < a.reloadInterval) {
+		return set
+	}
 
-	// If cache is full, remove oldest entry (simple FIFO)
-	if cacheSize >= a.settings.TemplateCacheSize {
-		a.templateCache.Range(func(k, _ interface{}) bool {
-			a.templateCache.Delete(k)
-			return false // Stop after deleting one
-		})
+	a.templatesMu.Lock()
+	defer a.templatesMu.Unlock()
+	if a.templates == nil {
+		a.templates = newTemplateSet(a.templateFunctions(), true)
+	}
+	if a.templates.modTimes == nil || time.Since(a.templatesChecked) < a.reloadInterval {
+		return a.templates
+	}
+	a.templatesChecked = time.Now()
+	if !a.templates.changed(a.templateBasePath) {
+		return a.templates
+	}
+
+	set, err := a.loadTemplateSet()
+	if err != nil {
+		a.safeLog("warn", "Failed to reload templates from %s, using the previous templates: %v", a.templateBasePath, err)
+		return a.templates
+	}
+	a.templates = set
+	a.templateReloads++
+	a.safeLog("info", "Reloaded %d templates from: %s", len(set.sources), a.templateBasePath)
+	return set
+}
+
+// templateFunctions returns the functions available to templates, including the
+// helpers that mark trusted content for html/template
+func (a *Activity) templateFunctions() template.FuncMap {
+	// The Sprig functions without side effects are available in both modes
+	funcs := getSprigFunctions()
+	var base template.FuncMap
+	if a.settings != nil && a.settings.EnableSafeMode {
+		// Essential functions even in safe mode for OOTB templates
+		a.safeLog("debug", "Loading essential template functions (safe mode enabled)")
+		base = a.getEssentialTemplateFunctions()
+	} else {
+		// Full function set when safe mode is disabled
+		a.safeLog("debug", "Loading full template function set (safe mode disabled)")
+		base = a.getTemplateFunctions()
+		for name, fn := range getSprigFullModeFunctions() {
+			funcs[name] = fn
+		}
+	}
+	for name, fn := range base {
+		funcs[name] = fn
 	}
+	for name, fn := range getTrustedContentFunctions() {
+		funcs[name] = fn
+	}
+	// Templates are parsed with these; renders bind the localizer of their locale
+	for name, fn := range (*localizer)(nil).funcs() {
+		funcs[name] = fn
+	}
+	return funcs
+}
 
-	// Store in cache
-	a.templateCache.Store(key, tmpl)
-	a.safeLog("debug", "Template compiled and cached (cache size: %d/%d)", cacheSize+1, a.settings.TemplateCacheSize)
+// cacheTemplate stores a compiled template in the cache, evicting the least recently
+// used template when the cache is full
+func (a *Activity) cacheTemplate(key string, tmpl interface{}) {
+	a.cache.add(key, tmpl)
+	a.safeLog("debug", "Template compiled and cached (cache size: %d/%d)", a.cache.len(), a.cache.capacity)
 }
 
 // getEssentialTemplateFunctions returns essential functions that are safe and needed for OOTB templates
@@ -685,6 +967,20 @@ func (a *Activity) getTemplateFunctions() template.FuncMap {
 	}
 }
 
+// getTrustedContentFunctions returns helpers that mark a value as trusted, so
+// html/template inserts it without escaping, e.g. {{safeHTML .footerHtml}}. They must
+// only be used for content that is not supplied by users. With text/template they
+// return the value unchanged.
+func getTrustedContentFunctions() template.FuncMap {
+	return template.FuncMap{
+		"safeHTML":     func(s string) htmltemplate.HTML { return htmltemplate.HTML(s) },
+		"safeHTMLAttr": func(s string) htmltemplate.HTMLAttr { return htmltemplate.HTMLAttr(s) },
+		"safeURL":      func(s string) htmltemplate.URL { return htmltemplate.URL(s) },
+		"safeJS":       func(s string) htmltemplate.JS { return htmltemplate.JS(s) },
+		"safeCSS":      func(s string) htmltemplate.CSS { return htmltemplate.CSS(s) },
+	}
+}
+
 // compareValues compares two values for ordering
 func compareValues(a, b interface{}) int {
 	switch av := a.(type) {
@@ -705,30 +1001,8 @@ func compareValues(a, b interface{}) int {
 	return 0
 }
 
-// extractVariablesFromTemplate extracts variable names from template content
-func (a *Activity) extractVariablesFromTemplate(content string) []string {
-	// Simple regex to find template variables
-	re := regexp.MustCompile(`\{\{\.([a-zA-Z_][a-zA-Z0-9_]*)\}\}`)
-	matches := re.FindAllStringSubmatch(content, -1)
-
-	variables := make([]string, 0, len(matches))
-	seen := make(map[string]bool)
-
-	for _, match := range matches {
-		if len(match) > 1 {
-			variable := match[1]
-			if !seen[variable] {
-				variables = append(variables, variable)
-				seen[variable] = true
-			}
-		}
-	}
-
-	return variables
-}
-
 // formatOutput formats the output based on the specified format
-func (a *Activity) formatOutput(content, format string) (string, error) {
+func (a *Activity) formatOutput(content, format, templateType string) (string, error) {
 	switch format {
 	case "json":
 		// For JSON format, wrap content in a JSON object with rich metadata
@@ -743,7 +1017,7 @@ func (a *Activity) formatOutput(content, format string) (string, error) {
 				"content":          obj,
 				"contentType":      "application/json",
 				"format":           "json",
-				"templateType":     a.getCurrentTemplateType(),
+				"templateType":     templateType,
 				"processingEngine": "go-template",
 				"safeMode":         safeMode,
 				"timestamp":        time.Now().Format(time.RFC3339),
@@ -768,7 +1042,7 @@ func (a *Activity) formatOutput(content, format string) (string, error) {
 			"content":          content,
 			"contentType":      contentType,
 			"format":           "text",
-			"templateType":     a.getCurrentTemplateType(),
+			"templateType":     templateType,
 			"processingEngine": "go-template",
 			"safeMode":         safeMode,
 			"timestamp":        time.Now().Format(time.RFC3339),
@@ -962,11 +1236,121 @@ func (a *Activity) formatAsMarkdown(content string) string {
 	return md.String()
 }
 
-// processHandlebarsTemplate processes templates using Handlebars-style syntax
-func (a *Activity) processHandlebarsTemplate(templateContent string, data map[string]interface{}, strictMode bool) (string, []string, error) {
+// processHandlebarsTemplate processes templates using the Handlebars engine
+func (a *Activity) processHandlebarsTemplate(rc *renderContext, templateContent string) (string, *templateReferences, error) {
+	cacheKey := templateCacheKey("handlebars", templateContent)
+
+	var parsedTemplate *hbTemplate
+	if cached, ok := a.cache.get(cacheKey); ok {
+		parsedTemplate = cached.(*hbTemplate)
+		rc.cacheHit = true
+		a.safeLog("debug", "Using cached compiled template")
+	} else {
+		a.safeLog("debug", "Compiling Handlebars template (%d characters)", len(templateContent))
+		var err error
+		parsedTemplate, err = parseHandlebars(templateContent)
+		if err != nil {
+			a.safeLog("error", "Template compilation failed: %v", err)
+			return "", nil, fmt.Errorf("template parsing failed: %v", err)
+		}
+		a.cacheTemplate(cacheKey, parsedTemplate)
+	}
+
+	// Template functions are available as helpers, e.g. {{upper name}}
+	localizer := a.templateSet().localizer(rc.locale, a.settings.DefaultLocale, rc.strict)
+	helpers := copyFuncs(a.templateFunctions(), localizer.funcs())
+
+	result, err := renderHandlebars(parsedTemplate, rc.data, helpers, a.loadPartial, rc.strict, !rc.plainText, newSandbox(a.limits))
+	if err != nil {
+		if limitErr, ok := asRenderLimitError(err); ok {
+			a.safeLog("error", "Template execution stopped: %v", limitErr)
+			return "", nil, limitErr
+		}
+		if rc.strict {
+			a.safeLog("error", "Strict mode execution failed: %v", err)
+			return "", nil, fmt.Errorf("strict mode: template execution failed: %v", err)
+		}
+		a.safeLog("error", "Template execution failed: %v", err)
+		return "", nil, fmt.Errorf("template execution failed: %v", err)
+	}
+
+	references := parsedTemplate.references(helpers)
+	a.safeLog("debug", "Template execution completed - Generated %d characters, Variables detected: %d",
+		len(result), len(references.refs))
+	return result, references, nil
+}
+
+// processMustacheTemplate processes templates using the Mustache engine
+func (a *Activity) processMustacheTemplate(rc *renderContext, templateContent string) (string, *templateReferences, error) {
+	cacheKey := templateCacheKey("mustache", templateContent)
+
+	var parsedTemplate *mustacheTemplate
+	if cached, ok := a.cache.get(cacheKey); ok {
+		parsedTemplate = cached.(*mustacheTemplate)
+		rc.cacheHit = true
+		a.safeLog("debug", "Using cached compiled template")
+	} else {
+		a.safeLog("debug", "Compiling Mustache template (%d characters)", len(templateContent))
+		var err error
+		parsedTemplate, err = parseMustache(templateContent)
+		if err != nil {
+			a.safeLog("error", "Template compilation failed: %v", err)
+			return "", nil, fmt.Errorf("template parsing failed: %v", err)
+		}
+		a.cacheTemplate(cacheKey, parsedTemplate)
+	}
+
+	result, err := renderMustache(parsedTemplate, rc.data, a.loadPartial, rc.strict, !rc.plainText, newSandbox(a.limits))
+	if err != nil {
+		if limitErr, ok := asRenderLimitError(err); ok {
+			a.safeLog("error", "Template execution stopped: %v", limitErr)
+			return "", nil, limitErr
+		}
+		if rc.strict {
+			a.safeLog("error", "Strict mode execution failed: %v", err)
+			return "", nil, fmt.Errorf("strict mode: template execution failed: %v", err)
+		}
+		a.safeLog("error", "Template execution failed: %v", err)
+		return "", nil, fmt.Errorf("template execution failed: %v", err)
+	}
+
+	references := parsedTemplate.references()
+	a.safeLog("debug", "Template execution completed - Generated %d characters, Variables detected: %d",
+		len(result), len(references.refs))
+	return result, references, nil
+}
+
+// loadPartial returns a partial from the template directory: {{> header}} uses
+// header.tmpl in any subdirectory, or a top-level file named header
+func (a *Activity) loadPartial(name string) (string, bool, error) {
+	if content, ok := a.templateSet().source(name); ok {
+		return content, true, nil
+	}
+	if name == "" || filepath.IsAbs(name) || strings.Contains(name, "..") {
+		return "", false, fmt.Errorf("invalid partial name %q", name)
+	}
+	for _, path := range []string{
+		filepath.Join(a.templateBasePath, name+".tmpl"),
+		filepath.Join(a.templateBasePath, name),
+	} {
+		content, err := ioutil.ReadFile(path)
+		if err == nil {
+			a.safeLog("debug", "Loaded partial '%s' from: %s", name, path)
+			return string(content), true, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, fmt.Errorf("failed to read partial %s: %v", path, err)
+		}
+	}
+	return "", false, nil
+}
+
+// processBasicHandlebarsTemplate processes simple {{variable}} templates by converting
+// them to Go template syntax
+func (a *Activity) processBasicHandlebarsTemplate(rc *renderContext, templateContent string) (string, *templateReferences, error) {
 	// Convert Handlebars syntax to Go template syntax
 	goTemplate := a.convertHandlebarsToGo(templateContent)
-	return a.processGoTemplate(goTemplate, data, strictMode)
+	return a.processGoTemplate(rc, goTemplate)
 }
 
 // convertHandlebarsToGo converts Handlebars syntax to Go template syntax
@@ -983,14 +1367,6 @@ func (a *Activity) convertHandlebarsToGo(template string) string {
 	return template
 }
 
-// getCurrentTemplateType returns the current template type being processed
-func (a *Activity) getCurrentTemplateType() string {
-	if a.currentTemplateType == "" {
-		return "custom"
-	}
-	return a.currentTemplateType
-}
-
 // detectContentType analyzes content and returns appropriate MIME type
 func (a *Activity) detectContentType(content string) string {
 	content = strings.TrimSpace(content)
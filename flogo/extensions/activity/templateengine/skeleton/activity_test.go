@@ -319,7 +319,7 @@ The Team
 ACME Corp`
 
 	t.Run("HTML Format", func(t *testing.T) {
-		htmlOutput, err := activity.formatOutput(sampleContent, "html")
+		htmlOutput, err := activity.formatOutput(sampleContent, "html", "custom")
 		if err != nil {
 			t.Fatalf("HTML formatting failed: %v", err)
 		}
@@ -345,7 +345,7 @@ ACME Corp`
 	})
 
 	t.Run("XML Format", func(t *testing.T) {
-		xmlOutput, err := activity.formatOutput(sampleContent, "xml")
+		xmlOutput, err := activity.formatOutput(sampleContent, "xml", "custom")
 		if err != nil {
 			t.Fatalf("XML formatting failed: %v", err)
 		}
@@ -365,7 +365,7 @@ ACME Corp`
 	})
 
 	t.Run("Markdown Format", func(t *testing.T) {
-		markdownOutput, err := activity.formatOutput(sampleContent, "markdown")
+		markdownOutput, err := activity.formatOutput(sampleContent, "markdown", "custom")
 		if err != nil {
 			t.Fatalf("Markdown formatting failed: %v", err)
 		}
@@ -382,7 +382,7 @@ ACME Corp`
 	})
 
 	t.Run("Text Format (unchanged)", func(t *testing.T) {
-		textOutput, err := activity.formatOutput(sampleContent, "text")
+		textOutput, err := activity.formatOutput(sampleContent, "text", "custom")
 		if err != nil {
 			t.Fatalf("Text formatting failed: %v", err)
 		}
@@ -395,7 +395,7 @@ ACME Corp`
 
 	t.Run("JSON Format", func(t *testing.T) {
 		jsonContent := `{"name": "John", "age": 30}`
-		jsonOutput, err := activity.formatOutput(jsonContent, "json")
+		jsonOutput, err := activity.formatOutput(jsonContent, "json", "custom")
 		if err != nil {
 			t.Fatalf("JSON formatting failed: %v", err)
 		}
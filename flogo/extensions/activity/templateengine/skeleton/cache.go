@@ -0,0 +1,164 @@
+package templateengine
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// CacheStats reports the activity's template caches
+type CacheStats struct {
+	Hits      int64 `json:"hits"`      // compiled templates found in the cache
+	Misses    int64 `json:"misses"`    // templates that had to be compiled
+	Evictions int64 `json:"evictions"` // least recently used templates removed to make room
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+	FileHits  int64 `json:"fileHits"`  // template files served from memory
+	FileReads int64 `json:"fileReads"` // template files read because they were new or changed
+	Reloads   int64 `json:"reloads"`   // times the template directory was reloaded after a change
+}
+
+// templateCacheKey returns the cache key for a template: the kind of compiled template
+// and a hash of its content
+func templateCacheKey(kind, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// templateCache is a least recently used cache of compiled templates. The zero value
+// caches nothing; a capacity of zero or less disables caching.
+type templateCache struct {
+	mu        sync.Mutex
+	capacity  int
+	entries   map[string]*list.Element
+	order     *list.List // most recently used first
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type cacheEntry struct {
+	key   string
+	value interface{}
+}
+
+// get returns a cached template and marks it as recently used
+func (c *templateCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.hits++
+		return element.Value.(*cacheEntry).value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// add caches a template, evicting the least recently used one when the cache is full
+func (c *templateCache) add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity <= 0 {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+	if element, ok := c.entries[key]; ok {
+		// Another evaluation compiled the same template concurrently
+		element.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+}
+
+// len returns the number of cached templates
+func (c *templateCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// fileCache keeps template files in memory until their size or modification time
+// changes on disk. The zero value is ready to use.
+type fileCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedFile
+	hits    int64
+	reads   int64
+}
+
+type cachedFile struct {
+	content string
+	modTime time.Time
+	size    int64
+}
+
+// read returns the content of a template file, reading it only if it changed
+func (c *fileCache) read(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		c.hits++
+		c.mu.Unlock()
+		return entry.content, nil
+	}
+	c.mu.Unlock()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedFile)
+	}
+	c.entries[path] = cachedFile{content: string(content), modTime: info.ModTime(), size: info.Size()}
+	c.reads++
+	return string(content), nil
+}
+
+// CacheStats returns the template cache counters
+func (a *Activity) CacheStats() CacheStats {
+	var stats CacheStats
+	a.cache.mu.Lock()
+	stats.Hits, stats.Misses, stats.Evictions = a.cache.hits, a.cache.misses, a.cache.evictions
+	stats.Size, stats.Capacity = len(a.cache.entries), a.cache.capacity
+	a.cache.mu.Unlock()
+
+	a.files.mu.Lock()
+	stats.FileHits, stats.FileReads = a.files.hits, a.files.reads
+	a.files.mu.Unlock()
+
+	a.templatesMu.RLock()
+	stats.Reloads = a.templateReloads
+	a.templatesMu.RUnlock()
+	return stats
+}
+
+// String formats the counters for logs
+func (s CacheStats) String() string {
+	return fmt.Sprintf("hits=%d misses=%d evictions=%d size=%d/%d fileHits=%d fileReads=%d reloads=%d",
+		s.Hits, s.Misses, s.Evictions, s.Size, s.Capacity, s.FileHits, s.FileReads, s.Reloads)
+}
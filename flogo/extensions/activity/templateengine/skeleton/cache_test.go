@@ -0,0 +1,152 @@
+package templateengine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTemplateCacheLRU(t *testing.T) {
+	cache := templateCache{capacity: 2}
+	cache.add("a", 1)
+	cache.add("b", 2)
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	// b is now the least recently used entry
+	cache.add("c", 3)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if cache.hits != 3 || cache.misses != 1 || cache.evictions != 1 || cache.len() != 2 {
+		t.Errorf("Unexpected counters: hits=%d misses=%d evictions=%d size=%d", cache.hits, cache.misses, cache.evictions, cache.len())
+	}
+
+	disabled := templateCache{}
+	disabled.add("a", 1)
+	if _, ok := disabled.get("a"); ok || disabled.len() != 0 {
+		t.Error("A cache without capacity should not store templates")
+	}
+}
+
+func TestTemplateCacheKey(t *testing.T) {
+	key := templateCacheKey("go:1", "Hello {{.name}}")
+	if len(key) != len("go:1:")+64 {
+		t.Errorf("Expected a SHA-256 key, got %q", key)
+	}
+	if key == templateCacheKey("go:1:html", "Hello {{.name}}") || key == templateCacheKey("go:1", "Hello {{.Name}}") {
+		t.Error("Expected different keys for different kinds and content")
+	}
+}
+
+func TestActivityCacheStats(t *testing.T) {
+	act, err := newTemplateSetActivity(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	act.cache.capacity = 2
+
+	for _, template := range []string{"A {{.x}}", "A {{.x}}", "B {{.x}}", "C {{.x}}", "A {{.x}}"} {
+		if result, errMsg := renderTemplate(act, "custom", template, map[string]interface{}{"x": 1}); errMsg != "" || result == "" {
+			t.Fatalf("Template processing failed: %s", errMsg)
+		}
+	}
+
+	stats := act.CacheStats()
+	expected := CacheStats{Hits: 1, Misses: 4, Evictions: 2, Size: 2, Capacity: 2}
+	if stats != expected {
+		t.Errorf("Expected %s, got %s", expected, stats)
+	}
+}
+
+// touch rewrites a file and moves its modification time forward, so the change is
+// seen even on file systems with coarse timestamps
+func touch(t *testing.T, path, content string, offset time.Duration) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	modTime := time.Now().Add(offset)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+}
+
+func TestTemplateFileReload(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"greeting.tmpl":        `{{template "header" .}} {{.name}}`,
+		"partials/header.tmpl": "Hello",
+	})
+	act, err := newTemplateSetActivity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	act.reloadInterval = 0
+	data := map[string]interface{}{"name": "Jane"}
+
+	render := func(expected string) {
+		t.Helper()
+		result, errMsg := renderTemplate(act, "greeting", "", data)
+		if errMsg != "" {
+			t.Fatalf("Template processing failed: %s", errMsg)
+		}
+		if result != expected {
+			t.Errorf("Expected %q, got %q", expected, result)
+		}
+	}
+
+	render("Hello Jane")
+	render("Hello Jane")
+	if stats := act.CacheStats(); stats.FileReads != 1 || stats.FileHits != 1 || stats.Reloads != 0 {
+		t.Errorf("Expected the unchanged file to be served from memory, got %s", stats)
+	}
+
+	touch(t, filepath.Join(dir, "greeting.tmpl"), `{{template "header" .}}, {{.name}}!`, time.Minute)
+	render("Hello, Jane!")
+
+	touch(t, filepath.Join(dir, "partials", "header.tmpl"), "Welcome", 2*time.Minute)
+	render("Welcome, Jane!")
+
+	touch(t, filepath.Join(dir, "partials", "signature.tmpl"), "-- Acme", 3*time.Minute)
+	touch(t, filepath.Join(dir, "greeting.tmpl"), `{{template "header" .}}, {{.name}}! {{template "signature" .}}`, 3*time.Minute)
+	render("Welcome, Jane! -- Acme")
+
+	if err := os.Remove(filepath.Join(dir, "partials", "signature.tmpl")); err != nil {
+		t.Fatalf("Failed to remove template: %v", err)
+	}
+	if _, errMsg := renderTemplate(act, "greeting", "", data); errMsg == "" {
+		t.Error("Expected an error for a removed partial")
+	}
+
+	stats := act.CacheStats()
+	if stats.FileReads != 3 || stats.Reloads != 4 {
+		t.Errorf("Expected 3 file reads and 4 reloads, got %s", stats)
+	}
+}
+
+func TestTemplateReloadInterval(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{"partials/header.tmpl": "Hello"})
+	act, err := newTemplateSetActivity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	touch(t, filepath.Join(dir, "partials", "header.tmpl"), "Welcome", time.Minute)
+	// Within the reload interval the loaded templates are used without checking the files
+	if result, _ := renderTemplate(act, "custom", `{{template "header"}}`, nil); result != "Hello" {
+		t.Errorf("Expected the loaded template, got %q", result)
+	}
+
+	act.templatesMu.Lock()
+	act.templatesChecked = time.Now().Add(-act.reloadInterval)
+	act.templatesMu.Unlock()
+	if result, _ := renderTemplate(act, "custom", `{{template "header"}}`, nil); result != "Welcome" {
+		t.Errorf("Expected the reloaded template, got %q", result)
+	}
+}
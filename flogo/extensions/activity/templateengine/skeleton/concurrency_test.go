@@ -0,0 +1,177 @@
+package templateengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// evalInputs evaluates the activity with the given inputs and returns the context
+func evalInputs(act *Activity, inputs map[string]interface{}) *test.TestActivityContext {
+	tc := test.NewActivityContext(act.Metadata())
+	for name, value := range inputs {
+		tc.SetInput(name, value)
+	}
+	act.Eval(tc)
+	return tc
+}
+
+// runParallel calls fn from several goroutines, each with its own iteration numbers
+func runParallel(workers, iterations int, fn func(worker, i int)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				fn(worker, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentEvalTemplateTypes(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"greeting.tmpl": "Hello {{.name}}",
+		"farewell.tmpl": "Goodbye {{.name}}",
+	})
+	act, err := newTemplateSetActivity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	cases := []struct {
+		templateType string
+		template     string
+		expected     string
+	}{
+		{"greeting", "", "Hello %s"},
+		{"farewell", "", "Goodbye %s"},
+		{"custom", "Hi {{.name}}", "Hi %s"},
+	}
+
+	runParallel(8, 50, func(worker, i int) {
+		tt := cases[(worker+i)%len(cases)]
+		name := fmt.Sprintf("user-%d-%d", worker, i)
+		tc := evalInputs(act, map[string]interface{}{
+			"templateType":     tt.templateType,
+			"template":         tt.template,
+			"templateData":     map[string]interface{}{"name": name},
+			"outputFormat":     "json",
+			"enableFormatting": true,
+		})
+
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.GetOutput("result").(string)), &result); err != nil {
+			t.Errorf("Invalid JSON output: %v", err)
+			return
+		}
+		if result["templateType"] != tt.templateType {
+			t.Errorf("Expected templateType %q, got %v", tt.templateType, result["templateType"])
+		}
+		if expected := fmt.Sprintf(tt.expected, name); result["content"] != expected {
+			t.Errorf("Expected content %q, got %v", expected, result["content"])
+		}
+		if used := tc.GetOutput("templateUsed").(string); !strings.HasPrefix(used, strings.SplitN(tt.expected, " ", 2)[0]) {
+			t.Errorf("Template %q reported templateUsed %q", tt.templateType, used)
+		}
+	})
+}
+
+func TestConcurrentEvalCompileOptions(t *testing.T) {
+	act, err := newTemplateSetActivity(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	template := "<p>{{.name}}</p>"
+
+	// The same template is compiled for each combination of strict mode and escaping;
+	// each evaluation must get the behaviour it asked for
+	runParallel(8, 50, func(worker, i int) {
+		strict := (worker+i)%2 == 0
+		escape := (worker/2+i)%2 == 0
+		data := map[string]interface{}{"name": "<b>Jane</b>"}
+		missing := i%3 == 0
+		if missing {
+			data = map[string]interface{}{}
+		}
+
+		tc := evalInputs(act, map[string]interface{}{
+			"template":     template,
+			"templateData": data,
+			"strictMode":   strict,
+			"escapeHtml":   escape,
+		})
+		success := tc.GetOutput("success").(bool)
+		result := tc.GetOutput("result").(string)
+
+		switch {
+		case missing && strict:
+			if success {
+				t.Errorf("Strict evaluation with missing data succeeded: %q", result)
+			}
+		case missing:
+			if !success || strings.Contains(result, "Jane") {
+				t.Errorf("Permissive evaluation with missing data: success %t, result %q", success, result)
+			}
+		case escape:
+			if result != "<p>&lt;b&gt;Jane&lt;/b&gt;</p>" {
+				t.Errorf("Expected escaped output, got %q (strict: %t)", result, strict)
+			}
+		default:
+			if result != "<p><b>Jane</b></p>" {
+				t.Errorf("Expected unescaped output, got %q (strict: %t)", result, strict)
+			}
+		}
+	})
+}
+
+func TestConcurrentEvalEngines(t *testing.T) {
+	engines := []struct {
+		engine   string
+		template string
+	}{
+		{"go", `{{template "header" .}}{{range .items}}[{{.}}]{{end}}`},
+		{"handlebars", `{{> header}}{{#each items}}[{{this}}]{{/each}}`},
+		{"mustache", `{{> header}}{{#items}}[{{.}}]{{/items}}`},
+	}
+
+	for _, e := range engines {
+		e := e
+		t.Run(e.engine, func(t *testing.T) {
+			t.Parallel()
+			header := "Order {{.id}}: "
+			if e.engine != "go" {
+				header = "Order {{id}}: "
+			}
+			act, err := New(test.NewActivityInitContext(&Settings{
+				TemplateEngine:    e.engine,
+				TemplateCacheSize: 2,
+				TemplatePath:      writeTemplates(t, map[string]string{"partials/header.tmpl": header}),
+			}, nil))
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+
+			runParallel(8, 50, func(worker, i int) {
+				id := fmt.Sprintf("%d-%d", worker, i)
+				// A template per worker keeps the small cache evicting while others render
+				template := e.template + strings.Repeat(" ", worker)
+				tc := evalInputs(act.(*Activity), map[string]interface{}{
+					"template":     template,
+					"templateData": map[string]interface{}{"id": id, "items": []interface{}{"a", worker}},
+					"strictMode":   i%2 == 0,
+				})
+				expected := fmt.Sprintf("Order %s: [a][%d]", id, worker) + strings.Repeat(" ", worker)
+				if result := tc.GetOutput("result"); result != expected {
+					t.Errorf("Expected %q, got %q (error: %v)", expected, result, tc.GetOutput("error"))
+				}
+			})
+		})
+	}
+}
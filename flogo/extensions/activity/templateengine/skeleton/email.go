@@ -0,0 +1,482 @@
+package templateengine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emailParts are the parts of an email, rendered from the templates of the same name
+var emailParts = []string{"subject", "text", "html"}
+
+// emailBlockPattern finds the parts a Go template defines with {{define}} or {{block}}
+var emailBlockPattern = regexp.MustCompile(`\{\{-?\s*(?:define|block)\s+"(subject|text|html)"`)
+
+// subjectLinePattern finds the "Subject:" first line of templates written before the
+// email output mode, such as the OOTB email templates
+var subjectLinePattern = regexp.MustCompile(`^[ \t]*Subject:[ \t]*([^\r\n]*)\r?\n?`)
+
+// addressHeaders hold mailbox lists, which are parsed and re-encoded
+var addressHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Sender": true,
+}
+
+// headerNamePattern matches valid header field names
+var headerNamePattern = regexp.MustCompile(`^[!-9;-~]+$`)
+
+// emailMessage is a rendered email
+type emailMessage struct {
+	subject string
+	text    string
+	html    string
+	headers map[string]string // the message headers, and Bcc, which is not written to it
+	mime    string            // the MIME message
+}
+
+// inlineImage is an image the HTML part references as cid:<cid>
+type inlineImage struct {
+	cid         string
+	contentType string
+	filename    string
+	content     []byte
+}
+
+// fields returns the structured email output
+func (m *emailMessage) fields() map[string]interface{} {
+	headers := make(map[string]interface{}, len(m.headers))
+	for name, value := range m.headers {
+		headers[name] = value
+	}
+	return map[string]interface{}{
+		"subject": m.subject,
+		"text":    m.text,
+		"html":    m.html,
+		"headers": headers,
+	}
+}
+
+// emailPartTemplates returns the part templates that are sibling files of an OOTB
+// template: email-welcome.subject.tmpl, email-welcome.text.tmpl and
+// email-welcome.html.tmpl for email-welcome
+func (a *Activity) emailPartTemplates(templateType string) (map[string]string, error) {
+	if templateType == "" || templateType == "custom" {
+		return nil, nil
+	}
+	name := strings.TrimSuffix(templateType, ".tmpl")
+	parts := make(map[string]string)
+	for _, part := range emailParts {
+		path := filepath.Join(a.templateBasePath, name+"."+part+".tmpl")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		content, err := a.files.read(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file %s: %v", path, err)
+		}
+		a.safeLog("debug", "Loaded %s part of '%s' from: %s", part, name, path)
+		parts[part] = content
+	}
+	return parts, nil
+}
+
+// renderEmail renders the subject, text and html parts of an email and builds the MIME
+// message. Each part comes from its sibling template file, from the template the Go
+// template defines with the part's name, or, for a template without text and html
+// parts, from the template itself, whose "Subject:" first line is the subject.
+func (a *Activity) renderEmail(rc *renderContext, templateContent string, partTemplates map[string]string, headerInput map[string]interface{}, imageInput []interface{}) (*emailMessage, *templateReferences, error) {
+	headers, err := emailHeaders(headerInput)
+	if err != nil {
+		return nil, nil, err
+	}
+	images, err := a.inlineImages(imageInput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defined := make(map[string]bool)
+	if a.goEngine() {
+		for _, match := range emailBlockPattern.FindAllStringSubmatch(templateContent, -1) {
+			defined[match[1]] = true
+		}
+	}
+
+	rendered := make(map[string]string)
+	references := &templateReferences{}
+	cacheHit := true
+	render := func(part, content, entry string) error {
+		prc := *rc
+		prc.entry = entry
+		prc.cacheHit = false
+		prc.escapeHTML = part == "html"
+		prc.plainText = part != "html"
+		result, refs, err := a.processTemplate(&prc, content)
+		if err != nil {
+			return fmt.Errorf("%s: %v", part, err)
+		}
+		rendered[part] = result
+		references.merge(refs)
+		cacheHit = cacheHit && prc.cacheHit
+		return nil
+	}
+	for _, part := range emailParts {
+		if content, ok := partTemplates[part]; ok {
+			err = render(part, content, "")
+		} else if defined[part] {
+			err = render(part, templateContent, part)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, hasText := rendered["text"]
+	_, hasHTML := rendered["html"]
+	if !hasText && !hasHTML {
+		// The template is the plain text, and may start with the subject line
+		if err := render("text", templateContent, ""); err != nil {
+			return nil, nil, err
+		}
+		if match := subjectLinePattern.FindStringSubmatch(rendered["text"]); match != nil {
+			if _, ok := rendered["subject"]; !ok {
+				rendered["subject"] = match[1]
+			}
+			rendered["text"] = strings.TrimLeft(rendered["text"][len(match[0]):], "\r\n")
+		}
+	}
+	rc.cacheHit = cacheHit
+
+	message := &emailMessage{
+		subject: strings.Join(strings.Fields(rendered["subject"]), " "),
+		text:    rendered["text"],
+		html:    rendered["html"],
+		headers: headers,
+	}
+	if message.subject == "" {
+		message.subject = headers["Subject"]
+	}
+	delete(headers, "Subject")
+	if len(images) > 0 && !hasHTML {
+		return nil, nil, fmt.Errorf("inline images require an html part")
+	}
+	if err := message.build(images); err != nil {
+		return nil, nil, err
+	}
+	a.safeLog("debug", "Rendered email with subject %q (text: %t, html: %t, inline images: %d)",
+		message.subject, message.text != "", message.html != "", len(images))
+	return message, references, nil
+}
+
+// goEngine reports whether templates are rendered with Go's text/template
+func (a *Activity) goEngine() bool {
+	switch a.settings.TemplateEngine {
+	case "handlebars", "mustache", "handlebars-basic", "mustache-basic":
+		return false
+	}
+	return true
+}
+
+// emailHeaders validates the message headers and returns them by canonical name.
+// Values must not contain line breaks, which would add headers, and addresses are
+// parsed and re-encoded. A list value is a comma-separated list.
+func emailHeaders(input map[string]interface{}) (map[string]string, error) {
+	headers := make(map[string]string, len(input))
+	for key, value := range input {
+		if !headerNamePattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid header name %q", key)
+		}
+		name := textproto.CanonicalMIMEHeaderKey(key)
+		if name == "Mime-Version" || strings.HasPrefix(name, "Content-") {
+			return nil, fmt.Errorf("header %q is set by the email output", name)
+		}
+		if _, ok := headers[name]; ok {
+			return nil, fmt.Errorf("header %q is given more than once", name)
+		}
+
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case []interface{}:
+			values := make([]string, len(v))
+			for i, item := range v {
+				values[i] = formatTemplateValue(item)
+			}
+			text = strings.Join(values, ", ")
+		case []string:
+			text = strings.Join(v, ", ")
+		default:
+			text = formatTemplateValue(v)
+		}
+		if strings.ContainsAny(text, "\r\n") {
+			return nil, fmt.Errorf("header %q must not contain line breaks", name)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		if addressHeaders[name] {
+			addresses, err := mail.ParseAddressList(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s address %q: %v", name, text, err)
+			}
+			formatted := make([]string, len(addresses))
+			for i, address := range addresses {
+				formatted[i] = address.String()
+			}
+			text = strings.Join(formatted, ", ")
+		}
+		headers[name] = text
+	}
+	if _, ok := headers["Date"]; !ok {
+		headers["Date"] = time.Now().Format(time.RFC1123Z)
+	}
+	return headers, nil
+}
+
+// inlineImages reads the inline images. Each has a cid, which the HTML references as
+// cid:<cid>, and either the path of a file under the template path or base64 content.
+func (a *Activity) inlineImages(input []interface{}) ([]*inlineImage, error) {
+	images := make([]*inlineImage, 0, len(input))
+	seen := make(map[string]bool)
+	for i, item := range input {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("inline image %d must be an object", i)
+		}
+		image := &inlineImage{}
+		image.cid, _ = fields["cid"].(string)
+		image.contentType, _ = fields["contentType"].(string)
+		image.filename, _ = fields["filename"].(string)
+		path, _ := fields["path"].(string)
+		content, _ := fields["content"].(string)
+
+		if image.cid == "" || strings.ContainsAny(image.cid, "<> \t\r\n\"") {
+			return nil, fmt.Errorf("inline image %d has an invalid cid %q", i, image.cid)
+		}
+		if seen[image.cid] {
+			return nil, fmt.Errorf("inline image cid %q is used more than once", image.cid)
+		}
+		seen[image.cid] = true
+
+		switch {
+		case path != "" && content != "":
+			return nil, fmt.Errorf("inline image %q has both a path and content", image.cid)
+		case path != "":
+			if filepath.IsAbs(path) || strings.Contains(path, "..") {
+				return nil, fmt.Errorf("inline image %q has an invalid path %q", image.cid, path)
+			}
+			data, err := os.ReadFile(filepath.Join(a.templateBasePath, path))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read inline image %q: %v", image.cid, err)
+			}
+			image.content = data
+			if image.filename == "" {
+				image.filename = filepath.Base(path)
+			}
+			if image.contentType == "" {
+				image.contentType = mime.TypeByExtension(filepath.Ext(path))
+			}
+		case content != "":
+			data, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				return nil, fmt.Errorf("inline image %q content is not base64: %v", image.cid, err)
+			}
+			image.content = data
+		default:
+			return nil, fmt.Errorf("inline image %q needs a path or content", image.cid)
+		}
+
+		if image.contentType == "" {
+			image.contentType = http.DetectContentType(image.content)
+		}
+		if mediaType, _, err := mime.ParseMediaType(image.contentType); err != nil || !strings.HasPrefix(mediaType, "image/") {
+			return nil, fmt.Errorf("inline image %q has content type %q, not an image", image.cid, image.contentType)
+		}
+		if image.filename == "" {
+			image.filename = image.cid
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// build writes the MIME message: a multipart/alternative message with the text and the
+// html part, or the one part there is. The html part and its inline images are a
+// multipart/related part.
+func (m *emailMessage) build(images []*inlineImage) error {
+	var body bytes.Buffer
+	var contentType string
+	var err error
+	switch {
+	case m.html == "":
+		contentType = "text/plain; charset=utf-8"
+		err = writeQuotedPrintable(&body, m.text)
+	case m.text == "":
+		contentType, err = writeHTMLPart(&body, m.html, images)
+	default:
+		w := multipart.NewWriter(&body)
+		contentType = "multipart/alternative; boundary=" + w.Boundary()
+		var part io.Writer
+		if part, err = w.CreatePart(textPartHeader("text/plain; charset=utf-8")); err == nil {
+			err = writeQuotedPrintable(part, m.text)
+		}
+		if err == nil {
+			var html bytes.Buffer
+			var htmlType string
+			if htmlType, err = writeHTMLPart(&html, m.html, images); err == nil {
+				header := textPartHeader(htmlType)
+				if len(images) > 0 {
+					header = textproto.MIMEHeader{"Content-Type": {htmlType}}
+				}
+				if part, err = w.CreatePart(header); err == nil {
+					_, err = part.Write(html.Bytes())
+				}
+			}
+		}
+		if err == nil {
+			err = w.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the MIME message: %v", err)
+	}
+
+	if m.subject != "" {
+		m.headers["Subject"] = m.subject
+	}
+	names := make([]string, 0, len(m.headers))
+	for name := range m.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var message strings.Builder
+	for _, name := range names {
+		if name == "Bcc" {
+			continue
+		}
+		message.WriteString(foldHeader(name, encodeHeader(name, m.headers[name])))
+	}
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString(foldHeader("Content-Type", contentType))
+	if !strings.HasPrefix(contentType, "multipart/") {
+		message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	m.mime = message.String()
+
+	m.headers["MIME-Version"] = "1.0"
+	m.headers["Content-Type"] = contentType
+	return nil
+}
+
+// writeHTMLPart writes the body of an html part, which is multipart/related when it
+// has inline images, and returns its content type
+func writeHTMLPart(w io.Writer, html string, images []*inlineImage) (string, error) {
+	if len(images) == 0 {
+		return "text/html; charset=utf-8", writeQuotedPrintable(w, html)
+	}
+	related := multipart.NewWriter(w)
+	return "multipart/related; boundary=" + related.Boundary(), writeRelatedParts(related, html, images)
+}
+
+// writeRelatedParts writes the html part followed by its inline images
+func writeRelatedParts(w *multipart.Writer, html string, images []*inlineImage) error {
+	part, err := w.CreatePart(textPartHeader("text/html; charset=utf-8"))
+	if err != nil {
+		return err
+	}
+	if err := writeQuotedPrintable(part, html); err != nil {
+		return err
+	}
+	for _, image := range images {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {image.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Id":                {"<" + image.cid + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": image.filename})},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64(part, image.content); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// textPartHeader returns the header of a quoted-printable text part
+func textPartHeader(contentType string) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+}
+
+// writeQuotedPrintable writes text quoted-printable encoded, with CRLF line breaks
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, text); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := len(encoded)
+		if n > 76 {
+			n = 76
+		}
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// encodeHeader encodes a header value that is not ASCII as RFC 2047 encoded words.
+// Addresses are encoded when they are parsed.
+func encodeHeader(name, value string) string {
+	if addressHeaders[name] {
+		return value
+	}
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// foldHeader returns a header line, folded at spaces so lines stay within 78 characters
+// where possible
+func foldHeader(name, value string) string {
+	var line strings.Builder
+	line.WriteString(name + ":")
+	width := len(name) + 1
+	for i, word := range strings.Split(value, " ") {
+		if i > 0 && width+1+len(word) > 78 {
+			line.WriteString("\r\n")
+			width = 0
+		}
+		line.WriteString(" " + word)
+		width += 1 + len(word)
+	}
+	line.WriteString("\r\n")
+	return line.String()
+}
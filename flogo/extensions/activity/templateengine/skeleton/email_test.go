@@ -0,0 +1,243 @@
+package templateengine
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// emailPart is a leaf part of a parsed MIME message
+type emailPart struct {
+	contentType string
+	header      map[string][]string
+	body        string
+}
+
+// parseEmail parses a MIME message into its headers and leaf parts, in order.
+// Quoted-printable bodies are decoded.
+func parseEmail(t *testing.T, message string) (*mail.Message, []emailPart) {
+	t.Helper()
+	if strings.Contains(strings.ReplaceAll(message, "\r\n", ""), "\n") {
+		t.Fatalf("Message has bare line feeds:\n%s", message)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	var parts []emailPart
+	var walk func(contentType string, header map[string][]string, body io.Reader)
+	walk = func(contentType string, header map[string][]string, body io.Reader) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("Invalid content type %q: %v", contentType, err)
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			parts = append(parts, emailPart{contentType: mediaType, header: header})
+			r := multipart.NewReader(body, params["boundary"])
+			for {
+				part, err := r.NextPart()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Fatalf("Failed to read part: %v", err)
+				}
+				walk(part.Header.Get("Content-Type"), part.Header, part)
+			}
+		}
+		// The multipart reader decodes parts, but not the message body
+		if values := header["Content-Transfer-Encoding"]; len(values) > 0 && values[0] == "quoted-printable" {
+			body = quotedprintable.NewReader(body)
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("Failed to read body: %v", err)
+		}
+		parts = append(parts, emailPart{contentType: mediaType, header: header, body: string(content)})
+	}
+	walk(msg.Header.Get("Content-Type"), msg.Header, msg.Body)
+	return msg, parts
+}
+
+// renderEmailOutput evaluates the activity in email mode and returns its context
+func renderEmailOutput(t *testing.T, act *Activity, inputs map[string]interface{}) *test.TestActivityContext {
+	t.Helper()
+	inputs["outputFormat"] = "email"
+	tc := evalInputs(act, inputs)
+	if success, _ := tc.GetOutput("success").(bool); !success {
+		t.Fatalf("Email rendering failed: %v", tc.GetOutput("error"))
+	}
+	return tc
+}
+
+func TestEmailNamedBlocks(t *testing.T) {
+	act, err := newTemplateSetActivity(writeTemplates(t, map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	tc := renderEmailOutput(t, act, map[string]interface{}{
+		"template": `{{define "subject"}}Order #{{.order}} for
+  {{.name}}{{end}}{{define "text"}}Hi {{.name}}, total: {{.total}}{{end}}{{define "html"}}<p>Hi {{.name}}</p>{{end}}`,
+		"templateData": map[string]interface{}{"order": 42, "name": "Tom & <Jerry>", "total": "5 €"},
+		"emailHeaders": map[string]interface{}{"from": "Shop <shop@example.com>", "to": []interface{}{"a@example.com", "Bé <b@example.com>"}, "bcc": "audit@example.com"},
+	})
+
+	email := tc.GetOutput("email").(map[string]interface{})
+	if subject := email["subject"]; subject != "Order #42 for Tom & <Jerry>" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	if text := email["text"]; text != "Hi Tom & <Jerry>, total: 5 €" {
+		t.Errorf("Text part must not be escaped, got %q", text)
+	}
+	if html := email["html"]; html != "<p>Hi Tom &amp; &lt;Jerry&gt;</p>" {
+		t.Errorf("HTML part must be escaped, got %q", html)
+	}
+	headers := email["headers"].(map[string]interface{})
+	if headers["Bcc"] != "<audit@example.com>" || headers["Date"] == nil {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+
+	msg, parts := parseEmail(t, tc.GetOutput("result").(string))
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("Bcc must not be written to the message")
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Order #42 for Tom & <Jerry>" {
+		t.Errorf("Unexpected Subject header %q", msg.Header.Get("Subject"))
+	}
+	if to, err := msg.Header.AddressList("To"); err != nil || len(to) != 2 || to[1].Name != "Bé" {
+		t.Errorf("Unexpected To header %q: %v", msg.Header.Get("To"), err)
+	}
+	if len(parts) != 3 || parts[0].contentType != "multipart/alternative" || parts[1].body != email["text"] || parts[2].body != email["html"] {
+		t.Fatalf("Unexpected parts %+v", parts)
+	}
+	if vars := tc.GetOutput("variablesUsed").([]string); strings.Join(vars, ",") != "order,name,total" {
+		t.Errorf("Unexpected variables %v", vars)
+	}
+}
+
+func TestEmailPartFiles(t *testing.T) {
+	files := map[string]string{
+		"order.subject.tmpl":    "Order {{order}}",
+		"order.text.tmpl":       "Hi {{name}}",
+		"order.html.tmpl":       `<p>Hi {{name}}</p><img src="cid:logo">`,
+		"order.de.subject.tmpl": "Bestellung {{order}}",
+		"images/logo.png":       "\x89PNG\r\n\x1a\n0000",
+	}
+	for _, engine := range []string{"handlebars", "mustache"} {
+		t.Run(engine, func(t *testing.T) {
+			act, err := New(test.NewActivityInitContext(&Settings{TemplateEngine: engine, TemplatePath: writeTemplates(t, files)}, nil))
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+			tc := renderEmailOutput(t, act.(*Activity), map[string]interface{}{
+				"templateType": "order",
+				"templateData": map[string]interface{}{"order": 7, "name": "<Ann>"},
+				"inlineImages": []interface{}{
+					map[string]interface{}{"cid": "logo", "path": "images/logo.png"},
+					map[string]interface{}{"cid": "dot", "content": base64.StdEncoding.EncodeToString([]byte("GIF89a")), "filename": "dot.gif"},
+				},
+			})
+
+			_, parts := parseEmail(t, tc.GetOutput("result").(string))
+			types := make([]string, len(parts))
+			for i, part := range parts {
+				types[i] = part.contentType
+			}
+			expected := "multipart/alternative,text/plain,multipart/related,text/html,image/png,image/gif"
+			if strings.Join(types, ",") != expected {
+				t.Fatalf("Expected parts %s, got %s", expected, strings.Join(types, ","))
+			}
+			if parts[1].body != "Hi <Ann>" || parts[3].body != `<p>Hi &lt;Ann&gt;</p><img src="cid:logo">` {
+				t.Errorf("Unexpected text and html parts %q, %q", parts[1].body, parts[3].body)
+			}
+			logo := parts[4]
+			if logo.header["Content-Id"][0] != "<logo>" || !strings.HasPrefix(logo.header["Content-Disposition"][0], "inline") {
+				t.Errorf("Unexpected image headers %v", logo.header)
+			}
+			if content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(logo.body, "\r\n", "")); err != nil || string(content) != files["images/logo.png"] {
+				t.Errorf("Unexpected image content %q: %v", logo.body, err)
+			}
+
+			// A locale with only a subject file uses it, with no other parts
+			tc = renderEmailOutput(t, act.(*Activity), map[string]interface{}{
+				"templateType": "order",
+				"templateData": map[string]interface{}{"order": 7},
+				"locale":       "de-AT",
+			})
+			email := tc.GetOutput("email").(map[string]interface{})
+			if email["subject"] != "Bestellung 7" || email["text"] != "" || tc.GetOutput("templateLocale") != "de" {
+				t.Errorf("Unexpected localized email %v", email)
+			}
+		})
+	}
+}
+
+func TestEmailSubjectLine(t *testing.T) {
+	result := renderHTML(t, "go", "Subject: Welcome, {{.name}}! 🎉\n\nDear {{.name}},\nthanks.\n", map[string]interface{}{"name": "Zoë"}, map[string]interface{}{
+		"outputFormat": "email",
+		"emailHeaders": map[string]interface{}{"From": "a@example.com", "Subject": "Ignored", "X-Campaign": "Été"},
+	})
+	msg, parts := parseEmail(t, result)
+	if raw := msg.Header.Get("Subject"); !strings.HasPrefix(raw, "=?utf-8?q?") {
+		t.Errorf("Expected a Q-encoded subject, got %q", raw)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Welcome, Zoë! 🎉" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	if campaign, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("X-Campaign")); campaign != "Été" {
+		t.Errorf("Unexpected X-Campaign header %q", campaign)
+	}
+	if len(parts) != 1 || parts[0].contentType != "text/plain" || parts[0].body != "Dear Zoë,\r\nthanks.\r\n" {
+		t.Errorf("Unexpected parts %+v", parts)
+	}
+
+	// A long subject is folded
+	result = renderHTML(t, "go", "Subject: "+strings.Repeat("word ", 40), nil, map[string]interface{}{"outputFormat": "email"})
+	header := result[:strings.Index(result, "\r\n\r\n")]
+	for _, line := range strings.Split(header, "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("Header line is %d characters: %q", len(line), line)
+		}
+	}
+}
+
+func TestEmailErrors(t *testing.T) {
+	act, err := newTemplateSetActivity(writeTemplates(t, map[string]string{"secret.txt": "x"}))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	tests := map[string]struct {
+		inputs   map[string]interface{}
+		expected string
+	}{
+		"Header injection":    {map[string]interface{}{"emailHeaders": map[string]interface{}{"To": "a@example.com\r\nBcc: b@example.com"}}, "must not contain line breaks"},
+		"Invalid header name": {map[string]interface{}{"emailHeaders": map[string]interface{}{"X Bad": "1"}}, "invalid header name"},
+		"Content header":      {map[string]interface{}{"emailHeaders": map[string]interface{}{"content-type": "text/html"}}, `header "Content-Type" is set by the email output`},
+		"Invalid address":     {map[string]interface{}{"emailHeaders": map[string]interface{}{"From": "not an address"}}, "invalid From address"},
+		"Image without html":  {map[string]interface{}{"inlineImages": []interface{}{map[string]interface{}{"cid": "a", "content": "R0lGODlh"}}}, "inline images require an html part"},
+		"Image path":          {map[string]interface{}{"inlineImages": []interface{}{map[string]interface{}{"cid": "a", "path": "../secret.txt"}}}, "invalid path"},
+		"Image type":          {map[string]interface{}{"inlineImages": []interface{}{map[string]interface{}{"cid": "a", "path": "secret.txt"}}}, "not an image"},
+		"Image cid":           {map[string]interface{}{"inlineImages": []interface{}{map[string]interface{}{"cid": "<a>", "content": "R0lGODlh"}}}, "invalid cid"},
+		"Undefined part":      {map[string]interface{}{"template": `{{define "html"}}{{template "missing"}}{{end}}`}, `html: `},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			inputs := tt.inputs
+			if _, ok := inputs["template"]; !ok {
+				inputs["template"] = "Hello"
+			}
+			inputs["outputFormat"] = "email"
+			tc := evalInputs(act, inputs)
+			if errMsg, _ := tc.GetOutput("error").(string); !strings.Contains(errMsg, tt.expected) {
+				t.Errorf("Expected an error containing %q, got %q", tt.expected, errMsg)
+			}
+		})
+	}
+}
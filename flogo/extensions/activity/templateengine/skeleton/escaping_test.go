@@ -0,0 +1,178 @@
+package templateengine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// renderHTML evaluates a custom template with the given escaping inputs
+func renderHTML(t *testing.T, engine, template string, data map[string]interface{}, inputs map[string]interface{}) string {
+	act, err := New(test.NewActivityInitContext(&Settings{
+		TemplateEngine:    engine,
+		TemplateCacheSize: 10,
+		EnableSafeMode:    true,
+	}, nil))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", template)
+	tc.SetInput("templateData", data)
+	for name, value := range inputs {
+		tc.SetInput(name, value)
+	}
+	if _, err := act.Eval(tc); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if success, _ := tc.GetOutput("success").(bool); !success {
+		t.Fatalf("Template processing failed: %v", tc.GetOutput("error"))
+	}
+	return tc.GetOutput("result").(string)
+}
+
+func TestHTMLAutoEscaping_XSS(t *testing.T) {
+	escapeHTML := map[string]interface{}{"escapeHtml": true}
+
+	tests := []struct {
+		name        string
+		template    string
+		data        map[string]interface{}
+		expected    string
+		notExpected string
+	}{
+		{
+			name:        "Element content",
+			template:    `<p>Hello {{.name}}</p>`,
+			data:        map[string]interface{}{"name": `<script>alert(1)</script>`},
+			expected:    `<p>Hello &lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+			notExpected: "<script>",
+		},
+		{
+			name:        "Quoted attribute",
+			template:    `<div title="{{.title}}">x</div>`,
+			data:        map[string]interface{}{"title": `" onmouseover="alert(1)`},
+			expected:    `<div title="&#34; onmouseover=&#34;alert(1)">x</div>`,
+			notExpected: `" onmouseover="`,
+		},
+		{
+			name:        "Unquoted attribute",
+			template:    `<div class={{.class}}>x</div>`,
+			data:        map[string]interface{}{"class": `x onclick=alert(1)`},
+			expected:    `<div class=x&#32;onclick&#61;alert(1)>x</div>`,
+			notExpected: " onclick=",
+		},
+		{
+			name:        "URL scheme",
+			template:    `<a href="{{.url}}">Track order</a>`,
+			data:        map[string]interface{}{"url": `javascript:alert(document.cookie)`},
+			expected:    `<a href="#ZgotmplZ">Track order</a>`,
+			notExpected: "javascript:",
+		},
+		{
+			name:     "URL query parameter",
+			template: `<a href="https://shop.example.com/orders?id={{.orderId}}">Order</a>`,
+			data:     map[string]interface{}{"orderId": `1" onclick="alert(1)&x=<y>`},
+			expected: `<a href="https://shop.example.com/orders?id=1%22%20onclick%3d%22alert%281%29%26x%3d%3cy%3e">Order</a>`,
+		},
+		{
+			name:        "Script string",
+			template:    `<script>var customer = "{{.name}}";</script>`,
+			data:        map[string]interface{}{"name": `"; alert(1); "</script><script>alert(2)//`},
+			expected:    `<script>var customer = "\u0022; alert(1); \u0022\u003c\/script\u003e\u003cscript\u003ealert(2)\/\/";</script>`,
+			notExpected: "</script><script>",
+		},
+		{
+			name:        "Script value",
+			template:    `<script>var order = {{.order}};</script>`,
+			data:        map[string]interface{}{"order": map[string]interface{}{"note": `</script><script>alert(1)</script>`}},
+			expected:    `<script>var order = {"note":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"};</script>`,
+			notExpected: "</script><script>",
+		},
+		{
+			name:     "Style attribute",
+			template: `<p style="color: {{.color}}">x</p>`,
+			data:     map[string]interface{}{"color": `red; background: url(javascript:alert(1))`},
+			expected: `<p style="color: ZgotmplZ">x</p>`,
+		},
+		{
+			name:     "Trusted helpers",
+			template: `{{safeHTML .footer}}<a href="{{safeURL .link}}">x</a>`,
+			data:     map[string]interface{}{"footer": `<b>ACME</b>`, "link": `mailto:support@acme.com`},
+			expected: `<b>ACME</b><a href="mailto:support@acme.com">x</a>`,
+		},
+		{
+			name:     "Functions work under html/template",
+			template: `<h1>{{.name | upper}}</h1>{{if eq .status "shipped"}}<p>{{.status}}</p>{{end}}`,
+			data:     map[string]interface{}{"name": "<jane>", "status": "shipped"},
+			expected: `<h1>&lt;JANE&gt;</h1><p>shipped</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := renderHTML(t, "go", tt.template, tt.data, escapeHTML)
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if tt.notExpected != "" && strings.Contains(result, tt.notExpected) {
+				t.Errorf("Result contains injected markup %q: %s", tt.notExpected, result)
+			}
+		})
+	}
+}
+
+func TestHTMLAutoEscaping_Selection(t *testing.T) {
+	template := `<p>{{.name}}</p>`
+	data := map[string]interface{}{"name": "<b>Jane</b>"}
+
+	t.Run("Text output is not escaped", func(t *testing.T) {
+		result := renderHTML(t, "go", template, data, map[string]interface{}{"escapeHtml": false})
+		if result != "<p><b>Jane</b></p>" {
+			t.Errorf("Expected unescaped output, got %q", result)
+		}
+	})
+
+	t.Run("HTML output format escapes", func(t *testing.T) {
+		result := renderHTML(t, "go", template, data, map[string]interface{}{"outputFormat": "html", "enableFormatting": false})
+		if result != "<p>&lt;b&gt;Jane&lt;/b&gt;</p>" {
+			t.Errorf("Expected escaped output, got %q", result)
+		}
+	})
+
+	t.Run("Template markup is kept", func(t *testing.T) {
+		result := renderHTML(t, "go", template, data, map[string]interface{}{"escapeHtml": true})
+		if !strings.HasPrefix(result, "<p>") {
+			t.Errorf("Template markup should not be escaped, got %q", result)
+		}
+	})
+
+	t.Run("HTML formatting escapes once", func(t *testing.T) {
+		result := renderHTML(t, "go", "Hello {{.name}}", data, map[string]interface{}{"escapeHtml": true, "outputFormat": "html", "enableFormatting": true})
+		if !strings.Contains(result, "<p>Hello &lt;b&gt;Jane&lt;/b&gt;</p>") {
+			t.Errorf("Expected text escaped once by the HTML formatter, got %q", result)
+		}
+	})
+
+	t.Run("Handlebars escapes once", func(t *testing.T) {
+		result := renderHTML(t, "handlebars", "<p>{{name}}</p>", data, map[string]interface{}{"escapeHtml": true})
+		if result != "<p>&lt;b&gt;Jane&lt;/b&gt;</p>" {
+			t.Errorf("Expected escaped output, got %q", result)
+		}
+	})
+
+	t.Run("Cached templates keep their mode", func(t *testing.T) {
+		act, _ := New(test.NewActivityInitContext(&Settings{TemplateEngine: "go", TemplateCacheSize: 10}, nil))
+		a := act.(*Activity)
+		escaped, _, err := a.processTemplate(&renderContext{data: data, escapeHTML: true}, template)
+		if err != nil || escaped != "<p>&lt;b&gt;Jane&lt;/b&gt;</p>" {
+			t.Errorf("Expected escaped output, got %q, %v", escaped, err)
+		}
+		raw, _, err := a.processTemplate(&renderContext{data: data}, template)
+		if err != nil || raw != "<p><b>Jane</b></p>" {
+			t.Errorf("Expected unescaped output, got %q, %v", raw, err)
+		}
+	})
+}
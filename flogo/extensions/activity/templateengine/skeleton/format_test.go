@@ -36,28 +36,28 @@ ACME Corp`
 	activity := &Activity{}
 
 	// Test HTML formatting
-	htmlOutput, err := activity.formatOutput(sampleContent, "html")
+	htmlOutput, err := activity.formatOutput(sampleContent, "html", "custom")
 	if err != nil {
 		t.Fatalf("HTML formatting failed: %v", err)
 	}
 	t.Logf("HTML Output:\n%s\n", htmlOutput)
 
 	// Test XML formatting
-	xmlOutput, err := activity.formatOutput(sampleContent, "xml")
+	xmlOutput, err := activity.formatOutput(sampleContent, "xml", "custom")
 	if err != nil {
 		t.Fatalf("XML formatting failed: %v", err)
 	}
 	t.Logf("XML Output:\n%s\n", xmlOutput)
 
 	// Test Markdown formatting
-	markdownOutput, err := activity.formatOutput(sampleContent, "markdown")
+	markdownOutput, err := activity.formatOutput(sampleContent, "markdown", "custom")
 	if err != nil {
 		t.Fatalf("Markdown formatting failed: %v", err)
 	}
 	t.Logf("Markdown Output:\n%s\n", markdownOutput)
 
 	// Test plain text (no formatting)
-	textOutput, err := activity.formatOutput(sampleContent, "text")
+	textOutput, err := activity.formatOutput(sampleContent, "text", "custom")
 	if err != nil {
 		t.Fatalf("Text formatting failed: %v", err)
 	}
@@ -2,6 +2,7 @@ package templateengine
 
 import (
 	"testing"
+	"text/template"
 )
 
 // Test to verify exact count of template functions
@@ -51,3 +52,117 @@ func TestTemplateFunctionCount(t *testing.T) {
 		}
 	}
 }
+
+// Test the split of the Sprig functions between safe mode and full mode. Safe mode only
+// gets functions whose result depends on nothing but their arguments.
+func TestSprigFunctionSplit(t *testing.T) {
+	safe := getSprigFunctions()
+	fullOnly := getSprigFullModeFunctions()
+
+	// Functions that read the clock, random numbers or the environment, or change
+	// their arguments
+	expectedFullOnly := []string{
+		"ago",                                                                                   // clock
+		"uuidv4", "randAlphaNum", "randAlpha", "randNumeric", "randAscii", "randInt", "shuffle", // random
+		"env", "expandenv", // environment
+		"set", "unset", "merge", "mergeOverwrite", // change their arguments
+	}
+	if len(fullOnly) != len(expectedFullOnly) {
+		t.Errorf("Expected %d full mode functions, got %d", len(expectedFullOnly), len(fullOnly))
+	}
+	for _, name := range expectedFullOnly {
+		if _, exists := fullOnly[name]; !exists {
+			t.Errorf("Expected full mode function %s not found", name)
+		}
+	}
+
+	expectedSafe := []string{
+		// Strings (27)
+		"trimAll", "trimPrefix", "trimSuffix", "hasPrefix", "hasSuffix", "untitle", "repeat", "substr",
+		"trunc", "abbrev", "initials", "nospace", "wrap", "wrapWith", "indent", "nindent", "quote",
+		"squote", "cat", "plural", "snakecase", "kebabcase", "camelcase", "swapcase", "splitList",
+		"toString", "toStrings",
+		// Regular expressions (13)
+		"regexMatch", "mustRegexMatch", "regexFind", "mustRegexFind", "regexFindAll", "mustRegexFindAll",
+		"regexReplaceAll", "mustRegexReplaceAll", "regexReplaceAllLiteral", "mustRegexReplaceAllLiteral",
+		"regexSplit", "mustRegexSplit", "regexQuoteMeta",
+		// Encoding and hashing (11)
+		"b64enc", "b64dec", "b32enc", "b32dec", "hexenc", "hexdec", "sha1sum", "sha256sum", "sha512sum",
+		"adler32sum", "hmacSha256",
+		// JSON (8)
+		"toJson", "mustToJson", "toPrettyJson", "mustToPrettyJson", "toRawJson", "mustToRawJson",
+		"fromJson", "mustFromJson",
+		// Integer math (7)
+		"add1", "sub", "mul", "div", "mod", "max", "min",
+		// Floating point math (9)
+		"addf", "subf", "mulf", "divf", "maxf", "minf", "floor", "ceil", "round",
+		// Number formatting (2)
+		"formatNumber", "formatCurrency",
+		// Type conversion (4)
+		"atoi", "int", "int64", "float64",
+		// Integer sequences (3)
+		"until", "untilStep", "seq",
+		// Lists (13)
+		"list", "append", "push", "prepend", "concat", "rest", "initial", "uniq", "without", "has",
+		"compact", "sortAlpha", "chunk",
+		// Dictionaries (10)
+		"dict", "get", "hasKey", "keys", "values", "pick", "omit", "pluck", "dig", "deepCopy",
+		// Dates (11)
+		"date", "dateInZone", "htmlDate", "htmlDateInZone", "toDate", "mustToDate", "dateModify",
+		"mustDateModify", "unixEpoch", "duration", "durationRound",
+		// Flow control (7)
+		"empty", "ternary", "coalesce", "all", "any", "fail", "required",
+		// Types (5)
+		"typeOf", "typeIs", "kindOf", "kindIs", "deepEqual",
+		// Slash-separated paths (5)
+		"base", "dir", "ext", "clean", "isAbs",
+	}
+	for _, name := range expectedSafe {
+		if _, exists := safe[name]; !exists {
+			t.Errorf("Expected side-effect free function %s not found", name)
+		}
+	}
+	t.Logf("Sprig functions: %d side-effect free, %d full mode only", len(safe), len(fullOnly))
+	if len(safe) != len(expectedSafe) {
+		t.Errorf("Expected %d side-effect free Sprig functions, got %d", len(expectedSafe), len(safe))
+	}
+
+	// The Sprig functions do not replace the template functions, which keep their
+	// argument order
+	activity := &Activity{}
+	for name := range safe {
+		if _, exists := fullOnly[name]; exists {
+			t.Errorf("Function %s is in both sets", name)
+		}
+	}
+	for _, existing := range []template.FuncMap{activity.getTemplateFunctions(), activity.getEssentialTemplateFunctions(), getTrustedContentFunctions()} {
+		for name := range existing {
+			if _, exists := safe[name]; exists {
+				t.Errorf("Sprig function %s redefines a template function", name)
+			}
+			if _, exists := fullOnly[name]; exists {
+				t.Errorf("Sprig function %s redefines a template function", name)
+			}
+		}
+	}
+
+	// Both modes add the 5 trusted content functions and the t and locale functions
+	tests := []struct {
+		safeMode bool
+		expected int
+	}{
+		{true, 12 + len(safe) + 5 + 2},
+		{false, 29 + len(safe) + len(fullOnly) + 5 + 2},
+	}
+	for _, tt := range tests {
+		activity := &Activity{settings: &Settings{EnableSafeMode: tt.safeMode}}
+		funcs := activity.templateFunctions()
+		if len(funcs) != tt.expected {
+			t.Errorf("Safe mode %t: expected %d functions, got %d", tt.safeMode, tt.expected, len(funcs))
+		}
+		_, hasUUID := funcs["uuidv4"]
+		if hasUUID == tt.safeMode {
+			t.Errorf("Safe mode %t: uuidv4 available %t", tt.safeMode, hasUUID)
+		}
+	}
+}
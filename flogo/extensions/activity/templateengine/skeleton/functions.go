@@ -0,0 +1,1258 @@
+package templateengine
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"math"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Functions that generate output from a count fail rather than allocate more than
+// this, whatever the render limits are
+const (
+	maxGeneratedSize  = defaultMaxOutputSize
+	maxGeneratedItems = defaultMaxLoopIterations
+)
+
+// getSprigFunctions returns the functions of the Sprig library that only depend on
+// their arguments, so they are also available in safe mode. Names that the template
+// functions already define, such as join, split and add, keep their existing argument
+// order and are not redefined.
+func getSprigFunctions() template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"untitle":    untitle,
+		"repeat":     repeat,
+		"substr":     substr,
+		"trunc":      trunc,
+		"abbrev":     abbrev,
+		"initials":   initials,
+		"nospace": func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, s)
+		},
+		"wrap":     func(width interface{}, s string) string { return wrapWith(width, "\n", s) },
+		"wrapWith": wrapWith,
+		"indent":   indent,
+		"nindent":  func(spaces interface{}, s string) string { return "\n" + indent(spaces, s) },
+		"quote":    func(values ...interface{}) string { return quoteAll(`"`, values) },
+		"squote":   func(values ...interface{}) string { return quoteAll("'", values) },
+		"cat": func(values ...interface{}) string {
+			parts := make([]string, 0, len(values))
+			for _, v := range values {
+				if v != nil {
+					parts = append(parts, strval(v))
+				}
+			}
+			return strings.Join(parts, " ")
+		},
+		"plural": func(one, many string, count interface{}) string {
+			if toInt64(count) == 1 {
+				return one
+			}
+			return many
+		},
+		"snakecase": func(s string) string { return strings.ToLower(strings.Join(splitWords(s), "_")) },
+		"kebabcase": func(s string) string { return strings.ToLower(strings.Join(splitWords(s), "-")) },
+		"camelcase": camelcase,
+		"swapcase": func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.IsUpper(r) {
+					return unicode.ToLower(r)
+				}
+				return unicode.ToUpper(r)
+			}, s)
+		},
+		"splitList": func(sep, s string) []string { return strings.Split(s, sep) },
+		"toString":  strval,
+		"toStrings": toStrings,
+
+		// Regular expressions; the must variants fail on an invalid expression
+		"regexMatch":                 func(re, s string) bool { ok, _ := regexMatch(re, s); return ok },
+		"mustRegexMatch":             regexMatch,
+		"regexFind":                  func(re, s string) string { found, _ := regexFind(re, s); return found },
+		"mustRegexFind":              regexFind,
+		"regexFindAll":               func(re, s string, n interface{}) []string { found, _ := regexFindAll(re, s, n); return found },
+		"mustRegexFindAll":           regexFindAll,
+		"regexReplaceAll":            func(re, s, repl string) string { out, _ := regexReplaceAll(re, s, repl); return out },
+		"mustRegexReplaceAll":        regexReplaceAll,
+		"regexReplaceAllLiteral":     func(re, s, repl string) string { out, _ := regexReplaceAllLiteral(re, s, repl); return out },
+		"mustRegexReplaceAllLiteral": regexReplaceAllLiteral,
+		"regexSplit":                 func(re, s string, n interface{}) []string { parts, _ := regexSplit(re, s, n); return parts },
+		"mustRegexSplit":             regexSplit,
+		"regexQuoteMeta":             regexp.QuoteMeta,
+
+		// Encoding and hashing
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) string { return decodeString(base64.StdEncoding.DecodeString(s)) },
+		"b32enc": func(s string) string { return base32.StdEncoding.EncodeToString([]byte(s)) },
+		"b32dec": func(s string) string { return decodeString(base32.StdEncoding.DecodeString(s)) },
+		"hexenc": func(s string) string { return hex.EncodeToString([]byte(s)) },
+		"hexdec": func(s string) string { return decodeString(hex.DecodeString(s)) },
+		"sha1sum": func(s string) string {
+			sum := sha1.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha256sum": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"sha512sum": func(s string) string {
+			sum := sha512.Sum512([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"adler32sum": func(s string) string { return strconv.FormatUint(uint64(adler32.Checksum([]byte(s))), 10) },
+		"hmacSha256": func(key, message string) string {
+			mac := hmac.New(sha256.New, []byte(key))
+			mac.Write([]byte(message))
+			return hex.EncodeToString(mac.Sum(nil))
+		},
+
+		// JSON
+		"toJson":           func(v interface{}) string { out, _ := toJSON(v, "", true); return out },
+		"mustToJson":       func(v interface{}) (string, error) { return toJSON(v, "", true) },
+		"toPrettyJson":     func(v interface{}) string { out, _ := toJSON(v, "  ", true); return out },
+		"mustToPrettyJson": func(v interface{}) (string, error) { return toJSON(v, "  ", true) },
+		"toRawJson":        func(v interface{}) string { out, _ := toJSON(v, "", false); return out },
+		"mustToRawJson":    func(v interface{}) (string, error) { return toJSON(v, "", false) },
+		"fromJson":         func(s string) interface{} { v, _ := fromJSON(s); return v },
+		"mustFromJson":     fromJSON,
+
+		// Integer math; arguments may be of any numeric type or numeric strings
+		"add1": func(a interface{}) int64 { return toInt64(a) + 1 },
+		"sub":  func(a, b interface{}) int64 { return toInt64(a) - toInt64(b) },
+		"mul": func(a interface{}, values ...interface{}) int64 {
+			product := toInt64(a)
+			for _, v := range values {
+				product *= toInt64(v)
+			}
+			return product
+		},
+		"div": func(a, b interface{}) (int64, error) {
+			if toInt64(b) == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return toInt64(a) / toInt64(b), nil
+		},
+		"mod": func(a, b interface{}) (int64, error) {
+			if toInt64(b) == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return toInt64(a) % toInt64(b), nil
+		},
+		"max": func(a interface{}, values ...interface{}) int64 {
+			result := toInt64(a)
+			for _, v := range values {
+				if n := toInt64(v); n > result {
+					result = n
+				}
+			}
+			return result
+		},
+		"min": func(a interface{}, values ...interface{}) int64 {
+			result := toInt64(a)
+			for _, v := range values {
+				if n := toInt64(v); n < result {
+					result = n
+				}
+			}
+			return result
+		},
+
+		// Floating point math
+		"addf": func(values ...interface{}) float64 {
+			sum := 0.0
+			for _, v := range values {
+				sum += toFloat64(v)
+			}
+			return sum
+		},
+		"subf": func(a interface{}, values ...interface{}) float64 {
+			result := toFloat64(a)
+			for _, v := range values {
+				result -= toFloat64(v)
+			}
+			return result
+		},
+		"mulf": func(a interface{}, values ...interface{}) float64 {
+			result := toFloat64(a)
+			for _, v := range values {
+				result *= toFloat64(v)
+			}
+			return result
+		},
+		"divf": func(a interface{}, values ...interface{}) (float64, error) {
+			result := toFloat64(a)
+			for _, v := range values {
+				divisor := toFloat64(v)
+				if divisor == 0 {
+					return 0, errors.New("division by zero")
+				}
+				result /= divisor
+			}
+			return result, nil
+		},
+		"maxf": func(a interface{}, values ...interface{}) float64 {
+			result := toFloat64(a)
+			for _, v := range values {
+				result = math.Max(result, toFloat64(v))
+			}
+			return result
+		},
+		"minf": func(a interface{}, values ...interface{}) float64 {
+			result := toFloat64(a)
+			for _, v := range values {
+				result = math.Min(result, toFloat64(v))
+			}
+			return result
+		},
+		"floor": func(a interface{}) float64 { return math.Floor(toFloat64(a)) },
+		"ceil":  func(a interface{}) float64 { return math.Ceil(toFloat64(a)) },
+		"round": round,
+
+		// Number formatting
+		"formatNumber": func(precision, value interface{}) string {
+			return formatNumber(toFloat64(value), int(toInt64(precision)))
+		},
+		"formatCurrency": formatCurrency,
+
+		// Type conversion
+		"atoi":    func(s string) int { n, _ := strconv.Atoi(strings.TrimSpace(s)); return n },
+		"int":     func(v interface{}) int { return int(toInt64(v)) },
+		"int64":   toInt64,
+		"float64": toFloat64,
+
+		// Integer sequences
+		"until": until,
+		"untilStep": func(start, stop, step interface{}) ([]int, error) {
+			return untilStep(int(toInt64(start)), int(toInt64(stop)), int(toInt64(step)))
+		},
+		"seq": seq,
+
+		// Lists
+		"list":   func(values ...interface{}) []interface{} { return values },
+		"append": func(list interface{}, v interface{}) []interface{} { return append(listCopy(list), v) },
+		"push":   func(list interface{}, v interface{}) []interface{} { return append(listCopy(list), v) },
+		"prepend": func(list interface{}, v interface{}) []interface{} {
+			return append([]interface{}{v}, listCopy(list)...)
+		},
+		"concat": func(lists ...interface{}) []interface{} {
+			var result []interface{}
+			for _, list := range lists {
+				result = append(result, listCopy(list)...)
+			}
+			return result
+		},
+		"rest": func(list interface{}) []interface{} {
+			items := listCopy(list)
+			if len(items) == 0 {
+				return items
+			}
+			return items[1:]
+		},
+		"initial": func(list interface{}) []interface{} {
+			items := listCopy(list)
+			if len(items) == 0 {
+				return items
+			}
+			return items[:len(items)-1]
+		},
+		"uniq": func(list interface{}) []interface{} {
+			result := []interface{}{}
+			for _, item := range listCopy(list) {
+				if !inList(result, item) {
+					result = append(result, item)
+				}
+			}
+			return result
+		},
+		"without": func(list interface{}, omit ...interface{}) []interface{} {
+			result := []interface{}{}
+			for _, item := range listCopy(list) {
+				if !inList(omit, item) {
+					result = append(result, item)
+				}
+			}
+			return result
+		},
+		"has": func(needle, list interface{}) bool { return inList(listCopy(list), needle) },
+		"compact": func(list interface{}) []interface{} {
+			result := []interface{}{}
+			for _, item := range listCopy(list) {
+				if !isEmpty(item) {
+					result = append(result, item)
+				}
+			}
+			return result
+		},
+		"sortAlpha": func(list interface{}) []string {
+			sorted := toStrings(list)
+			sort.Strings(sorted)
+			return sorted
+		},
+		"chunk": func(size, list interface{}) ([][]interface{}, error) {
+			n := int(toInt64(size))
+			if n <= 0 {
+				return nil, errors.New("chunk size must be positive")
+			}
+			items := listCopy(list)
+			chunks := [][]interface{}{}
+			for len(items) > 0 {
+				end := n
+				if end > len(items) {
+					end = len(items)
+				}
+				chunks = append(chunks, items[:end:end])
+				items = items[end:]
+			}
+			return chunks, nil
+		},
+
+		// Dictionaries; these return new dictionaries and do not change their arguments
+		"dict": func(pairs ...interface{}) map[string]interface{} {
+			d := make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i+1 < len(pairs); i += 2 {
+				d[strval(pairs[i])] = pairs[i+1]
+			}
+			return d
+		},
+		"get": func(d map[string]interface{}, key string) interface{} {
+			if v, ok := d[key]; ok {
+				return v
+			}
+			return ""
+		},
+		"hasKey": func(d map[string]interface{}, key string) bool { _, ok := d[key]; return ok },
+		"keys": func(dicts ...map[string]interface{}) []string {
+			var keys []string
+			for _, d := range dicts {
+				for key := range d {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			return keys
+		},
+		"values": func(d map[string]interface{}) []interface{} {
+			keys := make([]string, 0, len(d))
+			for key := range d {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				values[i] = d[key]
+			}
+			return values
+		},
+		"pick": func(d map[string]interface{}, keys ...string) map[string]interface{} {
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				if v, ok := d[key]; ok {
+					result[key] = v
+				}
+			}
+			return result
+		},
+		"omit": func(d map[string]interface{}, keys ...string) map[string]interface{} {
+			omitted := make(map[string]bool, len(keys))
+			for _, key := range keys {
+				omitted[key] = true
+			}
+			result := make(map[string]interface{})
+			for key, v := range d {
+				if !omitted[key] {
+					result[key] = v
+				}
+			}
+			return result
+		},
+		"pluck": func(key string, dicts ...map[string]interface{}) []interface{} {
+			result := []interface{}{}
+			for _, d := range dicts {
+				if v, ok := d[key]; ok {
+					result = append(result, v)
+				}
+			}
+			return result
+		},
+		"dig":      dig,
+		"deepCopy": deepCopy,
+
+		// Dates. A date is a time.Time, Unix seconds or an RFC 3339 string.
+		"date": func(layout string, date interface{}) string { return formatTime(layout, date, nil) },
+		"dateInZone": func(layout string, date interface{}, zone string) string {
+			return formatTime(layout, date, loadLocation(zone))
+		},
+		"htmlDate":       func(date interface{}) string { return formatTime("2006-01-02", date, nil) },
+		"htmlDateInZone": func(date interface{}, zone string) string { return formatTime("2006-01-02", date, loadLocation(zone)) },
+		"toDate":         func(layout, s string) time.Time { t, _ := toDate(layout, s); return t },
+		"mustToDate":     toDate,
+		"dateModify":     func(modifier string, date interface{}) time.Time { t, _ := dateModify(modifier, date); return t },
+		"mustDateModify": dateModify,
+		"unixEpoch": func(date interface{}) string {
+			t, _ := toTime(date)
+			return strconv.FormatInt(t.Unix(), 10)
+		},
+		"duration": func(seconds interface{}) string {
+			return (time.Duration(toInt64(seconds)) * time.Second).String()
+		},
+		"durationRound": durationRound,
+
+		// Flow control
+		"empty": isEmpty,
+		"ternary": func(whenTrue, whenFalse interface{}, condition bool) interface{} {
+			if condition {
+				return whenTrue
+			}
+			return whenFalse
+		},
+		"coalesce": coalesce,
+		"all": func(values ...interface{}) bool {
+			for _, v := range values {
+				if isEmpty(v) {
+					return false
+				}
+			}
+			return true
+		},
+		"any": func(values ...interface{}) bool {
+			for _, v := range values {
+				if !isEmpty(v) {
+					return true
+				}
+			}
+			return false
+		},
+		"fail": func(message string) (string, error) { return "", errors.New(message) },
+		"required": func(message string, v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return nil, errors.New(message)
+			}
+			return v, nil
+		},
+
+		// Types
+		"typeOf":    func(v interface{}) string { return fmt.Sprintf("%T", v) },
+		"typeIs":    func(target string, v interface{}) bool { return fmt.Sprintf("%T", v) == target },
+		"kindOf":    kindOf,
+		"kindIs":    func(target string, v interface{}) bool { return kindOf(v) == target },
+		"deepEqual": reflect.DeepEqual,
+
+		// Slash-separated paths
+		"base":  path.Base,
+		"dir":   path.Dir,
+		"ext":   path.Ext,
+		"clean": path.Clean,
+		"isAbs": path.IsAbs,
+	}
+}
+
+// getSprigFullModeFunctions returns the Sprig functions that read the clock, random
+// numbers or the environment, or that change their arguments. They are only available
+// in full mode.
+func getSprigFullModeFunctions() template.FuncMap {
+	return template.FuncMap{
+		"ago": func(date interface{}) string {
+			t, _ := toTime(date)
+			return time.Since(t).Round(time.Second).String()
+		},
+		"uuidv4":       uuidv4,
+		"randAlphaNum": func(count interface{}) (string, error) { return randomString(count, alphaNumeric) },
+		"randAlpha":    func(count interface{}) (string, error) { return randomString(count, alphaNumeric[10:]) },
+		"randNumeric":  func(count interface{}) (string, error) { return randomString(count, alphaNumeric[:10]) },
+		"randAscii":    func(count interface{}) (string, error) { return randomString(count, printableASCII) },
+		"randInt": func(min, max interface{}) (int64, error) {
+			low, high := toInt64(min), toInt64(max)
+			if high <= low {
+				return 0, errors.New("randInt: max must be greater than min")
+			}
+			n, err := rand.Int(rand.Reader, big.NewInt(high-low))
+			if err != nil {
+				return 0, err
+			}
+			return low + n.Int64(), nil
+		},
+		"shuffle": func(s string) string {
+			runes := []rune(s)
+			mathrand.Shuffle(len(runes), func(i, j int) { runes[i], runes[j] = runes[j], runes[i] })
+			return string(runes)
+		},
+		"env":       os.Getenv,
+		"expandenv": os.ExpandEnv,
+		"set": func(d map[string]interface{}, key string, v interface{}) map[string]interface{} {
+			d[key] = v
+			return d
+		},
+		"unset": func(d map[string]interface{}, key string) map[string]interface{} {
+			delete(d, key)
+			return d
+		},
+		"merge": func(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+			for _, src := range srcs {
+				mergeInto(dst, src, false)
+			}
+			return dst
+		},
+		"mergeOverwrite": func(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+			for _, src := range srcs {
+				mergeInto(dst, src, true)
+			}
+			return dst
+		},
+	}
+}
+
+// strval converts a value to a string as Sprig does
+func strval(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case error:
+		return s.Error()
+	case fmt.Stringer:
+		return s.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func toStrings(list interface{}) []string {
+	items, ok := listItems(list)
+	if !ok {
+		if list == nil {
+			return []string{}
+		}
+		return []string{strval(list)}
+	}
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = strval(item)
+	}
+	return result
+}
+
+// toInt64 converts numbers, numeric strings and booleans; anything else is 0
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64); err == nil {
+			return i
+		}
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return int64(f)
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float())
+	}
+	return 0
+}
+
+// toFloat64 converts numbers, numeric strings and booleans; anything else is 0
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return 0
+}
+
+func untitle(s string) string {
+	previousSpace := true
+	return strings.Map(func(r rune) rune {
+		if previousSpace && !unicode.IsSpace(r) {
+			previousSpace = false
+			return unicode.ToLower(r)
+		}
+		previousSpace = unicode.IsSpace(r)
+		return r
+	}, s)
+}
+
+func repeat(count interface{}, s string) (string, error) {
+	n := int(toInt64(count))
+	if n <= 0 {
+		return "", nil
+	}
+	if len(s) > 0 && n > maxGeneratedSize/len(s) {
+		return "", fmt.Errorf("repeat: result would be larger than %d bytes", maxGeneratedSize)
+	}
+	return strings.Repeat(s, n), nil
+}
+
+// substr returns the characters from start up to end; a negative start begins at the
+// first character and a negative end runs to the last one
+func substr(start, end interface{}, s string) string {
+	runes := []rune(s)
+	from, to := int(toInt64(start)), int(toInt64(end))
+	if from < 0 {
+		from = 0
+	}
+	if to < 0 || to > len(runes) {
+		to = len(runes)
+	}
+	if from > to {
+		return ""
+	}
+	return string(runes[from:to])
+}
+
+// trunc keeps the first count characters, or the last ones when count is negative
+func trunc(count interface{}, s string) string {
+	runes := []rune(s)
+	n := int(toInt64(count))
+	switch {
+	case n < 0 && len(runes)+n > 0:
+		return string(runes[len(runes)+n:])
+	case n >= 0 && len(runes) > n:
+		return string(runes[:n])
+	}
+	return s
+}
+
+// abbrev truncates a string to width characters with an ellipsis
+func abbrev(width interface{}, s string) string {
+	runes := []rune(s)
+	n := int(toInt64(width))
+	if n < 4 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func initials(s string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(s) {
+		for _, r := range word {
+			b.WriteRune(r)
+			break
+		}
+	}
+	return b.String()
+}
+
+// wrapWith wraps words into lines of at most width characters, separated by sep.
+// Words longer than width are not broken.
+func wrapWith(width interface{}, sep, s string) string {
+	n := int(toInt64(width))
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= n:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, sep)
+}
+
+// indent indents every line of s with spaces
+func indent(spaces interface{}, s string) string {
+	n := int(toInt64(spaces))
+	if n <= 0 {
+		return s
+	}
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func quoteAll(quote string, values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if quote == `"` {
+			parts = append(parts, strconv.Quote(strval(v)))
+		} else {
+			parts = append(parts, quote+strval(v)+quote)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitWords splits an identifier such as firstName, first_name or HTTPServer into
+// its words
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || nextLower {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
+
+// camelcase joins the words of s with each word capitalized: http_server is HttpServer
+func camelcase(s string) string {
+	var b strings.Builder
+	for _, word := range splitWords(s) {
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+// decodeString returns decoded bytes as a string, or the error message as Sprig does
+func decodeString(decoded []byte, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return string(decoded)
+}
+
+func regexMatch(re, s string) (bool, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(s), nil
+}
+
+func regexFind(re, s string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.FindString(s), nil
+}
+
+func regexFindAll(re, s string, n interface{}) ([]string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return []string{}, err
+	}
+	return r.FindAllString(s, int(toInt64(n))), nil
+}
+
+func regexReplaceAll(re, s, repl string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
+
+func regexReplaceAllLiteral(re, s, repl string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllLiteralString(s, repl), nil
+}
+
+func regexSplit(re, s string, n interface{}) ([]string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return []string{}, err
+	}
+	return r.Split(s, int(toInt64(n))), nil
+}
+
+// toJSON encodes a value, indented when indent is set. Raw JSON does not escape <, >
+// and &.
+func toJSON(v interface{}, indent string, escapeHTML bool) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(escapeHTML)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// round rounds to precision decimal places, rounding up from roundOn (0.5 by default)
+func round(value, precision interface{}, roundOn ...float64) float64 {
+	on := 0.5
+	if len(roundOn) > 0 {
+		on = roundOn[0]
+	}
+	pow := math.Pow(10, float64(toInt64(precision)))
+	digit := pow * toFloat64(value)
+	_, fraction := math.Modf(digit)
+	if math.Abs(fraction) >= on {
+		return math.Copysign(math.Ceil(math.Abs(digit)), digit) / pow
+	}
+	return math.Copysign(math.Floor(math.Abs(digit)), digit) / pow
+}
+
+// numberFormat holds the separators of a locale and where it places currency symbols
+type numberFormat struct {
+	decimal       string
+	group         string
+	minGrouping   int    // digits the highest group needs before it is separated
+	space         string // between a currency symbol and the amount
+	currencyAfter bool   // 1.234,50 € instead of €1,234.50
+	currencySpace bool   // always separate the symbol, as in € 1.234,50
+}
+
+// defaultNumberFormat formats numbers as 1,234.5 and amounts as $1,234.50
+var defaultNumberFormat = numberFormat{decimal: ".", group: ",", minGrouping: 1, space: " "}
+
+// formatNumber formats a number with precision decimals and comma thousands separators
+func formatNumber(value float64, precision int) string {
+	return defaultNumberFormat.format(value, precision)
+}
+
+// format formats a number with precision decimals and the separators of the format
+func (f numberFormat) format(value float64, precision int) string {
+	if precision < 0 {
+		precision = 0
+	}
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', precision, 64)
+	integer, fraction, hasFraction := strings.Cut(formatted, ".")
+
+	var b strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		b.WriteByte('-')
+	}
+	grouped := len(integer) >= 3+f.minGrouping
+	for i, digit := range integer {
+		if grouped && i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFraction {
+		b.WriteString(f.decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// currencies are the symbols and decimals of common currencies
+var currencies = map[string]struct {
+	symbol   string
+	decimals int
+}{
+	"USD": {"$", 2}, "EUR": {"€", 2}, "GBP": {"£", 2}, "JPY": {"¥", 0}, "CNY": {"¥", 2},
+	"INR": {"₹", 2}, "AUD": {"A$", 2}, "CAD": {"CA$", 2}, "CHF": {"CHF", 2}, "KRW": {"₩", 0},
+}
+
+// formatCurrency formats an amount in a currency given by its ISO 4217 code, such as
+// $1,234.50 for USD; currencies without a known symbol are prefixed with their code
+func formatCurrency(code string, amount interface{}) (string, error) {
+	return defaultNumberFormat.formatCurrency(code, amount)
+}
+
+// formatCurrency formats an amount with the currency symbol placed as the format
+// places it. A symbol that ends in a letter, such as CHF, is always separated.
+func (f numberFormat) formatCurrency(code string, amount interface{}) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "", fmt.Errorf("formatCurrency: missing currency code")
+	}
+	currency, ok := currencies[code]
+	if !ok {
+		currency.symbol, currency.decimals = code, 2
+	}
+	formatted := f.format(toFloat64(amount), currency.decimals)
+	sign := ""
+	if strings.HasPrefix(formatted, "-") {
+		sign, formatted = "-", formatted[1:]
+	}
+
+	symbol := []rune(currency.symbol)
+	if f.currencyAfter {
+		if f.currencySpace || unicode.IsLetter(symbol[0]) {
+			return sign + formatted + f.space + currency.symbol, nil
+		}
+		return sign + formatted + currency.symbol, nil
+	}
+	if f.currencySpace || unicode.IsLetter(symbol[len(symbol)-1]) {
+		return sign + currency.symbol + f.space + formatted, nil
+	}
+	return sign + currency.symbol + formatted, nil
+}
+
+// until returns the integers from 0 up to count, or down to it when count is negative
+func until(count interface{}) ([]int, error) {
+	n := int(toInt64(count))
+	if n < 0 {
+		return untilStep(0, n, -1)
+	}
+	return untilStep(0, n, 1)
+}
+
+// untilStep returns the integers from start up to stop, not including stop
+func untilStep(start, stop, step int) ([]int, error) {
+	if step == 0 {
+		return []int{}, nil
+	}
+	count := 0
+	if step > 0 && stop > start || step < 0 && stop < start {
+		count = (stop - start + step - sign(step)) / step
+	}
+	if count > maxGeneratedItems {
+		return nil, fmt.Errorf("sequence would have more than %d items", maxGeneratedItems)
+	}
+	result := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, start+i*step)
+	}
+	return result, nil
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// seq works like the seq command: seq 5, seq 2 5 and seq 0 2 10 count to the last
+// number inclusively
+func seq(params ...interface{}) (string, error) {
+	start, step, end := 1, 1, 0
+	switch len(params) {
+	case 1:
+		end = int(toInt64(params[0]))
+	case 2:
+		start, end = int(toInt64(params[0])), int(toInt64(params[1]))
+		if end < start {
+			step = -1
+		}
+	case 3:
+		start, step, end = int(toInt64(params[0])), int(toInt64(params[1])), int(toInt64(params[2]))
+	default:
+		return "", fmt.Errorf("seq takes 1 to 3 arguments, got %d", len(params))
+	}
+	if step == 0 || (end-start)*step < 0 {
+		return "", nil
+	}
+	numbers, err := untilStep(start, end+sign(step), step)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(fmt.Sprint(numbers), "[]"), nil
+}
+
+// listCopy returns the elements of a list in a new slice
+func listCopy(list interface{}) []interface{} {
+	items, ok := listItems(list)
+	if !ok {
+		return []interface{}{}
+	}
+	return append([]interface{}{}, items...)
+}
+
+func inList(list []interface{}, needle interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmpty reports whether a value is nil, false, zero or an empty string or collection
+func isEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Struct:
+		if t, ok := v.(time.Time); ok {
+			return t.IsZero()
+		}
+		return false
+	}
+	return rv.IsZero()
+}
+
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// dig looks up nested keys: dig "user" "name" "anonymous" .data returns the default
+// when a key is missing
+func dig(params ...interface{}) (interface{}, error) {
+	if len(params) < 3 {
+		return nil, errors.New("dig needs at least one key, a default and a dictionary")
+	}
+	value := params[len(params)-1]
+	fallback := params[len(params)-2]
+	for _, key := range params[:len(params)-2] {
+		next, ok := lookupKey(value, strval(key))
+		if !ok {
+			return fallback, nil
+		}
+		value = next
+	}
+	return value, nil
+}
+
+// deepCopy copies maps and lists, so changes to the copy do not affect the original
+func deepCopy(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = deepCopy(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = deepCopy(item)
+		}
+		return result
+	}
+	return v
+}
+
+// mergeInto merges nested dictionaries; keys already in dst are kept unless overwrite
+// is set
+func mergeInto(dst, src map[string]interface{}, overwrite bool) {
+	for key, value := range src {
+		existing, ok := dst[key]
+		dstMap, dstIsMap := existing.(map[string]interface{})
+		srcMap, srcIsMap := value.(map[string]interface{})
+		switch {
+		case ok && dstIsMap && srcIsMap:
+			mergeInto(dstMap, srcMap, overwrite)
+		case !ok || overwrite:
+			dst[key] = value
+		}
+	}
+}
+
+// toTime converts a time.Time, Unix seconds or an RFC 3339 string
+func toTime(date interface{}) (time.Time, bool) {
+	switch d := date.(type) {
+	case time.Time:
+		return d, true
+	case *time.Time:
+		if d != nil {
+			return *d, true
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, d); err == nil {
+			return t, true
+		}
+	case json.Number:
+		return time.Unix(toInt64(d.String()), 0), true
+	case int, int32, int64, float64:
+		return time.Unix(toInt64(d), 0), true
+	}
+	return time.Time{}, false
+}
+
+// formatTime formats a date with a Go layout, in loc if it is set. A value that is
+// not a date formats as an empty string.
+func formatTime(layout string, date interface{}, loc *time.Location) string {
+	t, ok := toTime(date)
+	if !ok {
+		return ""
+	}
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(layout)
+}
+
+// loadLocation returns a time zone by its IANA name, or UTC if it is not known
+func loadLocation(zone string) *time.Location {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func toDate(layout, s string) (time.Time, error) {
+	return time.ParseInLocation(layout, s, time.Local)
+}
+
+// dateModify adds a duration such as -1.5h or 30m to a date
+func dateModify(modifier string, date interface{}) (time.Time, error) {
+	t, ok := toTime(date)
+	if !ok {
+		return time.Time{}, fmt.Errorf("dateModify: %v is not a date", date)
+	}
+	d, err := time.ParseDuration(modifier)
+	if err != nil {
+		return t, err
+	}
+	return t.Add(d), nil
+}
+
+// durationRound rounds a duration, given as a duration string or seconds, to its
+// largest unit: 2h, 3d, 1y
+func durationRound(duration interface{}) string {
+	var d time.Duration
+	if s, ok := duration.(string); ok {
+		d, _ = time.ParseDuration(s)
+	} else {
+		d = time.Duration(toInt64(duration)) * time.Second
+	}
+	if d < 0 {
+		d = -d
+	}
+	const (
+		day   = 24 * time.Hour
+		month = 30 * day
+		year  = 365 * day
+	)
+	switch {
+	case d >= year:
+		return fmt.Sprintf("%dy", d/year)
+	case d >= month:
+		return fmt.Sprintf("%dmo", d/month)
+	case d >= day:
+		return fmt.Sprintf("%dd", d/day)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d >= time.Second:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return "0s"
+}
+
+func kindOf(v interface{}) string {
+	if v == nil {
+		return "invalid"
+	}
+	return reflect.ValueOf(v).Kind().String()
+}
+
+func uuidv4() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+const (
+	alphaNumeric   = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	printableASCII = "!\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~ "
+)
+
+// randomString returns count characters chosen from chars with a secure random source
+func randomString(count interface{}, chars string) (string, error) {
+	n := int(toInt64(count))
+	if n > maxGeneratedSize {
+		return "", fmt.Errorf("random string would be longer than %d characters", maxGeneratedSize)
+	}
+	result := make([]byte, 0, n)
+	limit := big.NewInt(int64(len(chars)))
+	for i := 0; i < n; i++ {
+		index, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, chars[index.Int64()])
+	}
+	return string(result), nil
+}
@@ -0,0 +1,151 @@
+package templateengine
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// executeFunctions renders a template with the functions of safe or full mode
+func executeFunctions(safeMode bool, content string, data interface{}) (string, error) {
+	a := &Activity{settings: &Settings{EnableSafeMode: safeMode}}
+	tmpl, err := template.New("test").Funcs(a.templateFunctions()).Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	return b.String(), err
+}
+
+func TestSprigFunctions(t *testing.T) {
+	// Template data comes from JSON, so numbers are float64
+	data := map[string]interface{}{
+		"n":      2.0,
+		"when":   "2024-03-15T13:30:00Z",
+		"unix":   1710509400.0,
+		"list":   []interface{}{"b", "a", "b", "c"},
+		"order":  map[string]interface{}{"id": 1.0, "tag": "<a>"},
+		"nested": map[string]interface{}{"user": map[string]interface{}{"name": "Jo"}},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"Trimming", `{{trimPrefix "Mr. " "Mr. Smith"}}|{{trimSuffix ".txt" "a.txt"}}|{{trimAll "-" "--a--"}}|{{nospace " a b "}}`, "Smith|a|a|ab"},
+		{"Truncation", `{{"hello world" | trunc 5}} {{trunc -5 "hello world"}} {{abbrev 8 "hello world"}} {{substr 1 3 "héllo"}}`, "hello world hello... él"},
+		{"Case", `{{snakecase "firstName"}} {{kebabcase "HTTPServer"}} {{camelcase "http_server"}} {{swapcase "aB"}} {{untitle "Hello World"}} {{initials "Jane Doe"}}`, "first_name http-server HttpServer Ab hello world JD"},
+		{"Layout", `{{wrap 10 "the quick brown fox jumps"}}|{{indent 2 "a\nb"}}|{{"x" | nindent 2}}|{{repeat 3 "ab"}}`, "the quick\nbrown fox\njumps|  a\n  b|\n  x|ababab"},
+		{"Quoting", `{{quote "a" 1}} {{squote "b"}} {{cat "a" nil 2}}`, `"a" "1" 'b' a 2`},
+		{"Plural", `{{plural "item" "items" 1}} {{plural "item" "items" .n}}`, "item items"},
+		{"Regular expressions", `{{regexMatch "^[a-z]+@" "jane@x.com"}} {{regexFind "\\d+" "ab12c"}} {{regexFindAll "\\d" "a1b2c3" 2}} {{regexReplaceAll "(\\d+)" "a1b22" "<$1>"}} {{regexReplaceAllLiteral "\\d" "a1" "$1"}} {{regexSplit "\\s*,\\s*" "a , b,c" -1}} {{regexQuoteMeta "1.5"}}`, `true 12 [1 2] a<1>b<22> a$1 [a b c] 1\.5`},
+		{"Encoding", `{{b64enc "hello"}} {{b64dec "aGVsbG8="}} {{b32enc "hi"}} {{hexenc "hi"}} {{hexdec "6869"}} {{b64dec "%%"}}`, "aGVsbG8= hello NBUQ==== 6869 hi illegal base64 data at input byte 0"},
+		{"Hashing", `{{sha256sum "abc"}} {{adler32sum "abc"}}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad 38600999"},
+		{"HMAC", `{{hmacSha256 "key" "The quick brown fox jumps over the lazy dog"}}`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"JSON", `{{toJson .order}} {{toRawJson .order}} {{(fromJson "{\"a\":[1,2]}").a}}`, `{"id":1,"tag":"\u003ca\u003e"} {"id":1,"tag":"<a>"} [1 2]`},
+		{"Pretty JSON", `{{toPrettyJson (dict "a" 1)}}`, "{\n  \"a\": 1\n}"},
+		{"Integer math", `{{add1 .n}} {{sub 10 .n}} {{mul 2 3 .n}} {{div 7 2}} {{mod 7 .n}} {{max 1 .n 3}} {{min 4 .n}}`, "3 8 12 3 1 3 2"},
+		{"Float math", `{{addf 1.5 .n}} {{subf 5 .n 0.5}} {{mulf 1.5 .n}} {{divf 1 4}} {{round 3.14159 2}} {{round -2.5 0}} {{floor 2.7}} {{ceil 2.1}} {{maxf 1 2.5}} {{minf 1 2.5}}`, "3.5 2.5 3 0.25 3.14 -3 2 3 2.5 1"},
+		{"Number formatting", `{{formatNumber 2 1234567.891}} {{formatNumber 0 -999.6}} {{formatCurrency "USD" -1234.5}} {{formatCurrency "eur" .n}} {{formatCurrency "JPY" 1234.4}} {{formatCurrency "SEK" 10}}`, "1,234,567.89 -1,000 -$1,234.50 €2.00 ¥1,234 SEK 10.00"},
+		{"Conversion", `{{atoi "42"}} {{int "7"}} {{int64 .n}} {{float64 "1.5"}} {{toString 3}} {{toStrings .list}}`, "42 7 2 1.5 3 [b a b c]"},
+		{"Sequences", `{{until 3}} {{until -2}} {{untilStep 10 0 -3}} {{seq 3}} {{seq 5 3}} {{seq 0 5 12}}`, "[0 1 2] [0 -1] [10 7 4 1] 1 2 3 5 4 3 0 5 10"},
+		{"Lists", `{{uniq .list}} {{without .list "b"}} {{has "a" .list}} {{sortAlpha .list}} {{rest .list}} {{initial .list}} {{len (append .list "d")}} {{prepend .list "z"}} {{concat (list 1) .list}} {{chunk 3 .list}} {{compact (list 0 "a" "" nil false)}}`, "[b a c] [a c] true [a b b c] [a b c] [b a b] 5 [z b a b c] [1 b a b c] [[b a b] [c]] [a]"},
+		{"Lists are not changed", `{{$l := append .list "d"}}{{.list}}`, "[b a b c]"},
+		{"Dictionaries", `{{$d := dict "name" "Jane" "age" 30}}{{get $d "name"}} {{get $d "x"}}|{{hasKey $d "age"}} {{keys $d}} {{values $d}} {{pick $d "name"}} {{omit $d "name"}} {{pluck "name" $d (dict "name" "Bob")}}`, "Jane |true [age name] [30 Jane] map[name:Jane] map[age:30] [Jane Bob]"},
+		{"Dig", `{{dig "user" "name" "anonymous" .nested}} {{dig "user" "email" "none" .nested}}`, "Jo none"},
+		{"Dates", `{{date "2006-01-02 15:04" .when}} {{dateInZone "15:04 MST" .when "UTC"}} {{htmlDateInZone .unix "UTC"}} {{(toDate "2006-01-02" "2024-03-15").Year}} {{dateModify "48h" .when | htmlDate}} {{unixEpoch .when}}`, "2024-03-15 13:30 13:30 UTC 2024-03-15 2024 2024-03-17 1710509400"},
+		{"Durations", `{{duration 95}} {{durationRound "50h"}} {{durationRound 7776000}} {{durationRound "-90s"}}`, "1m35s 2d 3mo 1m"},
+		{"Flow control", `{{empty ""}} {{empty 0}} {{empty .list}} {{ternary "yes" "no" true}} {{false | ternary "yes" "no" | upper}} {{coalesce "" nil "x"}} {{all 1 "a"}} {{any 0 ""}}`, "true true false yes NO x true false"},
+		{"Types", `{{typeOf 1}} {{typeIs "float64" .n}} {{kindOf .list}} {{kindIs "map" .nested}} {{deepEqual (list 1) (list 1)}}`, "int true slice true true"},
+		{"Paths", `{{base "a/b/c.txt"}} {{ext "c.tar.gz"}} {{dir "a/b/c"}} {{clean "a//b/../c"}} {{isAbs "/a"}}`, "c.txt .gz a/b a/c true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every function in these tests is side-effect free, so safe mode has it
+			result, err := executeFunctions(true, tt.template, data)
+			if err != nil {
+				t.Fatalf("Template failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSprigFunctionErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{mustRegexMatch "(" "x"}}`, "missing closing )"},
+		{`{{mustToDate "2006-01-02" "15 March"}}`, "cannot parse"},
+		{`{{div 1 0}}`, "division by zero"},
+		{`{{repeat 2000000 "ab"}}`, "repeat: result would be larger than 1048576 bytes"},
+		{`{{until 20000}}`, "sequence would have more than 10000 items"},
+		{`{{fail "bad input"}}`, "bad input"},
+		{`{{required "name is required" .name}}`, "name is required"},
+		{`{{formatCurrency "" 10}}`, "formatCurrency: missing currency code"},
+	}
+	for _, tt := range tests {
+		_, err := executeFunctions(true, tt.template, map[string]interface{}{})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.template, tt.expected, err)
+		}
+	}
+	// Without must, an invalid expression does not fail the render
+	if result, err := executeFunctions(true, `{{regexMatch "(" "x"}}`, nil); err != nil || result != "false" {
+		t.Errorf("Expected false, got %q, %v", result, err)
+	}
+}
+
+func TestSprigFullModeFunctions(t *testing.T) {
+	template := `{{uuidv4}} {{randAlphaNum 8}} {{randNumeric 4}} {{randInt 5 6}} {{len (shuffle "abc")}}`
+	if _, err := executeFunctions(true, template, nil); err == nil || !strings.Contains(err.Error(), `function "uuidv4" not defined`) {
+		t.Errorf("Expected full mode functions to be unavailable in safe mode, got %v", err)
+	}
+
+	result, err := executeFunctions(false, template, nil)
+	if err != nil {
+		t.Fatalf("Template failed: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12} [0-9a-zA-Z]{8} [0-9]{4} 5 3$`).MatchString(result) {
+		t.Errorf("Unexpected result %q", result)
+	}
+
+	data := map[string]interface{}{"config": map[string]interface{}{"a": 1, "nested": map[string]interface{}{"x": 1}}}
+	result, err = executeFunctions(false, `{{$_ := set .config "b" 2}}{{$_ := unset .config "a"}}{{$m := merge .config (dict "b" 3 "nested" (dict "x" 2 "y" 2))}}{{toJson .config}}`, data)
+	if expected := `{"b":2,"nested":{"x":1,"y":2}}`; err != nil || result != expected {
+		t.Errorf("Expected %q, got %q, %v", expected, result, err)
+	}
+	t.Setenv("TEMPLATE_ENGINE_TEST", "value")
+	if result, _ := executeFunctions(false, `{{env "TEMPLATE_ENGINE_TEST"}} {{expandenv "$TEMPLATE_ENGINE_TEST!"}} {{ago .when | len | lt 0}}`, map[string]interface{}{"when": "2024-03-15T13:30:00Z"}); result != "value value! true" {
+		t.Errorf("Unexpected result %q", result)
+	}
+}
+
+func TestSprigFunctionsInHandlebars(t *testing.T) {
+	act, err := New(test.NewActivityInitContext(&Settings{TemplateEngine: "handlebars", EnableSafeMode: true}, nil))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", `{{{b64enc name}}} {{formatCurrency "USD" total}} {{#each (uniq tags)}}{{upper this}} {{/each}}{{date}}`)
+	tc.SetInput("templateData", map[string]interface{}{"name": "Jane", "total": 1234.5, "tags": []interface{}{"a", "a", "b"}, "date": "today"})
+	tc.SetInput("enableFormatting", false)
+	act.Eval(tc)
+	if result := tc.GetOutput("result"); result != "SmFuZQ== $1,234.50 A B today" {
+		t.Errorf("Unexpected result %q: %v", result, tc.GetOutput("error"))
+	}
+	// A field named like a helper is reported when the data has it
+	expected := []string{"name", "total", "tags", "date"}
+	if used := tc.GetOutput("variablesUsed"); !strings.EqualFold(strings.Join(used.([]string), ","), strings.Join(expected, ",")) {
+		t.Errorf("Expected variables %v, got %v", expected, used)
+	}
+}
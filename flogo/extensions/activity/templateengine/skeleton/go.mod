@@ -2,7 +2,10 @@ module github.com/mpandav-tibco/flogo-custom-extensions/activity/templateengine
 
 go 1.20
 
-require github.com/project-flogo/core v1.6.13
+require (
+	github.com/project-flogo/core v1.6.13
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/araddon/dateparse v0.0.0-20210429162001-6b43995a97de // indirect
@@ -0,0 +1,1074 @@
+package templateengine
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type hbNodeKind int
+
+const (
+	hbText hbNodeKind = iota
+	hbMustache
+	hbBlock
+	hbPartial
+)
+
+// hbNode is a node of a parsed Handlebars template
+type hbNode struct {
+	kind        hbNodeKind
+	text        string
+	expr        *hbExpr
+	escape      bool
+	inverted    bool // {{^name}} block
+	program     []*hbNode
+	inverse     []*hbNode
+	blockParams []string
+	partial     string  // static partial name
+	dynamic     *hbExpr // subexpression returning the partial name
+	indent      string
+	line        int
+}
+
+// hbExpr is a helper call, a path or a literal. A subexpression is a helper call in
+// parentheses used as a parameter.
+type hbExpr struct {
+	path    *hbPath
+	literal interface{}
+	params  []*hbExpr
+	hash    map[string]*hbExpr
+	sub     bool
+	dynamic *hbExpr // subexpression naming a dynamic partial
+}
+
+// hbPath is a reference to a value such as name, person.name, this, ../name or @index
+type hbPath struct {
+	original string
+	data     bool
+	depth    int
+	scoped   bool
+	parts    []string
+}
+
+// hbTemplate is a parsed Handlebars template. It is not modified by rendering, so one
+// parsed template can be rendered concurrently.
+type hbTemplate struct {
+	nodes []*hbNode
+}
+
+// simpleName returns the name of a path that can refer to a helper: a single
+// identifier that is not a data variable, not scoped and not in a parent context
+func (p *hbPath) simpleName() (string, bool) {
+	if p == nil || p.data || p.scoped || p.depth > 0 || len(p.parts) != 1 {
+		return "", false
+	}
+	return p.parts[0], true
+}
+
+// hbTag is a scanned {{...}} tag
+type hbTag struct {
+	sigil      byte
+	content    string
+	stripLeft  bool
+	stripRight bool
+	end        int
+}
+
+// parseHandlebars parses a Handlebars template: expressions, helpers with parameters,
+// hash arguments and subexpressions, block helpers with {{else}} chains and block
+// parameters, partials, comments, whitespace control and escaped mustaches
+func parseHandlebars(src string) (*hbTemplate, error) {
+	type frame struct {
+		node      *hbNode
+		inInverse bool
+		chained   bool
+	}
+	root := &hbNode{kind: hbBlock}
+	stack := []*frame{{node: root}}
+	pos := 0
+	stripNext := false
+
+	appendNode := func(node *hbNode) {
+		top := stack[len(stack)-1]
+		if top.inInverse {
+			top.node.inverse = append(top.node.inverse, node)
+		} else {
+			top.node.program = append(top.node.program, node)
+		}
+	}
+	appendText := func(text string) {
+		if stripNext {
+			text = strings.TrimLeft(text, " \t\r\n")
+			stripNext = false
+		}
+		if text != "" {
+			appendNode(&hbNode{kind: hbText, text: text})
+		}
+	}
+
+	for {
+		idx := strings.Index(src[pos:], "{{")
+		if idx < 0 {
+			appendText(src[pos:])
+			break
+		}
+		start := pos + idx
+		line := strings.Count(src[:start], "\n") + 1
+
+		// \{{ is a literal mustache; \\{{ is a literal backslash before a mustache
+		if start > pos && src[start-1] == '\\' {
+			if start-1 > pos && src[start-2] == '\\' {
+				appendText(src[pos : start-1])
+				pos = start
+			} else {
+				end := strings.Index(src[start:], "}}")
+				if end < 0 {
+					end = len(src)
+				} else {
+					end += start + 2
+				}
+				appendText(src[pos:start-1] + src[start:end])
+				pos = end
+				continue
+			}
+		}
+
+		tag, err := scanHandlebarsTag(src, start)
+		if err != nil {
+			return nil, fmt.Errorf("%v at line %d", err, line)
+		}
+
+		isElse := false
+		if tag.sigil == '^' && strings.TrimSpace(tag.content) == "" {
+			isElse = true
+			tag.content = ""
+		} else if tag.sigil == 0 {
+			if fields := strings.Fields(tag.content); len(fields) > 0 && fields[0] == "else" {
+				isElse = true
+				tag.content = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag.content), "else"))
+			}
+		}
+
+		text := src[pos:start]
+		end := tag.end
+		indent := ""
+		standalone := isElse
+		switch tag.sigil {
+		case '#', '^', '/', '>', '!':
+			standalone = true
+		}
+		if standalone && !tag.stripLeft && !tag.stripRight {
+			if lineStart, lineEnd, ok := standaloneLine(src, pos, start, end); ok {
+				indent = src[lineStart:start]
+				text = src[pos:lineStart]
+				end = lineEnd
+			}
+		}
+		if tag.stripLeft {
+			text = strings.TrimRight(text, " \t\r\n")
+		}
+		appendText(text)
+		pos = end
+		stripNext = tag.stripRight
+
+		switch {
+		case tag.sigil == '!':
+
+		case isElse:
+			top := stack[len(stack)-1]
+			if len(stack) == 1 || top.inInverse {
+				return nil, fmt.Errorf("unexpected {{else}} at line %d", line)
+			}
+			top.inInverse = true
+			if tag.content != "" {
+				expr, blockParams, err := parseHandlebarsExpr(tag.content, true)
+				if err != nil {
+					return nil, fmt.Errorf("%v at line %d", err, line)
+				}
+				node := &hbNode{kind: hbBlock, expr: expr, blockParams: blockParams, line: line}
+				appendNode(node)
+				stack = append(stack, &frame{node: node, chained: true})
+			}
+
+		case tag.sigil == '#' || tag.sigil == '^':
+			expr, blockParams, err := parseHandlebarsExpr(tag.content, true)
+			if err != nil {
+				return nil, fmt.Errorf("%v at line %d", err, line)
+			}
+			if expr.path == nil {
+				return nil, fmt.Errorf("invalid block %q at line %d", tag.content, line)
+			}
+			node := &hbNode{kind: hbBlock, expr: expr, blockParams: blockParams, inverted: tag.sigil == '^', line: line}
+			appendNode(node)
+			stack = append(stack, &frame{node: node})
+
+		case tag.sigil == '/':
+			name := strings.TrimSpace(tag.content)
+			for len(stack) > 1 && stack[len(stack)-1].chained {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected closing tag %q at line %d", name, line)
+			}
+			open := stack[len(stack)-1].node
+			if open.expr.path.original != name {
+				return nil, fmt.Errorf("closing tag %q at line %d does not match block %q opened at line %d", name, line, open.expr.path.original, open.line)
+			}
+			stack = stack[:len(stack)-1]
+
+		case tag.sigil == '>':
+			expr, _, err := parseHandlebarsExpr(tag.content, false)
+			if err != nil {
+				return nil, fmt.Errorf("%v at line %d", err, line)
+			}
+			node := &hbNode{kind: hbPartial, expr: expr, indent: indent, line: line}
+			switch {
+			case expr.dynamic != nil:
+				node.dynamic = expr.dynamic
+			case expr.path != nil:
+				node.partial = expr.path.original
+			default:
+				node.partial = formatTemplateValue(expr.literal)
+			}
+			if len(expr.params) > 1 {
+				return nil, fmt.Errorf("partial %q takes at most one context at line %d", node.partial, line)
+			}
+			appendNode(node)
+
+		default:
+			expr, _, err := parseHandlebarsExpr(tag.content, false)
+			if err != nil {
+				return nil, fmt.Errorf("%v at line %d", err, line)
+			}
+			if expr.dynamic != nil {
+				return nil, fmt.Errorf("subexpression %q is not a value at line %d", tag.content, line)
+			}
+			appendNode(&hbNode{kind: hbMustache, expr: expr, escape: tag.sigil == 0, line: line})
+		}
+	}
+
+	for len(stack) > 1 && stack[len(stack)-1].chained {
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) > 1 {
+		open := stack[len(stack)-1].node
+		return nil, fmt.Errorf("unclosed block %q opened at line %d", open.expr.path.original, open.line)
+	}
+	return &hbTemplate{nodes: root.program}, nil
+}
+
+// scanHandlebarsTag reads the tag starting at src[start], which begins with {{
+func scanHandlebarsTag(src string, start int) (*hbTag, error) {
+	tag := &hbTag{}
+	i := start + 2
+	if i < len(src) && src[i] == '~' {
+		tag.stripLeft = true
+		i++
+	}
+	if i >= len(src) {
+		return nil, fmt.Errorf("unclosed tag")
+	}
+
+	closeAt := func(closing string) error {
+		j := strings.Index(src[i:], closing)
+		if j < 0 {
+			return fmt.Errorf("unclosed tag")
+		}
+		tag.content = src[i : i+j]
+		tag.end = i + j + len(closing)
+		if strings.HasSuffix(tag.content, "~") {
+			tag.stripRight = true
+			tag.content = tag.content[:len(tag.content)-1]
+		}
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(src[i:], "!--"):
+		tag.sigil = '!'
+		i += 3
+		if err := closeAt("--}}"); err != nil {
+			j := strings.Index(src[i:], "--~}}")
+			if j < 0 {
+				return nil, err
+			}
+			tag.content, tag.end, tag.stripRight = src[i:i+j], i+j+5, true
+		}
+		return tag, nil
+	case src[i] == '{':
+		tag.sigil = '{'
+		i++
+		j := strings.Index(src[i:], "}")
+		if j < 0 {
+			return nil, fmt.Errorf("unclosed tag")
+		}
+		rest := src[i+j:]
+		switch {
+		case strings.HasPrefix(rest, "}}}"):
+			tag.end = i + j + 3
+		case strings.HasPrefix(rest, "}~}}"):
+			tag.end, tag.stripRight = i+j+4, true
+		default:
+			return nil, fmt.Errorf("unclosed triple-stash")
+		}
+		tag.content = src[i : i+j]
+		return tag, nil
+	}
+
+	switch src[i] {
+	case '#':
+		if i+1 < len(src) && (src[i+1] == '>' || src[i+1] == '*') {
+			return nil, fmt.Errorf("partial blocks and decorators are not supported")
+		}
+		fallthrough
+	case '!', '^', '/', '>', '&':
+		tag.sigil = src[i]
+		i++
+	}
+	if err := closeAt("}}"); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+var hbNumberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// hbToken is a token of a tag's content. kind is 'w' for words, 's' for string
+// literals, or one of ( ) = | for punctuation.
+type hbToken struct {
+	kind byte
+	text string
+}
+
+func lexHandlebarsExpr(content string) ([]hbToken, error) {
+	var tokens []hbToken
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == '=' || c == '|':
+			tokens = append(tokens, hbToken{kind: c})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(content) && content[j] != c; j++ {
+				if content[j] == '\\' && j+1 < len(content) && content[j+1] == c {
+					j++
+				}
+				b.WriteByte(content[j])
+			}
+			if j >= len(content) {
+				return nil, fmt.Errorf("unterminated string in %q", content)
+			}
+			tokens = append(tokens, hbToken{kind: 's', text: b.String()})
+			i = j + 1
+		default:
+			j := i
+			for j < len(content) && !strings.ContainsRune(" \t\r\n()=|\"'", rune(content[j])) {
+				if content[j] == '[' {
+					k := strings.IndexByte(content[j:], ']')
+					if k < 0 {
+						return nil, fmt.Errorf("unterminated [ in %q", content)
+					}
+					j += k
+				}
+				j++
+			}
+			tokens = append(tokens, hbToken{kind: 'w', text: content[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// parseHandlebarsExpr parses the content of a tag into an expression. Blocks may end
+// with block parameters: as |item index|.
+func parseHandlebarsExpr(content string, allowBlockParams bool) (*hbExpr, []string, error) {
+	tokens, err := lexHandlebarsExpr(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("empty expression")
+	}
+	p := &hbExprParser{tokens: tokens}
+	expr, err := p.parseCall()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blockParams []string
+	if p.isBlockParams() {
+		if !allowBlockParams {
+			return nil, nil, fmt.Errorf("block parameters are only allowed on blocks")
+		}
+		p.pos += 2
+		for p.pos < len(p.tokens) && p.tokens[p.pos].kind == 'w' {
+			blockParams = append(blockParams, p.tokens[p.pos].text)
+			p.pos++
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != '|' || len(blockParams) == 0 {
+			return nil, nil, fmt.Errorf("invalid block parameters in %q", content)
+		}
+		p.pos++
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], content)
+	}
+	return expr, blockParams, nil
+}
+
+type hbExprParser struct {
+	tokens []hbToken
+	pos    int
+}
+
+func (p *hbExprParser) isBlockParams() bool {
+	return p.pos+1 < len(p.tokens) && p.tokens[p.pos].kind == 'w' && p.tokens[p.pos].text == "as" && p.tokens[p.pos+1].kind == '|'
+}
+
+// parseCall parses a value followed by its parameters and hash arguments
+func (p *hbExprParser) parseCall() (*hbExpr, error) {
+	expr, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if expr.sub {
+		expr = &hbExpr{dynamic: expr}
+	}
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		if token.kind == ')' || p.isBlockParams() {
+			break
+		}
+		if token.kind == 'w' && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == '=' {
+			p.pos += 2
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if expr.hash == nil {
+				expr.hash = make(map[string]*hbExpr)
+			}
+			expr.hash[token.text] = value
+			continue
+		}
+		if len(expr.hash) > 0 {
+			return nil, fmt.Errorf("parameter %q after hash arguments", token.text)
+		}
+		param, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr.params = append(expr.params, param)
+	}
+	if (len(expr.params) > 0 || len(expr.hash) > 0) && expr.path == nil && expr.dynamic == nil {
+		return nil, fmt.Errorf("%v is not a helper", expr.literal)
+	}
+	return expr, nil
+}
+
+func (p *hbExprParser) parseValue() (*hbExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case '(':
+		expr, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != ')' {
+			return nil, fmt.Errorf("unclosed subexpression")
+		}
+		p.pos++
+		if expr.path == nil {
+			return nil, fmt.Errorf("invalid subexpression")
+		}
+		expr.sub = true
+		return expr, nil
+	case 's':
+		return &hbExpr{literal: token.text}, nil
+	case 'w':
+		switch token.text {
+		case "true":
+			return &hbExpr{literal: true}, nil
+		case "false":
+			return &hbExpr{literal: false}, nil
+		case "null", "undefined":
+			return &hbExpr{}, nil
+		}
+		if hbNumberPattern.MatchString(token.text) {
+			f, _ := strconv.ParseFloat(token.text, 64)
+			return &hbExpr{literal: f}, nil
+		}
+		path, err := parseHandlebarsPath(token.text)
+		if err != nil {
+			return nil, err
+		}
+		return &hbExpr{path: path}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
+
+// String returns the token as written
+func (t hbToken) String() string {
+	if t.kind == 'w' || t.kind == 's' {
+		return t.text
+	}
+	return string(t.kind)
+}
+
+// parseHandlebarsPath splits a path into its parts. Segments are separated by . or /
+// and may be written as [literal] to include any character.
+func parseHandlebarsPath(text string) (*hbPath, error) {
+	path := &hbPath{original: text}
+	rest := text
+	if strings.HasPrefix(rest, "@") {
+		path.data = true
+		rest = rest[1:]
+	}
+	for {
+		if rest == ".." || strings.HasPrefix(rest, "../") {
+			path.depth++
+			rest = strings.TrimPrefix(rest[2:], "/")
+			continue
+		}
+		break
+	}
+	switch {
+	case rest == "." || rest == "this":
+		path.scoped = true
+		rest = ""
+	case strings.HasPrefix(rest, "./"):
+		path.scoped = true
+		rest = rest[2:]
+	case strings.HasPrefix(rest, "this.") || strings.HasPrefix(rest, "this/"):
+		path.scoped = true
+		rest = rest[5:]
+	}
+
+	for rest != "" {
+		var part string
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			part, rest = rest[1:end], rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, "./")
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+			if part == "" {
+				return nil, fmt.Errorf("invalid path %q", text)
+			}
+		}
+		path.parts = append(path.parts, part)
+		if rest != "" {
+			if rest[0] != '.' && rest[0] != '/' || len(rest) == 1 {
+				return nil, fmt.Errorf("invalid path %q", text)
+			}
+			rest = rest[1:]
+		}
+	}
+	if path.data && len(path.parts) == 0 {
+		return nil, fmt.Errorf("invalid path %q", text)
+	}
+	return path, nil
+}
+
+var hbEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#x27;", "`", "&#x60;", "=", "&#x3D;")
+
+// hbContext is one level of the context stack: the context value, the data variables
+// (@index, @key, ...) and the block parameters of the block that pushed it
+type hbContext struct {
+	value  interface{}
+	data   map[string]interface{}
+	params map[string]interface{}
+}
+
+// hbRenderer holds the state of one render, so parsed templates stay immutable
+type hbRenderer struct {
+	helpers  map[string]interface{}
+	partials partialSource
+	strict   bool
+	escape   bool
+	root     interface{}
+	parsed   map[string]*hbTemplate
+	depth    int
+	sandbox  *sandbox
+}
+
+// renderHandlebars renders a parsed template with data. helpers are functions callable
+// from the template. In strict mode interpolating a missing value is an error. With
+// escape set, {{value}} is HTML-escaped; plain text is rendered without it. The render
+// stops when it exceeds a limit of the sandbox, which may be nil.
+func renderHandlebars(tmpl *hbTemplate, data interface{}, helpers map[string]interface{}, partials partialSource, strict, escape bool, sb *sandbox) (string, error) {
+	r := &hbRenderer{
+		helpers:  helpers,
+		partials: partials,
+		strict:   strict,
+		escape:   escape,
+		root:     data,
+		parsed:   make(map[string]*hbTemplate),
+		sandbox:  sb,
+	}
+	if err := sb.enter(); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := r.render(&b, tmpl.nodes, []*hbContext{{value: data}}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (r *hbRenderer) render(b *strings.Builder, nodes []*hbNode, stack []*hbContext) error {
+	for _, node := range nodes {
+		if err := r.sandbox.checkOutput(b.Len()); err != nil {
+			return err
+		}
+		var err error
+		switch node.kind {
+		case hbText:
+			b.WriteString(node.text)
+		case hbMustache:
+			err = r.renderMustache(b, node, stack)
+		case hbBlock:
+			err = r.renderBlock(b, node, stack)
+		case hbPartial:
+			err = r.renderPartial(b, node, stack)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.sandbox.checkOutput(b.Len())
+}
+
+func (r *hbRenderer) renderMustache(b *strings.Builder, node *hbNode, stack []*hbContext) error {
+	value, found, err := r.evalMustache(node.expr, stack)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", node.line, err)
+	}
+	if !found && r.strict {
+		return fmt.Errorf("line %d: missing variable %q", node.line, node.expr.path.original)
+	}
+	text := formatTemplateValue(value)
+	if node.escape && r.escape {
+		text = hbEscaper.Replace(text)
+	}
+	b.WriteString(text)
+	return nil
+}
+
+// evalMustache evaluates the expression of a {{...}} tag. A name without parameters is
+// a value when the context has it and a helper call otherwise.
+func (r *hbRenderer) evalMustache(expr *hbExpr, stack []*hbContext) (interface{}, bool, error) {
+	if expr.path == nil {
+		return expr.literal, true, nil
+	}
+	if len(expr.params) > 0 || len(expr.hash) > 0 {
+		value, err := r.callHelper(expr, stack)
+		return value, true, err
+	}
+	value, found := r.resolve(expr.path, stack)
+	if found {
+		return value, true, nil
+	}
+	if name, ok := expr.path.simpleName(); ok {
+		if _, ok := r.helpers[name]; ok {
+			value, err := r.callHelper(expr, stack)
+			return value, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// eval evaluates a helper parameter
+func (r *hbRenderer) eval(expr *hbExpr, stack []*hbContext) (interface{}, error) {
+	switch {
+	case expr.sub:
+		return r.callHelper(expr, stack)
+	case expr.path != nil:
+		value, _ := r.resolve(expr.path, stack)
+		return value, nil
+	}
+	return expr.literal, nil
+}
+
+// callHelper calls the helper named by the expression with its evaluated parameters
+func (r *hbRenderer) callHelper(expr *hbExpr, stack []*hbContext) (interface{}, error) {
+	name, _ := expr.path.simpleName()
+	args := make([]interface{}, len(expr.params))
+	for i, param := range expr.params {
+		value, err := r.eval(param, stack)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	switch name {
+	case "lookup":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("helper \"lookup\" takes 2 arguments, got %d", len(args))
+		}
+		value, _ := lookupKey(args[0], formatTemplateValue(args[1]))
+		return value, nil
+	case "if", "unless", "each", "with":
+		return nil, fmt.Errorf("helper %q must be used as a block", name)
+	}
+
+	helper, ok := r.helpers[name]
+	if !ok || name == "" {
+		return nil, fmt.Errorf("missing helper %q", expr.path.original)
+	}
+	if len(expr.hash) > 0 {
+		if name != translateFunc {
+			return nil, fmt.Errorf("helper %q does not take hash arguments", name)
+		}
+		// {{t "greeting" name=customer.name}} passes the parameters of the message
+		params := make(map[string]interface{}, len(expr.hash))
+		for key, param := range expr.hash {
+			value, err := r.eval(param, stack)
+			if err != nil {
+				return nil, err
+			}
+			params[key] = value
+		}
+		args = append(args, params)
+	}
+	return callTemplateFunction(name, helper, args)
+}
+
+// callTemplateFunction calls a template function with arguments converted to its
+// parameter types. Functions may return a value, or a value and an error.
+func callTemplateFunction(name string, fn interface{}, args []interface{}) (result interface{}, err error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("helper %q is not a function", name)
+	}
+
+	numIn := ft.NumIn()
+	if ft.IsVariadic() && len(args) < numIn-1 || !ft.IsVariadic() && len(args) != numIn {
+		return nil, fmt.Errorf("helper %q takes %d arguments, got %d", name, numIn, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if ft.IsVariadic() && i >= numIn-1 {
+			argType = ft.In(numIn - 1).Elem()
+		} else {
+			argType = ft.In(i)
+		}
+		value, err := convertTemplateArg(arg, argType)
+		if err != nil {
+			return nil, fmt.Errorf("helper %q argument %d: %v", name, i+1, err)
+		}
+		in[i] = value
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("helper %q failed: %v", name, p)
+		}
+	}()
+	out := fv.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, fmt.Errorf("helper %q failed: %v", name, out[1].Interface())
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// convertTemplateArg converts a template value to a function parameter type. Numbers
+// convert between numeric types, as JSON data holds all numbers as float64.
+func convertTemplateArg(arg interface{}, argType reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(argType), nil
+	}
+	value := reflect.ValueOf(arg)
+	if value.Type().AssignableTo(argType) {
+		return value, nil
+	}
+	if isNumberKind(value.Kind()) && isNumberKind(argType.Kind()) {
+		return value.Convert(argType), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", arg, argType)
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// resolve looks up a path in the context stack. A simple name is looked up in the
+// block parameters, then in the current context and then in the enclosing contexts,
+// as Mustache does.
+func (r *hbRenderer) resolve(path *hbPath, stack []*hbContext) (interface{}, bool) {
+	index := len(stack) - 1 - path.depth
+	if index < 0 {
+		index = 0
+	}
+
+	var value interface{}
+	found := false
+	parts := path.parts
+	switch {
+	case path.data:
+		if parts[0] == "root" {
+			value, found = r.root, true
+		} else {
+			value, found = stack[index].data[parts[0]]
+		}
+		parts = parts[1:]
+	case path.scoped || path.depth > 0 || len(parts) == 0:
+		value, found = stack[index].value, true
+	default:
+		for i := index; i >= 0 && !found; i-- {
+			value, found = stack[i].params[parts[0]]
+		}
+		for i := index; i >= 0 && !found; i-- {
+			value, found = lookupKey(stack[i].value, parts[0])
+		}
+		parts = parts[1:]
+	}
+
+	for _, part := range parts {
+		if !found {
+			break
+		}
+		value, found = lookupKey(value, part)
+	}
+	return value, found
+}
+
+// hbFalsey reports whether a value fails {{#if}}: like a hidden Mustache section, but
+// zero is true with includeZero=true
+func hbFalsey(value interface{}, includeZero bool) bool {
+	if includeZero && value != nil && isNumberKind(reflect.ValueOf(value).Kind()) {
+		return false
+	}
+	return isFalsey(value)
+}
+
+// push returns a new context stack with a context for value on top. The new context
+// inherits the data variables of the current one.
+func push(stack []*hbContext, value interface{}, data map[string]interface{}, blockParams []string, params ...interface{}) []*hbContext {
+	ctx := &hbContext{value: value, data: stack[len(stack)-1].data}
+	if len(data) > 0 {
+		ctx.data = make(map[string]interface{}, len(ctx.data)+len(data))
+		for k, v := range stack[len(stack)-1].data {
+			ctx.data[k] = v
+		}
+		for k, v := range data {
+			ctx.data[k] = v
+		}
+	}
+	for i, name := range blockParams {
+		if i < len(params) {
+			if ctx.params == nil {
+				ctx.params = make(map[string]interface{}, len(blockParams))
+			}
+			ctx.params[name] = params[i]
+		}
+	}
+	return append(stack[:len(stack):len(stack)], ctx)
+}
+
+func (r *hbRenderer) renderBlock(b *strings.Builder, node *hbNode, stack []*hbContext) error {
+	expr := node.expr
+	name, isSimple := expr.path.simpleName()
+
+	param := func() (interface{}, error) {
+		if len(expr.params) != 1 {
+			return nil, fmt.Errorf("line %d: helper %q takes 1 argument, got %d", node.line, name, len(expr.params))
+		}
+		return r.eval(expr.params[0], stack)
+	}
+
+	if isSimple && !node.inverted {
+		switch name {
+		case "if", "unless":
+			value, err := param()
+			if err != nil {
+				return err
+			}
+			includeZero := false
+			if option, ok := expr.hash["includeZero"]; ok {
+				value, err := r.eval(option, stack)
+				if err != nil {
+					return err
+				}
+				includeZero = value == true
+			}
+			if hbFalsey(value, includeZero) == (name == "unless") {
+				return r.render(b, node.program, stack)
+			}
+			return r.render(b, node.inverse, stack)
+
+		case "with":
+			value, err := param()
+			if err != nil {
+				return err
+			}
+			if isFalsey(value) {
+				return r.render(b, node.inverse, stack)
+			}
+			return r.render(b, node.program, push(stack, value, nil, node.blockParams, value))
+
+		case "each":
+			value, err := param()
+			if err != nil {
+				return err
+			}
+			return r.renderEach(b, node, stack, value)
+		}
+
+		if _, ok := r.helpers[name]; ok && len(expr.params) > 0 {
+			return fmt.Errorf("line %d: helper %q cannot be used as a block", node.line, name)
+		}
+	}
+	if len(expr.params) > 0 || len(expr.hash) > 0 {
+		return fmt.Errorf("line %d: missing block helper %q", node.line, expr.path.original)
+	}
+
+	// A block without a helper is a Mustache section
+	value, _ := r.resolve(expr.path, stack)
+	if node.inverted {
+		if isFalsey(value) {
+			return r.render(b, node.program, stack)
+		}
+		return r.render(b, node.inverse, stack)
+	}
+	switch {
+	case isFalsey(value):
+		return r.render(b, node.inverse, stack)
+	case value == true:
+		return r.render(b, node.program, stack)
+	}
+	if _, ok := listItems(value); ok {
+		return r.renderEach(b, node, stack, value)
+	}
+	return r.render(b, node.program, push(stack, value, nil, node.blockParams, value))
+}
+
+// renderEach renders the block for each element of a list or each entry of a map, in
+// key order, setting @index, @key, @first and @last
+func (r *hbRenderer) renderEach(b *strings.Builder, node *hbNode, stack []*hbContext, value interface{}) error {
+	rendered := false
+	if items, ok := listItems(value); ok {
+		for i, item := range items {
+			if err := r.sandbox.loop(); err != nil {
+				return err
+			}
+			data := map[string]interface{}{"index": i, "key": i, "first": i == 0, "last": i == len(items)-1}
+			if err := r.render(b, node.program, push(stack, item, data, node.blockParams, item, i)); err != nil {
+				return err
+			}
+			rendered = true
+		}
+	} else if keys, ok := sortedKeys(value); ok {
+		for i, key := range keys {
+			if err := r.sandbox.loop(); err != nil {
+				return err
+			}
+			item, _ := lookupKey(value, key)
+			data := map[string]interface{}{"index": i, "key": key, "first": i == 0, "last": i == len(keys)-1}
+			if err := r.render(b, node.program, push(stack, item, data, node.blockParams, item, key)); err != nil {
+				return err
+			}
+			rendered = true
+		}
+	}
+	if !rendered {
+		return r.render(b, node.inverse, stack)
+	}
+	return nil
+}
+
+func (r *hbRenderer) renderPartial(b *strings.Builder, node *hbNode, stack []*hbContext) error {
+	name := node.partial
+	if node.dynamic != nil {
+		value, err := r.callHelper(node.dynamic, stack)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", node.line, err)
+		}
+		name = formatTemplateValue(value)
+	}
+
+	key := name + "\x00" + node.indent
+	tmpl, ok := r.parsed[key]
+	if !ok {
+		var content string
+		found := false
+		if r.partials != nil {
+			var err error
+			if content, found, err = r.partials(name); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("line %d: partial %q not found", node.line, name)
+		}
+
+		var err error
+		if tmpl, err = parseHandlebars(indentLines(content, node.indent)); err != nil {
+			return fmt.Errorf("partial %q: %v", name, err)
+		}
+		r.parsed[key] = tmpl
+	}
+
+	if len(node.expr.params) > 0 {
+		value, err := r.eval(node.expr.params[0], stack)
+		if err != nil {
+			return err
+		}
+		stack = push(stack, value, nil, nil)
+	}
+	if len(node.expr.hash) > 0 {
+		context := make(map[string]interface{})
+		if current, ok := stack[len(stack)-1].value.(map[string]interface{}); ok {
+			for k, v := range current {
+				context[k] = v
+			}
+		}
+		for k, expr := range node.expr.hash {
+			value, err := r.eval(expr, stack)
+			if err != nil {
+				return err
+			}
+			context[k] = value
+		}
+		stack = push(stack, context, nil, nil)
+	}
+
+	if r.depth >= maxPartialDepth {
+		return fmt.Errorf("partial %q: nesting exceeds %d levels", name, maxPartialDepth)
+	}
+	if err := r.sandbox.enter(); err != nil {
+		return err
+	}
+	r.depth++
+	defer func() {
+		r.depth--
+		r.sandbox.exit()
+	}()
+	return r.render(b, tmpl.nodes, stack)
+}
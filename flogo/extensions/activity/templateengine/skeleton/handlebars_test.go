@@ -0,0 +1,242 @@
+package templateengine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// handlebarsSpecExceptions are Mustache spec tests where Handlebars differs by design,
+// as in Handlebars.js: it has no set delimiter tag and a missing partial is an error
+var handlebarsSpecExceptions = map[string]bool{
+	"partials/Failed Lookup": true,
+}
+
+func TestHandlebarsMustacheSpec(t *testing.T) {
+	for module, tests := range loadMustacheSpec(t) {
+		for _, tt := range tests {
+			tt := tt
+			t.Run(module+"/"+tt.Name, func(t *testing.T) {
+				if module == "delimiters" || strings.Contains(tt.Template, "{{=") || handlebarsSpecExceptions[module+"/"+tt.Name] {
+					t.Skip("Not supported by Handlebars")
+				}
+				tmpl, err := parseHandlebars(tt.Template)
+				if err != nil {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				result, err := renderHandlebars(tmpl, tt.Data, nil, mapPartials(tt.Partials), false, true, nil)
+				if err != nil {
+					t.Fatalf("Render failed: %v", err)
+				}
+				if result != tt.Expected {
+					t.Errorf("%s\nTemplate: %q\nExpected: %q\nGot:      %q", tt.Desc, tt.Template, tt.Expected, result)
+				}
+			})
+		}
+	}
+}
+
+func TestHandlebarsTemplates(t *testing.T) {
+	activity := &Activity{}
+	helpers := activity.getTemplateFunctions()
+
+	data := map[string]interface{}{
+		"name":    "Jane",
+		"title":   "<b>Welcome</b>",
+		"vip":     true,
+		"count":   float64(0),
+		"company": map[string]interface{}{"name": "Acme"},
+		"items": []interface{}{
+			map[string]interface{}{"name": "Widget", "price": 9.5, "qty": float64(2)},
+			map[string]interface{}{"name": "Gadget", "price": float64(20), "qty": float64(1)},
+		},
+		"tags":   []interface{}{"new", "sale"},
+		"prices": map[string]interface{}{"b": 2, "a": 1},
+		"empty":  []interface{}{},
+	}
+	partials := map[string]string{
+		"item":   "{{name}} x{{qty}}",
+		"footer": "-- {{sender}}",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"Escaping", "{{title}} {{{title}}} {{&title}}", "&lt;b&gt;Welcome&lt;/b&gt; <b>Welcome</b> <b>Welcome</b>"},
+		{"Each with this", "{{#each tags}}[{{this}}]{{/each}}", "[new][sale]"},
+		{"Each data variables", "{{#each items}}{{@index}}:{{name}}{{#if @first}}*{{/if}}{{#unless @last}}, {{/unless}}{{/each}}", "0:Widget*, 1:Gadget"},
+		{"Each over map", "{{#each prices}}{{@key}}={{this}};{{/each}}", "a=1;b=2;"},
+		{"Each else", "{{#each empty}}x{{else}}none{{/each}}", "none"},
+		{"Block params", "{{#each items as |item i|}}{{i}}.{{item.name}} {{/each}}", "0.Widget 1.Gadget "},
+		{"Parent context", "{{#each items}}{{name}}@{{../company.name}} {{/each}}", "Widget@Acme Gadget@Acme "},
+		{"Root data", "{{#with company}}{{@root.name}}/{{name}}{{/with}}", "Jane/Acme"},
+		{"If else chain", "{{#if count}}count{{else if vip}}vip{{else}}none{{/if}}", "vip"},
+		{"If includeZero", "{{#if count includeZero=true}}zero{{/if}}", "zero"},
+		{"Inverse section", "{{^empty}}no items{{/empty}}{{#empty}}x{{else}} (really){{/empty}}", "no items (really)"},
+		{"With else", "{{#with missing}}x{{else}}no company{{/with}}", "no company"},
+		{"Helpers", "{{upper name}} {{add 1 2}} {{join tags \", \"}}", "JANE 3 new, sale"},
+		{"Subexpressions", "{{upper (join tags \"-\")}} {{lookup company \"name\"}}", "NEW-SALE Acme"},
+		{"Subexpression conditions", "{{#if (eq name \"Jane\")}}match{{/if}}", "match"},
+		{"Partials", "{{#each items}}{{> item}};{{/each}} {{> footer sender=\"Team\"}}", "Widget x2;Gadget x1; -- Team"},
+		{"Partial context", "{{> item items.[1]}}", "Gadget x1"},
+		{"Whitespace control", "<ul>\n  {{~#each tags~}}\n  <li>{{this}}</li>\n  {{~/each~}}\n</ul>", "<ul><li>new</li><li>sale</li></ul>"},
+		{"Comments", "a{{!-- {{not}} rendered --}}b{{! short }}c", "abc"},
+		{"Escaped mustache", `\{{name}} {{name}}`, "{{name}} Jane"},
+		{"Standalone blocks", "{{#each tags}}\n- {{this}}\n{{/each}}\n", "- new\n- sale\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseHandlebars(tt.template)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			result, err := renderHandlebars(tmpl, data, helpers, mapPartials(partials), false, true, nil)
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHandlebarsErrors(t *testing.T) {
+	activity := &Activity{}
+	helpers := activity.getEssentialTemplateFunctions()
+
+	parseErrors := []struct {
+		template string
+		expected string
+	}{
+		{"{{#if vip}}\nyes", `unclosed block "if" opened at line 1`},
+		{"{{#if vip}}\n{{/each}}", `closing tag "each" at line 2 does not match block "if" opened at line 1`},
+		{"{{else}}", "unexpected {{else}} at line 1"},
+		{"{{name", "unclosed tag at line 1"},
+		{"{{{name}}", "unclosed triple-stash at line 1"},
+		{`{{upper "name}}`, "unterminated string"},
+		{"{{upper (lower name}}", "unclosed subexpression"},
+		{"{{#> layout}}{{/layout}}", "partial blocks and decorators are not supported"},
+	}
+	for _, tt := range parseErrors {
+		t.Run("Parse "+tt.template, func(t *testing.T) {
+			_, err := parseHandlebars(tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	renderErrors := []struct {
+		template string
+		strict   bool
+		expected string
+	}{
+		{"{{unknown name}}", false, `missing helper "unknown"`},
+		{"{{truncate 5 name}}", false, `missing helper "truncate"`},
+		{"{{upper 1}}", false, `helper "upper" argument 1: cannot use float64 as string`},
+		{"{{upper}}", false, `helper "upper" takes 1 arguments, got 0`},
+		{"{{> missing}}", false, `partial "missing" not found`},
+		{"Hello\n{{name}}", true, `line 2: missing variable "name"`},
+	}
+	for _, tt := range renderErrors {
+		t.Run("Render "+tt.template, func(t *testing.T) {
+			tmpl, err := parseHandlebars(tt.template)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			_, err = renderHandlebars(tmpl, map[string]interface{}{}, helpers, nil, tt.strict, true, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestActivityTemplateEngines(t *testing.T) {
+	templateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templateDir, "signature.tmpl"), []byte("-- {{company}}"), 0644); err != nil {
+		t.Fatalf("Failed to write partial: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"name":    "<Jane>",
+		"company": "Acme",
+		"items":   []interface{}{"Widget", "Gadget"},
+	}
+
+	tests := []struct {
+		engine        string
+		template      string
+		expected      string
+		variablesUsed []string
+	}{
+		{
+			engine:        "handlebars",
+			template:      "Hi {{name}}! {{#each items}}{{upper this}}{{#unless @last}}, {{/unless}}{{/each}} {{> signature}}",
+			expected:      "Hi &lt;Jane&gt;! WIDGET, GADGET -- Acme",
+			variablesUsed: []string{"name", "items"},
+		},
+		{
+			engine:        "mustache",
+			template:      "Hi {{{name}}}! {{#items}}[{{.}}]{{/items}}{{^missing}} {{> signature}}{{/missing}}",
+			expected:      "Hi <Jane>! [Widget][Gadget] -- Acme",
+			variablesUsed: []string{"name", "items", "missing"},
+		},
+		{
+			engine:        "handlebars-basic",
+			template:      "Hi {{name}}",
+			expected:      "Hi <Jane>",
+			variablesUsed: []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			act, err := New(test.NewActivityInitContext(&Settings{
+				TemplateEngine:    tt.engine,
+				TemplateCacheSize: 10,
+				TemplatePath:      templateDir,
+			}, nil))
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+
+			tc := test.NewActivityContext(act.Metadata())
+			tc.SetInput("template", tt.template)
+			tc.SetInput("templateData", data)
+			if _, err := act.Eval(tc); err != nil {
+				t.Fatalf("Eval failed: %v", err)
+			}
+
+			if success, _ := tc.GetOutput("success").(bool); !success {
+				t.Fatalf("Template processing failed: %v", tc.GetOutput("error"))
+			}
+			if result := tc.GetOutput("result"); result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if variables := tc.GetOutput("variablesUsed"); !reflect.DeepEqual(variables, tt.variablesUsed) {
+				t.Errorf("Expected variables %v, got %v", tt.variablesUsed, variables)
+			}
+		})
+	}
+
+	t.Run("Strict mode", func(t *testing.T) {
+		act, _ := New(test.NewActivityInitContext(&Settings{TemplateEngine: "handlebars", TemplateCacheSize: 10}, nil))
+		tc := test.NewActivityContext(act.Metadata())
+		tc.SetInput("template", "Hi {{firstName}}")
+		tc.SetInput("templateData", data)
+		tc.SetInput("strictMode", true)
+		act.Eval(tc)
+		if errMsg, _ := tc.GetOutput("error").(string); !strings.Contains(errMsg, `missing variable "firstName"`) {
+			t.Errorf("Expected missing variable error, got %q", errMsg)
+		}
+	})
+}
@@ -0,0 +1,542 @@
+package templateengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// catalogDir is the directory under the template path that holds the message catalogs,
+// one file per locale such as locales/de-CH.json or locales/fr.yaml
+const catalogDir = "locales"
+
+// defaultLocale is the last locale messages fall back to when none is configured
+const defaultLocale = "en"
+
+// normalizeLocale returns a BCP 47 language tag in its canonical case, so de_ch and
+// DE-CH are both de-CH. An empty tag stays empty.
+func normalizeLocale(tag string) (string, error) {
+	if tag == "" {
+		return "", nil
+	}
+	subtags := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	for i, subtag := range subtags {
+		for _, r := range subtag {
+			if r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return "", fmt.Errorf("invalid locale %q", tag)
+			}
+		}
+		switch {
+		case i == 0:
+			if len(subtag) < 2 || len(subtag) > 3 {
+				return "", fmt.Errorf("invalid locale %q: %q is not a language", tag, subtag)
+			}
+			subtags[i] = strings.ToLower(subtag)
+		case len(subtag) == 4 && unicode.IsLetter(rune(subtag[0])):
+			// Script, as in zh-Hant
+			subtags[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 || len(subtag) == 3 && unicode.IsDigit(rune(subtag[0])):
+			// Region, as in de-CH or es-419
+			subtags[i] = strings.ToUpper(subtag)
+		default:
+			subtags[i] = strings.ToLower(subtag)
+		}
+	}
+	if len(subtags) == 0 {
+		return "", fmt.Errorf("invalid locale %q", tag)
+	}
+	return strings.Join(subtags, "-"), nil
+}
+
+// localeChain returns a locale followed by its more general parents, so de-CH falls
+// back to de
+func localeChain(locale string) []string {
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
+
+// language returns the language of a locale, de for de-CH
+func language(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+// message is a catalog entry: a text, or a text for each plural category
+type message struct {
+	text   string
+	plural map[string]string // by CLDR category, or =N for an exact count
+}
+
+// pluralCategories are the CLDR plural categories
+var pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// isPluralForms reports whether a catalog object holds the plural forms of one message
+// rather than nested messages: it has an other form, and only plural categories or
+// exact counts such as =0
+func isPluralForms(entry map[string]interface{}) bool {
+	if _, ok := entry["other"]; !ok {
+		return false
+	}
+	for key := range entry {
+		if _, err := strconv.Atoi(strings.TrimPrefix(key, "=")); !pluralCategories[key] && (!strings.HasPrefix(key, "=") || err != nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCatalog parses a JSON or YAML message catalog. Nested objects are flattened to
+// dotted keys, so {"order": {"shipped": "..."}} defines order.shipped.
+func parseCatalog(file string, content []byte) (map[string]*message, error) {
+	var entries map[string]interface{}
+	var err error
+	if filepath.Ext(file) == ".json" {
+		err = json.Unmarshal(content, &entries)
+	} else {
+		err = yaml.Unmarshal(content, &entries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message catalog %s: %v", file, err)
+	}
+
+	messages := make(map[string]*message)
+	var flatten func(prefix string, entries map[string]interface{}) error
+	flatten = func(prefix string, entries map[string]interface{}) error {
+		for key, value := range entries {
+			key = joinPath(prefix, key)
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if !isPluralForms(v) {
+					if err := flatten(key, v); err != nil {
+						return err
+					}
+					continue
+				}
+				msg := &message{plural: make(map[string]string)}
+				for form, text := range v {
+					if _, ok := text.(map[string]interface{}); ok {
+						return fmt.Errorf("message catalog %s: plural form %s.%s must be a text", file, key, form)
+					}
+					msg.plural[form] = fmt.Sprint(text)
+				}
+				messages[key] = msg
+			case []interface{}, nil:
+				return fmt.Errorf("message catalog %s: message %s must be a text or an object", file, key)
+			default:
+				messages[key] = &message{text: fmt.Sprint(v)}
+			}
+		}
+		return nil
+	}
+	if err := flatten("", entries); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// isCatalogFile reports whether a file, given by its path relative to the template
+// path, is a message catalog
+func isCatalogFile(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	switch path.Ext(rel) {
+	case ".json", ".yaml", ".yml":
+		return path.Dir(rel) == catalogDir
+	}
+	return false
+}
+
+// addCatalog adds the message catalog of the locale its file is named after
+func (s *templateSet) addCatalog(file string, content []byte) error {
+	name := path.Base(file)
+	locale, err := normalizeLocale(strings.TrimSuffix(name, path.Ext(name)))
+	if err != nil {
+		return fmt.Errorf("message catalog %s: %v", file, err)
+	}
+	if owner, ok := s.catalogFiles[locale]; ok {
+		return fmt.Errorf("message catalog collision: locale %q is defined in both %s and %s", locale, owner, file)
+	}
+	messages, err := parseCatalog(file, content)
+	if err != nil {
+		return err
+	}
+	s.catalogFiles[locale] = file
+	s.catalogs[locale] = messages
+	return nil
+}
+
+// localizer renders the messages and formats of one locale. A nil localizer has no
+// catalogs and leaves formatting to the default functions.
+type localizer struct {
+	locale   string   // the requested locale, empty if none
+	chain    []string // locales messages are looked up in, most specific first
+	catalogs map[string]map[string]*message
+	numbers  numberFormat
+	dates    *dateFormat
+	strict   bool // fail on missing messages
+}
+
+// localizer returns a localizer for a locale. Messages fall back through the parents
+// of the locale to the default locale; formats fall back to English.
+func (s *templateSet) localizer(locale, fallback string, strict bool) *localizer {
+	if fallback == "" {
+		fallback = defaultLocale
+	}
+	l := &localizer{
+		locale:   locale,
+		catalogs: s.catalogs,
+		numbers:  defaultNumberFormat,
+		dates:    dateFormats[defaultLocale],
+		strict:   strict,
+	}
+	seen := make(map[string]bool)
+	for _, tag := range append(localeChain(locale), localeChain(fallback)...) {
+		if !seen[tag] {
+			seen[tag] = true
+			l.chain = append(l.chain, tag)
+		}
+	}
+	chain := localeChain(locale)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if format, ok := numberFormats[chain[i]]; ok {
+			l.numbers = format
+		}
+		if format, ok := dateFormats[chain[i]]; ok {
+			l.dates = format
+		}
+	}
+	return l
+}
+
+// Template functions of the localizer
+const (
+	translateFunc = "t"
+	localeFunc    = "locale"
+)
+
+// funcs returns the localized functions. With a locale, formatDate, formatNumber and
+// formatCurrency use its formats.
+func (l *localizer) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		translateFunc: l.translate,
+		localeFunc:    l.tag,
+	}
+	if l != nil && l.locale != "" {
+		funcs["formatDate"] = l.formatDate
+		funcs["formatNumber"] = func(precision, value interface{}) string {
+			return l.numbers.format(toFloat64(value), int(toInt64(precision)))
+		}
+		funcs["formatCurrency"] = l.numbers.formatCurrency
+	}
+	return funcs
+}
+
+// tag returns the locale of the render, for <html lang="{{locale}}">
+func (l *localizer) tag() string {
+	if l == nil {
+		return ""
+	}
+	return l.locale
+}
+
+// translate returns a message with its {placeholders} replaced. Parameters are given
+// as name and value pairs, or as a single map; count selects the plural form. A missing
+// message renders as its key, or fails the render in strict mode.
+func (l *localizer) translate(key string, args ...interface{}) (string, error) {
+	params, err := translationParams(args)
+	if err != nil {
+		return "", fmt.Errorf("t %q: %v", key, err)
+	}
+	if l != nil {
+		for _, locale := range l.chain {
+			if msg, ok := l.catalogs[locale][key]; ok {
+				return l.interpolate(msg.form(language(locale), params["count"]), params), nil
+			}
+		}
+		if l.strict {
+			return "", fmt.Errorf("missing message %q for locale %q", key, strings.Join(l.chain, ", "))
+		}
+	}
+	return key, nil
+}
+
+// translationParams returns the parameters of a message
+func translationParams(args []interface{}) (map[string]interface{}, error) {
+	if len(args) == 1 {
+		if params, ok := args[0].(map[string]interface{}); ok {
+			return params, nil
+		}
+	}
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("parameters must be name and value pairs or a map")
+	}
+	params := make(map[string]interface{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter name %v is not a string", args[i])
+		}
+		params[name] = args[i+1]
+	}
+	return params, nil
+}
+
+// form returns the text of a message for a count: an exact count such as =0 first,
+// then the plural category of the count in the language, then other
+func (m *message) form(lang string, count interface{}) string {
+	if m.plural == nil {
+		return m.text
+	}
+	if count != nil {
+		n := toFloat64(count)
+		if text, ok := m.plural["="+strconv.FormatFloat(n, 'f', -1, 64)]; ok {
+			return text
+		}
+		if text, ok := m.plural[pluralCategory(lang, n)]; ok {
+			return text
+		}
+	}
+	return m.plural["other"]
+}
+
+// placeholderPattern finds the {name} placeholders of a message
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+// interpolate replaces placeholders with their parameters. Numbers are formatted for
+// the locale; placeholders without a parameter are left as they are.
+func (l *localizer) interpolate(text string, params map[string]interface{}) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := params[placeholder[1:len(placeholder)-1]]
+		if !ok {
+			return placeholder
+		}
+		switch value.(type) {
+		case int, int32, int64, float32, float64, json.Number:
+			n := toFloat64(value)
+			decimals := 0
+			if _, fraction, ok := strings.Cut(strconv.FormatFloat(n, 'f', -1, 64), "."); ok {
+				decimals = len(fraction)
+			}
+			return l.numbers.format(n, decimals)
+		}
+		return strval(value)
+	})
+}
+
+// pluralCategory returns the CLDR cardinal plural category of a number in a language
+func pluralCategory(lang string, n float64) string {
+	n = math.Abs(n)
+	integer := n == math.Trunc(n)
+	i := int64(n)
+	mod10, mod100 := i%10, i%100
+	switch lang {
+	case "ja", "zh", "ko", "th", "vi", "id", "ms":
+		return "other"
+	case "fr", "pt":
+		if i == 0 || i == 1 {
+			return "one"
+		}
+	case "ru", "uk", "be":
+		switch {
+		case !integer:
+			return "other"
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		}
+		return "many"
+	case "pl":
+		switch {
+		case !integer:
+			return "other"
+		case i == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		}
+		return "many"
+	case "cs", "sk":
+		switch {
+		case !integer:
+			return "many"
+		case i == 1:
+			return "one"
+		case i >= 2 && i <= 4:
+			return "few"
+		}
+	case "ar":
+		switch {
+		case !integer:
+		case i == 0:
+			return "zero"
+		case i == 1:
+			return "one"
+		case i == 2:
+			return "two"
+		case mod100 >= 3 && mod100 <= 10:
+			return "few"
+		case mod100 >= 11:
+			return "many"
+		}
+	default:
+		// English, German, Dutch, Italian, Spanish, the Nordic languages and most others
+		if integer && i == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// numberFormats are the number formats of locales whose format differs from English.
+// Most separate groups and currency symbols with a no-break space.
+var numberFormats = map[string]numberFormat{
+	"de":    {decimal: ",", group: ".", minGrouping: 1, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"de-AT": {decimal: ",", group: "\u00a0", minGrouping: 1, space: "\u00a0", currencySpace: true},
+	"de-CH": {decimal: ".", group: "’", minGrouping: 1, space: "\u00a0", currencySpace: true},
+	"fr":    {decimal: ",", group: "\u202f", minGrouping: 1, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"es":    {decimal: ",", group: ".", minGrouping: 2, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"it":    {decimal: ",", group: ".", minGrouping: 1, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"it-CH": {decimal: ".", group: "’", minGrouping: 1, space: "\u00a0", currencySpace: true},
+	"nl":    {decimal: ",", group: ".", minGrouping: 1, space: "\u00a0", currencySpace: true},
+	"pt":    {decimal: ",", group: ".", minGrouping: 1, space: "\u00a0", currencySpace: true},
+	"pt-PT": {decimal: ",", group: "\u00a0", minGrouping: 2, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"sv":    {decimal: ",", group: "\u00a0", minGrouping: 1, space: "\u00a0", currencyAfter: true, currencySpace: true},
+	"pl":    {decimal: ",", group: "\u00a0", minGrouping: 2, space: "\u00a0", currencyAfter: true, currencySpace: true},
+}
+
+// dateFormat holds the month and day names of a language and its date styles, which
+// are Go layouts
+type dateFormat struct {
+	months      [12]string
+	shortMonths [12]string
+	days        [7]string // from Sunday, as time.Weekday
+	shortDays   [7]string
+	styles      map[string]string // short, medium, long and full
+}
+
+var englishDates = &dateFormat{
+	months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	shortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	shortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	styles:      map[string]string{"short": "1/2/06", "medium": "Jan 2, 2006", "long": "January 2, 2006", "full": "Monday, January 2, 2006"},
+}
+
+// dateFormats are the date formats of locales; dates fall back to English
+var dateFormats = map[string]*dateFormat{
+	"en": englishDates,
+	"en-GB": {
+		months: englishDates.months, shortMonths: englishDates.shortMonths, days: englishDates.days, shortDays: englishDates.shortDays,
+		styles: map[string]string{"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"de": {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		styles:      map[string]string{"short": "02.01.06", "medium": "02.01.2006", "long": "2. January 2006", "full": "Monday, 2. January 2006"},
+	},
+	"fr": {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		styles:      map[string]string{"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"es": {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		styles:      map[string]string{"short": "2/1/06", "medium": "2 Jan 2006", "long": "2 de January de 2006", "full": "Monday, 2 de January de 2006"},
+	},
+	"it": {
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		styles:      map[string]string{"short": "02/01/06", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"nl": {
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		styles:      map[string]string{"short": "02-01-2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"pt": {
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+		days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:   [7]string{"dom.", "seg.", "ter.", "qua.", "qui.", "sex.", "sáb."},
+		styles:      map[string]string{"short": "02/01/2006", "medium": "2 de Jan de 2006", "long": "2 de January de 2006", "full": "Monday, 2 de January de 2006"},
+	},
+}
+
+// formatDate formats a date with a Go layout, or the short, medium, long or full
+// style of the locale, using the month and day names of the locale. A value that is
+// not a date formats as an empty string.
+func (l *localizer) formatDate(layout string, date interface{}) string {
+	t, ok := toTime(date)
+	if !ok {
+		return ""
+	}
+	if style, ok := l.dates.styles[layout]; ok {
+		layout = style
+	}
+
+	// Names are written by the localizer and the rest of the layout by time.Format
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); {
+		var name string
+		var width int
+		switch {
+		case strings.HasPrefix(layout[i:], "January"):
+			name, width = l.dates.months[t.Month()-1], len("January")
+		case strings.HasPrefix(layout[i:], "Monday"):
+			name, width = l.dates.days[t.Weekday()], len("Monday")
+		case strings.HasPrefix(layout[i:], "Jan"):
+			name, width = l.dates.shortMonths[t.Month()-1], len("Jan")
+		case strings.HasPrefix(layout[i:], "Mon"):
+			name, width = l.dates.shortDays[t.Weekday()], len("Mon")
+		default:
+			i++
+			continue
+		}
+		b.WriteString(t.Format(layout[start:i]))
+		b.WriteString(name)
+		i += width
+		start = i
+	}
+	b.WriteString(t.Format(layout[start:]))
+	return b.String()
+}
+
+// locales returns the locales with a message catalog, sorted
+func (s *templateSet) locales() []string {
+	locales := make([]string, 0, len(s.catalogs))
+	for locale := range s.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
@@ -0,0 +1,229 @@
+package templateengine
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// localizedTemplates are templates and catalogs for the welcome email in several locales
+var localizedTemplates = map[string]string{
+	"email-welcome.tmpl":       `{{t "welcome.title" "name" .name}} {{t "cart.items" "count" .count}}`,
+	"email-welcome.de.tmpl":    `DE {{t "welcome.title" .}} {{t "cart.items" "count" .count}}`,
+	"email-welcome.de-CH.tmpl": `CH {{t "welcome.title" .}} {{formatCurrency "CHF" .total}}`,
+	"locales/en.json":          `{"welcome": {"title": "Welcome, {name}!"}, "cart": {"items": {"=0": "Your cart is empty", "one": "{count} item", "other": "{count} items"}}, "footer": "Thanks"}`,
+	"locales/de.yaml":          "welcome:\n  title: Willkommen, {name}!\ncart:\n  items:\n    one: \"{count} Artikel\"\n    other: \"{count} Artikel\"\n",
+	"locales/de-CH.json":       `{"welcome": {"title": "Grüezi {name}!"}}`,
+}
+
+func TestLocalizedTemplates(t *testing.T) {
+	act, err := newTemplateSetActivity(writeTemplates(t, localizedTemplates))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	data := map[string]interface{}{"name": "Jana", "count": 1234.0, "total": 1234.5}
+
+	tests := []struct {
+		locale         string
+		expected       string
+		templateLocale string
+	}{
+		{"de-CH", "CH Grüezi Jana! CHF\u00a01’234.50", "de-CH"},
+		{"de_ch", "CH Grüezi Jana! CHF\u00a01’234.50", "de-CH"},
+		{"de-AT", "DE Willkommen, Jana! 1\u00a0234 Artikel", "de"},
+		{"de", "DE Willkommen, Jana! 1.234 Artikel", "de"},
+		{"fr-FR", "Welcome, Jana! 1\u202f234 items", ""},
+		{"", "Welcome, Jana! 1,234 items", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			tc := evalInputs(act, map[string]interface{}{
+				"templateType": "email-welcome",
+				"templateData": data,
+				"locale":       tt.locale,
+			})
+			if result := tc.GetOutput("result"); result != tt.expected {
+				t.Errorf("Expected %q, got %q: %v", tt.expected, result, tc.GetOutput("error"))
+			}
+			if locale := tc.GetOutput("templateLocale"); locale != tt.templateLocale {
+				t.Errorf("Expected template locale %q, got %q", tt.templateLocale, locale)
+			}
+		})
+	}
+
+	tc := evalInputs(act, map[string]interface{}{"templateType": "email-welcome", "locale": "d!"})
+	if errMsg := tc.GetOutput("error").(string); !strings.Contains(errMsg, `invalid locale "d!"`) {
+		t.Errorf("Expected an invalid locale error, got %q", errMsg)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	act, err := newTemplateSetActivity(writeTemplates(t, localizedTemplates))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	tests := []struct {
+		locale   string
+		template string
+		expected string
+	}{
+		{"en", `{{t "cart.items" "count" 0}}|{{t "cart.items" "count" 1}}|{{t "cart.items" "count" 2.5}}`, "Your cart is empty|1 item|2.5 items"},
+		{"de", `{{t "cart.items" "count" 1}}|{{t "footer"}}|{{t "welcome.title"}}`, "1 Artikel|Thanks|Willkommen, {name}!"},
+		{"de-CH", `{{t "welcome.title" (dict "name" "Urs")}} {{locale}}`, "Grüezi Urs! de-CH"},
+		{"en", `{{t "no.such.message"}}`, "no.such.message"},
+	}
+	for _, tt := range tests {
+		tc := evalInputs(act, map[string]interface{}{"template": tt.template, "locale": tt.locale})
+		if result := tc.GetOutput("result"); result != tt.expected {
+			t.Errorf("%s %s: expected %q, got %q: %v", tt.locale, tt.template, tt.expected, result, tc.GetOutput("error"))
+		}
+	}
+
+	// In strict mode a missing message fails the render
+	tc := evalInputs(act, map[string]interface{}{"template": `{{t "no.such.message"}}`, "locale": "de-CH", "strictMode": true})
+	if errMsg := tc.GetOutput("error").(string); !strings.Contains(errMsg, `missing message "no.such.message" for locale "de-CH, de, en"`) {
+		t.Errorf("Expected a missing message error, got %q", errMsg)
+	}
+	tc = evalInputs(act, map[string]interface{}{"template": `{{t "welcome.title" "name"}}`, "locale": "en"})
+	if errMsg := tc.GetOutput("error").(string); !strings.Contains(errMsg, "parameters must be name and value pairs or a map") {
+		t.Errorf("Expected a parameter error, got %q", errMsg)
+	}
+}
+
+func TestTranslateInHandlebars(t *testing.T) {
+	act, err := New(test.NewActivityInitContext(&Settings{
+		TemplateEngine: "handlebars",
+		EnableSafeMode: true,
+		TemplatePath:   writeTemplates(t, localizedTemplates),
+		DefaultLocale:  "de",
+	}, nil))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	tc := evalInputs(act.(*Activity), map[string]interface{}{
+		"template":     `{{t "welcome.title" name=customer.name}} {{t "cart.items" count=count}} {{formatNumber 2 total}}`,
+		"templateData": map[string]interface{}{"customer": map[string]interface{}{"name": "Jana"}, "count": 3, "total": 1234.5},
+	})
+	if result, expected := tc.GetOutput("result"), "Willkommen, Jana! 3 Artikel 1.234,50"; result != expected {
+		t.Errorf("Expected %q, got %q: %v", expected, result, tc.GetOutput("error"))
+	}
+}
+
+func TestLocaleFormats(t *testing.T) {
+	date := time.Date(2024, time.March, 5, 13, 30, 0, 0, time.UTC)
+	tests := []struct {
+		locale   string
+		template string
+		expected string
+	}{
+		{"en", `{{formatDate "long" .date}}|{{formatDate "Mon, 02 Jan 2006" .date}}|{{formatNumber 2 1234567.891}}|{{formatCurrency "EUR" -1234.5}}`, "March 5, 2024|Tue, 05 Mar 2024|1,234,567.89|-€1,234.50"},
+		{"en-GB", `{{formatDate "full" .date}}|{{formatDate "short" .date}}`, "Tuesday 5 March 2024|05/03/2024"},
+		{"de-DE", `{{formatDate "full" .date}}|{{formatDate "medium" .date}}|{{formatNumber 2 1234567.891}}|{{formatCurrency "EUR" 1234.5}}|{{formatCurrency "USD" 1}}`, "Dienstag, 5. März 2024|05.03.2024|1.234.567,89|1.234,50\u00a0€|1,00\u00a0$"},
+		{"de-CH", `{{formatDate "long" .date}}|{{formatNumber 0 1234567}}|{{formatCurrency "CHF" -5}}`, "5. März 2024|1’234’567|-CHF\u00a05.00"},
+		{"fr", `{{formatDate "full" .date}}|{{formatDate "2 Jan 15:04" .date}}|{{formatCurrency "EUR" 1234.5}}`, "mardi 5 mars 2024|5 mars 13:30|1\u202f234,50\u00a0€"},
+		{"es", `{{formatDate "long" .date}}|{{formatNumber 0 1234}}|{{formatNumber 0 12345}}`, "5 de marzo de 2024|1234|12.345"},
+		{"nl", `{{formatDate "full" .date}}|{{formatCurrency "EUR" 1234.5}}`, "dinsdag 5 maart 2024|€\u00a01.234,50"},
+		{"pt-BR", `{{formatDate "long" .date}}|{{formatCurrency "USD" 10}}`, "5 de março de 2024|$\u00a010,00"},
+		{"ja", `{{formatDate "long" .date}}|{{formatCurrency "JPY" 1234.5}}`, "March 5, 2024|¥1,234"},
+	}
+	for _, tt := range tests {
+		result := renderHTML(t, "go", tt.template, map[string]interface{}{"date": date}, map[string]interface{}{"locale": tt.locale})
+		if result != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.locale, tt.expected, result)
+		}
+	}
+
+	// A missing currency code is an error in every locale
+	act, err := newTemplateSetActivity(writeTemplates(t, map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	tc := evalInputs(act, map[string]interface{}{"template": `{{formatCurrency .code 5}}`, "templateData": map[string]interface{}{"code": ""}, "locale": "de"})
+	if errMsg := tc.GetOutput("error").(string); !strings.Contains(errMsg, "formatCurrency: missing currency code") {
+		t.Errorf("Expected a missing currency code error, got %q", errMsg)
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		lang     string
+		counts   []float64
+		expected string
+	}{
+		{"en", []float64{1}, "one"},
+		{"en", []float64{0, 2, 1.5}, "other"},
+		{"fr", []float64{0, 1, 1.5}, "one"},
+		{"fr", []float64{2}, "other"},
+		{"ja", []float64{1}, "other"},
+		{"ru", []float64{1, 21, 101}, "one"},
+		{"ru", []float64{2, 3, 24}, "few"},
+		{"ru", []float64{0, 5, 11, 12, 111}, "many"},
+		{"ru", []float64{1.5}, "other"},
+		{"pl", []float64{22}, "few"},
+		{"pl", []float64{21, 12}, "many"},
+		{"cs", []float64{3}, "few"},
+		{"cs", []float64{5}, "other"},
+		{"ar", []float64{0}, "zero"},
+		{"ar", []float64{2}, "two"},
+		{"ar", []float64{103}, "few"},
+		{"ar", []float64{111}, "many"},
+		{"ar", []float64{100}, "other"},
+	}
+	for _, tt := range tests {
+		for _, n := range tt.counts {
+			if category := pluralCategory(tt.lang, n); category != tt.expected {
+				t.Errorf("%s %v: expected %s, got %s", tt.lang, n, tt.expected, category)
+			}
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	for tag, expected := range map[string]string{
+		"de_ch": "de-CH", "EN": "en", "zh-hant-tw": "zh-Hant-TW", "es-419": "es-419", "": "",
+	} {
+		if normalized, err := normalizeLocale(tag); err != nil || normalized != expected {
+			t.Errorf("%q: expected %q, got %q, %v", tag, expected, normalized, err)
+		}
+	}
+	for _, tag := range []string{"d", "de CH", "-", "english"} {
+		if _, err := normalizeLocale(tag); err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
+
+func TestMessageCatalogErrorsAndReload(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"Syntax error":   {"locales/de.json": `{"a": `},
+		"List message":   {"locales/de.yaml": "a:\n  - x\n"},
+		"Two catalogs":   {"locales/de.json": `{}`, "locales/DE.yml": "a: b\n"},
+		"Invalid locale": {"locales/messages.json": `{}`},
+	} {
+		if _, err := newTemplateSetActivity(writeTemplates(t, files)); err == nil || !strings.Contains(err.Error(), "message catalog") {
+			t.Errorf("%s: expected a message catalog error, got %v", name, err)
+		}
+	}
+
+	dir := writeTemplates(t, map[string]string{"locales/de.json": `{"hello": "Hallo"}`})
+	act, err := newTemplateSetActivity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	act.reloadInterval = 0
+	render := func(expected string) {
+		t.Helper()
+		tc := evalInputs(act, map[string]interface{}{"template": `{{t "hello"}}`, "locale": "de"})
+		if result := tc.GetOutput("result"); result != expected {
+			t.Errorf("Expected %q, got %q: %v", expected, result, tc.GetOutput("error"))
+		}
+	}
+	render("Hallo")
+	// A changed catalog is reloaded, and templates compiled with the old one are not used
+	touch(t, filepath.Join(dir, "locales", "de.json"), `{"hello": "Servus"}`, time.Second)
+	render("Servus")
+}
@@ -0,0 +1,928 @@
+package templateengine
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// Validation issue severities and codes
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	IssueSyntaxError     = "syntaxError"
+	IssueUnknownField    = "unknownField"
+	IssueUnknownFunction = "unknownFunction"
+	IssueMissingPartial  = "missingPartial"
+	IssueUnusedInput     = "unusedInput"
+)
+
+// ValidationIssue is a problem found in a template without rendering it
+type ValidationIssue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Template string `json:"template,omitempty"` // template or partial the issue is in
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Field    string `json:"field,omitempty"` // dotted path of the field, for field issues
+}
+
+// String formats the issue like a compiler message: main:3:7: error: ...
+func (i ValidationIssue) String() string {
+	location := i.Template
+	if i.Line > 0 {
+		location += ":" + strconv.Itoa(i.Line)
+		if i.Column > 0 {
+			location += ":" + strconv.Itoa(i.Column)
+		}
+	}
+	if location == "" {
+		return i.Severity + ": " + i.Message
+	}
+	return location + ": " + i.Severity + ": " + i.Message
+}
+
+// ValidationResult is the outcome of validating a template
+type ValidationResult struct {
+	Valid  bool              `json:"valid"` // no issues with error severity
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// systemVariables are added to the data of every render
+var systemVariables = []string{"_timestamp", "_date", "_time", "_year"}
+
+// goBuiltinFunctions are the functions text/template always provides
+var goBuiltinFunctions = []string{"and", "call", "html", "index", "slice", "js", "len", "not", "or",
+	"print", "printf", "println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne"}
+
+// ValidateTemplate checks a template without rendering it. Field references are checked
+// against schema, a JSON Schema of the template data, and the fields of sample data;
+// with both, the sample adds the fields the schema does not declare. With neither, only
+// the syntax, functions and partials are checked. Go templates are checked with line and
+// column numbers; Handlebars and Mustache templates with line numbers.
+func (a *Activity) ValidateTemplate(content string, schema, sample map[string]interface{}) ValidationResult {
+	root := &dataShape{open: true}
+	if schema != nil {
+		root = shapeFromSchema(schema, "")
+	}
+	if sample != nil {
+		if schema == nil {
+			root = shapeFromValue(sample, "")
+		} else if root.fields != nil {
+			for name, field := range shapeFromValue(sample, "").fields {
+				if _, ok := root.fields[name]; !ok {
+					root.fields[name] = field
+				}
+			}
+		}
+	}
+	declared := root.declaredFields()
+	for _, name := range systemVariables {
+		root.field(name)
+	}
+
+	var issues []ValidationIssue
+	switch a.settings.TemplateEngine {
+	case "handlebars", "mustache":
+		issues = a.lintLogicless(content, root)
+	case "handlebars-basic", "mustache-basic":
+		issues = a.lintGoTemplate(a.convertHandlebarsToGo(content), root)
+	default:
+		issues = a.lintGoTemplate(content, root)
+	}
+
+	// A template that does not parse says nothing about which inputs it uses
+	if len(issues) == 1 && issues[0].Code == IssueSyntaxError {
+		declared = nil
+	}
+	for _, name := range declared {
+		if field := root.fields[name]; field != nil && !field.used {
+			issues = append(issues, ValidationIssue{
+				Severity: SeverityWarning,
+				Code:     IssueUnusedInput,
+				Message:  fmt.Sprintf("input %q is declared but not used", name),
+				Field:    name,
+			})
+		}
+	}
+
+	result := ValidationResult{Valid: true, Issues: issues}
+	if result.Issues == nil {
+		result.Issues = []ValidationIssue{}
+	}
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			result.Valid = false
+		}
+	}
+	return result
+}
+
+// dataShape describes the data a template may reference
+type dataShape struct {
+	path   string
+	fields map[string]*dataShape // known fields of an object
+	open   bool                  // fields that are not known may be present
+	list   bool
+	items  *dataShape // elements of a list
+	scalar bool
+	used   bool // referenced by the template
+	// detached values do not come from the template data, such as function results
+	detached bool
+}
+
+// field returns the shape of a field, adding it if the shape accepts unknown fields
+func (s *dataShape) field(name string) *dataShape {
+	if f, ok := s.fields[name]; ok {
+		return f
+	}
+	if s.fields == nil {
+		s.fields = make(map[string]*dataShape)
+	}
+	f := &dataShape{path: joinPath(s.path, name), open: true, detached: s.detached}
+	s.fields[name] = f
+	return f
+}
+
+// lookup returns the shape of a field, or nil and the reason the field cannot exist
+func (s *dataShape) lookup(name string) (*dataShape, string) {
+	path := joinPath(s.path, name)
+	if f, ok := s.fields[name]; ok {
+		return f, ""
+	}
+	switch {
+	case s.open:
+		return s.field(name), ""
+	case s.list:
+		return nil, fmt.Sprintf("unknown field %q: %s is a list", path, s.path)
+	case s.scalar:
+		return nil, fmt.Sprintf("unknown field %q: %s is not an object", path, s.path)
+	}
+	return nil, fmt.Sprintf("unknown field %q", path)
+}
+
+// declaredFields returns the names of the known fields in order
+func (s *dataShape) declaredFields() []string {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func joinPath(path, name string) string {
+	if path == "" || name == "" {
+		return path + name
+	}
+	return path + "." + name
+}
+
+// shapeFromSchema converts a JSON Schema. Objects accept only their properties unless
+// additionalProperties allows others; a schema without a type accepts anything.
+func shapeFromSchema(schema map[string]interface{}, path string) *dataShape {
+	s := &dataShape{path: path}
+	types := map[string]bool{}
+	switch t := schema["type"].(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types[name] = true
+			}
+		}
+	}
+	properties, hasProperties := schema["properties"].(map[string]interface{})
+	items, hasItems := schema["items"].(map[string]interface{})
+
+	switch {
+	case types["object"] || hasProperties:
+		s.fields = make(map[string]*dataShape)
+		for name, property := range properties {
+			propertySchema, _ := property.(map[string]interface{})
+			s.fields[name] = shapeFromSchema(propertySchema, joinPath(path, name))
+		}
+		// An object without declared properties may have any
+		s.open = !hasProperties
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			s.open = additional
+		case map[string]interface{}:
+			s.open = true
+		}
+	case types["array"] || hasItems:
+		s.list = true
+		s.items = &dataShape{path: path + "[]", open: true}
+		if hasItems {
+			s.items = shapeFromSchema(items, path+"[]")
+		}
+	case types["string"] || types["number"] || types["integer"] || types["boolean"]:
+		s.scalar = true
+	default:
+		s.open = true
+	}
+	return s
+}
+
+// shapeFromValue describes sample data. Objects accept only the fields in the sample;
+// the elements of a list accept the fields of any element.
+func shapeFromValue(value interface{}, path string) *dataShape {
+	s := &dataShape{path: path}
+	if value == nil {
+		s.open = true
+		return s
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		s.fields = make(map[string]*dataShape)
+		for name, v := range m {
+			s.fields[name] = shapeFromValue(v, joinPath(path, name))
+		}
+		return s
+	}
+	if items, ok := listItems(value); ok {
+		s.list = true
+		for _, item := range items {
+			s.items = mergeShapes(s.items, shapeFromValue(item, path+"[]"))
+		}
+		if s.items == nil {
+			s.items = &dataShape{path: path + "[]", open: true}
+		}
+		return s
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Map {
+		s.open = true
+		return s
+	}
+	s.scalar = true
+	return s
+}
+
+// mergeShapes combines the shapes of two list elements
+func mergeShapes(a, b *dataShape) *dataShape {
+	switch {
+	case a == nil:
+		return b
+	case a.fields != nil && b.fields != nil:
+		for name, f := range b.fields {
+			a.fields[name] = mergeShapes(a.fields[name], f)
+		}
+		return a
+	case a.list && b.list:
+		a.items = mergeShapes(a.items, b.items)
+		return a
+	case a.scalar && b.scalar:
+		return a
+	}
+	return &dataShape{path: a.path, open: true}
+}
+
+// goLinter checks the parse trees of a Go template
+type goLinter struct {
+	funcs    map[string]bool
+	trees    map[string]*parse.Tree
+	issues   []ValidationIssue
+	reported map[string]bool
+	visiting map[string]bool
+	// refs collects the data references of the template when it is set
+	refs *templateReferences
+}
+
+// goScope is the data visible at a point of a template
+type goScope struct {
+	dot  *dataShape
+	vars map[string]*dataShape
+}
+
+func (s goScope) with(dot *dataShape) goScope {
+	vars := make(map[string]*dataShape, len(s.vars))
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	return goScope{dot: dot, vars: vars}
+}
+
+// goErrorLocation splits a text/template error into its template, line and message
+var goErrorLocation = regexp.MustCompile(`^template: ([^:]+):(\d+):(?:(\d+):)? (.*)$`)
+
+func (a *Activity) lintGoTemplate(content string, root *dataShape) []ValidationIssue {
+	return newGoLinter(a.templateSet()).check(content, "main", root)
+}
+
+// newGoLinter returns a linter for templates compiled with the templates of set
+func newGoLinter(set *templateSet) *goLinter {
+	l := &goLinter{
+		funcs:    make(map[string]bool),
+		trees:    make(map[string]*parse.Tree),
+		reported: make(map[string]bool),
+		visiting: make(map[string]bool),
+	}
+	for _, name := range goBuiltinFunctions {
+		l.funcs[name] = true
+	}
+	for name := range set.funcs {
+		l.funcs[name] = true
+	}
+	if set.base != nil {
+		for _, t := range set.base.Templates() {
+			if t.Tree != nil {
+				l.trees[t.Name()] = t.Tree
+			}
+		}
+	}
+	return l
+}
+
+// check parses a template and walks the template named entry, main or one it defines,
+// from the root data
+func (l *goLinter) check(content, entry string, root *dataShape) []ValidationIssue {
+	// Parse without checking functions, so unknown functions are reported with the
+	// other issues rather than as a syntax error
+	page := make(map[string]*parse.Tree)
+	tree := parse.New("main")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(content, "", "", page); err != nil {
+		issue := ValidationIssue{Severity: SeverityError, Code: IssueSyntaxError, Message: err.Error(), Template: "main"}
+		if m := goErrorLocation.FindStringSubmatch(err.Error()); m != nil {
+			issue.Template, issue.Message = m[1], m[4]
+			issue.Line, _ = strconv.Atoi(m[2])
+			issue.Column, _ = strconv.Atoi(m[3])
+		}
+		return []ValidationIssue{issue}
+	}
+	for name, t := range page {
+		l.trees[name] = t
+	}
+
+	start := page[entry]
+	if start == nil {
+		// A template that only defines other templates renders nothing
+		return nil
+	}
+	l.visiting[entry] = true
+	l.walk(start, start.Root, goScope{dot: root, vars: map[string]*dataShape{"$": root}})
+	return l.issues
+}
+
+// report adds an issue at the position of node, once per position and message
+func (l *goLinter) report(tree *parse.Tree, node parse.Node, code, field, message string) {
+	issue := ValidationIssue{Severity: SeverityError, Code: code, Message: message, Template: tree.ParseName, Field: field}
+	location, _ := tree.ErrorContext(node)
+	if parts := strings.Split(location, ":"); len(parts) >= 3 {
+		issue.Template = strings.Join(parts[:len(parts)-2], ":")
+		issue.Line, _ = strconv.Atoi(parts[len(parts)-2])
+		// ErrorContext counts columns from 0, at the last field of a field chain
+		column, _ := strconv.Atoi(parts[len(parts)-1])
+		issue.Column = column + 1 - fieldChainOffset(node)
+	}
+	key := location + "\x00" + message
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+	l.issues = append(l.issues, issue)
+}
+
+// fieldChainOffset is the distance from the start of a field or variable reference such
+// as .a.b.c to the position the parser records for it, the last field
+func fieldChainOffset(node parse.Node) int {
+	var idents []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		idents = n.Ident
+	case *parse.VariableNode:
+		idents = n.Ident
+	}
+	if len(idents) < 2 {
+		return 0
+	}
+	return len(node.String()) - len(idents[len(idents)-1]) - 1
+}
+
+func (l *goLinter) walk(tree *parse.Tree, node parse.Node, scope goScope) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		// Variables declared in a list are visible until the end of the list
+		inner := scope.with(scope.dot)
+		for _, child := range n.Nodes {
+			l.walk(tree, child, inner)
+		}
+	case *parse.ActionNode:
+		l.pipe(tree, n.Pipe, scope)
+	case *parse.IfNode:
+		inner := scope.with(scope.dot)
+		l.pipe(tree, n.Pipe, inner)
+		l.walk(tree, n.List, inner)
+		l.walk(tree, n.ElseList, inner)
+	case *parse.WithNode:
+		inner := scope.with(scope.dot)
+		dot := l.pipe(tree, n.Pipe, inner)
+		l.walk(tree, n.List, inner.with(dot))
+		l.walk(tree, n.ElseList, inner)
+	case *parse.RangeNode:
+		inner := scope.with(scope.dot)
+		value := l.pipeValue(tree, n.Pipe, inner)
+		elem := &dataShape{path: value.path + "[]", open: true, detached: value.detached}
+		if value.list && value.items != nil {
+			elem = value.items
+		}
+		switch len(n.Pipe.Decl) {
+		case 1:
+			inner.vars[n.Pipe.Decl[0].Ident[0]] = elem
+		case 2:
+			inner.vars[n.Pipe.Decl[0].Ident[0]] = &dataShape{scalar: true, detached: true}
+			inner.vars[n.Pipe.Decl[1].Ident[0]] = elem
+		}
+		l.walk(tree, n.List, inner.with(elem))
+		l.walk(tree, n.ElseList, inner)
+	case *parse.TemplateNode:
+		dot := scope.dot
+		if n.Pipe != nil {
+			dot = l.pipe(tree, n.Pipe, scope)
+		}
+		called := l.trees[n.Name]
+		if called == nil {
+			l.report(tree, n, IssueMissingPartial, "", fmt.Sprintf("missing partial %q", n.Name))
+			return
+		}
+		if l.visiting[n.Name] {
+			return
+		}
+		l.visiting[n.Name] = true
+		l.walk(called, called.Root, goScope{dot: dot, vars: map[string]*dataShape{"$": dot}})
+		delete(l.visiting, n.Name)
+	}
+}
+
+// pipe checks a pipeline, declares its variables and returns the shape of its value
+func (l *goLinter) pipe(tree *parse.Tree, pipe *parse.PipeNode, scope goScope) *dataShape {
+	value := l.pipeValue(tree, pipe, scope)
+	for _, v := range pipe.Decl {
+		scope.vars[v.Ident[0]] = value
+	}
+	return value
+}
+
+func (l *goLinter) pipeValue(tree *parse.Tree, pipe *parse.PipeNode, scope goScope) *dataShape {
+	if pipe == nil {
+		return &dataShape{open: true, detached: true}
+	}
+	// The value of each command is passed to the next one as its last argument
+	var value *dataShape
+	for _, cmd := range pipe.Cmds {
+		value = l.command(tree, cmd, scope, value)
+	}
+	if value == nil {
+		return &dataShape{open: true, detached: true}
+	}
+	return value
+}
+
+// command checks a command and returns the shape of its value; the result of a
+// function is not known. piped is the value of the previous command of the pipeline.
+func (l *goLinter) command(tree *parse.Tree, cmd *parse.CommandNode, scope goScope, piped *dataShape) *dataShape {
+	if len(cmd.Args) == 0 {
+		return &dataShape{open: true, detached: true}
+	}
+	args := make([]*dataShape, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, l.arg(tree, arg, scope))
+	}
+	if piped != nil {
+		args = append(args, piped)
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+		if !l.funcs[ident.Ident] {
+			l.report(tree, ident, IssueUnknownFunction, "", fmt.Sprintf("unknown function %q", ident.Ident))
+		}
+		// default replaces its last argument when it is empty
+		if ident.Ident == "default" && len(args) == 2 && l.refs != nil && !args[1].detached && args[1].path != "" {
+			l.refs.add(args[1].path).defaulted = true
+		}
+		return &dataShape{open: true, detached: true}
+	}
+	return l.arg(tree, cmd.Args[0], scope)
+}
+
+// arg checks an argument and returns the shape of its value
+func (l *goLinter) arg(tree *parse.Tree, node parse.Node, scope goScope) *dataShape {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return scope.dot
+	case *parse.FieldNode:
+		return l.resolve(tree, n, scope.dot, n.Ident)
+	case *parse.VariableNode:
+		base, ok := scope.vars[n.Ident[0]]
+		if !ok {
+			return &dataShape{open: true, detached: true}
+		}
+		return l.resolve(tree, n, base, n.Ident[1:])
+	case *parse.ChainNode:
+		return l.resolve(tree, n, l.arg(tree, n.Node, scope), n.Field)
+	case *parse.PipeNode:
+		return l.pipeValue(tree, n, scope)
+	case *parse.IdentifierNode:
+		if !l.funcs[n.Ident] {
+			l.report(tree, n, IssueUnknownFunction, "", fmt.Sprintf("unknown function %q", n.Ident))
+		}
+		return &dataShape{open: true, detached: true}
+	case *parse.NilNode:
+		return &dataShape{open: true, detached: true}
+	}
+	// Literals
+	return &dataShape{scalar: true, detached: true}
+}
+
+// resolve follows a field path from a shape, reporting the first field that cannot exist
+func (l *goLinter) resolve(tree *parse.Tree, node parse.Node, shape *dataShape, path []string) *dataShape {
+	for _, name := range path {
+		field, problem := shape.lookup(name)
+		if field == nil {
+			l.report(tree, node, IssueUnknownField, joinPath(shape.path, name), problem)
+			return &dataShape{open: true, detached: true}
+		}
+		field.used = true
+		shape = field
+	}
+	shape.used = true
+	if l.refs != nil && len(path) > 0 && !shape.detached {
+		l.refs.add(shape.path)
+	}
+	return shape
+}
+
+// lintLogicless checks a Handlebars or Mustache template. Names are looked up from the
+// innermost context out, as the engines do, through blocks, sections and partials, and
+// helpers and partials must exist.
+func (a *Activity) lintLogicless(content string, root *dataShape) []ValidationIssue {
+	l := &logiclessLinter{
+		root:     root,
+		partials: a.loadPartial,
+		reported: make(map[string]bool),
+		visiting: make(map[string]bool),
+	}
+	stack := []lintScope{{dot: root}}
+	if a.settings.TemplateEngine == "handlebars" {
+		tmpl, err := parseHandlebars(content)
+		if err != nil {
+			return []ValidationIssue{logiclessSyntaxIssue(err, "main")}
+		}
+		l.helpers = copyFuncs(a.templateFunctions(), (*localizer)(nil).funcs())
+		l.handlebars("main", tmpl.nodes, stack)
+	} else {
+		tmpl, err := parseMustache(content)
+		if err != nil {
+			return []ValidationIssue{logiclessSyntaxIssue(err, "main")}
+		}
+		l.mustache("main", tmpl.nodes, stack)
+	}
+	return l.issues
+}
+
+// logiclessLinter checks the parsed nodes of a Handlebars or Mustache template
+type logiclessLinter struct {
+	root     *dataShape
+	helpers  map[string]interface{} // nil for Mustache
+	partials partialSource
+	reported map[string]bool
+	visiting map[string]bool
+	issues   []ValidationIssue
+}
+
+// lintScope is a context of a Handlebars or Mustache template, with the block
+// parameters it declares
+type lintScope struct {
+	dot    *dataShape
+	params map[string]*dataShape
+}
+
+// pushScope returns a new context stack with dot on top. The block parameters name
+// values in order.
+func pushScope(stack []lintScope, dot *dataShape, blockParams []string, values ...*dataShape) []lintScope {
+	scope := lintScope{dot: dot}
+	for i, name := range blockParams {
+		if i < len(values) {
+			if scope.params == nil {
+				scope.params = make(map[string]*dataShape, len(blockParams))
+			}
+			scope.params[name] = values[i]
+		}
+	}
+	return append(stack[:len(stack):len(stack)], scope)
+}
+
+// section returns the context stack of a section of value: each element of a list, or
+// the value itself. The block parameters name the element and its index.
+func (l *logiclessLinter) section(stack []lintScope, value *dataShape, blockParams []string) []lintScope {
+	if !value.list {
+		return pushScope(stack, value, blockParams, value)
+	}
+	elem := &dataShape{path: value.path + "[]", open: true, detached: value.detached}
+	if value.items != nil {
+		elem = value.items
+	}
+	return pushScope(stack, elem, blockParams, elem, &dataShape{scalar: true, detached: true})
+}
+
+// report adds an issue, once per location and message
+func (l *logiclessLinter) report(severity, code, tmpl string, line int, field, message string) {
+	key := tmpl + ":" + strconv.Itoa(line) + "\x00" + message
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+	l.issues = append(l.issues, ValidationIssue{
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+		Template: tmpl,
+		Line:     line,
+		Field:    field,
+	})
+}
+
+// follow resolves the fields of a dotted name from a shape, reporting the first field
+// that cannot exist
+func (l *logiclessLinter) follow(shape *dataShape, parts []string, tmpl string, line int) *dataShape {
+	for _, name := range parts {
+		field, problem := shape.lookup(name)
+		if field == nil {
+			l.report(SeverityError, IssueUnknownField, tmpl, line, joinPath(shape.path, name), problem)
+			return &dataShape{open: true, detached: true}
+		}
+		field.used = true
+		shape = field
+	}
+	shape.used = true
+	return shape
+}
+
+// name resolves a dotted name: the first part is a block parameter or is looked up
+// from the innermost context out, and the rest are fields of its value. A first part
+// that no context can have is reported when report is set; found is false for it.
+func (l *logiclessLinter) name(stack []lintScope, parts []string, tmpl string, line int, report bool) (*dataShape, bool) {
+	first, ok := lookupScopes(stack, parts[0])
+	if !ok {
+		if report {
+			top := stack[len(stack)-1].dot
+			_, problem := top.lookup(parts[0])
+			l.report(SeverityError, IssueUnknownField, tmpl, line, joinPath(top.path, parts[0]), problem)
+		}
+		return &dataShape{open: true, detached: true}, false
+	}
+	first.used = true
+	return l.follow(first, parts[1:], tmpl, line), true
+}
+
+// lookupScopes finds a name in the block parameters and then in the contexts, from the
+// innermost out. A context that accepts unknown fields may have any name, but a known
+// field of an enclosing context is preferred.
+func lookupScopes(stack []lintScope, name string) (*dataShape, bool) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if param, ok := stack[i].params[name]; ok {
+			return param, true
+		}
+	}
+	open := false
+	for i := len(stack) - 1; i >= 0; i-- {
+		if field, ok := stack[i].dot.fields[name]; ok {
+			return field, true
+		}
+		open = open || stack[i].dot.open
+	}
+	if open {
+		return &dataShape{open: true, detached: true}, true
+	}
+	return nil, false
+}
+
+// partial checks a partial in the context it is used in. A partial is not followed
+// into itself, so recursive partials terminate.
+func (l *logiclessLinter) partial(name, tmpl string, line int, severity string, check func(content string) error) {
+	content, found, err := l.partials(name)
+	switch {
+	case err != nil:
+		l.report(SeverityError, IssueMissingPartial, tmpl, line, "", err.Error())
+		return
+	case !found:
+		l.report(severity, IssueMissingPartial, tmpl, line, "", fmt.Sprintf("missing partial %q", name))
+		return
+	case l.visiting[name]:
+		return
+	}
+	l.visiting[name] = true
+	if err := check(content); err != nil {
+		issue := logiclessSyntaxIssue(err, name)
+		l.report(issue.Severity, issue.Code, issue.Template, issue.Line, "", issue.Message)
+	}
+	delete(l.visiting, name)
+}
+
+func (l *logiclessLinter) handlebars(tmpl string, nodes []*hbNode, stack []lintScope) {
+	for _, node := range nodes {
+		switch node.kind {
+		case hbMustache:
+			l.handlebarsExpr(node.expr, stack, tmpl, node.line, true)
+		case hbBlock:
+			l.handlebarsBlock(tmpl, node, stack)
+		case hbPartial:
+			l.handlebarsPartial(tmpl, node, stack)
+		}
+	}
+}
+
+// handlebarsBlock checks a block and walks it in the context its helper renders it in
+func (l *logiclessLinter) handlebarsBlock(tmpl string, node *hbNode, stack []lintScope) {
+	expr := node.expr
+	name, isSimple := expr.path.simpleName()
+	if isSimple && !node.inverted && (name == "if" || name == "unless" || name == "each" || name == "with") {
+		value := &dataShape{open: true, detached: true}
+		for i, param := range expr.params {
+			if shape := l.handlebarsExpr(param, stack, tmpl, node.line, false); i == 0 {
+				value = shape
+			}
+		}
+		l.handlebarsHash(expr, stack, tmpl, node.line)
+
+		program := stack
+		switch name {
+		case "each":
+			// each also iterates over the values of an object
+			list := value
+			if !list.list {
+				list = &dataShape{path: value.path, list: true, detached: value.detached}
+			}
+			program = l.section(stack, list, node.blockParams)
+		case "with":
+			program = pushScope(stack, value, node.blockParams, value)
+		}
+		l.handlebars(tmpl, node.program, program)
+		l.handlebars(tmpl, node.inverse, stack)
+		return
+	}
+
+	program := stack
+	if len(expr.params) > 0 || len(expr.hash) > 0 {
+		l.report(SeverityError, IssueUnknownFunction, tmpl, node.line, "", fmt.Sprintf("unknown block helper %q", expr.path.original))
+		for _, param := range expr.params {
+			l.handlebarsExpr(param, stack, tmpl, node.line, false)
+		}
+		l.handlebarsHash(expr, stack, tmpl, node.line)
+	} else {
+		// A block without a helper is a Mustache section
+		value, _ := l.handlebarsPath(expr.path, stack, tmpl, node.line, true)
+		if !node.inverted {
+			program = l.section(stack, value, node.blockParams)
+		}
+	}
+	l.handlebars(tmpl, node.program, program)
+	l.handlebars(tmpl, node.inverse, stack)
+}
+
+// handlebarsPartial checks a partial with its context: its parameter, extended by its
+// hash arguments
+func (l *logiclessLinter) handlebarsPartial(tmpl string, node *hbNode, stack []lintScope) {
+	if node.dynamic != nil {
+		l.handlebarsHelper(node.dynamic, stack, tmpl, node.line)
+	}
+	context := stack
+	if len(node.expr.params) > 0 {
+		value := l.handlebarsExpr(node.expr.params[0], stack, tmpl, node.line, false)
+		context = pushScope(context, value, nil)
+	}
+	if len(node.expr.hash) > 0 {
+		dot := context[len(context)-1].dot
+		value := &dataShape{path: dot.path, fields: make(map[string]*dataShape), open: dot.open, detached: dot.detached}
+		for name, field := range dot.fields {
+			value.fields[name] = field
+		}
+		keys, _ := sortedKeys(node.expr.hash)
+		for _, key := range keys {
+			value.fields[key] = l.handlebarsExpr(node.expr.hash[key], stack, tmpl, node.line, false)
+		}
+		context = pushScope(context, value, nil)
+	}
+	// The name of a dynamic partial is only known when rendering
+	if node.dynamic != nil {
+		return
+	}
+	l.partial(node.partial, tmpl, node.line, SeverityError, func(content string) error {
+		partial, err := parseHandlebars(content)
+		if err == nil {
+			l.handlebars(node.partial, partial.nodes, context)
+		}
+		return err
+	})
+}
+
+// handlebarsExpr checks an expression and returns the shape of its value. In a {{...}}
+// tag, a name without arguments is a value when the data has it and a helper call
+// otherwise; as a parameter, it is always a value.
+func (l *logiclessLinter) handlebarsExpr(expr *hbExpr, stack []lintScope, tmpl string, line int, tag bool) *dataShape {
+	if expr == nil || expr.path == nil {
+		// Literals
+		return &dataShape{scalar: true, detached: true}
+	}
+	if expr.sub || len(expr.params) > 0 || len(expr.hash) > 0 {
+		l.handlebarsHelper(expr, stack, tmpl, line)
+		return &dataShape{open: true, detached: true}
+	}
+	name, _ := expr.path.simpleName()
+	_, isHelper := l.helpers[name]
+	value, _ := l.handlebarsPath(expr.path, stack, tmpl, line, !tag || !isHelper)
+	return value
+}
+
+// handlebarsHelper checks a helper call and its arguments
+func (l *logiclessLinter) handlebarsHelper(expr *hbExpr, stack []lintScope, tmpl string, line int) {
+	name, _ := expr.path.simpleName()
+	if _, ok := l.helpers[name]; !ok && name != "lookup" {
+		l.report(SeverityError, IssueUnknownFunction, tmpl, line, "", fmt.Sprintf("unknown helper %q", expr.path.original))
+	}
+	for _, param := range expr.params {
+		l.handlebarsExpr(param, stack, tmpl, line, false)
+	}
+	l.handlebarsHash(expr, stack, tmpl, line)
+}
+
+func (l *logiclessLinter) handlebarsHash(expr *hbExpr, stack []lintScope, tmpl string, line int) {
+	keys, _ := sortedKeys(expr.hash)
+	for _, key := range keys {
+		l.handlebarsExpr(expr.hash[key], stack, tmpl, line, false)
+	}
+}
+
+// handlebarsPath returns the shape of the value a path refers to: @root and paths
+// relative to a context are resolved in that context only, and simple names from the
+// innermost context out
+func (l *logiclessLinter) handlebarsPath(path *hbPath, stack []lintScope, tmpl string, line int, report bool) (*dataShape, bool) {
+	index := len(stack) - 1 - path.depth
+	if index < 0 {
+		index = 0
+	}
+	switch {
+	case path.data:
+		if path.parts[0] != "root" {
+			// @index, @key, @first and @last
+			return &dataShape{scalar: true, detached: true}, true
+		}
+		return l.follow(l.root, path.parts[1:], tmpl, line), true
+	case path.scoped || path.depth > 0 || len(path.parts) == 0:
+		return l.follow(stack[index].dot, path.parts, tmpl, line), true
+	}
+	return l.name(stack[:index+1], path.parts, tmpl, line, report)
+}
+
+func (l *logiclessLinter) mustache(tmpl string, nodes []*mustacheNode, stack []lintScope) {
+	for _, node := range nodes {
+		switch node.kind {
+		case mustacheVariable:
+			l.mustacheName(node.text, stack, tmpl, node.line)
+		case mustacheSection:
+			value := l.mustacheName(node.text, stack, tmpl, node.line)
+			l.mustache(tmpl, node.children, l.section(stack, value, nil))
+		case mustacheInverted:
+			// Inverted sections render in the current context
+			l.mustacheName(node.text, stack, tmpl, node.line)
+			l.mustache(tmpl, node.children, stack)
+		case mustachePartial:
+			// A missing partial renders as empty text unless strict mode is enabled
+			l.partial(node.text, tmpl, node.line, SeverityWarning, func(content string) error {
+				partial, err := parseMustache(content)
+				if err == nil {
+					l.mustache(node.text, partial.nodes, stack)
+				}
+				return err
+			})
+		}
+	}
+}
+
+// mustacheName returns the shape of the value a Mustache tag name refers to
+func (l *logiclessLinter) mustacheName(name string, stack []lintScope, tmpl string, line int) *dataShape {
+	if name == "." {
+		return stack[len(stack)-1].dot
+	}
+	value, _ := l.name(stack, strings.Split(name, "."), tmpl, line, true)
+	return value
+}
+
+// logiclessLine finds the line number in Handlebars and Mustache parse errors
+var logiclessLine = regexp.MustCompile(`at line (\d+)`)
+
+func logiclessSyntaxIssue(err error, tmpl string) ValidationIssue {
+	issue := ValidationIssue{Severity: SeverityError, Code: IssueSyntaxError, Message: err.Error(), Template: tmpl}
+	if m := logiclessLine.FindStringSubmatch(err.Error()); m != nil {
+		issue.Line, _ = strconv.Atoi(m[1])
+	}
+	return issue
+}
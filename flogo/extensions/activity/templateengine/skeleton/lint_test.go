@@ -0,0 +1,263 @@
+package templateengine
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"customer": {
+			"type": "object",
+			"properties": {"name": {"type": "string"}, "email": {"type": "string"}}
+		},
+		"items": {
+			"type": "array",
+			"items": {"type": "object", "properties": {"sku": {"type": "string"}, "price": {"type": "number"}}}
+		},
+		"metadata": {"type": "object", "additionalProperties": true},
+		"coupon": {"type": "string"}
+	}
+}`
+
+func newLintActivity(t *testing.T, engine string) *Activity {
+	act, err := New(test.NewActivityInitContext(&Settings{
+		TemplateEngine: engine,
+		EnableSafeMode: true,
+		TemplatePath: writeTemplates(t, map[string]string{
+			"partials/signature.tmpl": "-- {{.name}} {{.title}}",
+		}),
+	}, nil))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	return act.(*Activity)
+}
+
+func parseSchema(t *testing.T, schema string) map[string]interface{} {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+		t.Fatalf("Invalid schema: %v", err)
+	}
+	return parsed
+}
+
+// issueStrings formats issues for comparison
+func issueStrings(issues []ValidationIssue) []string {
+	formatted := make([]string, len(issues))
+	for i, issue := range issues {
+		formatted[i] = issue.Code + " " + issue.String()
+	}
+	return formatted
+}
+
+func TestValidateTemplateAgainstSchema(t *testing.T) {
+	act := newLintActivity(t, "go")
+	schema := parseSchema(t, orderSchema)
+
+	tests := []struct {
+		name     string
+		template string
+		expected []string
+	}{
+		{
+			"Valid template",
+			"Hi {{.customer.name}} ({{.customer.email | lower}})\n{{range .items}}{{.sku}}: {{.price}}{{end}}\n{{.metadata.source}} {{.coupon}} {{._date}}",
+			nil,
+		},
+		{
+			"Unknown nested field",
+			"Hi {{.customer.name}}\n{{if .customer.adress}}x{{end}}",
+			[]string{
+				`unknownField main:2:6: error: unknown field "customer.adress"`,
+				`unusedInput warning: input "coupon" is declared but not used`,
+				`unusedInput warning: input "items" is declared but not used`,
+				`unusedInput warning: input "metadata" is declared but not used`,
+			},
+		},
+		{
+			"Range and with scopes",
+			"{{with .customer}}{{.nam}}{{end}}\n{{range $i, $item := .items}}{{$item.qty}} {{$.coupon}} {{.sku}}{{end}}\n{{.metadata.anything}}",
+			[]string{
+				`unknownField main:1:21: error: unknown field "customer.nam"`,
+				`unknownField main:2:32: error: unknown field "items[].qty"`,
+			},
+		},
+		{
+			"Fields of lists and scalars",
+			"{{.items.sku}} {{.coupon.code}} {{.customer.name}} {{.metadata.x}}",
+			[]string{
+				`unknownField main:1:3: error: unknown field "items.sku": items is a list`,
+				`unknownField main:1:18: error: unknown field "coupon.code": coupon is not an object`,
+			},
+		},
+		{
+			"Unknown functions and partials",
+			"{{upper .customer.name}} {{sha512 .coupon}}\n{{range .items}}{{fmtMoney .price}}{{end}}\n{{template \"signature\" .customer}}{{template \"footer\" .metadata}}",
+			[]string{
+				`unknownFunction main:1:28: error: unknown function "sha512"`,
+				`unknownFunction main:2:19: error: unknown function "fmtMoney"`,
+				`unknownField signature:1:16: error: unknown field "customer.title"`,
+				`missingPartial main:3:46: error: missing partial "footer"`,
+			},
+		},
+		{
+			"Syntax error",
+			"Hello\n{{if .customer}}",
+			[]string{`syntaxError main:2: error: unexpected EOF`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := act.ValidateTemplate(tt.template, schema, nil)
+			got := issueStrings(result.Issues)
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+			hasErrors := false
+			for _, line := range tt.expected {
+				hasErrors = hasErrors || strings.Contains(line, ": error: ")
+			}
+			if result.Valid == hasErrors {
+				t.Errorf("Expected valid %t, got %t", !hasErrors, result.Valid)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateAgainstSample(t *testing.T) {
+	act := newLintActivity(t, "go")
+	sample := map[string]interface{}{
+		"name":  "Jane",
+		"lines": []interface{}{map[string]interface{}{"sku": "A"}, map[string]interface{}{"sku": "B", "qty": 2}},
+	}
+
+	result := act.ValidateTemplate("{{.name}}{{range .lines}}{{.sku}}{{.qty}}{{.price}}{{end}}{{.nme}}", nil, sample)
+	expected := []string{
+		`unknownField main:1:44: error: unknown field "lines[].price"`,
+		`unknownField main:1:61: error: unknown field "nme"`,
+	}
+	if got := issueStrings(result.Issues); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Without a schema or sample only syntax, functions and partials are checked
+	result = act.ValidateTemplate("{{.anything.at.all}} {{nosuch}}", nil, nil)
+	if got := issueStrings(result.Issues); len(got) != 1 || !strings.Contains(got[0], `unknown function "nosuch"`) {
+		t.Errorf("Expected only the unknown function, got %v", got)
+	}
+}
+
+func TestValidateLogiclessTemplates(t *testing.T) {
+	schema := parseSchema(t, orderSchema)
+	tests := []struct {
+		engine   string
+		template string
+		expected []string
+	}{
+		{"handlebars", "{{customer.name}} {{#each items}}{{sku}}{{/each}} {{upper coupon}} {{metadata}} {{totl}}", []string{
+			`unknownField main:1: error: unknown field "totl"`,
+		}},
+		{"mustache", "{{customer.name}}{{#items}}{{sku}}{{/items}}{{coupon}}{{metadata}}{{totl}}", []string{
+			`unknownField main:1: error: unknown field "totl"`,
+		}},
+		{"handlebars", "{{#if customer}}\n{{/each}}", []string{
+			`syntaxError main:2: error: closing tag "each" at line 2 does not match block "if" opened at line 1`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			result := newLintActivity(t, tt.engine).ValidateTemplate(tt.template, schema, nil)
+			if got := issueStrings(result.Issues); strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateLogiclessScopes(t *testing.T) {
+	schema := parseSchema(t, orderSchema)
+	templates := writeTemplates(t, map[string]string{"partials/greeting.tmpl": "Hi {{name}}, {{nme}}"})
+	tests := []struct {
+		engine   string
+		template string
+		expected []string
+	}{
+		{"handlebars", "{{#each items as |item i|}}{{i}} {{item.sku}} {{x}}{{/each}}\n{{#with customer}}{{> greeting}}{{/with}} {{bogus coupon}}\n{{> footer}} {{metadata.any}} {{#if @root.coupon}}{{upper coupon}}{{/if}}", []string{
+			`unknownField main:1: error: unknown field "items[].x"`,
+			`unknownField greeting:1: error: unknown field "customer.nme"`,
+			`unknownFunction main:2: error: unknown helper "bogus"`,
+			`missingPartial main:3: error: missing partial "footer"`,
+		}},
+		{"mustache", "{{#items}}{{sku}} {{x}}{{/items}}\n{{#customer}}{{> greeting}}{{/customer}}{{coupon}}\n{{> footer}}{{metadata.any}}", []string{
+			`unknownField main:1: error: unknown field "items[].x"`,
+			`unknownField greeting:1: error: unknown field "customer.nme"`,
+			`missingPartial main:3: warning: missing partial "footer"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			act, err := New(test.NewActivityInitContext(&Settings{TemplateEngine: tt.engine, TemplatePath: templates}, nil))
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+			result := act.(*Activity).ValidateTemplate(tt.template, schema, nil)
+			if got := issueStrings(result.Issues); strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+
+			// Names in a block are checked against the elements of sample data
+			sample := map[string]interface{}{"items": []interface{}{map[string]interface{}{"y": 1}}}
+			template := "{{#each items}}{{x}}{{/each}}"
+			if tt.engine == "mustache" {
+				template = "{{#items}}{{x}}{{/items}}"
+			}
+			result = act.(*Activity).ValidateTemplate(template, nil, sample)
+			if got := issueStrings(result.Issues); len(got) != 1 || got[0] != `unknownField main:1: error: unknown field "items[].x"` {
+				t.Errorf("Unexpected issues against sample data: %v", got)
+			}
+		})
+	}
+}
+
+func TestValidateOnlyMode(t *testing.T) {
+	act := newLintActivity(t, "go")
+
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", "Hi {{.customer.nme}}\n{{.coupon}}")
+	tc.SetInput("validateOnly", true)
+	tc.SetInput("dataSchema", parseSchema(t, orderSchema))
+	tc.SetInput("templateVariables", map[string]interface{}{"company": "Acme"})
+	act.Eval(tc)
+
+	if tc.GetOutput("success").(bool) {
+		t.Error("Expected validation to fail")
+	}
+	if errMsg := tc.GetOutput("error").(string); errMsg != "template validation failed with 1 errors" {
+		t.Errorf("Unexpected error: %q", errMsg)
+	}
+	result := tc.GetOutput("result").(string)
+	if !strings.HasPrefix(result, `main:1:6: error: unknown field "customer.nme"`) || !strings.Contains(result, `warning: input "company" is declared but not used`) {
+		t.Errorf("Unexpected report:\n%s", result)
+	}
+	issues := tc.GetOutput("validationIssues").([]interface{})
+	first := issues[0].(map[string]interface{})
+	if first["code"] != IssueUnknownField || first["line"] != float64(1) || first["field"] != "customer.nme" {
+		t.Errorf("Unexpected issue: %v", first)
+	}
+
+	// Sample data is used when there is no schema; the template is not rendered
+	tc = test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", "Hi {{.name}}")
+	tc.SetInput("validateOnly", true)
+	tc.SetInput("templateData", map[string]interface{}{"name": "Jane"})
+	act.Eval(tc)
+	if !tc.GetOutput("success").(bool) || tc.GetOutput("result") != "" || len(tc.GetOutput("validationIssues").([]interface{})) != 0 {
+		t.Errorf("Expected a clean validation, got %q: %v", tc.GetOutput("result"), tc.GetOutput("error"))
+	}
+}
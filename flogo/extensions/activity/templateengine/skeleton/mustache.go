@@ -0,0 +1,491 @@
+package templateengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPartialDepth bounds nested partials, so a partial that includes itself without a
+// terminating section fails instead of recursing forever
+const maxPartialDepth = 100
+
+// partialSource returns the source of a named partial. found is false when no partial
+// with that name exists.
+type partialSource func(name string) (content string, found bool, err error)
+
+type mustacheNodeKind int
+
+const (
+	mustacheText mustacheNodeKind = iota
+	mustacheVariable
+	mustacheSection
+	mustacheInverted
+	mustachePartial
+)
+
+// mustacheNode is a node of a parsed Mustache template
+type mustacheNode struct {
+	kind     mustacheNodeKind
+	text     string // literal text, or the tag name
+	escape   bool
+	indent   string // indentation of a standalone partial tag
+	line     int    // line of the tag
+	children []*mustacheNode
+}
+
+// mustacheTemplate is a parsed Mustache template. It is not modified by rendering, so
+// one parsed template can be rendered concurrently.
+type mustacheTemplate struct {
+	nodes []*mustacheNode
+}
+
+// parseMustache parses a template following the Mustache specification
+func parseMustache(src string) (*mustacheTemplate, error) {
+	otag, ctag := "{{", "}}"
+	root := &mustacheNode{}
+	stack := []*mustacheNode{root}
+	pos := 0
+
+	appendText := func(text string) {
+		if text != "" {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, &mustacheNode{kind: mustacheText, text: text})
+		}
+	}
+
+	for {
+		idx := strings.Index(src[pos:], otag)
+		if idx < 0 {
+			appendText(src[pos:])
+			break
+		}
+		start := pos + idx
+		line := strings.Count(src[:start], "\n") + 1
+		i := start + len(otag)
+		if i >= len(src) {
+			return nil, fmt.Errorf("unclosed tag at line %d", line)
+		}
+
+		sigil := src[i]
+		closing := ctag
+		switch sigil {
+		case '{':
+			closing = "}" + ctag
+			i++
+		case '=':
+			closing = "=" + ctag
+			i++
+		case '&', '#', '^', '/', '>', '!':
+			i++
+		default:
+			sigil = 0
+		}
+		j := strings.Index(src[i:], closing)
+		if j < 0 {
+			return nil, fmt.Errorf("unclosed tag at line %d", line)
+		}
+		content := src[i : i+j]
+		name := strings.TrimSpace(content)
+		end := i + j + len(closing)
+
+		text := src[pos:start]
+		indent := ""
+		switch sigil {
+		case '#', '^', '/', '>', '!', '=':
+			if lineStart, lineEnd, ok := standaloneLine(src, pos, start, end); ok {
+				indent = src[lineStart:start]
+				text = src[pos:lineStart]
+				end = lineEnd
+			}
+		}
+		appendText(text)
+		pos = end
+
+		if sigil != '!' && sigil != '=' && name == "" {
+			return nil, fmt.Errorf("empty tag at line %d", line)
+		}
+
+		parent := stack[len(stack)-1]
+		switch sigil {
+		case '!':
+		case '=':
+			delimiters := strings.Fields(content)
+			if len(delimiters) != 2 || strings.Contains(delimiters[0], "=") || strings.Contains(delimiters[1], "=") {
+				return nil, fmt.Errorf("invalid delimiters %q at line %d", content, line)
+			}
+			otag, ctag = delimiters[0], delimiters[1]
+		case '#', '^':
+			kind := mustacheSection
+			if sigil == '^' {
+				kind = mustacheInverted
+			}
+			node := &mustacheNode{kind: kind, text: name, line: line}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case '/':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected closing tag %q at line %d", name, line)
+			}
+			if parent.text != name {
+				return nil, fmt.Errorf("closing tag %q at line %d does not match section %q", name, line, parent.text)
+			}
+			stack = stack[:len(stack)-1]
+		case '>':
+			parent.children = append(parent.children, &mustacheNode{kind: mustachePartial, text: name, indent: indent, line: line})
+		default:
+			parent.children = append(parent.children, &mustacheNode{kind: mustacheVariable, text: name, escape: sigil == 0, line: line})
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("unclosed section %q", stack[len(stack)-1].text)
+	}
+	return &mustacheTemplate{nodes: root.children}, nil
+}
+
+// standaloneLine reports whether the tag spanning src[start:end] is alone on its line,
+// with only spaces or tabs around it. It returns the start of the line and the end of
+// the line including its newline, which a standalone tag removes from the output. Text
+// before pos was consumed by earlier tags.
+func standaloneLine(src string, pos, start, end int) (int, int, bool) {
+	lineStart := strings.LastIndexByte(src[pos:start], '\n')
+	switch {
+	case lineStart >= 0:
+		lineStart += pos + 1
+	case pos == 0 || src[pos-1] == '\n':
+		lineStart = pos
+	default:
+		return 0, 0, false
+	}
+	if strings.Trim(src[lineStart:start], " \t") != "" {
+		return 0, 0, false
+	}
+
+	lineEnd := end
+	for lineEnd < len(src) && (src[lineEnd] == ' ' || src[lineEnd] == '\t') {
+		lineEnd++
+	}
+	switch {
+	case lineEnd == len(src):
+		return lineStart, lineEnd, true
+	case src[lineEnd] == '\n':
+		return lineStart, lineEnd + 1, true
+	case src[lineEnd] == '\r' && lineEnd+1 < len(src) && src[lineEnd+1] == '\n':
+		return lineStart, lineEnd + 2, true
+	}
+	return 0, 0, false
+}
+
+// indentLines prefixes every non-empty line of text with indent
+func indentLines(text, indent string) string {
+	if indent == "" {
+		return text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+var mustacheEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;")
+
+// mustacheRenderer holds the state of one render, so parsed templates stay immutable
+type mustacheRenderer struct {
+	partials partialSource
+	strict   bool
+	escape   bool
+	parsed   map[string]*mustacheTemplate
+	depth    int
+	sandbox  *sandbox
+}
+
+// renderMustache renders a parsed template with data. In strict mode interpolating a
+// missing variable or including a missing partial is an error. With escape set,
+// {{name}} is HTML-escaped; plain text is rendered without it. The render stops when
+// it exceeds a limit of the sandbox, which may be nil.
+func renderMustache(tmpl *mustacheTemplate, data interface{}, partials partialSource, strict, escape bool, sb *sandbox) (string, error) {
+	r := &mustacheRenderer{partials: partials, strict: strict, escape: escape, parsed: make(map[string]*mustacheTemplate), sandbox: sb}
+	if err := sb.enter(); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := r.render(&b, tmpl.nodes, []interface{}{data}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (r *mustacheRenderer) render(b *strings.Builder, nodes []*mustacheNode, stack []interface{}) error {
+	for _, node := range nodes {
+		if err := r.sandbox.checkOutput(b.Len()); err != nil {
+			return err
+		}
+		switch node.kind {
+		case mustacheText:
+			b.WriteString(node.text)
+
+		case mustacheVariable:
+			value, found := mustacheLookup(stack, node.text)
+			if !found {
+				if r.strict {
+					return fmt.Errorf("missing variable %q", node.text)
+				}
+				continue
+			}
+			text := formatTemplateValue(value)
+			if node.escape && r.escape {
+				text = mustacheEscaper.Replace(text)
+			}
+			b.WriteString(text)
+
+		case mustacheSection:
+			value, found := mustacheLookup(stack, node.text)
+			if !found || isFalsey(value) {
+				continue
+			}
+			if items, ok := listItems(value); ok {
+				for _, item := range items {
+					if err := r.sandbox.loop(); err != nil {
+						return err
+					}
+					if err := r.render(b, node.children, pushContext(stack, item)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if value == true {
+				if err := r.render(b, node.children, stack); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.render(b, node.children, pushContext(stack, value)); err != nil {
+				return err
+			}
+
+		case mustacheInverted:
+			value, found := mustacheLookup(stack, node.text)
+			if !found || isFalsey(value) {
+				if err := r.render(b, node.children, stack); err != nil {
+					return err
+				}
+			}
+
+		case mustachePartial:
+			if err := r.renderPartial(b, node, stack); err != nil {
+				return err
+			}
+		}
+	}
+	return r.sandbox.checkOutput(b.Len())
+}
+
+func (r *mustacheRenderer) renderPartial(b *strings.Builder, node *mustacheNode, stack []interface{}) error {
+	key := node.text + "\x00" + node.indent
+	tmpl, ok := r.parsed[key]
+	if !ok {
+		var content string
+		found := false
+		if r.partials != nil {
+			var err error
+			if content, found, err = r.partials(node.text); err != nil {
+				return err
+			}
+		}
+		if !found {
+			if r.strict {
+				return fmt.Errorf("partial %q not found", node.text)
+			}
+			return nil
+		}
+
+		var err error
+		if tmpl, err = parseMustache(indentLines(content, node.indent)); err != nil {
+			return fmt.Errorf("partial %q: %v", node.text, err)
+		}
+		r.parsed[key] = tmpl
+	}
+
+	if r.depth >= maxPartialDepth {
+		return fmt.Errorf("partial %q: nesting exceeds %d levels", node.text, maxPartialDepth)
+	}
+	if err := r.sandbox.enter(); err != nil {
+		return err
+	}
+	r.depth++
+	defer func() {
+		r.depth--
+		r.sandbox.exit()
+	}()
+	return r.render(b, tmpl.nodes, stack)
+}
+
+// mustacheLookup resolves a tag name against the context stack. The first part of a
+// dotted name is looked up from the innermost context outwards; the remaining parts are
+// resolved within the value found.
+func mustacheLookup(stack []interface{}, name string) (interface{}, bool) {
+	if name == "." {
+		return stack[len(stack)-1], true
+	}
+
+	parts := strings.Split(name, ".")
+	var value interface{}
+	found := false
+	for i := len(stack) - 1; i >= 0 && !found; i-- {
+		value, found = lookupKey(stack[i], parts[0])
+	}
+	if !found {
+		return nil, false
+	}
+	for _, part := range parts[1:] {
+		if value, found = lookupKey(value, part); !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// pushContext returns a new context stack with value on top, leaving stack unchanged
+func pushContext(stack []interface{}, value interface{}) []interface{} {
+	return append(stack[:len(stack):len(stack)], value)
+}
+
+// lookupKey returns the value of a key in a map, an exported struct field, or an
+// element of a list when key is an index
+func lookupKey(value interface{}, key string) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case map[string]interface{}:
+		result, ok := v[key]
+		return result, ok
+	case map[string]string:
+		result, ok := v[key]
+		return result, ok
+	case []interface{}:
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(v) {
+			return v[index], true
+		}
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		result := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !result.IsValid() {
+			return nil, false
+		}
+		return result.Interface(), true
+	case reflect.Struct:
+		field, ok := rv.Type().FieldByName(key)
+		if !ok || field.PkgPath != "" {
+			return nil, false
+		}
+		return rv.FieldByIndex(field.Index).Interface(), true
+	case reflect.Slice, reflect.Array:
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < rv.Len() {
+			return rv.Index(index).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// listItems returns the elements of a slice or array
+func listItems(value interface{}) ([]interface{}, bool) {
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+// sortedKeys returns the keys of a map with string keys in sorted order
+func sortedKeys(value interface{}) ([]string, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	keys := make([]string, 0, rv.Len())
+	for _, key := range rv.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys, true
+}
+
+// isFalsey reports whether a value hides a section: nil, false, zero, the empty string
+// and empty lists
+func isFalsey(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Slice, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// formatTemplateValue formats an interpolated value. Numbers are written without
+// trailing zeros or exponents, nil as the empty string.
+func formatTemplateValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
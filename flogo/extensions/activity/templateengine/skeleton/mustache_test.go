@@ -0,0 +1,123 @@
+package templateengine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mustacheSpecTest is a test case of the official Mustache specification
+type mustacheSpecTest struct {
+	Name     string            `json:"name"`
+	Desc     string            `json:"desc"`
+	Data     interface{}       `json:"data"`
+	Template string            `json:"template"`
+	Partials map[string]string `json:"partials"`
+	Expected string            `json:"expected"`
+}
+
+// loadMustacheSpec loads the spec modules from testdata/mustache-spec
+func loadMustacheSpec(t *testing.T) map[string][]mustacheSpecTest {
+	files, err := filepath.Glob(filepath.Join("testdata", "mustache-spec", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Failed to find Mustache spec files: %v", err)
+	}
+
+	modules := make(map[string][]mustacheSpecTest)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		var spec struct {
+			Tests []mustacheSpecTest `json:"tests"`
+		}
+		if err := json.Unmarshal(content, &spec); err != nil {
+			t.Fatalf("Failed to parse %s: %v", file, err)
+		}
+		modules[strings.TrimSuffix(filepath.Base(file), ".json")] = spec.Tests
+	}
+	return modules
+}
+
+// mapPartials returns a partial source backed by a map
+func mapPartials(partials map[string]string) partialSource {
+	return func(name string) (string, bool, error) {
+		content, ok := partials[name]
+		return content, ok, nil
+	}
+}
+
+func TestMustacheSpec(t *testing.T) {
+	for module, tests := range loadMustacheSpec(t) {
+		for _, tt := range tests {
+			tt := tt
+			t.Run(module+"/"+tt.Name, func(t *testing.T) {
+				tmpl, err := parseMustache(tt.Template)
+				if err != nil {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				result, err := renderMustache(tmpl, tt.Data, mapPartials(tt.Partials), false, true, nil)
+				if err != nil {
+					t.Fatalf("Render failed: %v", err)
+				}
+				if result != tt.Expected {
+					t.Errorf("%s\nTemplate: %q\nExpected: %q\nGot:      %q", tt.Desc, tt.Template, tt.Expected, result)
+				}
+			})
+		}
+	}
+}
+
+func TestMustacheErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"Unclosed tag", "Hello {{name", "unclosed tag at line 1"},
+		{"Unclosed section", "{{#items}}\n{{name}}", `unclosed section "items"`},
+		{"Mismatched closing tag", "{{#items}}\n{{/item}}", `closing tag "item" at line 2 does not match section "items"`},
+		{"Unexpected closing tag", "{{/items}}", `unexpected closing tag "items" at line 1`},
+		{"Invalid delimiters", "{{=<% %> x=}}", "invalid delimiters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMustache(tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestMustacheStrictMode(t *testing.T) {
+	tmpl, err := parseMustache("Hello {{name}}{{#missing}}!{{/missing}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	result, err := renderMustache(tmpl, map[string]interface{}{"name": "Jane"}, nil, true, true, nil)
+	if err != nil || result != "Hello Jane" {
+		t.Errorf("Missing sections should be falsey in strict mode, got %q, %v", result, err)
+	}
+
+	_, err = renderMustache(tmpl, map[string]interface{}{}, nil, true, true, nil)
+	if err == nil || !strings.Contains(err.Error(), `missing variable "name"`) {
+		t.Errorf("Expected missing variable error, got %v", err)
+	}
+}
+
+func TestMustachePartialRecursionLimit(t *testing.T) {
+	tmpl, err := parseMustache("{{>loop}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	_, err = renderMustache(tmpl, nil, mapPartials(map[string]string{"loop": "x{{>loop}}"}), false, true, nil)
+	if err == nil || !strings.Contains(err.Error(), "nesting exceeds") {
+		t.Errorf("Expected nesting error, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package templateengine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Render limit errors. A render that exceeds a limit fails with an error that wraps one
+// of these, so it can be told apart from template errors with errors.Is.
+var (
+	ErrRenderTimeout  = errors.New("render timeout exceeded")
+	ErrOutputLimit    = errors.New("output size limit exceeded")
+	ErrLoopLimit      = errors.New("loop iteration limit exceeded")
+	ErrRecursionLimit = errors.New("template recursion limit exceeded")
+)
+
+// Render limits used in safe mode for limits that are not configured
+const (
+	defaultRenderTimeout     = 5 * time.Second
+	defaultMaxOutputSize     = 1 << 20
+	defaultMaxLoopIterations = 10000
+	defaultMaxTemplateDepth  = 25
+)
+
+// renderLimits bound a single render. A zero limit is not enforced.
+type renderLimits struct {
+	timeout       time.Duration
+	maxOutputSize int
+	maxIterations int // loop iterations across all loops of the render
+	maxDepth      int // nested templates and partials, counting the template itself
+}
+
+// newRenderLimits returns the configured limits. In safe mode a limit that is not set
+// uses its default; a negative limit is never enforced.
+func newRenderLimits(s *Settings) renderLimits {
+	limit := func(value, safeDefault int) int {
+		switch {
+		case value < 0:
+			return 0
+		case value == 0 && s.EnableSafeMode:
+			return safeDefault
+		}
+		return value
+	}
+	return renderLimits{
+		timeout:       time.Duration(limit(s.RenderTimeout, int(defaultRenderTimeout/time.Millisecond))) * time.Millisecond,
+		maxOutputSize: limit(s.MaxOutputSize, defaultMaxOutputSize),
+		maxIterations: limit(s.MaxLoopIterations, defaultMaxLoopIterations),
+		maxDepth:      limit(s.MaxTemplateDepth, defaultMaxTemplateDepth),
+	}
+}
+
+func (l renderLimits) enabled() bool {
+	return l.timeout > 0 || l.maxOutputSize > 0 || l.maxIterations > 0 || l.maxDepth > 0
+}
+
+// renderLimitError reports the limit a render exceeded
+type renderLimitError struct {
+	err    error
+	detail string
+}
+
+func (e *renderLimitError) Error() string { return e.err.Error() + ": " + e.detail }
+func (e *renderLimitError) Unwrap() error { return e.err }
+
+// asRenderLimitError returns the render limit error in err's chain, if any
+func asRenderLimitError(err error) (*renderLimitError, bool) {
+	var limitErr *renderLimitError
+	ok := errors.As(err, &limitErr)
+	return limitErr, ok
+}
+
+// sandbox tracks one render against its limits. A nil sandbox enforces nothing.
+type sandbox struct {
+	limits     renderLimits
+	deadline   time.Time
+	iterations int
+	depth      int
+}
+
+// newSandbox returns a sandbox for a render, or nil if no limits are enforced
+func newSandbox(limits renderLimits) *sandbox {
+	if !limits.enabled() {
+		return nil
+	}
+	s := &sandbox{limits: limits}
+	s.start()
+	return s
+}
+
+// start resets the counters and the deadline for a new render
+func (s *sandbox) start() {
+	if s == nil {
+		return
+	}
+	s.iterations, s.depth = 0, 0
+	if s.limits.timeout > 0 {
+		s.deadline = time.Now().Add(s.limits.timeout)
+	}
+}
+
+// checkTime fails once the render has run past its deadline
+func (s *sandbox) checkTime() error {
+	if s == nil || s.limits.timeout <= 0 || time.Now().Before(s.deadline) {
+		return nil
+	}
+	return &renderLimitError{ErrRenderTimeout, fmt.Sprintf("rendering took longer than %v", s.limits.timeout)}
+}
+
+// loop counts a loop iteration
+func (s *sandbox) loop() error {
+	if s == nil {
+		return nil
+	}
+	s.iterations++
+	if s.limits.maxIterations > 0 && s.iterations > s.limits.maxIterations {
+		return &renderLimitError{ErrLoopLimit, fmt.Sprintf("more than %d iterations", s.limits.maxIterations)}
+	}
+	return s.checkTime()
+}
+
+// enter counts a template or partial being rendered; exit must follow when it is done
+func (s *sandbox) enter() error {
+	if s == nil {
+		return nil
+	}
+	s.depth++
+	if s.limits.maxDepth > 0 && s.depth > s.limits.maxDepth {
+		return &renderLimitError{ErrRecursionLimit, fmt.Sprintf("more than %d nested templates", s.limits.maxDepth)}
+	}
+	return s.checkTime()
+}
+
+func (s *sandbox) exit() {
+	if s != nil {
+		s.depth--
+	}
+}
+
+// checkOutput fails once the render has produced more than the output limit
+func (s *sandbox) checkOutput(size int) error {
+	if s == nil {
+		return nil
+	}
+	if s.limits.maxOutputSize > 0 && size > s.limits.maxOutputSize {
+		return &renderLimitError{ErrOutputLimit, fmt.Sprintf("more than %d bytes", s.limits.maxOutputSize)}
+	}
+	return s.checkTime()
+}
+
+// Go templates call the sandbox through these functions, which instrumentTree adds to
+// every loop and template. Templates compiled without a sandbox use no-op versions.
+const (
+	sandboxLoopFunc  = "_sandboxLoop"
+	sandboxEnterFunc = "_sandboxEnter"
+	sandboxExitFunc  = "_sandboxExit"
+)
+
+// funcs returns the sandbox functions for a Go template
+func (s *sandbox) funcs() template.FuncMap {
+	return template.FuncMap{
+		sandboxLoopFunc:  func() (string, error) { return "", s.loop() },
+		sandboxEnterFunc: func() (string, error) { return "", s.enter() },
+		sandboxExitFunc:  func() (string, error) { s.exit(); return "", nil },
+	}
+}
+
+// sandboxActions holds one {{$_sandbox := ...}} action per sandbox function. Declaring
+// a variable keeps the actions out of the output, and html/template does not escape them.
+var sandboxActions = func() map[string]*parse.ActionNode {
+	noop := func() (string, error) { return "", nil }
+	actions := make(map[string]*parse.ActionNode)
+	for _, name := range []string{sandboxLoopFunc, sandboxEnterFunc, sandboxExitFunc} {
+		t := template.Must(template.New(name).Funcs(template.FuncMap{name: noop}).Parse("{{$_sandbox := " + name + "}}"))
+		actions[name] = t.Tree.Root.Nodes[0].(*parse.ActionNode)
+	}
+	return actions
+}()
+
+// sandboxAction returns a call to a sandbox function, reported at pos in tree
+func sandboxAction(name string, tree *parse.Tree, pos parse.Pos) *parse.ActionNode {
+	action := sandboxActions[name].Copy().(*parse.ActionNode)
+	ident := action.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	ident.SetTree(tree).SetPos(pos)
+	return action
+}
+
+// instrumentTree adds the sandbox calls to a parsed Go template: each template counts
+// as one level of nesting and each loop iteration is counted
+func instrumentTree(tree *parse.Tree) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+			n.List.Nodes = append([]parse.Node{sandboxAction(sandboxLoopFunc, tree, n.Pos)}, n.List.Nodes...)
+		}
+	}
+	walk(tree.Root)
+
+	root := tree.Root
+	root.Nodes = append([]parse.Node{sandboxAction(sandboxEnterFunc, tree, root.Pos)}, root.Nodes...)
+	root.Nodes = append(root.Nodes, sandboxAction(sandboxExitFunc, tree, root.Pos))
+}
+
+// sandboxWriter fails a render that writes more than the output limit or runs past
+// its deadline
+type sandboxWriter struct {
+	w       io.Writer
+	sandbox *sandbox
+	written int
+}
+
+func (w *sandboxWriter) Write(p []byte) (int, error) {
+	if err := w.sandbox.checkOutput(w.written + len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	w.written += n
+	return n, err
+}
+
+// sandboxedTemplate is a Go template compiled for renders with limits. The sandbox
+// functions are bound when a template is compiled, so each compiled instance has its
+// own sandbox and is used by one render at a time.
+type sandboxedTemplate struct {
+	limits  renderLimits
+	compile func(*sandbox) (executableTemplate, error)
+	pool    sync.Pool
+}
+
+type sandboxedInstance struct {
+	tmpl    executableTemplate
+	sandbox *sandbox
+}
+
+// newSandboxedTemplate compiles the first instance of a template, reporting any
+// compile errors
+func newSandboxedTemplate(limits renderLimits, compile func(*sandbox) (executableTemplate, error)) (*sandboxedTemplate, error) {
+	t := &sandboxedTemplate{limits: limits, compile: compile}
+	instance, err := t.newInstance()
+	if err != nil {
+		return nil, err
+	}
+	t.pool.Put(instance)
+	return t, nil
+}
+
+func (t *sandboxedTemplate) newInstance() (*sandboxedInstance, error) {
+	sb := &sandbox{limits: t.limits}
+	tmpl, err := t.compile(sb)
+	if err != nil {
+		return nil, err
+	}
+	return &sandboxedInstance{tmpl: tmpl, sandbox: sb}, nil
+}
+
+// Execute renders the template within its limits
+func (t *sandboxedTemplate) Execute(w io.Writer, data interface{}) error {
+	instance, ok := t.pool.Get().(*sandboxedInstance)
+	if !ok {
+		var err error
+		if instance, err = t.newInstance(); err != nil {
+			return err
+		}
+	}
+	defer t.pool.Put(instance)
+
+	instance.sandbox.start()
+	return instance.tmpl.Execute(&sandboxWriter{w: w, sandbox: instance.sandbox}, data)
+}
@@ -0,0 +1,159 @@
+package templateengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+func newLimitedActivity(t *testing.T, engine string, settings Settings) *Activity {
+	settings.TemplateEngine = engine
+	settings.TemplateCacheSize = 10
+	partial := "x{{> loop}}"
+	if engine == "go" {
+		partial = `x{{template "loop" .}}`
+	}
+	settings.TemplatePath = writeTemplates(t, map[string]string{"partials/loop.tmpl": partial})
+	act, err := New(test.NewActivityInitContext(&settings, nil))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	return act.(*Activity)
+}
+
+func items(n int) []interface{} {
+	list := make([]interface{}, n)
+	for i := range list {
+		list[i] = i
+	}
+	return list
+}
+
+func TestRenderLimits(t *testing.T) {
+	templates := map[string]map[string]string{
+		"go": {
+			"loop":      `{{range .items}}{{.}}{{end}}`,
+			"output":    `{{range .items}}0123456789{{end}}`,
+			"recursion": `{{template "loop" .}}`,
+			"timeout":   `{{range .items}}{{range $.items}}{{range $.items}}{{end}}{{end}}{{end}}`,
+		},
+		"handlebars": {
+			"loop":      `{{#each items}}{{this}}{{/each}}`,
+			"output":    `{{#each items}}0123456789{{/each}}`,
+			"recursion": `{{> loop}}`,
+			"timeout":   `{{#each items}}{{#each @root.items}}{{#each @root.items}}{{/each}}{{/each}}{{/each}}`,
+		},
+		"mustache": {
+			"loop":      `{{#items}}{{.}}{{/items}}`,
+			"output":    `{{#items}}0123456789{{/items}}`,
+			"recursion": `{{> loop}}`,
+			"timeout":   `{{#items}}{{#items}}{{#items}}{{/items}}{{/items}}{{/items}}`,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		template string
+		items    int
+		err      error
+		expected string
+	}{
+		{"Loop iterations", Settings{MaxLoopIterations: 10}, "loop", 11, ErrLoopLimit, "loop iteration limit exceeded: more than 10 iterations"},
+		{"Output size", Settings{MaxOutputSize: 100}, "output", 11, ErrOutputLimit, "output size limit exceeded: more than 100 bytes"},
+		{"Recursion depth", Settings{MaxTemplateDepth: 5}, "recursion", 0, ErrRecursionLimit, "template recursion limit exceeded: more than 5 nested templates"},
+		{"Timeout", Settings{RenderTimeout: 20}, "timeout", 1000, ErrRenderTimeout, "render timeout exceeded: rendering took longer than 20ms"},
+	}
+
+	for _, engine := range []string{"go", "handlebars", "mustache"} {
+		for _, escapeHTML := range []bool{false, true} {
+			if escapeHTML && engine != "go" {
+				continue
+			}
+			for _, tt := range tests {
+				t.Run(fmt.Sprintf("%s/html=%t/%s", engine, escapeHTML, tt.name), func(t *testing.T) {
+					act := newLimitedActivity(t, engine, tt.settings)
+					rc := &renderContext{data: map[string]interface{}{"items": items(tt.items)}, escapeHTML: escapeHTML}
+					_, _, err := act.processTemplate(rc, templates[engine][tt.template])
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected %v, got %v", tt.err, err)
+					}
+					if err.Error() != tt.expected {
+						t.Errorf("Expected error %q, got %q", tt.expected, err.Error())
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestRenderLimitsWithinBounds(t *testing.T) {
+	for _, engine := range []string{"go", "handlebars", "mustache"} {
+		act := newLimitedActivity(t, engine, Settings{MaxLoopIterations: 10, MaxOutputSize: 10, MaxTemplateDepth: 1})
+		template := map[string]string{
+			"go":         `{{range .items}}{{.}}{{end}}`,
+			"handlebars": `{{#each items}}{{this}}{{/each}}`,
+			"mustache":   `{{#items}}{{.}}{{/items}}`,
+		}[engine]
+
+		// The counters start over for every render of a cached template
+		for i := 0; i < 3; i++ {
+			result, _, err := act.processTemplate(&renderContext{data: map[string]interface{}{"items": items(10)}}, template)
+			if err != nil || result != "0123456789" {
+				t.Errorf("%s: expected the render to stay within its limits, got %q, %v", engine, result, err)
+			}
+		}
+	}
+}
+
+func TestRenderLimitsSafeMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		expected renderLimits
+	}{
+		{"Safe mode defaults", Settings{EnableSafeMode: true}, renderLimits{defaultRenderTimeout, defaultMaxOutputSize, defaultMaxLoopIterations, defaultMaxTemplateDepth}},
+		{"Safe mode with configured limits", Settings{EnableSafeMode: true, RenderTimeout: 100, MaxLoopIterations: -1}, renderLimits{100 * time.Millisecond, defaultMaxOutputSize, 0, defaultMaxTemplateDepth}},
+		{"Full mode", Settings{}, renderLimits{}},
+		{"Full mode with configured limits", Settings{MaxOutputSize: 512}, renderLimits{maxOutputSize: 512}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if limits := newRenderLimits(&tt.settings); limits != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, limits)
+			}
+		})
+	}
+
+	act := newLimitedActivity(t, "go", Settings{EnableSafeMode: true})
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", `{{range .items}}{{end}}`)
+	tc.SetInput("templateData", map[string]interface{}{"items": items(defaultMaxLoopIterations + 1)})
+	act.Eval(tc)
+	if errMsg := tc.GetOutput("error").(string); !strings.Contains(errMsg, "loop iteration limit exceeded") {
+		t.Errorf("Expected safe mode to limit loops, got %q", errMsg)
+	}
+}
+
+func TestRenderLimitsConcurrent(t *testing.T) {
+	act := newLimitedActivity(t, "go", Settings{MaxLoopIterations: 50})
+	template := `{{range .items}}{{.}},{{end}}`
+
+	runParallel(8, 50, func(worker, i int) {
+		count := 45 + (worker+i)%10
+		result, _, err := act.processTemplate(&renderContext{data: map[string]interface{}{"items": items(count)}, escapeHTML: i%2 == 0}, template)
+		if count > 50 {
+			if !errors.Is(err, ErrLoopLimit) {
+				t.Errorf("Expected the loop limit for %d items, got %v", count, err)
+			}
+			return
+		}
+		if err != nil || strings.Count(result, ",") != count {
+			t.Errorf("Expected %d items, got %q, %v", count, result, err)
+		}
+	})
+}
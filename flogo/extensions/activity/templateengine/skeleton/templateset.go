@@ -0,0 +1,376 @@
+package templateengine
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateSetVersion numbers template sets, so templates compiled with a set that was
+// since reloaded are not taken from the cache
+var templateSetVersion uint64
+
+// blockPattern finds {{block "name" ...}} actions, which define templates that other
+// templates may override
+var blockPattern = regexp.MustCompile(`\{\{-?\s*block\s+"([^"]+)"`)
+
+// templateSet holds every template under the template path. Each file is available by
+// its name without the .tmpl extension, so partials/header.tmpl is {{template "header" .}}.
+// Templates defined with {{define}} or {{block}} in files in subdirectories, such as
+// partials/ and layouts/, are shared by all templates; those defined in top-level
+// templates stay local to that template.
+type templateSet struct {
+	funcs    template.FuncMap
+	base     *template.Template     // shared Go templates, nil for the Handlebars and Mustache engines
+	htmlBase *htmltemplate.Template // the shared Go templates for html/template
+	sources  map[string]string      // template source by name
+	files    map[string]string      // file that defines each shared name
+	blocks   map[string]bool        // names defined with {{block}}, which templates may override
+	invalid  map[string]error       // parse errors of top-level templates, reported when they are used
+	modTimes map[string]time.Time   // modification time of each file, nil if the template path does not exist
+	version  uint64
+
+	catalogs     map[string]map[string]*message // messages by locale
+	catalogFiles map[string]string              // file that defines each catalog
+}
+
+// executableTemplate is a compiled text/template or html/template
+type executableTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// goTemplate is a compiled Go template with the data it references
+type goTemplate struct {
+	tmpl       executableTemplate
+	references *templateReferences
+}
+
+// compileOptions select how a Go template is compiled
+type compileOptions struct {
+	escapeHTML bool       // render with html/template
+	strict     bool       // fail on missing map keys
+	localizer  *localizer // messages and formats of the locale, nil for none
+	entry      string     // the template to execute, one the content defines; empty for the content
+}
+
+// newTemplateSet returns an empty template set. Go templates are parsed only when
+// goTemplates is set.
+func newTemplateSet(funcs template.FuncMap, goTemplates bool) *templateSet {
+	// Templates compiled without a sandbox call no-op sandbox functions
+	funcs = copyFuncs(funcs, (*sandbox)(nil).funcs())
+	set := &templateSet{
+		funcs:   funcs,
+		sources: make(map[string]string),
+		files:   make(map[string]string),
+		blocks:  make(map[string]bool),
+		invalid: make(map[string]error),
+		version: atomic.AddUint64(&templateSetVersion, 1),
+
+		catalogs:     make(map[string]map[string]*message),
+		catalogFiles: make(map[string]string),
+	}
+	if goTemplates {
+		set.base = template.New("").Funcs(funcs)
+		set.htmlBase = htmltemplate.New("").Funcs(funcs)
+	}
+	return set
+}
+
+// loadTemplateSet loads all .tmpl files and message catalogs under the template path.
+// The files are parsed with the configured engine, so two files or definitions with the
+// same name and syntax errors in shared templates are reported when the activity starts.
+// A syntax error in a top-level template is reported when the template is used.
+func (a *Activity) loadTemplateSet() (*templateSet, error) {
+	engine := a.settings.TemplateEngine
+	set := newTemplateSet(a.templateFunctions(), engine != "handlebars" && engine != "mustache")
+
+	if _, err := os.Stat(a.templateBasePath); os.IsNotExist(err) {
+		return set, nil
+	}
+	set.modTimes = make(map[string]time.Time)
+	err := filepath.WalkDir(a.templateBasePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(a.templateBasePath, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isTemplateSetFile(rel) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read template file %s: %v", path, err)
+		}
+		set.modTimes[path] = info.ModTime()
+		if isCatalogFile(rel) {
+			return set.addCatalog(filepath.ToSlash(rel), content)
+		}
+		text := string(content)
+		if engine == "handlebars-basic" || engine == "mustache-basic" {
+			text = a.convertHandlebarsToGo(text)
+		}
+		return set.add(filepath.ToSlash(rel), text)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.safeLog("debug", "Loaded %d templates from: %s", len(set.sources), a.templateBasePath)
+	if len(set.catalogs) > 0 {
+		a.safeLog("debug", "Loaded message catalogs for: %s", strings.Join(set.locales(), ", "))
+	}
+	return set, nil
+}
+
+// isTemplateSetFile reports whether a file, given by its path relative to the template
+// path, is loaded into the template set
+func isTemplateSetFile(rel string) bool {
+	return filepath.Ext(rel) == ".tmpl" || isCatalogFile(rel)
+}
+
+// add adds a template file, given by its path relative to the template path
+func (s *templateSet) add(file, content string) error {
+	name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+	if owner, ok := s.files[name]; ok {
+		return fmt.Errorf("template name collision: %q is defined in both %s and %s", name, owner, file)
+	}
+	s.files[name] = file
+	s.sources[name] = content
+	if s.base == nil {
+		return nil
+	}
+
+	shared := strings.Contains(file, "/")
+	parsed, err := template.New(name).Funcs(s.funcs).Parse(content)
+	if err != nil {
+		err = fmt.Errorf("failed to parse template %s: %v", file, err)
+		if shared {
+			return err
+		}
+		s.invalid[name] = err
+		return nil
+	}
+
+	blocks := make(map[string]bool)
+	if shared {
+		for _, match := range blockPattern.FindAllStringSubmatch(content, -1) {
+			blocks[match[1]] = true
+		}
+	}
+
+	for _, t := range parsed.Templates() {
+		instrumentTree(t.Tree)
+		if t.Name() != name {
+			if !shared {
+				continue
+			}
+			if owner, ok := s.files[t.Name()]; ok {
+				// Layouts may declare the same block; the first declaration is the default
+				if blocks[t.Name()] && s.blocks[t.Name()] {
+					continue
+				}
+				return fmt.Errorf("template name collision: %q is defined in both %s and %s", t.Name(), owner, file)
+			}
+			s.files[t.Name()] = file
+			s.blocks[t.Name()] = blocks[t.Name()]
+		}
+		if _, err := s.base.AddParseTree(t.Name(), t.Tree); err != nil {
+			return fmt.Errorf("failed to add template %q from %s: %v", t.Name(), file, err)
+		}
+		// html/template rewrites the trees it escapes, so it gets its own copy
+		if _, err := s.htmlBase.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+			return fmt.Errorf("failed to add template %q from %s: %v", t.Name(), file, err)
+		}
+	}
+	return nil
+}
+
+// changed reports whether .tmpl files or message catalogs under dir were added, removed
+// or modified since the set was loaded
+func (s *templateSet) changed(dir string) bool {
+	seen := 0
+	errChanged := fmt.Errorf("changed")
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isTemplateSetFile(rel) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if modTime, ok := s.modTimes[path]; !ok || !modTime.Equal(info.ModTime()) {
+			return errChanged
+		}
+		seen++
+		return nil
+	})
+	return err != nil || seen != len(s.modTimes)
+}
+
+// copyFuncs returns a function map with the functions of all maps
+func copyFuncs(maps ...template.FuncMap) template.FuncMap {
+	funcs := make(template.FuncMap)
+	for _, m := range maps {
+		for name, fn := range m {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// source returns the source of a template by name
+func (s *templateSet) source(name string) (string, bool) {
+	content, ok := s.sources[name]
+	return content, ok
+}
+
+// compile parses a Go template together with the shared templates. The templates it
+// defines may override shared {{block}}s, but not other shared templates, and every
+// template it uses must exist. The result is not modified afterwards, so it can be
+// cached and executed concurrently, unless it is bound to a sandbox, which tracks one
+// render at a time. The functions of the localizer are bound when it is compiled.
+func (s *templateSet) compile(name, content string, options compileOptions, sb *sandbox) (executableTemplate, error) {
+	page, err := template.New(name).Funcs(s.funcs).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("template parsing failed: %v", err)
+	}
+	for _, t := range page.Templates() {
+		instrumentTree(t.Tree)
+	}
+
+	tmpl, err := s.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range page.Templates() {
+		if owner, ok := s.files[t.Name()]; ok && t.Name() != name && !s.blocks[t.Name()] {
+			return nil, fmt.Errorf("template name collision: %q is already defined in %s", t.Name(), owner)
+		}
+		if _, err := tmpl.AddParseTree(t.Name(), t.Tree); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := name
+	if options.entry != "" {
+		entry = options.entry
+	}
+	main := tmpl.Lookup(entry)
+	if main == nil || main.Tree == nil {
+		return nil, fmt.Errorf("template %q is not defined", entry)
+	}
+	if err := checkTemplateReferences(main, s.invalid); err != nil {
+		return nil, err
+	}
+
+	missingKey := "missingkey=zero"
+	if options.strict {
+		missingKey = "missingkey=error"
+	}
+	if !options.escapeHTML {
+		if options.localizer != nil {
+			tmpl.Funcs(options.localizer.funcs())
+		}
+		if sb != nil {
+			tmpl.Funcs(sb.funcs())
+		}
+		return main.Option(missingKey), nil
+	}
+
+	htmlTmpl, err := s.htmlBase.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range page.Templates() {
+		if _, err := htmlTmpl.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	if options.localizer != nil {
+		htmlTmpl.Funcs(htmltemplate.FuncMap(options.localizer.funcs()))
+	}
+	if sb != nil {
+		htmlTmpl.Funcs(htmltemplate.FuncMap(sb.funcs()))
+	}
+	return htmlTmpl.Lookup(entry).Option(missingKey), nil
+}
+
+// checkTemplateReferences reports the first {{template}} or {{block}} reachable from
+// tmpl that names a template which does not exist, or one of the invalid templates
+func checkTemplateReferences(tmpl *template.Template, invalid map[string]error) error {
+	checked := make(map[string]bool)
+	var check func(t *template.Template) error
+	check = func(t *template.Template) error {
+		if checked[t.Name()] {
+			return nil
+		}
+		checked[t.Name()] = true
+
+		var err error
+		walkTemplateNodes(t.Tree.Root, func(node *parse.TemplateNode) {
+			if err != nil {
+				return
+			}
+			if invalidErr, ok := invalid[node.Name]; ok {
+				err = invalidErr
+				return
+			}
+			ref := tmpl.Lookup(node.Name)
+			if ref == nil || ref.Tree == nil {
+				location, _ := t.Tree.ErrorContext(node)
+				err = fmt.Errorf("missing partial %q used at %s", node.Name, location)
+				return
+			}
+			err = check(ref)
+		})
+		return err
+	}
+	return check(tmpl)
+}
+
+// walkTemplateNodes calls visit for each {{template}} action in a parse tree
+func walkTemplateNodes(node parse.Node, visit func(*parse.TemplateNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNodes(child, visit)
+		}
+	case *parse.IfNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.RangeNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.WithNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.TemplateNode:
+		visit(n)
+	}
+}
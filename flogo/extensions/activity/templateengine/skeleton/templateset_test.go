@@ -0,0 +1,187 @@
+package templateengine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+// writeTemplates creates template files in a new directory
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+	}
+	return dir
+}
+
+func newTemplateSetActivity(dir string) (*Activity, error) {
+	act, err := New(test.NewActivityInitContext(&Settings{
+		TemplateEngine:    "go",
+		TemplateCacheSize: 10,
+		EnableSafeMode:    true,
+		TemplatePath:      dir,
+	}, nil))
+	if err != nil {
+		return nil, err
+	}
+	return act.(*Activity), nil
+}
+
+// renderTemplate evaluates the activity and returns its result and error outputs
+func renderTemplate(act *Activity, templateType, template string, data map[string]interface{}) (string, string) {
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("templateType", templateType)
+	tc.SetInput("template", template)
+	tc.SetInput("templateData", data)
+	act.Eval(tc)
+	result, _ := tc.GetOutput("result").(string)
+	errMsg, _ := tc.GetOutput("error").(string)
+	return result, errMsg
+}
+
+func TestTemplateSetLayoutsAndPartials(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/email.tmpl":     "{{template \"header\" .}}\n{{block \"content\" .}}No content{{end}}\n{{template \"footer\" .}}",
+		"layouts/report.tmpl":    "REPORT\n{{block \"content\" .}}{{end}}",
+		"partials/header.tmpl":   "Hello {{.name}},",
+		"partials/common.tmpl":   "{{define \"footer\"}}-- {{.company | upper}}{{end}}",
+		"email-welcome.tmpl":     "{{template \"email\" .}}{{define \"content\"}}Welcome aboard!{{end}}",
+		"email-plain.tmpl":       "{{template \"email\" .}}",
+		"report-daily.tmpl":      "{{template \"report\" .}}{{define \"content\"}}{{.count}} orders{{end}}",
+		"partials/notes.md":      "not a template {{",
+		"email-with-header.tmpl": "{{template \"header\" .}} {{template \"email-plain\" .}}",
+	})
+	act, err := newTemplateSetActivity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+	data := map[string]interface{}{"name": "Jane", "company": "Acme", "count": 3}
+
+	tests := []struct {
+		name         string
+		templateType string
+		template     string
+		expected     string
+	}{
+		{"Layout with block override", "email-welcome", "", "Hello Jane,\nWelcome aboard!\n-- ACME"},
+		{"Layout with default block", "email-plain", "", "Hello Jane,\nNo content\n-- ACME"},
+		{"Layouts share block names", "report-daily", "", "REPORT\n3 orders"},
+		{"Top-level templates are partials", "email-with-header", "", "Hello Jane, Hello Jane,\nNo content\n-- ACME"},
+		{"Custom template with partials", "custom", "{{template \"header\" .}} {{template \"footer\" .}}", "Hello Jane, -- ACME"},
+		{"Custom template with layout", "custom", "{{template \"email\" .}}{{define \"content\"}}Custom{{end}}", "Hello Jane,\nCustom\n-- ACME"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, errMsg := renderTemplate(act, tt.templateType, tt.template, data)
+			if errMsg != "" {
+				t.Fatalf("Template processing failed: %s", errMsg)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Overrides stay local to a template", func(t *testing.T) {
+		renderTemplate(act, "email-welcome", "", data)
+		result, _ := renderTemplate(act, "email-plain", "", data)
+		if !strings.Contains(result, "No content") {
+			t.Errorf("Expected default block content, got %q", result)
+		}
+	})
+}
+
+func TestTemplateSetErrors(t *testing.T) {
+	loadErrors := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			"Duplicate file names",
+			map[string]string{"header.tmpl": "a", "partials/header.tmpl": "b"},
+			`template name collision: "header" is defined in both header.tmpl and partials/header.tmpl`,
+		},
+		{
+			"Duplicate definitions",
+			map[string]string{"partials/a.tmpl": `{{define "footer"}}a{{end}}`, "partials/b.tmpl": `{{define "footer"}}b{{end}}`},
+			`template name collision: "footer" is defined in both partials/a.tmpl and partials/b.tmpl`,
+		},
+		{
+			"Definition named like a file",
+			map[string]string{"footer.tmpl": "a", "partials/common.tmpl": `{{define "footer"}}b{{end}}`},
+			`template name collision: "footer" is defined in both footer.tmpl and partials/common.tmpl`,
+		},
+		{
+			"Syntax error",
+			map[string]string{"partials/broken.tmpl": "{{if .x}}"},
+			"failed to parse template partials/broken.tmpl",
+		},
+	}
+	for _, tt := range loadErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTemplateSetActivity(writeTemplates(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	act, err := newTemplateSetActivity(writeTemplates(t, map[string]string{
+		"partials/header.tmpl": "Hello",
+		"layouts/base.tmpl":    `{{block "content" .}}{{end}}{{template "signature" .}}`,
+		"broken.tmpl":          "{{if .x}}",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create activity: %v", err)
+	}
+
+	renderErrors := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"Missing partial", "Hi\n{{if .x}}{{template \"footer\" .}}{{end}}", `missing partial "footer" used at main:2:`},
+		{"Missing partial in a layout", `{{template "base" .}}`, `missing partial "signature" used at base:1:`},
+		{"Broken template", `{{template "broken" .}}`, "failed to parse template broken.tmpl"},
+		{"Overriding a partial", `{{define "header"}}Bye{{end}}{{template "header" .}}`, `template name collision: "header" is already defined in partials/header.tmpl`},
+	}
+	for _, tt := range renderErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errMsg := renderTemplate(act, "custom", tt.template, nil)
+			if !strings.Contains(errMsg, tt.expected) {
+				t.Errorf("Expected error containing %q, got %q", tt.expected, errMsg)
+			}
+		})
+	}
+	if _, errMsg := renderTemplate(act, "broken", "", nil); !strings.Contains(errMsg, "template parsing failed") {
+		t.Errorf("Expected a parse error for the broken template, got %q", errMsg)
+	}
+}
+
+func TestTemplateSetShippedTemplates(t *testing.T) {
+	// The shipped templates use the syntax of different engines, so they must not stop
+	// the activity from starting with any engine
+	for _, engine := range []string{"go", "handlebars", "mustache", "handlebars-basic", "mustache-basic"} {
+		t.Run(engine, func(t *testing.T) {
+			_, err := New(test.NewActivityInitContext(&Settings{
+				TemplateEngine:    engine,
+				TemplateCacheSize: 10,
+				TemplatePath:      "templates",
+			}, nil))
+			if err != nil {
+				t.Errorf("Failed to create activity: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package templateengine
+
+import "strings"
+
+// templateReference is a value a template looks up in its data. Paths are dotted;
+// [] stands for each element of a list, as in items[].sku.
+type templateReference struct {
+	// candidates are the paths the reference may resolve to, from the innermost
+	// context out: Handlebars and Mustache look names up in the enclosing contexts
+	candidates []string
+	defaulted  bool // passed to the default function, which replaces empty values
+	// optional references may name a helper instead, and are only reported when found
+	optional bool
+}
+
+// templateReferences are the data references of a template in order of first use. They
+// are found from the parsed template and do not change between renders.
+type templateReferences struct {
+	refs  []*templateReference
+	index map[string]*templateReference
+}
+
+// add returns the reference with the candidate paths, adding it if it is new
+func (r *templateReferences) add(candidates ...string) *templateReference {
+	key := strings.Join(candidates, "\x00")
+	if ref, ok := r.index[key]; ok {
+		return ref
+	}
+	if r.index == nil {
+		r.index = make(map[string]*templateReference)
+	}
+	ref := &templateReference{candidates: candidates}
+	r.index[key] = ref
+	r.refs = append(r.refs, ref)
+	return ref
+}
+
+// merge adds the references of other that r does not have, keeping the order of first
+// use. The references of other are shared, not copied.
+func (r *templateReferences) merge(other *templateReferences) {
+	for _, ref := range other.refs {
+		key := strings.Join(ref.candidates, "\x00")
+		if _, ok := r.index[key]; ok {
+			continue
+		}
+		if r.index == nil {
+			r.index = make(map[string]*templateReference)
+		}
+		r.index[key] = ref
+		r.refs = append(r.refs, ref)
+	}
+}
+
+// paths returns the innermost path of each reference, for reports without data
+func (r *templateReferences) paths() []string {
+	paths := []string{}
+	seen := make(map[string]bool)
+	for _, ref := range r.refs {
+		if path := ref.candidates[0]; !seen[path] && !ref.optional {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// variableReport tells which referenced paths a render found in its data
+type variableReport struct {
+	used      []string
+	resolved  []string
+	missing   []string
+	defaulted []string // missing or empty, so default supplied the value
+}
+
+// report resolves the references against the data of a render. A reference resolves
+// to its first candidate found in the data; one that is not found is reported by its
+// innermost path. A path through a list is missing if any element lacks it.
+func (r *templateReferences) report(data interface{}) variableReport {
+	report := variableReport{used: []string{}, resolved: []string{}, missing: []string{}, defaulted: []string{}}
+	seen := make(map[string]bool)
+	for _, ref := range r.refs {
+		path := ref.candidates[0]
+		values, found := []interface{}(nil), false
+		for _, candidate := range ref.candidates {
+			if values, found = lookupPath(data, candidate); found {
+				path = candidate
+				break
+			}
+		}
+		if seen[path] || !found && ref.optional {
+			continue
+		}
+		seen[path] = true
+
+		report.used = append(report.used, path)
+		if found {
+			report.resolved = append(report.resolved, path)
+		} else {
+			report.missing = append(report.missing, path)
+		}
+		if ref.defaulted && (!found || hasEmptyValue(values)) {
+			report.defaulted = append(report.defaulted, path)
+		}
+	}
+	return report
+}
+
+// hasEmptyValue reports whether any value would be replaced by default
+func hasEmptyValue(values []interface{}) bool {
+	for _, value := range values {
+		if value == nil || value == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPath returns the values at a path. A section or block over a list renders once
+// per element, so a field of a list is looked up in each element.
+func lookupPath(data interface{}, path string) ([]interface{}, bool) {
+	values := []interface{}{data}
+	for _, segment := range strings.Split(path, ".") {
+		name, elements := strings.CutSuffix(segment, "[]")
+		var next []interface{}
+		for _, value := range values {
+			targets := []interface{}{value}
+			if items, ok := listItems(value); ok {
+				targets = items
+			}
+			for _, target := range targets {
+				field, ok := lookupKey(target, name)
+				if !ok {
+					return nil, false
+				}
+				next = append(next, field)
+			}
+		}
+		if elements {
+			next = elementsOf(next)
+		}
+		values = next
+	}
+	return values, true
+}
+
+// elementsOf returns the elements of lists and the values of maps, as range sees them
+func elementsOf(values []interface{}) []interface{} {
+	var elements []interface{}
+	for _, value := range values {
+		if items, ok := listItems(value); ok {
+			elements = append(elements, items...)
+			continue
+		}
+		if keys, ok := sortedKeys(value); ok {
+			for _, key := range keys {
+				element, _ := lookupKey(value, key)
+				elements = append(elements, element)
+			}
+		}
+	}
+	return elements
+}
+
+// goReferences finds the data a Go template, or the template named entry that it
+// defines, references, following the templates it calls. The sandbox instrumentation
+// only calls functions, so it adds no references.
+func goReferences(set *templateSet, content, entry string) *templateReferences {
+	l := newGoLinter(set)
+	l.refs = &templateReferences{}
+	l.check(content, entry, &dataShape{open: true})
+	return l.refs
+}
+
+// templateReferences finds the data a template references without rendering it. A
+// template that does not parse references nothing.
+func (a *Activity) templateReferences(content string) *templateReferences {
+	switch a.settings.TemplateEngine {
+	case "handlebars":
+		if tmpl, err := parseHandlebars(content); err == nil {
+			return tmpl.references(a.templateFunctions())
+		}
+	case "mustache":
+		if tmpl, err := parseMustache(content); err == nil {
+			return tmpl.references()
+		}
+	case "handlebars-basic", "mustache-basic":
+		return goReferences(a.templateSet(), a.convertHandlebarsToGo(content), "main")
+	default:
+		return goReferences(a.templateSet(), content, "main")
+	}
+	return &templateReferences{}
+}
+
+// references finds the data a Handlebars template references. Partials are not
+// followed, since they are only loaded when rendered.
+func (t *hbTemplate) references(helpers map[string]interface{}) *templateReferences {
+	w := &hbReferenceWalker{helpers: helpers, refs: &templateReferences{}}
+	w.walk(t.nodes, []hbScope{{}})
+	return w.refs
+}
+
+// hbScope is a context of a Handlebars template: the path of its value, the paths of
+// its block parameters, and the block parameters that hold an index or key
+type hbScope struct {
+	path   string
+	params map[string]string
+	keys   map[string]bool
+}
+
+type hbReferenceWalker struct {
+	helpers map[string]interface{}
+	refs    *templateReferences
+}
+
+func (w *hbReferenceWalker) walk(nodes []*hbNode, stack []hbScope) {
+	for _, node := range nodes {
+		switch node.kind {
+		case hbMustache:
+			w.expr(node.expr, stack)
+		case hbBlock:
+			w.block(node, stack)
+		case hbPartial:
+			if node.dynamic != nil {
+				w.expr(node.dynamic, stack)
+			}
+			w.args(node.expr, stack)
+		}
+	}
+}
+
+// block walks a block in the context its helper renders it in
+func (w *hbReferenceWalker) block(node *hbNode, stack []hbScope) {
+	w.expr(node.expr, stack)
+	name, _ := node.expr.path.simpleName()
+	var target string
+	hasTarget := false
+	if len(node.expr.params) > 0 {
+		target, hasTarget = w.path(node.expr.params[0], stack)
+	}
+
+	program := stack
+	switch _, isHelper := w.helpers[name]; {
+	case name == "if" || name == "unless":
+	case name == "each" && hasTarget:
+		program = w.push(stack, target+"[]", node.blockParams)
+	case name == "with" && hasTarget:
+		program = w.push(stack, target, node.blockParams)
+	case !isHelper && len(node.expr.params) == 0 && len(node.expr.hash) == 0 && !node.inverted:
+		// A section renders in the context of its value
+		path, _ := w.path(node.expr, stack)
+		program = w.push(stack, path, node.blockParams)
+	}
+	w.walk(node.program, program)
+	w.walk(node.inverse, stack)
+}
+
+// push adds the context of a block. Its first block parameter names the value, and the
+// second the index or key, which is not data.
+func (w *hbReferenceWalker) push(stack []hbScope, path string, blockParams []string) []hbScope {
+	scope := hbScope{path: path}
+	if len(blockParams) > 0 {
+		scope.params = map[string]string{blockParams[0]: path}
+	}
+	if len(blockParams) > 1 {
+		scope.keys = make(map[string]bool, len(blockParams)-1)
+		for _, param := range blockParams[1:] {
+			scope.keys[param] = true
+		}
+	}
+	return append(stack[:len(stack):len(stack)], scope)
+}
+
+// expr adds the references of an expression. A path is a reference unless it names a
+// helper or is called with arguments.
+func (w *hbReferenceWalker) expr(expr *hbExpr, stack []hbScope) {
+	if expr == nil {
+		return
+	}
+	if expr.dynamic != nil {
+		w.expr(expr.dynamic, stack)
+	}
+	name, _ := expr.path.simpleName()
+	_, isHelper := w.helpers[name]
+	if !expr.sub && len(expr.params) == 0 && len(expr.hash) == 0 {
+		// Data takes precedence over a helper of the same name
+		if ref := w.reference(expr, stack); ref != nil && isHelper {
+			ref.optional = true
+		}
+	}
+	w.args(expr, stack)
+	// default replaces its last argument when it is empty
+	if name == "default" && len(expr.params) == 2 {
+		if ref := w.reference(expr.params[1], stack); ref != nil {
+			ref.defaulted = true
+		}
+	}
+}
+
+func (w *hbReferenceWalker) args(expr *hbExpr, stack []hbScope) {
+	if expr == nil {
+		return
+	}
+	for _, param := range expr.params {
+		w.expr(param, stack)
+	}
+	keys, _ := sortedKeys(expr.hash)
+	for _, key := range keys {
+		w.expr(expr.hash[key], stack)
+	}
+}
+
+// reference adds the reference of a path expression, if it refers to the data
+func (w *hbReferenceWalker) reference(expr *hbExpr, stack []hbScope) *templateReference {
+	path := expr.path
+	if path == nil || expr.sub || (path.data && (len(path.parts) < 2 || path.parts[0] != "root")) {
+		return nil
+	}
+	if len(path.parts) == 0 {
+		// this refers to the context, whose path is already a reference
+		return nil
+	}
+	if path.data || path.scoped || path.depth > 0 {
+		p, _ := w.path(expr, stack)
+		return w.refs.add(p)
+	}
+
+	// A simple name is a block parameter, or is looked up from the innermost context out
+	rest := strings.Join(path.parts[1:], ".")
+	for i := len(stack) - 1; i >= 0; i-- {
+		if param, ok := stack[i].params[path.parts[0]]; ok {
+			return w.refs.add(joinPath(param, rest))
+		}
+		if stack[i].keys[path.parts[0]] {
+			return nil
+		}
+	}
+	candidates := make([]string, 0, len(stack))
+	for i := len(stack) - 1; i >= 0; i-- {
+		candidate := joinPath(joinPath(stack[i].path, path.parts[0]), rest)
+		if len(candidates) == 0 || candidates[len(candidates)-1] != candidate {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return w.refs.add(candidates...)
+}
+
+// path returns the path of the value an expression refers to in its innermost context
+func (w *hbReferenceWalker) path(expr *hbExpr, stack []hbScope) (string, bool) {
+	path := expr.path
+	if path == nil || expr.sub || len(expr.params) > 0 {
+		return "", false
+	}
+	parts := path.parts
+	base := ""
+	switch {
+	case path.data:
+		if len(parts) == 0 || parts[0] != "root" {
+			return "", false
+		}
+		parts = parts[1:]
+	default:
+		index := len(stack) - 1 - path.depth
+		if index < 0 {
+			index = 0
+		}
+		base = stack[index].path
+		if !path.scoped && path.depth == 0 && len(parts) > 0 {
+			if stack[index].keys[parts[0]] {
+				return "", false
+			}
+			if param, ok := stack[index].params[parts[0]]; ok {
+				base, parts = param, parts[1:]
+			}
+		}
+	}
+	return joinPath(base, strings.Join(parts, ".")), true
+}
+
+// references finds the data a Mustache template references. Partials are not
+// followed, since they are only loaded when rendered.
+func (t *mustacheTemplate) references() *templateReferences {
+	refs := &templateReferences{}
+	var walk func(nodes []*mustacheNode, stack []string)
+	walk = func(nodes []*mustacheNode, stack []string) {
+		for _, node := range nodes {
+			if node.kind != mustacheVariable && node.kind != mustacheSection && node.kind != mustacheInverted {
+				continue
+			}
+			if node.text == "." {
+				walk(node.children, stack)
+				continue
+			}
+			// The first name of a dotted name is looked up from the innermost context out
+			candidates := make([]string, 0, len(stack))
+			for i := len(stack) - 1; i >= 0; i-- {
+				candidates = append(candidates, joinPath(stack[i], node.text))
+			}
+			refs.add(candidates...)
+			if node.kind == mustacheSection {
+				walk(node.children, append(stack[:len(stack):len(stack)], candidates[0]))
+			} else {
+				walk(node.children, stack)
+			}
+		}
+	}
+	walk(t.nodes, []string{""})
+	return refs
+}
@@ -0,0 +1,154 @@
+package templateengine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+)
+
+func TestVariablesUsed(t *testing.T) {
+	templateDir := writeTemplates(t, map[string]string{
+		"partials/signature.tmpl": "-- {{.name}} {{.title}}",
+	})
+	data := map[string]interface{}{
+		"customer": map[string]interface{}{"name": "Jane", "email": "JANE@EXAMPLE.COM"},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "A", "price": 10},
+			map[string]interface{}{"sku": "B"},
+		},
+		"currency": "EUR",
+		"nickname": "",
+	}
+
+	tests := []struct {
+		engine    string
+		template  string
+		used      []string
+		missing   []string
+		defaulted []string
+	}{
+		{
+			engine: "go",
+			template: `{{.customer.name}} {{.customer.email | lower}} {{printf "%s" .customer.tier | upper}}
+{{range $i, $item := .items}}{{.sku}} {{$item.price}} {{$.currency}}{{end}}
+{{with .customer}}{{.name}}{{end}} {{(index .items 0).sku}}
+{{.nickname | default "friend"}} {{default "n/a" .customer.phone}}
+{{template "signature" .customer}}`,
+			used:      []string{"customer.name", "customer.email", "customer.tier", "items", "items[].sku", "items[].price", "currency", "customer", "nickname", "customer.phone", "customer.title"},
+			missing:   []string{"customer.tier", "items[].price", "customer.phone", "customer.title"},
+			defaulted: []string{"nickname", "customer.phone"},
+		},
+		{
+			engine:    "handlebars",
+			template:  `{{customer.name}} {{#each items as |item i|}}{{i}}={{item.sku}} {{price}} {{../currency}} {{@index}}{{/each}} {{#with customer}}{{tier}}{{/with}} {{default "friend" nickname}} {{upper @root.customer.email}}`,
+			used:      []string{"customer.name", "items", "items[].sku", "items[].price", "currency", "customer", "customer.tier", "nickname", "customer.email"},
+			missing:   []string{"items[].price", "customer.tier"},
+			defaulted: []string{"nickname"},
+		},
+		{
+			engine:   "mustache",
+			template: `{{#customer}}{{name}} {{currency}} {{tier}}{{/customer}}{{#items}}{{sku}}{{/items}}{{^vip}}{{.}}{{/vip}}`,
+			used:     []string{"customer", "customer.name", "currency", "customer.tier", "items", "items.sku", "vip"},
+			missing:  []string{"customer.tier", "vip"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			// Safe mode renders with limits, so Go templates are instrumented
+			act, err := New(test.NewActivityInitContext(&Settings{
+				TemplateEngine:    tt.engine,
+				TemplateCacheSize: 10,
+				TemplatePath:      templateDir,
+				EnableSafeMode:    true,
+			}, nil))
+			if err != nil {
+				t.Fatalf("Failed to create activity: %v", err)
+			}
+
+			// The second render uses the cached template
+			for i := 0; i < 2; i++ {
+				tc := test.NewActivityContext(act.Metadata())
+				tc.SetInput("template", tt.template)
+				tc.SetInput("templateData", data)
+				tc.SetInput("strictMode", false)
+				act.Eval(tc)
+				if success, _ := tc.GetOutput("success").(bool); !success {
+					t.Fatalf("Template processing failed: %v", tc.GetOutput("error"))
+				}
+
+				var resolved []string
+				missing := make(map[string]bool)
+				for _, path := range tt.missing {
+					missing[path] = true
+				}
+				for _, path := range tt.used {
+					if !missing[path] {
+						resolved = append(resolved, path)
+					}
+				}
+				expected := map[string][]string{
+					"variablesUsed":      tt.used,
+					"variablesResolved":  resolved,
+					"variablesMissing":   tt.missing,
+					"variablesDefaulted": tt.defaulted,
+				}
+				for name, paths := range expected {
+					if paths == nil {
+						paths = []string{}
+					}
+					if got := tc.GetOutput(name); !reflect.DeepEqual(got, paths) {
+						t.Errorf("Expected %s %v, got %v", name, paths, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	data := map[string]interface{}{
+		"order": map[string]interface{}{
+			"lines": []interface{}{
+				map[string]interface{}{"sku": "A", "tags": []interface{}{"x"}},
+				map[string]interface{}{"sku": "B", "tags": []interface{}{}},
+			},
+			"totals": map[string]interface{}{"net": 1, "gross": 2},
+		},
+		"empty": []interface{}{},
+	}
+
+	tests := []struct {
+		path   string
+		values []interface{}
+		found  bool
+	}{
+		{"order.lines[].sku", []interface{}{"A", "B"}, true},
+		{"order.lines[].tags[]", []interface{}{"x"}, true},
+		{"order.lines[].qty", nil, false},
+		{"order.totals[]", []interface{}{2, 1}, true},
+		{"empty[].anything", nil, true},
+		{"order.lines.sku", []interface{}{"A", "B"}, true},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		values, found := lookupPath(data, tt.path)
+		if found != tt.found || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("%s: expected %v, %t, got %v, %t", tt.path, tt.values, tt.found, values, found)
+		}
+	}
+}
+
+func TestValidateOnlyVariablesUsed(t *testing.T) {
+	act := newLintActivity(t, "go")
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("template", "{{range .items}}{{.sku}}{{end}} {{.customer.name | default .customer.email}}")
+	tc.SetInput("validateOnly", true)
+	act.Eval(tc)
+
+	expected := []string{"items", "items[].sku", "customer.name", "customer.email"}
+	if got := tc.GetOutput("variablesUsed"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
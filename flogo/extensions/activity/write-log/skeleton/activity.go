@@ -22,8 +22,19 @@ func init() {
 
 // Activity represents the write log activity
 type Activity struct {
-	settings *Settings
-	logger   log.Logger
+	settings   *Settings
+	logger     log.Logger
+	piiScanner *piiScanner
+	maskingKey []byte
+	sinks      []Sink
+	async      *asyncWriter
+	formatter  Formatter
+	formatName string
+	ecs        *ecsMapper
+	throttle   *throttler
+	audit      *auditChain
+	limits     *sizeLimiter
+	metrics    *metricsRecorder
 }
 
 // Settings for the write log activity
@@ -33,6 +44,19 @@ type Settings struct {
 	OutputFormat    string      `md:"outputFormat,required"`
 	AddFlowDetails  bool        `md:"addFlowDetails"`
 	FieldFilters    interface{} `md:"fieldFilters"`
+	PIIDetection    interface{} `md:"piiDetection"`
+	MaskingKey      string      `md:"maskingKey"`
+	Sinks           interface{} `md:"sinks"`
+	Async           interface{} `md:"async"`
+	FormatOptions   interface{} `md:"formatOptions"`
+	ECSMode         string      `md:"ecsMode"`
+	ECSNamespace    string      `md:"ecsNamespace"`
+	Throttle        interface{} `md:"throttle"`
+	LevelControl    interface{} `md:"levelControl"`
+	Audit           interface{} `md:"audit"`
+	AuditKey        string      `md:"auditKey"`
+	SizeLimits      interface{} `md:"sizeLimits"`
+	Metrics         interface{} `md:"metrics"`
 }
 
 // Input for the write log activity
@@ -40,6 +64,7 @@ type Input struct {
 	LogObject       interface{} `md:"logObject"`
 	LogLevel        string      `md:"logLevel"`
 	SensitiveFields interface{} `md:"sensitiveFields"`
+	CorrelationID   string      `md:"correlationId"`
 }
 
 // New creates a new Activity instance
@@ -59,16 +84,119 @@ func New(ctx activity.InitContext) (activity.Activity, error) {
 		return nil, fmt.Errorf("logger cannot be nil")
 	}
 
+	maskingKey := resolveMaskingKey(s.MaskingKey)
+
+	scanner, err := newPIIScanner(s.PIIDetection, maskingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncConfig, err := parseAsyncConfig(s.Async)
+	if err != nil {
+		return nil, err
+	}
+
+	throttleConfig, err := parseThrottleConfig(s.Throttle)
+	if err != nil {
+		return nil, err
+	}
+
+	auditConfig, err := parseAuditConfig(s.Audit)
+	if err != nil {
+		return nil, err
+	}
+
+	sizeLimitsConfig, err := parseSizeLimitsConfig(s.SizeLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	metricsConfig, err := parseMetricsConfig(s.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	levelControlConfig, err := parseLevelControlConfig(s.LevelControl)
+	if err != nil {
+		return nil, err
+	}
+	if levelControlConfig != nil {
+		if err := startLevelControls(levelControlConfig, logger); err != nil {
+			return nil, err
+		}
+	}
+
 	logger.Info("Write Log Activity initialized with enterprise tracing support")
 
 	activity := &Activity{
-		settings: s,
-		logger:   logger,
+		settings:   s,
+		logger:     logger,
+		piiScanner: scanner,
+		maskingKey: maskingKey,
 	}
 
 	// Initialize context-aware logger
 	activity.logger = activity.initializeContextLogger(logger, ctx)
 
+	activity.ecs, err = newECSMapper(s.ECSMode, s.ECSNamespace, activity.logger.Warnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if sizeLimitsConfig != nil {
+		activity.limits = newSizeLimiter(sizeLimitsConfig, activity.getSystemFields())
+	}
+
+	activity.formatter, activity.formatName, err = activity.buildFormatter(s.OutputFormat, s.FormatOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if auditConfig != nil {
+		// The verifier reads JSON lines, so audited entries must be written as JSON
+		if activity.formatName != FormatJSON {
+			return nil, fmt.Errorf("audit mode requires the JSON output format, not %s", activity.formatName)
+		}
+		// Entries are sealed before they are queued, so a dropped entry would leave a
+		// gap in the chain that looks like tampering
+		if asyncConfig != nil && asyncConfig.OverflowPolicy != OverflowBlock {
+			return nil, fmt.Errorf("audit mode requires the %s async overflow policy, not %s", OverflowBlock, asyncConfig.OverflowPolicy)
+		}
+		activity.audit, err = acquireAuditChain(auditConfig, resolveAuditKey(s.AuditKey), activity.logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if metricsConfig != nil {
+		activity.metrics, err = newMetricsRecorder(metricsConfig, activity.logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if throttleConfig != nil {
+		activity.throttle = newThrottler(throttleConfig)
+		activity.throttle.summarize = activity.emitRepeatSummary
+		activity.throttle.warn = activity.logger.Warnf
+	}
+
+	sinks, err := activity.buildSinks(s.Sinks)
+	if err != nil {
+		return nil, err
+	}
+	activity.sinks = sinks
+
+	if asyncConfig != nil {
+		if len(activity.sinks) == 0 {
+			activity.sinks = []Sink{&engineSink{activity: activity}}
+		}
+		activity.async, err = acquireAsyncWriter(asyncConfig, activity.logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return activity, nil
 }
 
@@ -109,20 +237,42 @@ func (a *Activity) Eval(ctx activity.Context) (done bool, err error) {
 	fieldFilters := ctx.GetInput("fieldFilters")
 
 	// Step 2: Determine effective log level (input overrides settings)
-	effectiveLogLevel := a.determineLogLevel(logLevel)
+	flow := flowName(ctx)
+	effectiveLogLevel := a.determineLogLevel(logLevel, flow)
 
-	// Step 3 & 4 & 6: Format the log entry with flow info according to output format
-	formattedMessage := a.formatLogEntry(ctx, logObject, effectiveLogLevel, sensitiveFields, fieldFilters)
+	// Sampled-out entries are discarded before any formatting work, unless metrics
+	// still need to count them
+	sampled := a.throttle == nil || a.throttle.sample(effectiveLogLevel)
+	if !sampled && a.metrics == nil {
+		return true, nil
+	}
 
-	// Log using the determined level
-	a.logAtLevel(effectiveLogLevel, formattedMessage)
+	// Step 3 & 4: Build the log entry with flow info
+	record := a.newRecord(ctx, logObject, effectiveLogLevel, sensitiveFields, fieldFilters)
+
+	// Metrics count every entry, including those the throttle controls drop
+	if a.metrics != nil {
+		a.metrics.observe(record, flow)
+	}
+	if !sampled {
+		return true, nil
+	}
+
+	// Suppress duplicates and apply the rate limit
+	if a.throttle != nil && !a.throttle.admit(record) {
+		return true, nil
+	}
+
+	// Step 6: Format according to output format and write to the configured sinks
+	// (engine logger by default)
+	a.write(ctx, record)
 
 	return true, nil
 }
 
 // determineLogLevel determines the effective log level
-// Priority: Input logLevel > Environment Variables > Settings logLevel
-func (a *Activity) determineLogLevel(inputLogLevel interface{}) string {
+// Priority: Input logLevel > Runtime override > Environment Variables > Settings logLevel
+func (a *Activity) determineLogLevel(inputLogLevel interface{}, flow string) string {
 	// Priority 1: Input logLevel overrides everything
 	if inputLogLevel != nil {
 		if levelStr, ok := inputLogLevel.(string); ok && levelStr != "" {
@@ -130,7 +280,12 @@ func (a *Activity) determineLogLevel(inputLogLevel interface{}) string {
 		}
 	}
 
-	// Priority 2: Environment variables (in order of precedence)
+	// Priority 2: Runtime override from the admin endpoint, level file or SetLevelOverride
+	if level, ok := lookupLevelOverride(flow); ok {
+		return level
+	}
+
+	// Priority 3: Environment variables (in order of precedence)
 	envVars := []string{
 		"FLOGO_LOG_LEVEL",
 		"FLOGO_DYNAMICLOG_LOG_LEVEL",
@@ -143,7 +298,7 @@ func (a *Activity) determineLogLevel(inputLogLevel interface{}) string {
 		}
 	}
 
-	// Priority 3: Fall back to settings log level
+	// Priority 4: Fall back to settings log level
 	return strings.ToUpper(a.settings.LogLevel)
 }
 
@@ -193,29 +348,87 @@ func (a *Activity) logAtLevel(level, message string) {
 
 // formatLogEntry formats the log entry according to the configured output format
 func (a *Activity) formatLogEntry(ctx activity.Context, logObject interface{}, level string, sensitiveFields interface{}, fieldFilters interface{}) string {
+	return a.buildRecord(ctx, logObject, level, sensitiveFields, fieldFilters).Line
+}
+
+// buildRecord creates the structured entry and its formatted line for the sinks
+func (a *Activity) buildRecord(ctx activity.Context, logObject interface{}, level string, sensitiveFields interface{}, fieldFilters interface{}) *Record {
+	record := a.newRecord(ctx, logObject, level, sensitiveFields, fieldFilters)
+	a.formatRecord(ctx, record)
+	return record
+}
+
+// newRecord creates the structured entry for a log call, without formatting it
+func (a *Activity) newRecord(ctx activity.Context, logObject interface{}, level string, sensitiveFields interface{}, fieldFilters interface{}) *Record {
+	now := time.Now()
+
 	// Step 1: Create the main log entry (user data + system fields)
 	entry := a.createMainLogEntry(logObject, level, sensitiveFields, fieldFilters)
 
+	// Join the entry to the flow's trace when a tracing context exists
+	correlation := resolveTraceCorrelation(ctx)
+	correlation.addTo(entry)
+
+	// Structured formats carry flow details as fields rather than a text suffix
+	if a.settings.AddFlowDetails && !a.suffixFlowDetails() {
+		addFlowFields(ctx, entry)
+	}
+
+	// Strict ECS mode rewrites the finished entry to the ECS layout
+	if a.ecs != nil {
+		entry = a.ecs.mapEntry(entry, level)
+	}
+
+	// Oversized values are truncated last, so the limits apply to what is written
+	if a.limits != nil {
+		entry = a.limits.apply(entry)
+	}
+
+	return &Record{
+		Time:    now,
+		Level:   strings.ToUpper(level),
+		Entry:   entry,
+		TraceID: correlation.traceID,
+		SpanID:  correlation.spanID,
+	}
+}
+
+// formatRecord sets the formatted line of a record. Without an activity context, as for
+// duplicate summaries, no flow suffix is added.
+func (a *Activity) formatRecord(ctx activity.Context, record *Record) {
 	// Step 2: Format the main content according to output format setting
-	outputFormat := strings.ToUpper(a.settings.OutputFormat)
-	var mainContent string
-	switch outputFormat {
-	case "JSON":
-		mainContent = a.formatAsJSON(entry)
-	case "KEY_VALUE":
-		mainContent = a.formatAsKeyValue(entry)
-	case "LOGFMT":
-		mainContent = a.formatAsLogfmt(entry)
-	default:
-		mainContent = a.formatAsJSON(entry) // Default to JSON
+	mainContent, err := a.formatter.Format(record)
+	if err != nil {
+		a.logger.Warnf("Failed to format log entry as %s, using JSON: %v", a.formatName, err)
+		mainContent = a.formatAsJSON(record.Entry)
 	}
 
 	// Step 3: Append flow information as readable suffix (like official Log activity)
-	if a.settings.AddFlowDetails {
-		return a.appendFlowSuffix(ctx, mainContent)
+	if ctx != nil && a.suffixFlowDetails() {
+		mainContent = a.appendFlowSuffix(ctx, mainContent)
 	}
 
-	return mainContent
+	record.Line = mainContent
+}
+
+// suffixFlowDetails reports whether flow details are appended as text rather than added
+// as fields. Audited entries carry them as fields, so the hash covers them.
+func (a *Activity) suffixFlowDetails() bool {
+	return a.settings.AddFlowDetails && lineFormats[a.formatName] && a.audit == nil
+}
+
+// write formats a record and sends it to the sinks. In audit mode the record is first
+// sealed into the hash chain; the chain stays locked until the record is handed to the
+// sinks, so entries reach them in sequence order.
+func (a *Activity) write(ctx activity.Context, record *Record) {
+	if a.audit != nil {
+		a.audit.Lock()
+		defer a.audit.Unlock()
+		a.audit.seal(record)
+	}
+
+	a.formatRecord(ctx, record)
+	a.emit(record)
 }
 
 // createMainLogEntry creates the main log entry (user data + system fields) without flow details
@@ -226,12 +439,12 @@ func (a *Activity) createMainLogEntry(logObject interface{}, level string, sensi
 	entry["level"] = strings.ToUpper(level)
 
 	// Add timestamp only if ECS is enabled
-	if a.settings.IncludeFlowInfo {
+	if a.ecsEnabled() {
 		entry["@timestamp"] = time.Now().UTC().Format(time.RFC3339)
 	}
 
 	// Add ECS fields if includeFlowInfo is enabled (but not flow details)
-	if a.settings.IncludeFlowInfo {
+	if a.ecsEnabled() {
 		a.addECSFields(entry)
 	}
 
@@ -274,6 +487,14 @@ func (a *Activity) createMainLogEntry(logObject interface{}, level string, sensi
 		entry = a.applySensitiveFieldMasking(entry, sensitiveFields)
 	}
 
+	// Step 7: Mask PII detected in string values, regardless of field names
+	entry = a.applyPIIDetection(entry)
+
+	// Step 8: Resolve message template placeholders from the filtered and masked fields
+	if _, ok := logObject.(map[string]interface{}); ok {
+		entry = applyMessageTemplate(entry)
+	}
+
 	return entry
 }
 
@@ -320,36 +541,7 @@ func (a *Activity) formatAsKeyValue(entry map[string]interface{}) string {
 
 // flattenMap flattens nested maps into dot-notation keys
 func (a *Activity) flattenMap(data map[string]interface{}, prefix string) map[string]interface{} {
-	result := make(map[string]interface{})
-
-	for key, value := range data {
-		var newKey string
-		if prefix == "" {
-			newKey = key
-		} else {
-			newKey = prefix + "." + key
-		}
-
-		switch v := value.(type) {
-		case map[string]interface{}:
-			// Recursively flatten nested maps
-			nested := a.flattenMap(v, newKey)
-			for nestedKey, nestedValue := range nested {
-				result[nestedKey] = nestedValue
-			}
-		case []interface{}:
-			// Handle arrays - convert to JSON string for readability
-			if jsonBytes, err := json.Marshal(v); err == nil {
-				result[newKey] = string(jsonBytes)
-			} else {
-				result[newKey] = fmt.Sprintf("%v", v)
-			}
-		default:
-			result[newKey] = value
-		}
-	}
-
-	return result
+	return flattenEntry(data, prefix)
 }
 
 // formatAsLogfmt formats the entry in logfmt style
@@ -399,7 +591,7 @@ func (a *Activity) needsQuoting(s string) bool {
 func (a *Activity) addECSFields(entry map[string]interface{}) {
 	// ECS version - indicates which version of ECS this event complies with
 	entry["ecs"] = map[string]interface{}{
-		"version": "8.11",
+		"version": ecsVersion,
 	}
 
 	// @timestamp is already added in createMainLogEntry when ECS is enabled
@@ -568,6 +760,11 @@ func (a *Activity) getHostname() string {
 
 // getServiceName returns the service name from environment or default
 func (a *Activity) getServiceName() string {
+	return defaultServiceName()
+}
+
+// defaultServiceName resolves the service name shared by ECS fields and OTLP resources
+func defaultServiceName() string {
 	// Check common service name environment variables
 	if name := os.Getenv("SERVICE_NAME"); name != "" {
 		return name
@@ -670,6 +867,11 @@ func (a *Activity) appendFlowSuffix(ctx activity.Context, mainContent string) st
 	return mainContent
 }
 
+// ecsEnabled reports whether ECS fields are added, either by includeFlowInfo or by strict ECS mode
+func (a *Activity) ecsEnabled() bool {
+	return a.settings.IncludeFlowInfo || a.ecs != nil
+}
+
 // getSystemFields returns the list of system fields that should be preserved during filtering
 func (a *Activity) getSystemFields() []string {
 	var systemFields []string
@@ -678,12 +880,12 @@ func (a *Activity) getSystemFields() []string {
 	systemFields = append(systemFields, "level")
 
 	// Add @timestamp only if ECS is enabled
-	if a.settings.IncludeFlowInfo {
+	if a.ecsEnabled() {
 		systemFields = append(systemFields, "@timestamp")
 	}
 
 	// Add ECS fields if enabled
-	if a.settings.IncludeFlowInfo {
+	if a.ecsEnabled() {
 		systemFields = append(systemFields,
 			"service", "agent", "host", "process", "event")
 	}
@@ -712,10 +914,8 @@ func (a *Activity) applyFieldFiltersFromInput(entry map[string]interface{}, fiel
 		return entry
 	}
 
-	// If include list is specified, start with empty map and only include specified fields
+	// If include list is specified, keep only the fields matched by the include paths
 	if len(filter.Include) > 0 {
-		filtered := make(map[string]interface{})
-
 		// Create an enhanced include list that preserves system fields
 		enhancedInclude := make([]string, len(filter.Include))
 		copy(enhancedInclude, filter.Include)
@@ -724,26 +924,23 @@ func (a *Activity) applyFieldFiltersFromInput(entry map[string]interface{}, fiel
 		systemFields := a.getSystemFields()
 		enhancedInclude = append(enhancedInclude, systemFields...)
 
-		for _, field := range enhancedInclude {
-			if value, exists := entry[field]; exists {
-				filtered[field] = value
-			} else if a.matchesWildcard(entry, field, filtered) {
-				// matchesWildcard handles wildcard patterns and adds matches to filtered
-			}
+		filtered := make(map[string]interface{})
+		if selected, ok := selectPaths(entry, nil, a.parseFieldPaths(enhancedInclude)); ok {
+			filtered = selected.(map[string]interface{})
 		}
-
 		entry = filtered
 	}
 
-	// Apply exclude list (remove specified fields)
+	// Apply exclude list (remove fields matched by the exclude paths)
 	if len(filter.Exclude) > 0 {
-		for _, field := range filter.Exclude {
-			if a.containsWildcard(field) {
-				a.removeWildcardMatches(entry, field)
-			} else {
-				delete(entry, field)
+		excludePaths := a.parseFieldPaths(filter.Exclude)
+		pruned, _ := rewriteTree(entry, nil, func(path []pathStep, value interface{}) (interface{}, treeAction) {
+			if anyPathMatches(excludePaths, path) {
+				return nil, treeRemove
 			}
-		}
+			return value, treeDescend
+		})
+		entry = pruned.(map[string]interface{})
 	}
 
 	return entry
@@ -819,50 +1016,42 @@ func (a *Activity) parseFieldFilters() (*FieldFilter, error) {
 	return &filter, nil
 }
 
-// matchesWildcard checks if any fields match a wildcard pattern and adds them to filtered map
-func (a *Activity) matchesWildcard(entry map[string]interface{}, pattern string, filtered map[string]interface{}) bool {
-	if !a.containsWildcard(pattern) {
-		return false
-	}
-
-	matched := false
-	for key, value := range entry {
-		if a.matchWildcardPattern(key, pattern) {
-			filtered[key] = value
-			matched = true
-		}
-	}
-
-	return matched
+// containsWildcard checks if a pattern contains wildcard characters
+func containsWildcard(pattern string) bool {
+	return strings.Contains(pattern, "*") || strings.Contains(pattern, "?")
 }
 
-// removeWildcardMatches removes all fields that match a wildcard pattern
-func (a *Activity) removeWildcardMatches(entry map[string]interface{}, pattern string) {
-	var keysToRemove []string
-
-	for key := range entry {
-		if a.matchWildcardPattern(key, pattern) {
-			keysToRemove = append(keysToRemove, key)
+// decodeJSONConfig decodes an object or JSON string setting into the target struct
+func decodeJSONConfig(raw interface{}, target interface{}) error {
+	switch v := raw.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil
 		}
-	}
-
-	for _, key := range keysToRemove {
-		delete(entry, key)
+		return json.Unmarshal([]byte(v), target)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, target)
+	default:
+		return fmt.Errorf("unsupported configuration type: %T", v)
 	}
 }
 
-// containsWildcard checks if a pattern contains wildcard characters
-func (a *Activity) containsWildcard(pattern string) bool {
-	return strings.Contains(pattern, "*") || strings.Contains(pattern, "?")
-}
-
 // matchWildcardPattern matches a string against a wildcard pattern
 func (a *Activity) matchWildcardPattern(str, pattern string) bool {
+	return wildcardMatch(str, pattern)
+}
+
+// wildcardMatch matches a single key against a wildcard pattern
+func wildcardMatch(str, pattern string) bool {
 	if pattern == "*" {
 		return true
 	}
 
-	if !a.containsWildcard(pattern) {
+	if !containsWildcard(pattern) {
 		return str == pattern
 	}
 
@@ -915,10 +1104,13 @@ func (a *Activity) matchWildcardPattern(str, pattern string) bool {
 
 // SensitiveFieldConfig represents the configuration for sensitive field masking
 type SensitiveFieldConfig struct {
-	FieldNamesToHide []string `json:"fieldNamesToHide"` // List of field names to mask
-	Fields           []string `json:"fields"`           // Backwards compatibility
-	MaskWith         string   `json:"maskWith"`         // What to mask with (default: "***")
-	MaskLength       int      `json:"maskLength"`       // Length of mask (0 = replace entire value)
+	FieldNamesToHide []string        `json:"fieldNamesToHide"` // List of field names to mask
+	Fields           []string        `json:"fields"`           // Backwards compatibility
+	MaskWith         string          `json:"maskWith"`         // What to mask with (default: "***")
+	MaskLength       int             `json:"maskLength"`       // Length of mask (0 = replace entire value)
+	Strategy         string          `json:"strategy"`         // Masking strategy for the listed fields (default: legacy maskLength behavior)
+	Keep             int             `json:"keep"`             // Characters kept by the strategy
+	Rules            []FieldMaskRule `json:"rules"`            // Per-field strategies, evaluated before the field list
 }
 
 // getEffectiveFields returns the field list, prioritizing new field name over legacy
@@ -937,7 +1129,7 @@ func (a *Activity) applySensitiveFieldMasking(entry map[string]interface{}, sens
 		return entry
 	}
 
-	if config == nil || len(config.getEffectiveFields()) == 0 {
+	if config == nil || (len(config.getEffectiveFields()) == 0 && len(config.Rules) == 0) {
 		return entry
 	}
 
@@ -947,20 +1139,18 @@ func (a *Activity) applySensitiveFieldMasking(entry map[string]interface{}, sens
 		maskWith = "***"
 	}
 
-	// Apply masking to specified fields
-	for _, fieldName := range config.getEffectiveFields() {
-		if a.containsWildcard(fieldName) {
-			// Handle wildcard patterns
-			a.maskWildcardFields(entry, fieldName, maskWith, config.MaskLength)
-		} else {
-			// Handle exact field match
-			if value, exists := entry[fieldName]; exists {
-				entry[fieldName] = a.maskValue(value, maskWith, config.MaskLength)
+	// Apply the first matching rule to every node, without mutating shared nested data
+	rules := a.buildFieldMaskRules(config, maskWith)
+	masked, _ := rewriteTree(entry, nil, func(path []pathStep, value interface{}) (interface{}, treeAction) {
+		for _, rule := range rules {
+			if anyPathMatches(rule.paths, path) {
+				return a.maskWithRule(rule, value), treeReplace
 			}
 		}
-	}
+		return value, treeDescend
+	})
 
-	return entry
+	return masked.(map[string]interface{})
 }
 
 // parseSensitiveFields parses the sensitiveFields input into a SensitiveFieldConfig
@@ -1010,15 +1200,6 @@ func (a *Activity) parseSensitiveFields(sensitiveFields interface{}) (*Sensitive
 	return &config, nil
 }
 
-// maskWildcardFields masks all fields that match a wildcard pattern
-func (a *Activity) maskWildcardFields(entry map[string]interface{}, pattern, maskWith string, maskLength int) {
-	for key, value := range entry {
-		if a.matchWildcardPattern(key, pattern) {
-			entry[key] = a.maskValue(value, maskWith, maskLength)
-		}
-	}
-}
-
 // maskValue masks a field value according to the masking configuration
 func (a *Activity) maskValue(value interface{}, maskWith string, maskLength int) interface{} {
 	if value == nil {
@@ -129,7 +129,7 @@ func TestActivity_DetermineLogLevel(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := activity.determineLogLevel(tt.input)
+			result := activity.determineLogLevel(tt.input, "")
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -1056,7 +1056,7 @@ func TestActivity_ECSCompliance(t *testing.T) {
 		// Check ECS version field
 		assert.Contains(t, logEntry, "ecs")
 		ecsInfo := logEntry["ecs"].(map[string]interface{})
-		assert.Equal(t, "8.11", ecsInfo["version"])
+		assert.Equal(t, ecsVersion, ecsInfo["version"])
 
 		// Check @timestamp (ECS core field)
 		assert.Contains(t, logEntry, "@timestamp")
@@ -0,0 +1,397 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+// Overflow policies applied when the async queue is full
+const (
+	OverflowBlock      = "block"       // Wait for space in the queue
+	OverflowDropOldest = "drop-oldest" // Evict the oldest queued entry
+	OverflowDropNewest = "drop-newest" // Discard the new entry
+	OverflowSample     = "sample"      // Keep 1 in sampleRate entries once the queue is half full
+)
+
+const (
+	defaultAsyncQueueSize     = 10000
+	defaultAsyncBatchSize     = 100
+	defaultAsyncFlushInterval = time.Second
+	defaultAsyncSampleRate    = 10
+)
+
+// AsyncConfig configures the asynchronous writer in the async setting
+type AsyncConfig struct {
+	Enabled        *bool  `json:"enabled,omitempty"`        // Defaults to true when the setting is present
+	QueueSize      int    `json:"queueSize,omitempty"`      // Maximum queued entries (default: 10000)
+	BatchSize      int    `json:"batchSize,omitempty"`      // Entries written per batch (default: 100)
+	FlushInterval  string `json:"flushInterval,omitempty"`  // How often sinks are flushed (default: "1s")
+	OverflowPolicy string `json:"overflowPolicy,omitempty"` // block, drop-oldest, drop-newest or sample (default: block)
+	SampleRate     int    `json:"sampleRate,omitempty"`     // For the sample policy (default: 10)
+}
+
+// AsyncStats reports counters for the asynchronous writers
+type AsyncStats struct {
+	Queued   int    // Entries currently waiting in the queues
+	Enqueued uint64 // Entries accepted into the queues
+	Written  uint64 // Entries written to all of their sinks
+	Failed   uint64 // Entries that failed to write to at least one sink
+	Dropped  uint64 // Entries discarded by the overflow policy
+}
+
+// parseAsyncConfig reads the async setting. It returns nil when asynchronous writing is disabled.
+func parseAsyncConfig(setting interface{}) (*AsyncConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+
+	switch v := setting.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return normalizeAsyncConfig(&AsyncConfig{})
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+	}
+
+	config := &AsyncConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid async setting: %w", err)
+	}
+	if config.Enabled != nil && !*config.Enabled {
+		return nil, nil
+	}
+
+	return normalizeAsyncConfig(config)
+}
+
+// normalizeAsyncConfig validates the configuration and applies defaults
+func normalizeAsyncConfig(config *AsyncConfig) (*AsyncConfig, error) {
+	if config.QueueSize < 0 || config.BatchSize < 0 || config.SampleRate < 0 {
+		return nil, fmt.Errorf("async queueSize, batchSize and sampleRate must not be negative")
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = defaultAsyncQueueSize
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = defaultAsyncBatchSize
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = defaultAsyncSampleRate
+	}
+
+	config.OverflowPolicy = strings.ToLower(strings.TrimSpace(config.OverflowPolicy))
+	switch config.OverflowPolicy {
+	case "":
+		config.OverflowPolicy = OverflowBlock
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowSample:
+	default:
+		return nil, fmt.Errorf("unknown async overflowPolicy '%s' (supported: %s, %s, %s, %s)",
+			config.OverflowPolicy, OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowSample)
+	}
+
+	if config.FlushInterval == "" {
+		config.FlushInterval = defaultAsyncFlushInterval.String()
+	}
+	d, err := time.ParseDuration(config.FlushInterval)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid async flushInterval '%s'", config.FlushInterval)
+	}
+
+	return config, nil
+}
+
+// asyncItem is a queued record together with the sinks it must be written to
+type asyncItem struct {
+	rec    *Record
+	sinks  []Sink
+	logger log.Logger
+}
+
+// asyncWriter moves sink writes off the flow's goroutine. Records are queued in a bounded
+// ring buffer and written in batches by a single worker; sinks are flushed every
+// flushInterval and when the writer stops.
+type asyncWriter struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	buf      []asyncItem
+	head     int
+	count    int
+	closed   bool
+	sampleN  uint64
+	wake     chan struct{}
+	done     chan struct{}
+	policy   string
+	batch    int
+	rate     uint64
+	interval time.Duration
+	logger   log.Logger
+
+	dirty map[Sink]struct{} // Sinks written since the last flush; owned by the worker
+
+	enqueued, written, failed, dropped atomic.Uint64
+	reportedDrops                      uint64
+}
+
+func newAsyncWriter(config *AsyncConfig, logger log.Logger) *asyncWriter {
+	interval, _ := time.ParseDuration(config.FlushInterval)
+
+	w := &asyncWriter{
+		buf:      make([]asyncItem, config.QueueSize),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		policy:   config.OverflowPolicy,
+		batch:    config.BatchSize,
+		rate:     uint64(config.SampleRate),
+		interval: interval,
+		logger:   logger,
+		dirty:    make(map[Sink]struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+
+	go w.run()
+
+	return w
+}
+
+// enqueue queues an item according to the overflow policy. It returns false when the
+// writer has stopped, in which case the caller writes synchronously.
+func (w *asyncWriter) enqueue(item asyncItem) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return false
+	}
+
+	capacity := len(w.buf)
+
+	if w.policy == OverflowSample && w.count >= capacity/2 {
+		w.sampleN++
+		if w.sampleN%w.rate != 0 {
+			w.dropped.Add(1)
+			return true
+		}
+	}
+
+	if w.count == capacity {
+		switch w.policy {
+		case OverflowBlock:
+			for w.count == capacity && !w.closed {
+				w.notFull.Wait()
+			}
+			if w.closed {
+				return false
+			}
+		case OverflowDropOldest:
+			w.buf[w.head] = asyncItem{}
+			w.head = (w.head + 1) % capacity
+			w.count--
+			w.dropped.Add(1)
+		default: // drop-newest, and sample when completely full
+			w.dropped.Add(1)
+			return true
+		}
+	}
+
+	w.buf[(w.head+w.count)%capacity] = item
+	w.count++
+	w.enqueued.Add(1)
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// take removes up to batch items from the queue
+func (w *asyncWriter) take() ([]asyncItem, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.count
+	if n > w.batch {
+		n = w.batch
+	}
+
+	items := make([]asyncItem, n)
+	for i := 0; i < n; i++ {
+		items[i] = w.buf[w.head]
+		w.buf[w.head] = asyncItem{}
+		w.head = (w.head + 1) % len(w.buf)
+	}
+	w.count -= n
+
+	if n > 0 {
+		w.notFull.Broadcast()
+	}
+	return items, w.closed
+}
+
+// run is the worker loop
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.wake:
+		case <-ticker.C:
+			w.flush()
+		}
+
+		for {
+			items, closed := w.take()
+			for _, item := range items {
+				w.write(item)
+			}
+			if len(items) > 0 {
+				continue
+			}
+			if closed {
+				w.flush()
+				return
+			}
+			break
+		}
+	}
+}
+
+// write delivers one record to each of its sinks
+func (w *asyncWriter) write(item asyncItem) {
+	ok := true
+	for _, sink := range item.sinks {
+		w.dirty[sink] = struct{}{}
+		if err := sink.Write(item.rec); err != nil {
+			ok = false
+			if item.logger != nil {
+				item.logger.Warnf("Failed to write log entry to sink: %v", err)
+			}
+		}
+	}
+	if ok {
+		w.written.Add(1)
+	} else {
+		w.failed.Add(1)
+	}
+}
+
+// flush flushes the sinks written since the last flush and reports new drops
+func (w *asyncWriter) flush() {
+	for sink := range w.dirty {
+		if err := sink.Flush(); err != nil && w.logger != nil {
+			w.logger.Warnf("Failed to flush log sink: %v", err)
+		}
+		delete(w.dirty, sink)
+	}
+
+	dropped := w.dropped.Load()
+	if dropped > w.reportedDrops && w.logger != nil {
+		w.logger.Warnf("Async log writer dropped %d entries (%d total, policy %s)", dropped-w.reportedDrops, dropped, w.policy)
+	}
+	w.reportedDrops = dropped
+}
+
+// stop drains the queue, flushes the sinks and stops the worker
+func (w *asyncWriter) stop() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.done
+		return
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	<-w.done
+}
+
+func (w *asyncWriter) stats() AsyncStats {
+	w.mu.Lock()
+	queued := w.count
+	w.mu.Unlock()
+
+	return AsyncStats{
+		Queued:   queued,
+		Enqueued: w.enqueued.Load(),
+		Written:  w.written.Load(),
+		Failed:   w.failed.Load(),
+		Dropped:  w.dropped.Load(),
+	}
+}
+
+// asyncWriters holds the process-wide writers, shared by every activity instance with
+// the same async configuration
+var asyncWriters = struct {
+	sync.Mutex
+	byKey map[string]*asyncWriter
+}{byKey: make(map[string]*asyncWriter)}
+
+// acquireAsyncWriter returns the shared writer for a configuration, starting it on first use
+func acquireAsyncWriter(config *AsyncConfig, logger log.Logger) (*asyncWriter, error) {
+	keyBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode async configuration: %w", err)
+	}
+	key := string(keyBytes)
+
+	asyncWriters.Lock()
+	defer asyncWriters.Unlock()
+
+	if w, exists := asyncWriters.byKey[key]; exists {
+		return w, nil
+	}
+
+	w := newAsyncWriter(config, logger)
+	asyncWriters.byKey[key] = w
+	registerShutdownHook()
+
+	return w, nil
+}
+
+// stopAsyncWriters drains and stops every shared writer
+func stopAsyncWriters() {
+	asyncWriters.Lock()
+	writers := asyncWriters.byKey
+	asyncWriters.byKey = make(map[string]*asyncWriter)
+	asyncWriters.Unlock()
+
+	for _, w := range writers {
+		w.stop()
+	}
+}
+
+// GetAsyncStats returns the combined counters of the running asynchronous writers
+func GetAsyncStats() AsyncStats {
+	asyncWriters.Lock()
+	defer asyncWriters.Unlock()
+
+	var total AsyncStats
+	for _, w := range asyncWriters.byKey {
+		s := w.stats()
+		total.Queued += s.Queued
+		total.Enqueued += s.Enqueued
+		total.Written += s.Written
+		total.Failed += s.Failed
+		total.Dropped += s.Dropped
+	}
+	return total
+}
@@ -0,0 +1,234 @@
+package writelog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gateSink blocks its first write until the gate is opened, so tests can fill the queue
+type gateSink struct {
+	mu      sync.Mutex
+	entered chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+	lines   []string
+	flushes int
+}
+
+func newGateSink() *gateSink {
+	return &gateSink{entered: make(chan struct{}), gate: make(chan struct{})}
+}
+
+func (g *gateSink) Write(rec *Record) error {
+	g.once.Do(func() {
+		close(g.entered)
+		<-g.gate
+	})
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lines = append(g.lines, rec.Line)
+	return nil
+}
+
+func (g *gateSink) Flush() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.flushes++
+	return nil
+}
+
+func (g *gateSink) Close() error { return nil }
+
+func (g *gateSink) written() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.lines...)
+}
+
+// blockedWriter returns a writer whose worker is stuck writing "0", leaving the queue empty
+func blockedWriter(t *testing.T, config *AsyncConfig) (*asyncWriter, *gateSink) {
+	config, err := normalizeAsyncConfig(config)
+	require.NoError(t, err)
+
+	sink := newGateSink()
+	w := newAsyncWriter(config, nil)
+	require.True(t, w.enqueue(asyncItem{rec: &Record{Line: "0"}, sinks: []Sink{sink}}))
+	<-sink.entered
+	return w, sink
+}
+
+func enqueueLines(w *asyncWriter, sink Sink, from, to int) {
+	for i := from; i <= to; i++ {
+		w.enqueue(asyncItem{rec: &Record{Line: fmt.Sprint(i)}, sinks: []Sink{sink}})
+	}
+}
+
+func TestAsyncWriter_OverflowPolicies(t *testing.T) {
+	t.Run("drop-newest", func(t *testing.T) {
+		w, sink := blockedWriter(t, &AsyncConfig{QueueSize: 3, OverflowPolicy: "drop-newest"})
+		enqueueLines(w, sink, 1, 5)
+		assert.Equal(t, uint64(2), w.stats().Dropped)
+
+		close(sink.gate)
+		w.stop()
+		assert.Equal(t, []string{"0", "1", "2", "3"}, sink.written())
+	})
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		w, sink := blockedWriter(t, &AsyncConfig{QueueSize: 3, OverflowPolicy: "DROP-OLDEST"})
+		enqueueLines(w, sink, 1, 5)
+		assert.Equal(t, uint64(2), w.stats().Dropped)
+
+		close(sink.gate)
+		w.stop()
+		assert.Equal(t, []string{"0", "3", "4", "5"}, sink.written())
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		w, sink := blockedWriter(t, &AsyncConfig{QueueSize: 4, OverflowPolicy: "sample", SampleRate: 2})
+		enqueueLines(w, sink, 1, 8)
+		// 1 and 2 fill half the queue; then every second entry is kept until the queue is full
+		assert.Equal(t, uint64(4), w.stats().Dropped)
+
+		close(sink.gate)
+		w.stop()
+		assert.Equal(t, []string{"0", "1", "2", "4", "6"}, sink.written())
+	})
+
+	t.Run("block", func(t *testing.T) {
+		w, sink := blockedWriter(t, &AsyncConfig{QueueSize: 1, OverflowPolicy: "block"})
+		enqueueLines(w, sink, 1, 1)
+
+		returned := make(chan bool)
+		go func() {
+			returned <- w.enqueue(asyncItem{rec: &Record{Line: "2"}, sinks: []Sink{sink}})
+		}()
+
+		select {
+		case <-returned:
+			t.Fatal("enqueue should block while the queue is full")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(sink.gate)
+		assert.True(t, <-returned)
+		w.stop()
+
+		assert.Equal(t, []string{"0", "1", "2"}, sink.written())
+		assert.Equal(t, uint64(0), w.stats().Dropped)
+	})
+}
+
+func TestAsyncWriter_StopDrainsAndFlushes(t *testing.T) {
+	config, err := normalizeAsyncConfig(&AsyncConfig{BatchSize: 7, FlushInterval: "1h"})
+	require.NoError(t, err)
+
+	sink := newGateSink()
+	close(sink.gate)
+
+	w := newAsyncWriter(config, nil)
+	enqueueLines(w, sink, 1, 50)
+	w.stop()
+
+	assert.Len(t, sink.written(), 50)
+	assert.Equal(t, 1, sink.flushes, "sinks are flushed once on stop")
+
+	stats := w.stats()
+	assert.Equal(t, AsyncStats{Queued: 0, Enqueued: 50, Written: 50}, stats)
+
+	assert.False(t, w.enqueue(asyncItem{rec: &Record{Line: "late"}, sinks: []Sink{sink}}), "a stopped writer rejects entries")
+	w.stop() // idempotent
+}
+
+func TestParseAsyncConfig(t *testing.T) {
+	for _, disabled := range []interface{}{nil, false, "", `{"enabled": false}`} {
+		config, err := parseAsyncConfig(disabled)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", disabled)
+	}
+
+	config, err := parseAsyncConfig(true)
+	require.NoError(t, err)
+	assert.Equal(t, &AsyncConfig{QueueSize: 10000, BatchSize: 100, FlushInterval: "1s", OverflowPolicy: OverflowBlock, SampleRate: 10}, config)
+
+	config, err = parseAsyncConfig(map[string]interface{}{"queueSize": 50, "overflowPolicy": "drop-oldest", "flushInterval": "250ms"})
+	require.NoError(t, err)
+	assert.Equal(t, 50, config.QueueSize)
+	assert.Equal(t, OverflowDropOldest, config.OverflowPolicy)
+	assert.Equal(t, "250ms", config.FlushInterval)
+
+	for _, invalid := range []interface{}{
+		`{"overflowPolicy": "panic"}`,
+		`{"flushInterval": "0s"}`,
+		`{"queueSize": -1}`,
+		`not json`,
+	} {
+		_, err := parseAsyncConfig(invalid)
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestActivity_AsyncWriter(t *testing.T) {
+	sinkType, mem := registerMemorySink(t)
+
+	settings := map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "LOGFMT",
+		"sinks":        fmt.Sprintf(`[{"type":%q}]`, sinkType),
+		"async":        map[string]interface{}{"queueSize": 1000, "flushInterval": "10ms"},
+	}
+
+	act1, err := New(test.NewActivityInitContext(settings, nil))
+	require.NoError(t, err)
+	act2, err := New(test.NewActivityInitContext(settings, nil))
+	require.NoError(t, err)
+	assert.Same(t, act1.(*Activity).async, act2.(*Activity).async, "activities with the same configuration share a writer")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			act := act1
+			if i%2 == 1 {
+				act = act2
+			}
+			for j := 0; j < 10; j++ {
+				tc := test.NewActivityContext(act.Metadata())
+				tc.SetInput("logObject", fmt.Sprintf("entry %d-%d", i, j))
+				_, err := act.Eval(tc)
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(200), GetAsyncStats().Enqueued)
+	require.NoError(t, CloseSinks())
+
+	mem.mu.Lock()
+	assert.Len(t, mem.records, 200, "shutdown drains the queue")
+	mem.mu.Unlock()
+	assert.Equal(t, AsyncStats{}, GetAsyncStats())
+
+	// After shutdown entries are written synchronously
+	tc := test.NewActivityContext(act1.Metadata())
+	tc.SetInput("logObject", "after stop")
+	_, err = act1.Eval(tc)
+	require.NoError(t, err)
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	assert.Len(t, mem.records, 201)
+
+	_, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel": "INFO", "outputFormat": "JSON", "async": `{"overflowPolicy":"sometimes"}`,
+	}, nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,387 @@
+package writelog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+const (
+	auditKeyEnvVar      = "FLOGO_WRITELOG_AUDIT_KEY"
+	defaultAuditChain   = "default"
+	auditField          = "audit"
+	auditMaxLineLength  = 16 * 1024 * 1024
+	auditGenesisPrevHex = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// AuditConfig configures the tamper-evident audit mode in the audit setting
+type AuditConfig struct {
+	Enabled   *bool  `json:"enabled,omitempty"`   // Defaults to true when the setting is present
+	Chain     string `json:"chain,omitempty"`     // Chain name, shared by activities writing to the same log (default: "default")
+	StateFile string `json:"stateFile,omitempty"` // Keeps the sequence and last hash across restarts
+}
+
+// parseAuditConfig reads the audit setting. It returns nil when audit mode is disabled.
+func parseAuditConfig(setting interface{}) (*AuditConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+
+	switch v := setting.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &AuditConfig{Chain: defaultAuditChain}, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+	}
+
+	config := &AuditConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid audit setting: %w", err)
+	}
+	if config.Enabled != nil && !*config.Enabled {
+		return nil, nil
+	}
+	if config.Chain == "" {
+		config.Chain = defaultAuditChain
+	}
+	return config, nil
+}
+
+// resolveAuditKey returns the HMAC key for audit signatures from the setting or the
+// environment. Entries are not signed without a key.
+func resolveAuditKey(setting string) []byte {
+	if setting != "" {
+		return []byte(setting)
+	}
+	if env := os.Getenv(auditKeyEnvVar); env != "" {
+		return []byte(env)
+	}
+	return nil
+}
+
+// auditChain is the hash chain of one audit log. Each entry gets the next sequence number
+// and the hash of the previous entry; its own hash covers both, so removing, reordering or
+// altering entries breaks the chain.
+type auditChain struct {
+	sync.Mutex
+	name      string
+	key       []byte
+	stateFile string
+	seq       uint64
+	prev      string
+	logger    log.Logger
+}
+
+// auditState is the content of an audit state file
+type auditState struct {
+	Chain string `json:"chain"`
+	Seq   uint64 `json:"seq"`
+	Hash  string `json:"hash"`
+}
+
+// auditChains holds the chains of the process by name
+var auditChains = struct {
+	sync.Mutex
+	byName map[string]*auditChain
+}{byName: make(map[string]*auditChain)}
+
+// acquireAuditChain returns the shared chain for a configuration, creating it on first use.
+// Activities sharing a chain must use the same key and state file.
+func acquireAuditChain(config *AuditConfig, key []byte, logger log.Logger) (*auditChain, error) {
+	auditChains.Lock()
+	defer auditChains.Unlock()
+
+	if chain, exists := auditChains.byName[config.Chain]; exists {
+		if !hmac.Equal(chain.key, key) || chain.stateFile != config.StateFile {
+			return nil, fmt.Errorf("audit chain '%s' is already used with a different key or state file", config.Chain)
+		}
+		return chain, nil
+	}
+
+	chain := &auditChain{
+		name:      config.Chain,
+		key:       key,
+		stateFile: config.StateFile,
+		prev:      auditGenesisPrevHex,
+		logger:    logger,
+	}
+	if config.StateFile != "" {
+		if err := chain.loadState(); err != nil {
+			return nil, err
+		}
+	}
+
+	auditChains.byName[config.Chain] = chain
+	return chain, nil
+}
+
+// loadState resumes the chain from its state file, if the file exists
+func (c *auditChain) loadState() error {
+	data, err := os.ReadFile(c.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit state file: %w", err)
+	}
+
+	var state auditState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid audit state file %s: %w", c.stateFile, err)
+	}
+	if state.Chain != c.name {
+		return fmt.Errorf("audit state file %s belongs to chain '%s', not '%s'", c.stateFile, state.Chain, c.name)
+	}
+	if _, err := hex.DecodeString(state.Hash); err != nil || len(state.Hash) != sha256.Size*2 {
+		return fmt.Errorf("invalid hash in audit state file %s", c.stateFile)
+	}
+
+	c.seq, c.prev = state.Seq, state.Hash
+	return nil
+}
+
+// saveState writes the sequence and last hash, replacing the state file atomically
+func (c *auditChain) saveState() error {
+	data, err := json.Marshal(auditState{Chain: c.name, Seq: c.seq, Hash: c.prev})
+	if err != nil {
+		return err
+	}
+	tmp := c.stateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(c.stateFile), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.stateFile)
+}
+
+// seal adds the audit object to the record's entry. The caller must hold the chain lock
+// until the record is handed to the sinks.
+func (c *auditChain) seal(rec *Record) {
+	c.seq++
+
+	entry := copyMap(rec.Entry)
+	audit := map[string]interface{}{
+		"chain": c.name,
+		"seq":   c.seq,
+		"prev":  c.prev,
+	}
+	entry[auditField] = audit
+
+	hash, err := auditHash(entry)
+	if err != nil {
+		// The entry cannot be encoded, so it would not be written as JSON either
+		c.logger.Warnf("Failed to hash audit entry %d: %v", c.seq, err)
+		hash = auditGenesisPrevHex
+	}
+	audit["hash"] = hash
+	if len(c.key) > 0 {
+		audit["sig"] = auditSignature(c.key, hash)
+	}
+
+	c.prev = hash
+	rec.Entry = entry
+
+	if c.stateFile != "" {
+		if err := c.saveState(); err != nil {
+			c.logger.Warnf("Failed to save audit state for chain %s: %v", c.name, err)
+		}
+	}
+}
+
+// auditHash returns the SHA-256 of the entry's canonical JSON, without the hash and
+// signature of its audit object. The canonical form is what a JSON decoder reading the
+// written line sees: map keys are sorted and numbers keep their text.
+func auditHash(entry map[string]interface{}) (string, error) {
+	canonical, err := canonicalAuditJSON(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func canonicalAuditJSON(entry map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	if audit, ok := decoded[auditField].(map[string]interface{}); ok {
+		delete(audit, "hash")
+		delete(audit, "sig")
+	}
+	return json.Marshal(decoded)
+}
+
+func auditSignature(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Audit issue kinds reported by the verifier
+const (
+	AuditIssueTampered     = "tampered"      // The entry does not match its hash
+	AuditIssueBadSignature = "bad-signature" // The signature is missing or wrong
+	AuditIssueGap          = "gap"           // Sequence numbers are missing
+	AuditIssueBrokenLink   = "broken-link"   // The entry does not follow the previous one
+	AuditIssueOutOfOrder   = "out-of-order"  // The sequence number repeats or goes back
+	AuditIssueMalformed    = "malformed"     // The audit object is incomplete
+)
+
+// AuditIssue is a problem found in an audit log
+type AuditIssue struct {
+	Line   int    `json:"line"`
+	Chain  string `json:"chain"`
+	Seq    uint64 `json:"seq"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+func (i AuditIssue) String() string {
+	return fmt.Sprintf("line %d: chain %s seq %d: %s: %s", i.Line, i.Chain, i.Seq, i.Kind, i.Detail)
+}
+
+// AuditReport is the result of verifying an audit log
+type AuditReport struct {
+	Entries  int               `json:"entries"`  // Audited entries checked
+	Skipped  int               `json:"skipped"`  // Lines without an audited JSON entry
+	Restarts int               `json:"restarts"` // Chains restarted from sequence 1, e.g. after a restart without a state file
+	LastSeq  map[string]uint64 `json:"lastSeq"`  // Last sequence number per chain
+	Issues   []AuditIssue      `json:"issues"`
+}
+
+// OK reports whether the log verified without issues
+func (r *AuditReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// VerifyAuditFile checks the hash chains of an audit log file. See VerifyAuditLog.
+func VerifyAuditFile(path string, key []byte) (*AuditReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return VerifyAuditLog(f, key)
+}
+
+// VerifyAuditLog checks the hash chains of an audit log. Each line may have a prefix, such
+// as the engine logger's timestamp, and a suffix; the audited JSON entry starts at the first
+// '{'. Lines without an audited entry are skipped. With a key, every entry must carry a
+// valid signature. Entries removed from the end of a log cannot be detected from the log
+// alone; compare LastSeq with the chain's state file for that.
+func VerifyAuditLog(r io.Reader, key []byte) (*AuditReport, error) {
+	report := &AuditReport{LastSeq: make(map[string]uint64)}
+	prevHash := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), auditMaxLineLength)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+
+		start := bytes.IndexByte(line, '{')
+		if start < 0 {
+			report.Skipped++
+			continue
+		}
+		var entry map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(line[start:]))
+		dec.UseNumber()
+		if err := dec.Decode(&entry); err != nil {
+			report.Skipped++
+			continue
+		}
+		audit, ok := entry[auditField].(map[string]interface{})
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		report.Entries++
+
+		issue := func(chain string, seq uint64, kind, format string, args ...interface{}) {
+			report.Issues = append(report.Issues, AuditIssue{Line: lineNo, Chain: chain, Seq: seq, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+		}
+
+		chain, _ := audit["chain"].(string)
+		hash, _ := audit["hash"].(string)
+		prev, _ := audit["prev"].(string)
+		seqNum, _ := audit["seq"].(json.Number)
+		seq, err := strconv.ParseUint(seqNum.String(), 10, 64)
+		if chain == "" || hash == "" || prev == "" || err != nil {
+			issue(chain, seq, AuditIssueMalformed, "the audit object needs chain, seq, prev and hash")
+			continue
+		}
+
+		if computed, err := auditHash(entry); err != nil || computed != hash {
+			issue(chain, seq, AuditIssueTampered, "the entry does not match its hash")
+		}
+		if len(key) > 0 {
+			sig, _ := audit["sig"].(string)
+			if sig == "" {
+				issue(chain, seq, AuditIssueBadSignature, "the entry is not signed")
+			} else if !hmac.Equal([]byte(sig), []byte(auditSignature(key, hash))) {
+				issue(chain, seq, AuditIssueBadSignature, "the signature does not match")
+			}
+		}
+
+		last, seen := report.LastSeq[chain]
+		switch {
+		case !seen:
+			// The log may start in the middle of a chain, e.g. after rotation
+		case seq == 1 && prev == auditGenesisPrevHex:
+			report.Restarts++
+		case seq == last+1:
+			if prev != prevHash[chain] {
+				issue(chain, seq, AuditIssueBrokenLink, "prev does not match the hash of entry %d", last)
+			}
+		case seq > last+1:
+			if seq == last+2 {
+				issue(chain, seq, AuditIssueGap, "entry %d is missing", last+1)
+			} else {
+				issue(chain, seq, AuditIssueGap, "entries %d to %d are missing", last+1, seq-1)
+			}
+		default:
+			// Keep checking the following entries against the chain so far
+			issue(chain, seq, AuditIssueOutOfOrder, "follows entry %d", last)
+			continue
+		}
+
+		report.LastSeq[chain] = seq
+		prevHash[chain] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
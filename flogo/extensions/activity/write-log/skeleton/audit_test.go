@@ -0,0 +1,207 @@
+package writelog
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuditedActivity creates an activity writing audited entries to a memory sink
+func newAuditedActivity(t *testing.T, audit map[string]interface{}, key string) (*Activity, *memorySink) {
+	sinkType, mem := registerMemorySink(t)
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":       "INFO",
+		"outputFormat":   "JSON",
+		"addFlowDetails": true,
+		"sinks":          `[{"type":"` + sinkType + `"}]`,
+		"audit":          audit,
+		"auditKey":       key,
+	}, nil))
+	require.NoError(t, err)
+	return act.(*Activity), mem
+}
+
+func uniqueChain() string {
+	return fmt.Sprintf("audit-test-%d", memorySinkSeq.Add(1))
+}
+
+func auditLines(mem *memorySink) []string {
+	lines := make([]string, len(mem.records))
+	for i, rec := range mem.records {
+		lines[i] = rec.Line
+	}
+	return lines
+}
+
+func verifyLines(t *testing.T, lines []string, key string) *AuditReport {
+	report, err := VerifyAuditLog(strings.NewReader(strings.Join(lines, "\n")), []byte(key))
+	require.NoError(t, err)
+	return report
+}
+
+func issueKinds(report *AuditReport) []string {
+	kinds := make([]string, len(report.Issues))
+	for i, issue := range report.Issues {
+		kinds[i] = issue.Kind
+	}
+	return kinds
+}
+
+func TestAudit_HashChain(t *testing.T) {
+	chain := uniqueChain()
+	act, mem := newAuditedActivity(t, map[string]interface{}{"chain": chain}, "audit-secret")
+
+	for i := 1; i <= 5; i++ {
+		evalMessage(t, act, "INFO", map[string]interface{}{"message": fmt.Sprintf("transfer %d", i), "amount": 10.5 * float64(i), "big": int64(1) << 60})
+	}
+	lines := auditLines(mem)
+	require.Len(t, lines, 5)
+
+	first := mem.records[0].Entry[auditField].(map[string]interface{})
+	assert.Equal(t, chain, first["chain"])
+	assert.Equal(t, uint64(1), first["seq"])
+	assert.Equal(t, auditGenesisPrevHex, first["prev"])
+	assert.Len(t, first["sig"], 64)
+	second := mem.records[1].Entry[auditField].(map[string]interface{})
+	assert.Equal(t, first["hash"], second["prev"], "each entry links to the previous hash")
+	assert.Contains(t, mem.records[0].Entry, "flogo", "flow details are fields, covered by the hash")
+
+	t.Run("Intact log", func(t *testing.T) {
+		// Lines may carry a prefix such as the engine logger's timestamp and level
+		prefixed := append([]string{"2025-08-04T10:30:45.000Z\tINFO\t[flogo] -\t" + lines[0], "not an audit line"}, lines[1:]...)
+		report := verifyLines(t, prefixed, "audit-secret")
+		assert.True(t, report.OK(), "%v", report.Issues)
+		assert.Equal(t, 5, report.Entries)
+		assert.Equal(t, 1, report.Skipped)
+		assert.Equal(t, map[string]uint64{chain: 5}, report.LastSeq)
+	})
+
+	t.Run("Altered entry", func(t *testing.T) {
+		altered := append([]string(nil), lines...)
+		altered[2] = strings.Replace(altered[2], "transfer 3", "transfer 9", 1)
+		report := verifyLines(t, altered, "audit-secret")
+		assert.Equal(t, []string{AuditIssueTampered}, issueKinds(report))
+		assert.Equal(t, 3, report.Issues[0].Line)
+		assert.Equal(t, uint64(3), report.Issues[0].Seq)
+	})
+
+	t.Run("Removed entries", func(t *testing.T) {
+		report := verifyLines(t, []string{lines[0], lines[3], lines[4]}, "audit-secret")
+		assert.Equal(t, []string{AuditIssueGap}, issueKinds(report))
+		assert.Equal(t, "entries 2 to 3 are missing", report.Issues[0].Detail)
+	})
+
+	t.Run("Reordered entries", func(t *testing.T) {
+		report := verifyLines(t, []string{lines[0], lines[2], lines[1], lines[3], lines[4]}, "audit-secret")
+		assert.Equal(t, []string{AuditIssueGap, AuditIssueOutOfOrder}, issueKinds(report))
+	})
+
+	t.Run("Signatures", func(t *testing.T) {
+		report := verifyLines(t, lines, "other-key")
+		assert.Len(t, report.Issues, 5)
+		assert.Equal(t, AuditIssueBadSignature, report.Issues[0].Kind)
+
+		report = verifyLines(t, lines, "")
+		assert.True(t, report.OK(), "signatures are only checked with a key")
+	})
+
+	t.Run("Re-hashed entry", func(t *testing.T) {
+		// Without the key, an altered entry can be given a matching hash, but it no longer
+		// links to its successor
+		entry := mem.records[1].Entry
+		forged := copyMap(entry)
+		forged["message"] = "transfer 200"
+		audit := copyMap(entry[auditField].(map[string]interface{}))
+		delete(audit, "sig")
+		forged[auditField] = audit
+		hash, err := auditHash(forged)
+		require.NoError(t, err)
+		audit["hash"] = hash
+		line := act.formatAsJSON(forged)
+
+		report := verifyLines(t, []string{lines[0], line, lines[2]}, "")
+		assert.Equal(t, []string{AuditIssueBrokenLink}, issueKinds(report))
+		assert.Equal(t, uint64(3), report.Issues[0].Seq)
+
+		report = verifyLines(t, []string{lines[0], line, lines[2]}, "audit-secret")
+		assert.Equal(t, []string{AuditIssueBadSignature, AuditIssueBrokenLink}, issueKinds(report))
+	})
+}
+
+func TestAudit_StateFile(t *testing.T) {
+	chain := uniqueChain()
+	stateFile := filepath.Join(t.TempDir(), "state", "audit.json")
+	config := map[string]interface{}{"chain": chain, "stateFile": stateFile}
+
+	act, mem := newAuditedActivity(t, config, "")
+	evalMessage(t, act, "INFO", "one")
+	evalMessage(t, act, "INFO", "two")
+
+	// Simulate a restart: the chain resumes from the state file
+	auditChains.Lock()
+	delete(auditChains.byName, chain)
+	auditChains.Unlock()
+	act, mem2 := newAuditedActivity(t, config, "")
+	evalMessage(t, act, "INFO", "three")
+
+	lines := append(auditLines(mem), auditLines(mem2)...)
+	report := verifyLines(t, lines, "")
+	assert.True(t, report.OK(), "%v", report.Issues)
+	assert.Equal(t, uint64(3), report.LastSeq[chain])
+	assert.Equal(t, 0, report.Restarts)
+
+	// Without a state file, a restart begins a new chain from sequence 1
+	restarted, mem3 := newAuditedActivity(t, map[string]interface{}{"chain": uniqueChain()}, "")
+	evalMessage(t, restarted, "INFO", "a")
+	auditChains.Lock()
+	delete(auditChains.byName, restarted.audit.name)
+	auditChains.Unlock()
+	restarted, mem4 := newAuditedActivity(t, map[string]interface{}{"chain": restarted.audit.name}, "")
+	evalMessage(t, restarted, "INFO", "b")
+
+	report = verifyLines(t, append(auditLines(mem3), auditLines(mem4)...), "")
+	assert.True(t, report.OK(), "%v", report.Issues)
+	assert.Equal(t, 1, report.Restarts)
+}
+
+func TestAudit_Configuration(t *testing.T) {
+	config, err := parseAuditConfig(true)
+	require.NoError(t, err)
+	assert.Equal(t, defaultAuditChain, config.Chain)
+
+	for _, disabled := range []interface{}{nil, false, "", `{"enabled": false}`} {
+		config, err := parseAuditConfig(disabled)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", disabled)
+	}
+
+	_, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "LOGFMT",
+		"audit":        true,
+	}, nil))
+	assert.Error(t, err, "audit mode needs JSON output")
+
+	_, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"audit":        map[string]interface{}{"chain": uniqueChain()},
+		"async":        map[string]interface{}{"overflowPolicy": "drop-newest"},
+	}, nil))
+	assert.ErrorContains(t, err, "overflow policy", "dropped entries would break the chain")
+
+	chain := uniqueChain()
+	newAuditedActivity(t, map[string]interface{}{"chain": chain}, "key-1")
+	_, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"audit":        map[string]interface{}{"chain": chain},
+		"auditKey":     "key-2",
+	}, nil))
+	assert.Error(t, err, "a chain has a single key")
+}
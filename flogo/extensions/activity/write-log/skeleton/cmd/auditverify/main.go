@@ -0,0 +1,81 @@
+// Command auditverify checks the hash chains of write-log audit files and reports
+// gaps and tampered entries.
+//
+// Usage:
+//
+//	auditverify [-key secret] [-json] file...
+//
+// The HMAC key defaults to the FLOGO_WRITELOG_AUDIT_KEY environment variable. The exit
+// status is 0 when every file verifies, 1 when issues are found and 2 on errors.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	writelog "github.com/milindpandav/activity/write-log"
+)
+
+func main() {
+	key := flag.String("key", os.Getenv("FLOGO_WRITELOG_AUDIT_KEY"), "HMAC key; entries must be signed when set")
+	asJSON := flag.Bool("json", false, "print the reports as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-key secret] [-json] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	status := 0
+	reports := make(map[string]*writelog.AuditReport)
+	for _, path := range flag.Args() {
+		report, err := writelog.VerifyAuditFile(path, []byte(*key))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(2)
+		}
+		reports[path] = report
+		if !report.OK() {
+			status = 1
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Exit(status)
+	}
+
+	for _, path := range flag.Args() {
+		report := reports[path]
+		result := "OK"
+		if !report.OK() {
+			result = fmt.Sprintf("%d issue(s)", len(report.Issues))
+		}
+		fmt.Printf("%s: %s, %d entries, %d skipped lines, %d restarts\n", path, result, report.Entries, report.Skipped, report.Restarts)
+
+		chains := make([]string, 0, len(report.LastSeq))
+		for chain := range report.LastSeq {
+			chains = append(chains, chain)
+		}
+		sort.Strings(chains)
+		for _, chain := range chains {
+			fmt.Printf("  chain %s: last seq %d\n", chain, report.LastSeq[chain])
+		}
+		for _, issue := range report.Issues {
+			fmt.Printf("  %s\n", issue)
+		}
+	}
+	os.Exit(status)
+}
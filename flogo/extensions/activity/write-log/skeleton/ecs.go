@@ -0,0 +1,502 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ECS modes
+const (
+	ECSModeCompatible = "compatible"
+	ECSModeStrict     = "strict"
+)
+
+const (
+	ecsVersion          = "8.11.0"
+	defaultECSNamespace = "labels"
+	ecsDateLayout       = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// ECS field types used for coercion
+const (
+	ecsKeyword = "keyword"
+	ecsText    = "text"
+	ecsLong    = "long"
+	ecsFloat   = "float"
+	ecsBoolean = "boolean"
+	ecsDate    = "date"
+	ecsIP      = "ip"
+)
+
+// ecsFields lists the ECS 8.11 fields that strict mode maps and coerces. Fields of a
+// known field set that are not listed here are treated as custom fields.
+var ecsFields = map[string]string{
+	"@timestamp": ecsDate,
+	"message":    ecsText,
+	"tags":       ecsKeyword,
+
+	"ecs.version": ecsKeyword,
+
+	"log.level":            ecsKeyword,
+	"log.logger":           ecsKeyword,
+	"log.origin.function":  ecsKeyword,
+	"log.origin.file.name": ecsKeyword,
+	"log.origin.file.line": ecsLong,
+
+	"trace.id":       ecsKeyword,
+	"span.id":        ecsKeyword,
+	"transaction.id": ecsKeyword,
+
+	"service.name":        ecsKeyword,
+	"service.type":        ecsKeyword,
+	"service.version":     ecsKeyword,
+	"service.environment": ecsKeyword,
+	"service.id":          ecsKeyword,
+	"service.node.name":   ecsKeyword,
+
+	"agent.name":    ecsKeyword,
+	"agent.type":    ecsKeyword,
+	"agent.version": ecsKeyword,
+	"agent.id":      ecsKeyword,
+
+	"host.name":         ecsKeyword,
+	"host.hostname":     ecsKeyword,
+	"host.id":           ecsKeyword,
+	"host.ip":           ecsIP,
+	"host.mac":          ecsKeyword,
+	"host.architecture": ecsKeyword,
+	"host.os.platform":  ecsKeyword,
+	"host.os.family":    ecsKeyword,
+	"host.os.kernel":    ecsKeyword,
+	"host.os.name":      ecsKeyword,
+	"host.os.version":   ecsKeyword,
+	"host.os.type":      ecsKeyword,
+
+	"process.pid":          ecsLong,
+	"process.name":         ecsKeyword,
+	"process.executable":   ecsKeyword,
+	"process.command_line": ecsKeyword,
+	"process.args":         ecsKeyword,
+	"process.exit_code":    ecsLong,
+	"process.title":        ecsKeyword,
+
+	"event.kind":       ecsKeyword,
+	"event.category":   ecsKeyword,
+	"event.type":       ecsKeyword,
+	"event.outcome":    ecsKeyword,
+	"event.action":     ecsKeyword,
+	"event.dataset":    ecsKeyword,
+	"event.module":     ecsKeyword,
+	"event.provider":   ecsKeyword,
+	"event.code":       ecsKeyword,
+	"event.id":         ecsKeyword,
+	"event.reason":     ecsKeyword,
+	"event.original":   ecsKeyword,
+	"event.duration":   ecsLong,
+	"event.sequence":   ecsLong,
+	"event.severity":   ecsLong,
+	"event.risk_score": ecsFloat,
+	"event.created":    ecsDate,
+	"event.start":      ecsDate,
+	"event.end":        ecsDate,
+	"event.ingested":   ecsDate,
+
+	"error.message":     ecsText,
+	"error.type":        ecsKeyword,
+	"error.code":        ecsKeyword,
+	"error.id":          ecsKeyword,
+	"error.stack_trace": ecsKeyword,
+
+	"http.version":               ecsKeyword,
+	"http.request.method":        ecsKeyword,
+	"http.request.id":            ecsKeyword,
+	"http.request.referrer":      ecsKeyword,
+	"http.request.body.bytes":    ecsLong,
+	"http.request.bytes":         ecsLong,
+	"http.response.status_code":  ecsLong,
+	"http.response.body.bytes":   ecsLong,
+	"http.response.bytes":        ecsLong,
+	"http.response.mime_type":    ecsKeyword,
+	"url.full":                   ecsKeyword,
+	"url.original":               ecsKeyword,
+	"url.scheme":                 ecsKeyword,
+	"url.domain":                 ecsKeyword,
+	"url.port":                   ecsLong,
+	"url.path":                   ecsKeyword,
+	"url.query":                  ecsKeyword,
+	"user_agent.original":        ecsKeyword,
+	"network.protocol":           ecsKeyword,
+	"network.transport":          ecsKeyword,
+	"network.direction":          ecsKeyword,
+	"client.ip":                  ecsIP,
+	"client.port":                ecsLong,
+	"client.address":             ecsKeyword,
+	"client.domain":              ecsKeyword,
+	"source.ip":                  ecsIP,
+	"source.port":                ecsLong,
+	"source.address":             ecsKeyword,
+	"source.domain":              ecsKeyword,
+	"destination.ip":             ecsIP,
+	"destination.port":           ecsLong,
+	"destination.address":        ecsKeyword,
+	"destination.domain":         ecsKeyword,
+	"server.ip":                  ecsIP,
+	"server.port":                ecsLong,
+	"server.address":             ecsKeyword,
+	"server.domain":              ecsKeyword,
+	"user.id":                    ecsKeyword,
+	"user.name":                  ecsKeyword,
+	"user.full_name":             ecsKeyword,
+	"user.email":                 ecsKeyword,
+	"user.domain":                ecsKeyword,
+	"user.roles":                 ecsKeyword,
+	"organization.id":            ecsKeyword,
+	"organization.name":          ecsKeyword,
+	"cloud.provider":             ecsKeyword,
+	"cloud.region":               ecsKeyword,
+	"cloud.availability_zone":    ecsKeyword,
+	"cloud.account.id":           ecsKeyword,
+	"cloud.instance.id":          ecsKeyword,
+	"container.id":               ecsKeyword,
+	"container.name":             ecsKeyword,
+	"container.image.name":       ecsKeyword,
+	"orchestrator.type":          ecsKeyword,
+	"orchestrator.namespace":     ecsKeyword,
+	"orchestrator.resource.name": ecsKeyword,
+	"data_stream.type":           ecsKeyword,
+	"data_stream.dataset":        ecsKeyword,
+	"data_stream.namespace":      ecsKeyword,
+	"file.path":                  ecsKeyword,
+	"file.name":                  ecsKeyword,
+	"file.size":                  ecsLong,
+	"rule.id":                    ecsKeyword,
+	"rule.name":                  ecsKeyword,
+	"threat.framework":           ecsKeyword,
+	"related.ip":                 ecsIP,
+	"related.user":               ecsKeyword,
+	"related.hosts":              ecsKeyword,
+	"related.hash":               ecsKeyword,
+	"observer.name":              ecsKeyword,
+	"observer.type":              ecsKeyword,
+	"observer.vendor":            ecsKeyword,
+	"observer.product":           ecsKeyword,
+	"observer.version":           ecsKeyword,
+}
+
+// ecsObjects holds every ECS path that is an object (e.g. "host", "host.os")
+var ecsObjects = func() map[string]bool {
+	objects := map[string]bool{"labels": true}
+	for field := range ecsFields {
+		parts := strings.Split(field, ".")
+		for i := 1; i < len(parts); i++ {
+			objects[strings.Join(parts[:i], ".")] = true
+		}
+	}
+	return objects
+}()
+
+// ecsMapper rewrites entries to the strict ECS layout
+type ecsMapper struct {
+	namespace string
+	warn      func(format string, args ...interface{})
+	warned    sync.Map // Conflicts already reported, so each is logged once
+}
+
+// newECSMapper returns the mapper for the ecsMode setting, or nil in compatible mode
+func newECSMapper(mode, namespace string, warn func(format string, args ...interface{})) (*ecsMapper, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", ECSModeCompatible:
+		return nil, nil
+	case ECSModeStrict:
+	default:
+		return nil, fmt.Errorf("invalid ecsMode '%s': expected %s or %s", mode, ECSModeCompatible, ECSModeStrict)
+	}
+
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		namespace = defaultECSNamespace
+	}
+	if strings.ContainsAny(namespace, ". ") || strings.HasPrefix(namespace, "@") {
+		return nil, fmt.Errorf("invalid ecsNamespace '%s': must be a single field name", namespace)
+	}
+	if namespace != defaultECSNamespace && (ecsObjects[namespace] || ecsFields[namespace] != "") {
+		return nil, fmt.Errorf("invalid ecsNamespace '%s': it is an ECS field set", namespace)
+	}
+
+	return &ecsMapper{namespace: namespace, warn: warn}, nil
+}
+
+// mapEntry returns the entry in strict ECS layout: ecs.version is set, level moves to
+// log.level, ECS fields are coerced to their ECS types and every other field is moved
+// under the custom namespace. Values that cannot be coerced are moved to the namespace
+// too, and reported as warnings.
+func (m *ecsMapper) mapEntry(entry map[string]interface{}, level string) map[string]interface{} {
+	result := make(map[string]interface{}, len(entry))
+	custom := make(map[string]interface{})
+
+	for _, key := range sortedKeys(entry) {
+		value := entry[key]
+		switch {
+		case key == "level":
+			// Replaced by log.level below
+		case key == "labels":
+			if labels, ok := value.(map[string]interface{}); ok {
+				for k, v := range labels {
+					custom[k] = v
+				}
+			} else {
+				m.conflict("labels", "labels must be an object, moved to %s.labels", m.namespace)
+				custom["labels"] = value
+			}
+		case key == m.namespace:
+			if nested, ok := value.(map[string]interface{}); ok {
+				for k, v := range nested {
+					custom[k] = v
+				}
+			} else {
+				custom[key] = value
+			}
+		case ecsFields[key] != "" || ecsObjects[key]:
+			m.mapField(result, custom, key, value)
+		default:
+			custom[key] = value
+		}
+	}
+
+	logObj, _ := result["log"].(map[string]interface{})
+	if logObj == nil {
+		logObj = make(map[string]interface{})
+		result["log"] = logObj
+	}
+	if _, exists := logObj["level"]; !exists {
+		logObj["level"] = strings.ToUpper(level)
+	}
+
+	if ecs, ok := result["ecs"].(map[string]interface{}); ok {
+		if v, exists := ecs["version"]; exists && v != ecsVersion {
+			m.conflict("ecs.version", "ecs.version '%v' replaced by %s", v, ecsVersion)
+		}
+	}
+	result["ecs"] = map[string]interface{}{"version": ecsVersion}
+
+	if len(custom) > 0 {
+		if m.namespace == defaultECSNamespace {
+			result[m.namespace] = ecsLabels(custom)
+		} else {
+			result[m.namespace] = custom
+		}
+	}
+
+	return result
+}
+
+// mapField places an ECS field, or the fields of an ECS object, into the result
+func (m *ecsMapper) mapField(result, custom map[string]interface{}, path string, value interface{}) {
+	if fieldType := ecsFields[path]; fieldType != "" {
+		coerced, ok := coerceECSValue(fieldType, value)
+		if !ok {
+			m.conflict(path, "%s expects a %s value, got %T; moved to %s.%s", path, fieldType, value, m.namespace, path)
+			setPath(custom, path, value)
+			return
+		}
+		setPath(result, path, coerced)
+		return
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		m.conflict(path, "%s is an ECS object, got %T; moved to %s.%s", path, value, m.namespace, path)
+		setPath(custom, path, value)
+		return
+	}
+
+	for _, key := range sortedKeys(nested) {
+		child := path + "." + key
+		if ecsFields[child] != "" || ecsObjects[child] {
+			m.mapField(result, custom, child, nested[key])
+		} else {
+			setPath(custom, child, nested[key])
+		}
+	}
+}
+
+// conflict reports a mapping conflict once per field
+func (m *ecsMapper) conflict(field, format string, args ...interface{}) {
+	if _, seen := m.warned.LoadOrStore(field, true); seen || m.warn == nil {
+		return
+	}
+	m.warn("ECS mapping conflict: "+format, args...)
+}
+
+// setPath sets a dotted path in a nested map, creating intermediate objects
+func setPath(target map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := target[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			target[part] = next
+		}
+		target = next
+	}
+	target[parts[len(parts)-1]] = value
+}
+
+// ecsLabels flattens custom fields into ECS labels, whose keys cannot contain dots and
+// whose values are keywords
+func ecsLabels(custom map[string]interface{}) map[string]interface{} {
+	labels := make(map[string]interface{})
+	for key, value := range flattenEntry(custom, "") {
+		if value == nil {
+			continue
+		}
+		name := strings.ReplaceAll(key, ".", "_")
+		if s, ok := value.(string); ok {
+			labels[name] = s
+			continue
+		}
+		if coerced, ok := coerceECSValue(ecsKeyword, value); ok {
+			labels[name] = coerced
+		} else {
+			labels[name] = fmt.Sprintf("%v", value)
+		}
+	}
+	return labels
+}
+
+// coerceECSValue converts a value to the given ECS type. Arrays are coerced element by
+// element, since any ECS field may hold an array of values.
+func coerceECSValue(fieldType string, value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			coerced, ok := coerceECSScalar(fieldType, item)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, coerced)
+		}
+		return out, true
+	case []string:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			coerced, ok := coerceECSScalar(fieldType, item)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, coerced)
+		}
+		return out, true
+	}
+	return coerceECSScalar(fieldType, value)
+}
+
+func coerceECSScalar(fieldType string, value interface{}) (interface{}, bool) {
+	if _, isMap := value.(map[string]interface{}); isMap {
+		return nil, false
+	}
+
+	switch fieldType {
+	case ecsKeyword, ecsText:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case time.Time:
+			return v.UTC().Format(ecsDateLayout), true
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+		if n, ok := toNumber(value); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64), true
+		}
+		return nil, false
+
+	case ecsLong:
+		n, ok := toNumber(value)
+		if !ok {
+			s, isString := value.(string)
+			if !isString {
+				return nil, false
+			}
+			var err error
+			if n, err = strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil {
+				return nil, false
+			}
+		}
+		if n != math.Trunc(n) || math.IsInf(n, 0) || n > math.MaxInt64 || n < math.MinInt64 {
+			return nil, false
+		}
+		return int64(n), true
+
+	case ecsFloat:
+		if n, ok := toNumber(value); ok {
+			return n, true
+		}
+		if s, ok := value.(string); ok {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return n, true
+			}
+		}
+		return nil, false
+
+	case ecsBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, true
+			}
+		}
+		return nil, false
+
+	case ecsDate:
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC().Format(ecsDateLayout), true
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v)); err == nil {
+				return t.UTC().Format(ecsDateLayout), true
+			}
+			return nil, false
+		}
+		// Numbers are epoch milliseconds, as in Elasticsearch date fields
+		if n, ok := toNumber(value); ok {
+			return time.UnixMilli(int64(n)).UTC().Format(ecsDateLayout), true
+		}
+		return nil, false
+
+	case ecsIP:
+		if s, ok := value.(string); ok && net.ParseIP(strings.TrimSpace(s)) != nil {
+			return strings.TrimSpace(s), true
+		}
+		return nil, false
+	}
+
+	return value, true
+}
+
+// addCustom adds a field under the namespace of an entry that is already mapped
+func (m *ecsMapper) addCustom(entry map[string]interface{}, key string, value interface{}) {
+	existing, _ := entry[m.namespace].(map[string]interface{})
+	custom := copyMap(existing)
+	if m.namespace == defaultECSNamespace {
+		for k, v := range ecsLabels(map[string]interface{}{key: value}) {
+			custom[k] = v
+		}
+	} else {
+		custom[key] = value
+	}
+	entry[m.namespace] = custom
+}
@@ -0,0 +1,182 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestECSMapper(t *testing.T) {
+	var warnings []string
+	warn := func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+
+	m, err := newECSMapper("strict", "", warn)
+	require.NoError(t, err)
+
+	entry := m.mapEntry(map[string]interface{}{
+		"level":      "WARN",
+		"message":    42,
+		"@timestamp": time.Date(2025, 8, 4, 10, 30, 45, 123456789, time.FixedZone("CEST", 2*3600)),
+		"orderId":    "ord-1",
+		"amount":     12.5,
+		"customer":   map[string]interface{}{"tier": "gold", "flags": []interface{}{"a", "b"}},
+		"user":       map[string]interface{}{"id": 7, "plan": "pro"},
+		"http":       map[string]interface{}{"response": map[string]interface{}{"status_code": "201"}},
+		"client":     map[string]interface{}{"ip": "not-an-ip", "port": 8080.0},
+		"host":       "web-1",
+		"tags":       []interface{}{"x", 1},
+		"labels":     map[string]interface{}{"team": "orders"},
+		"ecs":        map[string]interface{}{"version": "1.0"},
+	}, "WARN")
+
+	assert.Equal(t, map[string]interface{}{
+		"ecs":        map[string]interface{}{"version": "8.11.0"},
+		"log":        map[string]interface{}{"level": "WARN"},
+		"message":    "42",
+		"@timestamp": "2025-08-04T08:30:45.123Z",
+		"user":       map[string]interface{}{"id": "7"},
+		"http":       map[string]interface{}{"response": map[string]interface{}{"status_code": int64(201)}},
+		"client":     map[string]interface{}{"port": int64(8080)},
+		"tags":       []interface{}{"x", "1"},
+		"labels": map[string]interface{}{
+			"team":           "orders",
+			"orderId":        "ord-1",
+			"amount":         "12.5",
+			"customer_tier":  "gold",
+			"customer_flags": `["a","b"]`,
+			"user_plan":      "pro",
+			"client_ip":      "not-an-ip",
+			"host":           "web-1",
+		},
+	}, entry)
+	assert.Len(t, warnings, 3, "%v", warnings)
+
+	// Conflicts are reported once per field
+	m.mapEntry(map[string]interface{}{"host": "web-2"}, "INFO")
+	assert.Len(t, warnings, 3)
+
+	t.Run("Custom namespace keeps types", func(t *testing.T) {
+		m, err := newECSMapper("STRICT", "app", nil)
+		require.NoError(t, err)
+
+		entry := m.mapEntry(map[string]interface{}{
+			"level":    "INFO",
+			"orderId":  42,
+			"customer": map[string]interface{}{"tier": "gold"},
+			"user":     map[string]interface{}{"plan": "pro"},
+			"app":      map[string]interface{}{"build": 3},
+		}, "INFO")
+
+		assert.Equal(t, map[string]interface{}{
+			"orderId":  42,
+			"customer": map[string]interface{}{"tier": "gold"},
+			"user":     map[string]interface{}{"plan": "pro"},
+			"build":    3,
+		}, entry["app"])
+		assert.NotContains(t, entry, "user", "ECS field sets without ECS fields are left out")
+		assert.NotContains(t, entry, "level")
+	})
+
+	t.Run("Configuration", func(t *testing.T) {
+		m, err := newECSMapper("", "app", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, m, "compatible mode needs no mapper")
+
+		for _, c := range []struct{ mode, namespace string }{
+			{"loose", ""},
+			{"strict", "host"},
+			{"strict", "my.fields"},
+			{"strict", "@meta"},
+		} {
+			_, err := newECSMapper(c.mode, c.namespace, nil)
+			assert.Error(t, err, "%+v", c)
+		}
+	})
+}
+
+func TestCoerceECSValue(t *testing.T) {
+	cases := []struct {
+		fieldType string
+		in        interface{}
+		want      interface{}
+		ok        bool
+	}{
+		{ecsKeyword, true, "true", true},
+		{ecsKeyword, map[string]interface{}{}, nil, false},
+		{ecsLong, "17", int64(17), true},
+		{ecsLong, 1.5, nil, false},
+		{ecsLong, "abc", nil, false},
+		{ecsFloat, "0.25", 0.25, true},
+		{ecsBoolean, "false", false, true},
+		{ecsDate, "2025-08-04T10:30:45+02:00", "2025-08-04T08:30:45.000Z", true},
+		{ecsDate, int64(1754303445123), "2025-08-04T10:30:45.123Z", true},
+		{ecsDate, "yesterday", nil, false},
+		{ecsIP, "::1", "::1", true},
+		{ecsIP, []string{"10.0.0.1", "10.0.0.2"}, []interface{}{"10.0.0.1", "10.0.0.2"}, true},
+		{ecsIP, []interface{}{"10.0.0.1", "x"}, nil, false},
+	}
+	for _, c := range cases {
+		got, ok := coerceECSValue(c.fieldType, c.in)
+		assert.Equal(t, c.ok, ok, "%s %v", c.fieldType, c.in)
+		if c.ok {
+			assert.Equal(t, c.want, got, "%s %v", c.fieldType, c.in)
+		}
+	}
+}
+
+func TestActivity_StrictECS(t *testing.T) {
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":        "INFO",
+		"outputFormat":    "JSON",
+		"includeFlowInfo": false,
+		"ecsMode":         "strict",
+	}, nil))
+	require.NoError(t, err)
+
+	tc := test.NewActivityContext(act.Metadata())
+	line := act.(*Activity).formatLogEntry(tc, map[string]interface{}{
+		"message":  "order placed",
+		"password": "secret",
+		"orderId":  42,
+	}, "ERROR", `{"fields": ["password"]}`, nil)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(line), &entry))
+
+	assert.NotContains(t, entry, "level")
+	assert.Equal(t, "ERROR", entry["log"].(map[string]interface{})["level"])
+	assert.Equal(t, "8.11.0", entry["ecs"].(map[string]interface{})["version"])
+	assert.Contains(t, entry, "@timestamp", "strict mode adds the standard fields")
+	assert.Equal(t, "failure", entry["event"].(map[string]interface{})["outcome"])
+
+	labels := entry["labels"].(map[string]interface{})
+	assert.Equal(t, "42", labels["orderId"])
+	assert.Equal(t, "***", labels["password"], "fields are masked before they are moved")
+	assert.Equal(t, "flogo", labels["framework"])
+
+	_, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"ecsMode":      "strict",
+		"ecsNamespace": "event",
+	}, nil))
+	assert.Error(t, err)
+
+	// The activity's own ECS fields are not reported as conflicts
+	act, err = New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":        "INFO",
+		"outputFormat":    "JSON",
+		"includeFlowInfo": true,
+		"ecsMode":         "strict",
+	}, nil))
+	require.NoError(t, err)
+	var warnings []string
+	act.(*Activity).ecs.warn = func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+	act.(*Activity).formatLogEntry(tc, map[string]interface{}{"message": "order placed"}, "INFO", nil, nil)
+	assert.Empty(t, warnings)
+}
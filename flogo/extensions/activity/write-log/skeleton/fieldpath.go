@@ -0,0 +1,351 @@
+package writelog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one concrete step into a log entry: either a map key or an array index
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// segmentKind identifies the type of a compiled field path segment
+type segmentKind int
+
+const (
+	segmentKey      segmentKind = iota // map key, may contain * and ? wildcards
+	segmentIndex                       // [N] - a specific array element
+	segmentAnyIndex                    // [*] - any array element
+	segmentAnyDepth                    // ** - zero or more levels of nesting
+)
+
+// pathSegment is one compiled segment of a field path pattern
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// fieldPath is a compiled field path pattern such as "customer.card.number",
+// "payments[*].cardNumber" or "**.password"
+type fieldPath struct {
+	raw      string
+	segments []pathSegment
+}
+
+// parseFieldPath compiles a dotted field path pattern.
+// Supported syntax:
+//   - "a.b.c"     nested map keys
+//   - "items[0]"  a specific array element, "items[*]" any array element
+//   - "*", "user*" wildcards within a single key (a bare "*" also matches array elements)
+//   - "**"        zero or more levels of nesting
+//   - "a\.b"      a literal dot inside a key
+func parseFieldPath(raw string) (*fieldPath, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("field path cannot be empty")
+	}
+
+	p := &fieldPath{raw: raw}
+	var key strings.Builder
+	pendingKey := false
+
+	flushKey := func() {
+		if !pendingKey {
+			return
+		}
+		k := key.String()
+		if k == "**" {
+			p.segments = append(p.segments, pathSegment{kind: segmentAnyDepth})
+		} else {
+			p.segments = append(p.segments, pathSegment{kind: segmentKey, key: k})
+		}
+		key.Reset()
+		pendingKey = false
+	}
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch c {
+		case '\\':
+			if i+1 < len(raw) {
+				i++
+				key.WriteByte(raw[i])
+				pendingKey = true
+			}
+		case '.':
+			if !pendingKey && (i == 0 || raw[i-1] != ']') {
+				return nil, fmt.Errorf("invalid field path %q: empty segment at position %d", raw, i)
+			}
+			flushKey()
+		case '[':
+			flushKey()
+			end := strings.IndexByte(raw[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: missing ']'", raw)
+			}
+			inner := strings.TrimSpace(raw[i+1 : i+end])
+			if inner == "*" {
+				p.segments = append(p.segments, pathSegment{kind: segmentAnyIndex})
+			} else {
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid field path %q: bad array index %q", raw, inner)
+				}
+				p.segments = append(p.segments, pathSegment{kind: segmentIndex, index: idx})
+			}
+			i += end
+		default:
+			key.WriteByte(c)
+			pendingKey = true
+		}
+	}
+
+	if strings.HasSuffix(raw, ".") && !strings.HasSuffix(raw, "\\.") {
+		return nil, fmt.Errorf("invalid field path %q: trailing '.'", raw)
+	}
+	flushKey()
+
+	return p, nil
+}
+
+// parseFieldPaths compiles a list of field path patterns, skipping invalid ones
+func (a *Activity) parseFieldPaths(raw []string) []*fieldPath {
+	paths := make([]*fieldPath, 0, len(raw))
+	for _, r := range raw {
+		p, err := parseFieldPath(r)
+		if err != nil {
+			a.logger.Warn("Ignoring field path:", err)
+			continue
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// matches reports whether the concrete path is matched by the pattern
+func (p *fieldPath) matches(path []pathStep) bool {
+	return matchSegments(p.segments, path)
+}
+
+// mayMatchBelow reports whether some descendant of the concrete path could be matched by the pattern
+func (p *fieldPath) mayMatchBelow(path []pathStep) bool {
+	return matchSegmentPrefix(p.segments, path)
+}
+
+func matchSegments(segments []pathSegment, path []pathStep) bool {
+	if len(segments) == 0 {
+		return len(path) == 0
+	}
+
+	if segments[0].kind == segmentAnyDepth {
+		// "**" consumes zero steps, or one step and stays in place
+		if matchSegments(segments[1:], path) {
+			return true
+		}
+		return len(path) > 0 && matchSegments(segments, path[1:])
+	}
+
+	if len(path) == 0 || !segments[0].matchStep(path[0]) {
+		return false
+	}
+	return matchSegments(segments[1:], path[1:])
+}
+
+func matchSegmentPrefix(segments []pathSegment, path []pathStep) bool {
+	if len(path) == 0 {
+		return len(segments) > 0
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if segments[0].kind == segmentAnyDepth {
+		return true
+	}
+	if !segments[0].matchStep(path[0]) {
+		return false
+	}
+	return matchSegmentPrefix(segments[1:], path[1:])
+}
+
+// matchStep reports whether a single non-"**" segment matches a concrete step
+func (s pathSegment) matchStep(step pathStep) bool {
+	switch s.kind {
+	case segmentKey:
+		if step.isIndex {
+			return s.key == "*"
+		}
+		return wildcardMatch(step.key, s.key)
+	case segmentIndex:
+		return step.isIndex && step.index == s.index
+	case segmentAnyIndex:
+		return step.isIndex
+	default:
+		return false
+	}
+}
+
+// anyPathMatches reports whether any of the patterns matches the concrete path
+func anyPathMatches(paths []*fieldPath, path []pathStep) bool {
+	for _, p := range paths {
+		if p.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyPathMayMatchBelow reports whether any of the patterns could match below the concrete path
+func anyPathMayMatchBelow(paths []*fieldPath, path []pathStep) bool {
+	for _, p := range paths {
+		if p.mayMatchBelow(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// treeAction tells rewriteTree what to do with a visited node
+type treeAction int
+
+const (
+	treeDescend treeAction = iota // keep the node and walk its children
+	treeReplace                   // substitute the node with the returned value
+	treeRemove                    // drop the node from its parent
+)
+
+// treeVisitor is called for every node below the root of a rewritten tree
+type treeVisitor func(path []pathStep, value interface{}) (interface{}, treeAction)
+
+// rewriteTree walks maps and slices below value and applies visit to every node.
+// Containers are copied only when something below them changes, so the caller's
+// data is never mutated.
+func rewriteTree(value interface{}, path []pathStep, visit treeVisitor) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var out map[string]interface{}
+		for k, child := range v {
+			childPath := append(path, pathStep{key: k})
+			newChild, action := visit(childPath, child)
+			changed := false
+			switch action {
+			case treeReplace:
+				changed = true
+			case treeRemove:
+				if out == nil {
+					out = copyMap(v)
+				}
+				delete(out, k)
+				continue
+			default:
+				newChild, changed = rewriteTree(child, childPath, visit)
+			}
+			if changed {
+				if out == nil {
+					out = copyMap(v)
+				}
+				out[k] = newChild
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+
+	case []interface{}:
+		var out []interface{}
+		removed := false
+		for i, child := range v {
+			childPath := append(path, pathStep{index: i, isIndex: true})
+			newChild, action := visit(childPath, child)
+			changed := false
+			switch action {
+			case treeReplace:
+				changed = true
+			case treeRemove:
+				if out == nil {
+					out = make([]interface{}, 0, len(v))
+					out = append(out, v[:i]...)
+				}
+				removed = true
+				continue
+			default:
+				newChild, changed = rewriteTree(child, childPath, visit)
+			}
+			if out == nil && changed {
+				out = make([]interface{}, 0, len(v))
+				out = append(out, v[:i]...)
+			}
+			if out != nil {
+				out = append(out, newChild)
+			}
+		}
+		if out == nil && !removed {
+			return v, false
+		}
+		return out, true
+
+	case []map[string]interface{}:
+		generic := make([]interface{}, len(v))
+		for i, m := range v {
+			generic[i] = m
+		}
+		if newValue, changed := rewriteTree(generic, path, visit); changed {
+			return newValue, true
+		}
+		return v, false
+
+	default:
+		return value, false
+	}
+}
+
+// selectPaths returns a copy of value containing only the nodes matched by the patterns.
+// The boolean result reports whether anything was selected.
+func selectPaths(value interface{}, path []pathStep, paths []*fieldPath) (interface{}, bool) {
+	if len(path) > 0 && anyPathMatches(paths, path) {
+		return value, true
+	}
+	if !anyPathMayMatchBelow(paths, path) {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, child := range v {
+			if selected, ok := selectPaths(child, append(path, pathStep{key: k}), paths); ok {
+				out[k] = selected
+			}
+		}
+		return out, len(out) > 0
+	case []interface{}:
+		var out []interface{}
+		for i, child := range v {
+			if selected, ok := selectPaths(child, append(path, pathStep{index: i, isIndex: true}), paths); ok {
+				out = append(out, selected)
+			}
+		}
+		return out, len(out) > 0
+	case []map[string]interface{}:
+		generic := make([]interface{}, len(v))
+		for i, m := range v {
+			generic[i] = m
+		}
+		return selectPaths(generic, path, paths)
+	default:
+		return nil, false
+	}
+}
+
+// copyMap returns a shallow copy of a map
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,215 @@
+package writelog
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPathTestActivity(t *testing.T) *Activity {
+	settings := map[string]interface{}{
+		"logLevel":        "INFO",
+		"includeFlowInfo": false,
+		"outputFormat":    "JSON",
+		"addFlowDetails":  false,
+	}
+
+	ctx := test.NewActivityInitContext(settings, nil)
+	act, err := New(ctx)
+	assert.NoError(t, err)
+
+	return act.(*Activity)
+}
+
+func nestedOrder() map[string]interface{} {
+	return map[string]interface{}{
+		"message":  "Order placed",
+		"password": "top-secret",
+		"customer": map[string]interface{}{
+			"name":     "Jane",
+			"password": "hunter2",
+			"card": map[string]interface{}{
+				"number": "4111111111111111",
+				"expiry": "12/29",
+			},
+		},
+		"payments": []interface{}{
+			map[string]interface{}{"cardNumber": "4111111111111111", "amount": 10.5},
+			map[string]interface{}{"cardNumber": "5500000000000004", "amount": 20.0},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "A-1", "ssn": "123-45-6789"},
+		},
+	}
+}
+
+func TestFieldPath_Parse(t *testing.T) {
+	tests := []struct {
+		path    string
+		valid   bool
+		nSegs   int
+		lastKey segmentKind
+	}{
+		{"password", true, 1, segmentKey},
+		{"customer.card.number", true, 3, segmentKey},
+		{"payments[*].cardNumber", true, 3, segmentKey},
+		{"items[0]", true, 2, segmentIndex},
+		{"items[*]", true, 2, segmentAnyIndex},
+		{"**.password", true, 2, segmentKey},
+		{"customer.**", true, 2, segmentAnyDepth},
+		{"a\\.b", true, 1, segmentKey},
+		{"", false, 0, 0},
+		{"a..b", false, 0, 0},
+		{".a", false, 0, 0},
+		{"a.", false, 0, 0},
+		{"items[x]", false, 0, 0},
+		{"items[0", false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseFieldPath(tt.path)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, p.segments, tt.nSegs)
+			assert.Equal(t, tt.lastKey, p.segments[len(p.segments)-1].kind)
+		})
+	}
+
+	p, err := parseFieldPath("a\\.b")
+	assert.NoError(t, err)
+	assert.Equal(t, "a.b", p.segments[0].key)
+}
+
+func TestFieldPath_Matches(t *testing.T) {
+	key := func(k string) pathStep { return pathStep{key: k} }
+	idx := func(i int) pathStep { return pathStep{index: i, isIndex: true} }
+
+	tests := []struct {
+		pattern string
+		path    []pathStep
+		match   bool
+	}{
+		{"password", []pathStep{key("password")}, true},
+		{"password", []pathStep{key("customer"), key("password")}, false},
+		{"**.password", []pathStep{key("password")}, true},
+		{"**.password", []pathStep{key("customer"), key("password")}, true},
+		{"**.password", []pathStep{key("a"), idx(3), key("b"), key("password")}, true},
+		{"customer.card.number", []pathStep{key("customer"), key("card"), key("number")}, true},
+		{"customer.card.number", []pathStep{key("customer"), key("card")}, false},
+		{"payments[*].cardNumber", []pathStep{key("payments"), idx(1), key("cardNumber")}, true},
+		{"payments[0].cardNumber", []pathStep{key("payments"), idx(1), key("cardNumber")}, false},
+		{"payments.*.cardNumber", []pathStep{key("payments"), idx(0), key("cardNumber")}, true},
+		{"customer.*", []pathStep{key("customer"), key("name")}, true},
+		{"*card*", []pathStep{key("credit_card")}, true},
+		{"customer.**", []pathStep{key("customer"), key("card"), key("number")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := parseFieldPath(tt.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.match, p.matches(tt.path))
+		})
+	}
+}
+
+func TestActivity_NestedSensitiveFieldMasking(t *testing.T) {
+	activity := newPathTestActivity(t)
+
+	t.Run("Dotted and array paths", func(t *testing.T) {
+		data := nestedOrder()
+		result := activity.applySensitiveFieldMasking(data, map[string]interface{}{
+			"fieldNamesToHide": []string{"customer.card.number", "payments[*].cardNumber", "items[*].ssn"},
+		})
+
+		customer := result["customer"].(map[string]interface{})
+		assert.Equal(t, "***", customer["card"].(map[string]interface{})["number"])
+		assert.Equal(t, "12/29", customer["card"].(map[string]interface{})["expiry"])
+
+		payments := result["payments"].([]interface{})
+		assert.Equal(t, "***", payments[0].(map[string]interface{})["cardNumber"])
+		assert.Equal(t, "***", payments[1].(map[string]interface{})["cardNumber"])
+		assert.Equal(t, 20.0, payments[1].(map[string]interface{})["amount"])
+
+		items := result["items"].([]interface{})
+		assert.Equal(t, "***", items[0].(map[string]interface{})["ssn"])
+		assert.Equal(t, "A-1", items[0].(map[string]interface{})["sku"])
+	})
+
+	t.Run("Recursive wildcard", func(t *testing.T) {
+		result := activity.applySensitiveFieldMasking(nestedOrder(), []string{"**.password"})
+
+		assert.Equal(t, "***", result["password"])
+		assert.Equal(t, "***", result["customer"].(map[string]interface{})["password"])
+		assert.Equal(t, "Jane", result["customer"].(map[string]interface{})["name"])
+	})
+
+	t.Run("Plain names stay top-level only", func(t *testing.T) {
+		result := activity.applySensitiveFieldMasking(nestedOrder(), []string{"password"})
+
+		assert.Equal(t, "***", result["password"])
+		assert.Equal(t, "hunter2", result["customer"].(map[string]interface{})["password"])
+	})
+
+	t.Run("Caller data is not mutated", func(t *testing.T) {
+		original := nestedOrder()
+		_ = activity.applySensitiveFieldMasking(original, []string{"**.password", "payments[*].cardNumber", "customer.card.number"})
+
+		assert.Equal(t, nestedOrder(), original)
+	})
+
+	t.Run("Nested masking through Eval leaves input intact", func(t *testing.T) {
+		logObject := nestedOrder()
+
+		tc := test.NewActivityContext(activity.Metadata())
+		tc.SetInput("logObject", logObject)
+		tc.SetInput("sensitiveFields", map[string]interface{}{
+			"fieldNamesToHide": []string{"customer.card.number"},
+		})
+
+		done, err := activity.Eval(tc)
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, nestedOrder(), logObject)
+	})
+}
+
+func TestActivity_NestedFieldFiltering(t *testing.T) {
+	activity := newPathTestActivity(t)
+
+	t.Run("Include nested paths", func(t *testing.T) {
+		entry := activity.applyFieldFiltersFromInput(nestedOrder(), map[string]interface{}{
+			"include": []string{"message", "customer.name", "payments[*].amount"},
+		})
+
+		assert.Equal(t, "Order placed", entry["message"])
+		assert.Equal(t, map[string]interface{}{"name": "Jane"}, entry["customer"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"amount": 10.5},
+			map[string]interface{}{"amount": 20.0},
+		}, entry["payments"])
+		assert.NotContains(t, entry, "items")
+		assert.NotContains(t, entry, "password")
+	})
+
+	t.Run("Exclude nested paths", func(t *testing.T) {
+		original := nestedOrder()
+		entry := activity.applyFieldFiltersFromInput(original, map[string]interface{}{
+			"exclude": []string{"customer.card", "**.ssn", "payments[0]"},
+		})
+
+		assert.NotContains(t, entry["customer"], "card")
+		assert.Contains(t, entry["customer"], "name")
+		assert.NotContains(t, entry["items"].([]interface{})[0], "ssn")
+		assert.Len(t, entry["payments"], 1)
+		assert.Equal(t, "5500000000000004", entry["payments"].([]interface{})[0].(map[string]interface{})["cardNumber"])
+
+		// Nested data shared with the caller is left untouched
+		assert.Equal(t, nestedOrder()["customer"], original["customer"])
+	})
+}
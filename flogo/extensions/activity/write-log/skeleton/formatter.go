@@ -0,0 +1,242 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+)
+
+// Formatter renders a log record as a single line for the sinks
+type Formatter interface {
+	Format(rec *Record) (string, error)
+}
+
+// FormatterFunc adapts a function to the Formatter interface
+type FormatterFunc func(rec *Record) (string, error)
+
+// Format calls f(rec)
+func (f FormatterFunc) Format(rec *Record) (string, error) {
+	return f(rec)
+}
+
+// FormatterFactory creates a formatter from the formatOptions setting
+type FormatterFactory func(options map[string]interface{}) (Formatter, error)
+
+// Output formats
+const (
+	FormatJSON          = "JSON"
+	FormatKeyValue      = "KEY_VALUE"
+	FormatLogfmt        = "LOGFMT"
+	FormatGELF          = "GELF"
+	FormatCEF           = "CEF"
+	FormatSplunkHEC     = "SPLUNK_HEC"
+	FormatCloudWatchEMF = "CLOUDWATCH_EMF"
+)
+
+// lineFormats are the original text formats, which carry flow details as a readable
+// suffix. All other formats carry them as fields so their output stays parseable.
+var lineFormats = map[string]bool{FormatJSON: true, FormatKeyValue: true, FormatLogfmt: true}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]FormatterFactory{
+		FormatGELF:          newGELFFormatter,
+		FormatCEF:           newCEFFormatter,
+		FormatSplunkHEC:     newSplunkHECFormatter,
+		FormatCloudWatchEMF: newEMFFormatter,
+	}
+)
+
+// RegisterFormatter registers a custom output format that can be selected with the outputFormat setting
+func RegisterFormatter(format string, factory FormatterFactory) error {
+	format = strings.ToUpper(strings.TrimSpace(format))
+	if format == "" || factory == nil {
+		return fmt.Errorf("format name and factory are required")
+	}
+
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	if _, exists := formatters[format]; exists || lineFormats[format] {
+		return fmt.Errorf("format '%s' is already registered", format)
+	}
+	formatters[format] = factory
+
+	return nil
+}
+
+// buildFormatter creates the formatter for the outputFormat setting. Unknown formats fall
+// back to JSON, as they always have.
+func (a *Activity) buildFormatter(format string, optionsSetting interface{}) (Formatter, string, error) {
+	format = strings.ToUpper(strings.TrimSpace(format))
+
+	switch format {
+	case FormatJSON:
+		return FormatterFunc(func(rec *Record) (string, error) { return a.formatAsJSON(rec.Entry), nil }), format, nil
+	case FormatKeyValue:
+		return FormatterFunc(func(rec *Record) (string, error) { return a.formatAsKeyValue(rec.Entry), nil }), format, nil
+	case FormatLogfmt:
+		return FormatterFunc(func(rec *Record) (string, error) { return a.formatAsLogfmt(rec.Entry), nil }), format, nil
+	}
+
+	formattersMu.RLock()
+	factory, ok := formatters[format]
+	formattersMu.RUnlock()
+	if !ok {
+		a.logger.Warnf("Unknown output format '%s', using JSON", format)
+		return a.buildFormatter(FormatJSON, nil)
+	}
+
+	options := make(map[string]interface{})
+	if optionsSetting != nil {
+		if err := decodeJSONConfig(optionsSetting, &options); err != nil {
+			return nil, "", fmt.Errorf("invalid formatOptions setting: %w", err)
+		}
+	}
+
+	formatter, err := factory(options)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid formatOptions for %s: %w", format, err)
+	}
+	return formatter, format, nil
+}
+
+// addFlowFields adds the flow details to the entry under flogo.*
+func addFlowFields(ctx activity.Context, entry map[string]interface{}) {
+	flogo := make(map[string]interface{})
+	if host := ctx.ActivityHost(); host != nil {
+		if id := host.ID(); id != "" {
+			flogo["instance_id"] = id
+		}
+		if name := host.Name(); name != "" {
+			flogo["flow"] = name
+		}
+	}
+	if name := ctx.Name(); name != "" {
+		flogo["activity"] = name
+	}
+	if len(flogo) > 0 {
+		if _, exists := entry["flogo"]; !exists {
+			entry["flogo"] = flogo
+		}
+	}
+}
+
+// decodeFormatOptions decodes the formatOptions map into a formatter's option struct
+func decodeFormatOptions(options map[string]interface{}, target interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	return decodeJSONConfig(options, target)
+}
+
+// flattenEntry flattens nested maps into dot-notation keys; arrays become JSON strings
+func flattenEntry(data map[string]interface{}, prefix string) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	for key, value := range data {
+		var newKey string
+		if prefix == "" {
+			newKey = key
+		} else {
+			newKey = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			// Recursively flatten nested maps
+			nested := flattenEntry(v, newKey)
+			for nestedKey, nestedValue := range nested {
+				result[nestedKey] = nestedValue
+			}
+		case []interface{}:
+			// Handle arrays - convert to JSON string for readability
+			if jsonBytes, err := json.Marshal(v); err == nil {
+				result[newKey] = string(jsonBytes)
+			} else {
+				result[newKey] = fmt.Sprintf("%v", v)
+			}
+		default:
+			result[newKey] = value
+		}
+	}
+
+	return result
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookupField resolves a dotted path such as service.name in a nested entry. A top-level
+// key containing dots takes precedence over the nested path.
+func lookupField(entry map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := entry[path]; ok {
+		return v, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := entry[path[:i]].(map[string]interface{}); ok {
+			if v, ok := lookupField(nested, path[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// entryMessage returns the entry's message as a string, if it has one
+func entryMessage(entry map[string]interface{}) (string, bool) {
+	msg, ok := entry["message"]
+	if !ok || msg == nil {
+		return "", false
+	}
+	if s, ok := msg.(string); ok {
+		return s, s != ""
+	}
+	return fmt.Sprintf("%v", msg), true
+}
+
+// epochSeconds returns t as fractional seconds with millisecond precision
+func epochSeconds(t time.Time) float64 {
+	return math.Round(float64(t.UnixNano())/float64(time.Millisecond)) / 1000
+}
+
+// toNumber returns v as a float64 if it is a JSON-compatible number
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
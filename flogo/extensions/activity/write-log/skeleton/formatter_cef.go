@@ -0,0 +1,205 @@
+package writelog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cefOptions configures the CEF formatter
+type cefOptions struct {
+	DeviceVendor     string `json:"deviceVendor"`     // Default: TIBCO
+	DeviceProduct    string `json:"deviceProduct"`    // Default: Flogo
+	DeviceVersion    string `json:"deviceVersion"`    // Default: 1.0.0
+	SignatureID      string `json:"signatureId"`      // Default: the level
+	SignatureIDField string `json:"signatureIdField"` // Field holding the signature ID, e.g. event.code
+	NameField        string `json:"nameField"`        // Field holding the event name (default: message)
+}
+
+// cefFormatter writes ArcSight Common Event Format (CEF:0) events
+type cefFormatter struct {
+	header string // CEF:0|vendor|product|version|, pre-escaped
+	opts   cefOptions
+}
+
+// cefMappings maps entry fields to CEF extension keys. Entries with a label use the
+// custom string keys (cs1-cs6), whose meaning is given by the matching csNLabel.
+var cefMappings = []struct {
+	field string
+	key   string
+	label string
+}{
+	{field: "message", key: "msg"},
+	{field: "host.name", key: "dvchost"},
+	{field: "process.pid", key: "dvcpid"},
+	{field: "process.name", key: "dproc"},
+	{field: "event.outcome", key: "outcome"},
+	{field: "trace.id", key: "cs1", label: "traceId"},
+	{field: "span.id", key: "cs2", label: "spanId"},
+	{field: "correlation.id", key: "cs3", label: "correlationId"},
+	{field: "service.name", key: "cs4", label: "serviceName"},
+}
+
+const cefMaxNameLength = 512
+
+func newCEFFormatter(options map[string]interface{}) (Formatter, error) {
+	opts := cefOptions{}
+	if err := decodeFormatOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.DeviceVendor == "" {
+		opts.DeviceVendor = "TIBCO"
+	}
+	if opts.DeviceProduct == "" {
+		opts.DeviceProduct = "Flogo"
+	}
+	if opts.DeviceVersion == "" {
+		opts.DeviceVersion = "1.0.0"
+	}
+	if opts.NameField == "" {
+		opts.NameField = "message"
+	}
+
+	header := "CEF:0|" + cefHeaderEscape(opts.DeviceVendor) + "|" + cefHeaderEscape(opts.DeviceProduct) + "|" + cefHeaderEscape(opts.DeviceVersion) + "|"
+
+	return &cefFormatter{header: header, opts: opts}, nil
+}
+
+func (f *cefFormatter) Format(rec *Record) (string, error) {
+	entry := rec.Entry
+
+	signatureID := f.opts.SignatureID
+	if f.opts.SignatureIDField != "" {
+		if v, ok := lookupField(entry, f.opts.SignatureIDField); ok && v != nil {
+			signatureID = fmt.Sprintf("%v", v)
+		}
+	}
+	if signatureID == "" {
+		signatureID = strings.ToUpper(rec.Level)
+	}
+
+	name := "Log entry"
+	if v, ok := lookupField(entry, f.opts.NameField); ok && v != nil {
+		if s := fmt.Sprintf("%v", v); s != "" {
+			name = s
+		}
+	}
+	if runes := []rune(name); len(runes) > cefMaxNameLength {
+		name = string(runes[:cefMaxNameLength])
+	}
+
+	var b strings.Builder
+	b.WriteString(f.header)
+	b.WriteString(cefHeaderEscape(signatureID))
+	b.WriteByte('|')
+	b.WriteString(cefHeaderEscape(name))
+	b.WriteByte('|')
+	b.WriteString(strconv.Itoa(cefSeverity(rec.Level)))
+	b.WriteByte('|')
+
+	ext := []string{"rt=" + strconv.FormatInt(rec.Time.UnixMilli(), 10)}
+
+	flat := flattenEntry(entry, "")
+	delete(flat, "level")
+	delete(flat, "@timestamp")
+
+	for _, m := range cefMappings {
+		v, ok := flat[m.field]
+		if !ok {
+			continue
+		}
+		delete(flat, m.field)
+		if v == nil {
+			continue
+		}
+		ext = append(ext, m.key+"="+cefExtensionEscape(fmt.Sprintf("%v", v)))
+		if m.label != "" {
+			ext = append(ext, m.key+"Label="+m.label)
+		}
+	}
+
+	// Remaining fields are added as custom extension keys
+	for _, key := range sortedKeys(flat) {
+		v := flat[key]
+		if v == nil {
+			continue
+		}
+		ext = append(ext, cefKey(key)+"="+cefExtensionEscape(fmt.Sprintf("%v", v)))
+	}
+
+	b.WriteString(strings.Join(ext, " "))
+	return b.String(), nil
+}
+
+// cefSeverity maps a log level to the CEF severity scale (0-10)
+func cefSeverity(level string) int {
+	switch strings.ToUpper(level) {
+	case "TRACE":
+		return 0
+	case "DEBUG":
+		return 1
+	case "INFO":
+		return 3
+	case "WARN", "WARNING":
+		return 6
+	case "ERROR":
+		return 8
+	case "FATAL":
+		return 10
+	default:
+		return 3
+	}
+}
+
+// cefHeaderEscape escapes pipes and backslashes in header fields. Header fields cannot
+// contain line breaks, so they are replaced with spaces.
+func cefHeaderEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '|':
+			b.WriteString(`\|`)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// cefExtensionEscape escapes equals signs, backslashes and line breaks in extension values
+func cefExtensionEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '=':
+			b.WriteString(`\=`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// cefKey makes an extension key from a field path. Keys may only contain letters, digits,
+// dots and underscores.
+func cefKey(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// emfUnits are the units accepted by CloudWatch metrics
+var emfUnits = map[string]bool{
+	"Seconds": true, "Microseconds": true, "Milliseconds": true,
+	"Bytes": true, "Kilobytes": true, "Megabytes": true, "Gigabytes": true, "Terabytes": true,
+	"Bits": true, "Kilobits": true, "Megabits": true, "Gigabits": true, "Terabits": true,
+	"Percent": true, "Count": true,
+	"Bytes/Second": true, "Kilobytes/Second": true, "Megabytes/Second": true, "Gigabytes/Second": true, "Terabytes/Second": true,
+	"Bits/Second": true, "Kilobits/Second": true, "Megabits/Second": true, "Gigabits/Second": true, "Terabits/Second": true,
+	"Count/Second": true, "None": true,
+}
+
+const (
+	emfMaxDimensions = 30
+	emfMaxMetrics    = 100
+)
+
+// emfMetric declares one metric taken from a numeric entry field
+type emfMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"`  // CloudWatch unit (default: None)
+	Field string `json:"field"` // Entry field holding the value (default: name)
+}
+
+// emfOptions configures the CloudWatch Embedded Metric Format formatter
+type emfOptions struct {
+	Namespace  string      `json:"namespace"`  // Default: Flogo
+	Dimensions [][]string  `json:"dimensions"` // Dimension sets of entry fields (default: [["level"]])
+	Metrics    []emfMetric `json:"metrics"`
+}
+
+// emfFormatter writes CloudWatch Embedded Metric Format log events
+// (https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html)
+type emfFormatter struct {
+	opts emfOptions
+}
+
+func newEMFFormatter(options map[string]interface{}) (Formatter, error) {
+	opts := emfOptions{}
+	if err := decodeFormatOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = "Flogo"
+	}
+	if opts.Dimensions == nil {
+		opts.Dimensions = [][]string{{"level"}}
+	}
+	for _, set := range opts.Dimensions {
+		if len(set) > emfMaxDimensions {
+			return nil, fmt.Errorf("a dimension set may have at most %d dimensions", emfMaxDimensions)
+		}
+	}
+
+	if len(opts.Metrics) > emfMaxMetrics {
+		return nil, fmt.Errorf("at most %d metrics are allowed", emfMaxMetrics)
+	}
+	for i := range opts.Metrics {
+		m := &opts.Metrics[i]
+		if m.Name == "" {
+			return nil, fmt.Errorf("metric %d has no name", i)
+		}
+		if m.Field == "" {
+			m.Field = m.Name
+		}
+		if m.Unit == "" {
+			m.Unit = "None"
+		}
+		if !emfUnits[m.Unit] {
+			return nil, fmt.Errorf("invalid unit '%s' for metric %s", m.Unit, m.Name)
+		}
+	}
+
+	return &emfFormatter{opts: opts}, nil
+}
+
+// Format writes the entry with an _aws metadata object. Metric and dimension values are
+// copied to top-level members, as EMF requires. Metrics whose field is missing or not
+// numeric, and dimension sets with a missing field, are left out; if no metric remains,
+// the entry is written as plain JSON.
+func (f *emfFormatter) Format(rec *Record) (string, error) {
+	root := copyMap(rec.Entry)
+
+	var metrics []map[string]interface{}
+	for _, m := range f.opts.Metrics {
+		v, ok := lookupField(rec.Entry, m.Field)
+		if !ok || !emfNumeric(v) {
+			continue
+		}
+		root[m.Name] = v
+		metrics = append(metrics, map[string]interface{}{"Name": m.Name, "Unit": m.Unit})
+	}
+
+	if len(metrics) > 0 {
+		dimensions := make([][]string, 0, len(f.opts.Dimensions))
+		for _, set := range f.opts.Dimensions {
+			complete := true
+			for _, dim := range set {
+				v, ok := lookupField(rec.Entry, dim)
+				if !ok || v == nil {
+					complete = false
+					break
+				}
+				root[dim] = emfDimensionValue(v)
+			}
+			if complete {
+				dimensions = append(dimensions, set)
+			}
+		}
+
+		root["_aws"] = map[string]interface{}{
+			"Timestamp": rec.Time.UnixMilli(),
+			"CloudWatchMetrics": []interface{}{
+				map[string]interface{}{
+					"Namespace":  f.opts.Namespace,
+					"Dimensions": dimensions,
+					"Metrics":    metrics,
+				},
+			},
+		}
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// emfNumeric reports whether v is a number or an array of numbers
+func emfNumeric(v interface{}) bool {
+	if arr, ok := v.([]interface{}); ok {
+		if len(arr) == 0 {
+			return false
+		}
+		for _, item := range arr {
+			if _, ok := toNumber(item); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := toNumber(v)
+	return ok
+}
+
+// emfDimensionValue converts a dimension value to a string, as CloudWatch requires
+func emfDimensionValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		data, _ := json.Marshal(m)
+		return string(data)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", v))
+}
@@ -0,0 +1,101 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// gelfOptions configures the GELF formatter
+type gelfOptions struct {
+	Host string `json:"host"` // GELF host field (default: local hostname)
+}
+
+// gelfFormatter writes GELF 1.1 messages for Graylog
+// (https://go2docs.graylog.org/current/getting_in_log_data/gelf.html)
+type gelfFormatter struct {
+	host string
+}
+
+func newGELFFormatter(options map[string]interface{}) (Formatter, error) {
+	opts := gelfOptions{}
+	if err := decodeFormatOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	host := opts.Host
+	if host == "" {
+		host = hostnameOrDefault()
+	}
+	if host == "" {
+		host = "flogo"
+	}
+
+	return &gelfFormatter{host: host}, nil
+}
+
+func (f *gelfFormatter) Format(rec *Record) (string, error) {
+	msg, ok := entryMessage(rec.Entry)
+	if !ok {
+		data, err := json.Marshal(rec.Entry)
+		if err != nil {
+			return "", err
+		}
+		msg = string(data)
+	}
+
+	gelf := map[string]interface{}{
+		"version":   "1.1",
+		"host":      f.host,
+		"timestamp": epochSeconds(rec.Time),
+		"level":     syslogSeverity(rec.Level),
+	}
+
+	// short_message is a single line; the complete text goes to full_message
+	if i := strings.IndexAny(msg, "\r\n"); i >= 0 {
+		gelf["short_message"] = msg[:i]
+		gelf["full_message"] = msg
+	} else {
+		gelf["short_message"] = msg
+	}
+
+	for key, value := range flattenEntry(rec.Entry, "") {
+		switch key {
+		case "message", "level", "@timestamp":
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		if _, ok := toNumber(value); !ok {
+			value = fmt.Sprintf("%v", value)
+		}
+		gelf[gelfFieldName(key)] = value
+	}
+
+	data, err := json.Marshal(gelf)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// gelfFieldName prefixes an additional field with an underscore and replaces characters
+// outside [A-Za-z0-9_.-]. The reserved _id field is renamed.
+func gelfFieldName(key string) string {
+	var b strings.Builder
+	b.WriteByte('_')
+	for _, r := range key {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+
+	name := b.String()
+	if name == "_id" {
+		return "__id"
+	}
+	return name
+}
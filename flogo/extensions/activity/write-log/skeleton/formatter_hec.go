@@ -0,0 +1,105 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// hecOptions configures the Splunk HEC formatter
+type hecOptions struct {
+	Host       string   `json:"host"`       // Default: local hostname
+	Source     string   `json:"source"`     // Optional
+	SourceType string   `json:"sourcetype"` // Default: _json
+	Index      string   `json:"index"`      // Optional
+	Fields     []string `json:"fields"`     // Entry fields to send as indexed fields, e.g. service.name
+}
+
+// hecEventBuilder builds Splunk HTTP Event Collector events. It is shared by the
+// SPLUNK_HEC formatter and the splunk sink.
+type hecEventBuilder struct {
+	host       string
+	source     string
+	sourceType string
+	index      string
+	fields     []string
+}
+
+func newHECEventBuilder(opts hecOptions) *hecEventBuilder {
+	b := &hecEventBuilder{
+		host:       opts.Host,
+		source:     opts.Source,
+		sourceType: opts.SourceType,
+		index:      opts.Index,
+		fields:     opts.Fields,
+	}
+	if b.host == "" {
+		b.host = hostnameOrDefault()
+	}
+	if b.sourceType == "" {
+		b.sourceType = "_json"
+	}
+	return b
+}
+
+// event returns the HEC event envelope for a record
+func (b *hecEventBuilder) event(rec *Record) map[string]interface{} {
+	event := map[string]interface{}{
+		"time":       epochSeconds(rec.Time),
+		"event":      rec.Entry,
+		"sourcetype": b.sourceType,
+	}
+	if b.host != "" {
+		event["host"] = b.host
+	}
+	if b.source != "" {
+		event["source"] = b.source
+	}
+	if b.index != "" {
+		event["index"] = b.index
+	}
+
+	// Indexed fields must be strings or arrays of strings
+	if len(b.fields) > 0 {
+		fields := make(map[string]interface{})
+		for _, path := range b.fields {
+			v, ok := lookupField(rec.Entry, path)
+			if !ok || v == nil {
+				continue
+			}
+			switch val := v.(type) {
+			case []interface{}:
+				values := make([]string, 0, len(val))
+				for _, item := range val {
+					values = append(values, fmt.Sprintf("%v", item))
+				}
+				fields[path] = values
+			case map[string]interface{}:
+				data, _ := json.Marshal(val)
+				fields[path] = string(data)
+			default:
+				fields[path] = fmt.Sprintf("%v", val)
+			}
+		}
+		if len(fields) > 0 {
+			event["fields"] = fields
+		}
+	}
+
+	return event
+}
+
+func newSplunkHECFormatter(options map[string]interface{}) (Formatter, error) {
+	opts := hecOptions{}
+	if err := decodeFormatOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	builder := newHECEventBuilder(opts)
+	return FormatterFunc(func(rec *Record) (string, error) {
+		data, err := json.Marshal(builder.event(rec))
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}), nil
+}
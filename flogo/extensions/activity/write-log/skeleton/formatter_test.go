@@ -0,0 +1,236 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formatterRecord(level string, entry map[string]interface{}) *Record {
+	return &Record{Time: time.Date(2025, 8, 4, 10, 30, 45, 123456789, time.UTC), Level: level, Entry: entry}
+}
+
+func TestGELFFormatter(t *testing.T) {
+	f, err := newGELFFormatter(map[string]interface{}{"host": "orders-1"})
+	require.NoError(t, err)
+
+	line, err := f.Format(formatterRecord("ERROR", map[string]interface{}{
+		"level":      "ERROR",
+		"message":    "payment failed\nstack: at charge()",
+		"@timestamp": "2025-08-04T10:30:45Z",
+		"id":         "ord-1",
+		"amount":     12.5,
+		"retry":      true,
+		"user name":  "jane",
+		"trace":      map[string]interface{}{"id": "abc"},
+		"items":      []interface{}{"a", "b"},
+		"empty":      nil,
+	}))
+	require.NoError(t, err)
+
+	var gelf map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(line), &gelf))
+	assert.Equal(t, map[string]interface{}{
+		"version":       "1.1",
+		"host":          "orders-1",
+		"timestamp":     1754303445.123,
+		"level":         float64(3),
+		"short_message": "payment failed",
+		"full_message":  "payment failed\nstack: at charge()",
+		"__id":          "ord-1",
+		"_amount":       12.5,
+		"_retry":        "true",
+		"_user_name":    "jane",
+		"_trace.id":     "abc",
+		"_items":        `["a","b"]`,
+	}, gelf)
+
+	line, err = f.Format(formatterRecord("INFO", map[string]interface{}{"level": "INFO", "orderId": 7}))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(line), &gelf))
+	assert.Equal(t, `{"level":"INFO","orderId":7}`, gelf["short_message"], "entries without a message use their JSON")
+	assert.Equal(t, float64(6), gelf["level"])
+}
+
+func TestCEFFormatter(t *testing.T) {
+	f, err := newCEFFormatter(map[string]interface{}{
+		"deviceVendor":     "Acme|Corp",
+		"deviceProduct":    "Orders",
+		"deviceVersion":    "2.1",
+		"signatureIdField": "event.code",
+	})
+	require.NoError(t, err)
+
+	line, err := f.Format(formatterRecord("WARN", map[string]interface{}{
+		"level":       "WARN",
+		"message":     "login a=b | c\\d\nnext",
+		"host":        map[string]interface{}{"name": "web-1"},
+		"process":     map[string]interface{}{"pid": 42},
+		"trace":       map[string]interface{}{"id": "4bf9"},
+		"correlation": map[string]interface{}{"id": "c-1"},
+		"event":       map[string]interface{}{"code": "AUTH|001"},
+		"user-id":     "u=1",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, `CEF:0|Acme\|Corp|Orders|2.1|AUTH\|001|login a=b \| c\\d next|6|`+
+		`rt=1754303445123 msg=login a\=b | c\\d\nnext dvchost=web-1 dvcpid=42 cs1=4bf9 cs1Label=traceId cs3=c-1 cs3Label=correlationId `+
+		`event.code=AUTH|001 user_id=u\=1`, line)
+
+	defaults, err := newCEFFormatter(nil)
+	require.NoError(t, err)
+	line, err = defaults.Format(formatterRecord("FATAL", map[string]interface{}{"level": "FATAL"}))
+	require.NoError(t, err)
+	assert.Equal(t, "CEF:0|TIBCO|Flogo|1.0.0|FATAL|Log entry|10|rt=1754303445123", line)
+}
+
+func TestSplunkHECFormatter(t *testing.T) {
+	f, err := newSplunkHECFormatter(map[string]interface{}{
+		"host":   "web-1",
+		"index":  "app",
+		"source": "flogo:orders",
+		"fields": []interface{}{"service.name", "tags", "missing"},
+	})
+	require.NoError(t, err)
+
+	entry := map[string]interface{}{
+		"level":   "INFO",
+		"message": "ok",
+		"service": map[string]interface{}{"name": "orders"},
+		"tags":    []interface{}{"a", 1},
+	}
+	line, err := f.Format(formatterRecord("INFO", entry))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"time": 1754303445.123,
+		"host": "web-1",
+		"index": "app",
+		"source": "flogo:orders",
+		"sourcetype": "_json",
+		"event": {"level": "INFO", "message": "ok", "service": {"name": "orders"}, "tags": ["a", 1]},
+		"fields": {"service.name": "orders", "tags": ["a", "1"]}
+	}`, line)
+}
+
+func TestCloudWatchEMFFormatter(t *testing.T) {
+	f, err := newEMFFormatter(map[string]interface{}{
+		"namespace":  "Orders",
+		"dimensions": []interface{}{[]interface{}{"service.name", "level"}, []interface{}{"region"}},
+		"metrics": []interface{}{
+			map[string]interface{}{"name": "Latency", "unit": "Milliseconds", "field": "timing.ms"},
+			map[string]interface{}{"name": "items", "unit": "Count"},
+			map[string]interface{}{"name": "missing"},
+		},
+	})
+	require.NoError(t, err)
+
+	line, err := f.Format(formatterRecord("INFO", map[string]interface{}{
+		"level":   "INFO",
+		"message": "order placed",
+		"service": map[string]interface{}{"name": "orders"},
+		"timing":  map[string]interface{}{"ms": 42},
+		"items":   3,
+	}))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"_aws": {
+			"Timestamp": 1754303445123,
+			"CloudWatchMetrics": [{
+				"Namespace": "Orders",
+				"Dimensions": [["service.name", "level"]],
+				"Metrics": [{"Name": "Latency", "Unit": "Milliseconds"}, {"Name": "items", "Unit": "Count"}]
+			}]
+		},
+		"level": "INFO",
+		"message": "order placed",
+		"service": {"name": "orders"},
+		"service.name": "orders",
+		"timing": {"ms": 42},
+		"Latency": 42,
+		"items": 3
+	}`, line)
+
+	line, err = f.Format(formatterRecord("INFO", map[string]interface{}{"level": "INFO", "items": "three"}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"level": "INFO", "items": "three"}`, line, "no _aws directive without numeric metrics")
+
+	for _, invalid := range []map[string]interface{}{
+		{"metrics": []interface{}{map[string]interface{}{"name": "x", "unit": "Parsecs"}}},
+		{"metrics": []interface{}{map[string]interface{}{"unit": "Count"}}},
+		{"dimensions": "not a list"},
+	} {
+		_, err := newEMFFormatter(invalid)
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestActivity_Formatters(t *testing.T) {
+	t.Run("Structured formats carry flow details as fields", func(t *testing.T) {
+		act, err := New(test.NewActivityInitContext(map[string]interface{}{
+			"logLevel":       "INFO",
+			"outputFormat":   "gelf",
+			"addFlowDetails": true,
+			"formatOptions":  `{"host": "flogo-test"}`,
+		}, nil))
+		require.NoError(t, err)
+
+		host := &test.TestActivityHost{HostId: "inst-9"}
+		tc := test.NewActivityContextWithAction(act.Metadata(), host)
+		line := act.(*Activity).formatLogEntry(tc, "hello", "INFO", nil, nil)
+
+		var gelf map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &gelf), "no text suffix after the JSON")
+		assert.Equal(t, "flogo-test", gelf["host"])
+		assert.Equal(t, "inst-9", gelf["_flogo.instance_id"])
+		assert.Equal(t, "Test TaskOld", gelf["_flogo.activity"])
+	})
+
+	t.Run("Custom formatter registry", func(t *testing.T) {
+		format := fmt.Sprintf("pipe-test-%d", memorySinkSeq.Add(1))
+		require.NoError(t, RegisterFormatter(format, func(options map[string]interface{}) (Formatter, error) {
+			sep, _ := options["separator"].(string)
+			return FormatterFunc(func(rec *Record) (string, error) {
+				msg, _ := entryMessage(rec.Entry)
+				return rec.Level + sep + msg, nil
+			}), nil
+		}))
+		assert.Error(t, RegisterFormatter(strings.ToUpper(format), func(map[string]interface{}) (Formatter, error) { return nil, nil }))
+		assert.Error(t, RegisterFormatter("logfmt", func(map[string]interface{}) (Formatter, error) { return nil, nil }))
+
+		act, err := New(test.NewActivityInitContext(map[string]interface{}{
+			"logLevel":      "INFO",
+			"outputFormat":  format,
+			"formatOptions": map[string]interface{}{"separator": " | "},
+		}, nil))
+		require.NoError(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+		assert.Equal(t, "WARN | disk low", act.(*Activity).formatLogEntry(tc, "disk low", "WARN", nil, nil))
+	})
+
+	t.Run("Unknown formats fall back to JSON", func(t *testing.T) {
+		act, err := New(test.NewActivityInitContext(map[string]interface{}{"logLevel": "INFO", "outputFormat": "XML"}, nil))
+		require.NoError(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+		line := act.(*Activity).formatLogEntry(tc, "hi", "INFO", nil, nil)
+		assert.True(t, strings.HasPrefix(line, "{"), line)
+	})
+
+	t.Run("Invalid format options fail initialization", func(t *testing.T) {
+		_, err := New(test.NewActivityInitContext(map[string]interface{}{
+			"logLevel":      "INFO",
+			"outputFormat":  "CLOUDWATCH_EMF",
+			"formatOptions": `{"metrics": [{"name": "x", "unit": "Furlongs"}]}`,
+		}, nil))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,554 @@
+package writelog
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+// Sources of level overrides
+const (
+	OverrideSourceAPI   = "api"
+	OverrideSourceAdmin = "admin"
+	OverrideSourceFile  = "file"
+)
+
+const (
+	defaultOverrideTTL      = 15 * time.Minute
+	defaultOverrideMaxTTL   = 24 * time.Hour
+	defaultLevelFilePoll    = 5 * time.Second
+	levelAdminPath          = "/loglevel"
+	levelAdminTokenEnv      = "FLOGO_WRITELOG_ADMIN_TOKEN"
+	levelAdminMaxBodyLength = 64 * 1024
+)
+
+// validLogLevels are the levels accepted by level overrides
+var validLogLevels = map[string]bool{
+	"TRACE": true, "DEBUG": true, "INFO": true, "WARN": true, "ERROR": true, "FATAL": true,
+}
+
+// LevelOverride replaces the environment and settings log level until it expires
+type LevelOverride struct {
+	Flow    string    `json:"flow,omitempty"` // Flow name; empty for the global override
+	Level   string    `json:"level"`
+	Expires time.Time `json:"expires"`
+	Source  string    `json:"source"` // api, admin or file
+}
+
+// levelOverrides holds the active overrides of the process
+var levelOverrides = struct {
+	sync.Mutex
+	global *LevelOverride
+	flows  map[string]*LevelOverride
+	now    func() time.Time
+}{flows: make(map[string]*LevelOverride), now: time.Now}
+
+// SetLevelOverride changes the effective log level of a flow, or of every flow when flow
+// is empty, for the given duration. Levels from the logLevel input still take precedence.
+func SetLevelOverride(flow, level string, ttl time.Duration) error {
+	return setLevelOverride(flow, level, ttl, OverrideSourceAPI)
+}
+
+func setLevelOverride(flow, level string, ttl time.Duration, source string) error {
+	levelOverrides.Lock()
+	defer levelOverrides.Unlock()
+	return setLevelOverrideLocked(flow, level, levelOverrides.now().Add(ttl), ttl, source)
+}
+
+func setLevelOverrideLocked(flow, level string, expires time.Time, ttl time.Duration, source string) error {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if !validLogLevels[level] {
+		return fmt.Errorf("invalid log level '%s'", level)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("level override duration must be positive")
+	}
+
+	override := &LevelOverride{Flow: flow, Level: level, Expires: expires, Source: source}
+	if flow == "" {
+		levelOverrides.global = override
+	} else {
+		levelOverrides.flows[flow] = override
+	}
+	return nil
+}
+
+// ClearLevelOverride removes the override of a flow, or the global override when flow is empty
+func ClearLevelOverride(flow string) {
+	levelOverrides.Lock()
+	defer levelOverrides.Unlock()
+
+	if flow == "" {
+		levelOverrides.global = nil
+	} else {
+		delete(levelOverrides.flows, flow)
+	}
+}
+
+// GetLevelOverrides returns the overrides that have not expired, global first and then by flow
+func GetLevelOverrides() []LevelOverride {
+	levelOverrides.Lock()
+	defer levelOverrides.Unlock()
+
+	now := levelOverrides.now()
+	var active []LevelOverride
+	if o := levelOverrides.global; o != nil && now.Before(o.Expires) {
+		active = append(active, *o)
+	}
+
+	flows := make([]string, 0, len(levelOverrides.flows))
+	for flow := range levelOverrides.flows {
+		flows = append(flows, flow)
+	}
+	sort.Strings(flows)
+	for _, flow := range flows {
+		if o := levelOverrides.flows[flow]; now.Before(o.Expires) {
+			active = append(active, *o)
+		}
+	}
+	return active
+}
+
+// lookupLevelOverride returns the override level for a flow. A flow override takes
+// precedence over the global one. Expired overrides are removed.
+func lookupLevelOverride(flow string) (string, bool) {
+	levelOverrides.Lock()
+	defer levelOverrides.Unlock()
+
+	if levelOverrides.global == nil && len(levelOverrides.flows) == 0 {
+		return "", false
+	}
+
+	now := levelOverrides.now()
+	if flow != "" {
+		if o, ok := levelOverrides.flows[flow]; ok {
+			if now.Before(o.Expires) {
+				return o.Level, true
+			}
+			delete(levelOverrides.flows, flow)
+		}
+	}
+	if o := levelOverrides.global; o != nil {
+		if now.Before(o.Expires) {
+			return o.Level, true
+		}
+		levelOverrides.global = nil
+	}
+	return "", false
+}
+
+// clearLevelOverridesFrom removes every override set by a source. The caller must hold the lock.
+func clearLevelOverridesFrom(source string) {
+	if o := levelOverrides.global; o != nil && o.Source == source {
+		levelOverrides.global = nil
+	}
+	for flow, o := range levelOverrides.flows {
+		if o.Source == source {
+			delete(levelOverrides.flows, flow)
+		}
+	}
+}
+
+// flowName returns the name of the flow running the activity
+func flowName(ctx activity.Context) string {
+	if host := ctx.ActivityHost(); host != nil {
+		return host.Name()
+	}
+	return ""
+}
+
+// LevelControlConfig configures runtime log level control in the levelControl setting
+type LevelControlConfig struct {
+	AdminAddress string `json:"adminAddress,omitempty"` // Address of the admin HTTP endpoint, e.g. 127.0.0.1:7071
+	AdminToken   string `json:"adminToken,omitempty"`   // Bearer token required by the endpoint (default: FLOGO_WRITELOG_ADMIN_TOKEN)
+	File         string `json:"file,omitempty"`         // Watched level file
+	PollInterval string `json:"pollInterval,omitempty"` // How often the file is checked (default: "5s")
+	DefaultTTL   string `json:"defaultTTL,omitempty"`   // Duration of overrides without a ttl (default: "15m")
+	MaxTTL       string `json:"maxTTL,omitempty"`       // Longest accepted ttl (default: "24h")
+
+	defaultTTL   time.Duration
+	maxTTL       time.Duration
+	pollInterval time.Duration
+}
+
+// parseLevelControlConfig reads the levelControl setting. It returns nil when neither an
+// admin endpoint nor a file is configured.
+func parseLevelControlConfig(setting interface{}) (*LevelControlConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+	if s, ok := setting.(string); ok && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	config := &LevelControlConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid levelControl setting: %w", err)
+	}
+	if config.AdminAddress == "" && config.File == "" {
+		return nil, nil
+	}
+	if config.AdminAddress != "" && config.AdminToken == "" {
+		config.AdminToken = os.Getenv(levelAdminTokenEnv)
+	}
+
+	durations := []struct {
+		name   string
+		value  string
+		def    time.Duration
+		target *time.Duration
+	}{
+		{"defaultTTL", config.DefaultTTL, defaultOverrideTTL, &config.defaultTTL},
+		{"maxTTL", config.MaxTTL, defaultOverrideMaxTTL, &config.maxTTL},
+		{"pollInterval", config.PollInterval, defaultLevelFilePoll, &config.pollInterval},
+	}
+	for _, d := range durations {
+		*d.target = d.def
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid levelControl %s '%s'", d.name, d.value)
+		}
+		*d.target = parsed
+	}
+	if config.defaultTTL > config.maxTTL {
+		return nil, fmt.Errorf("levelControl defaultTTL must not exceed maxTTL")
+	}
+
+	return config, nil
+}
+
+// resolveTTL parses an override ttl, applying the default and the maximum
+func (c *LevelControlConfig) resolveTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return c.defaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl '%s'", value)
+	}
+	if ttl > c.maxTTL {
+		return 0, fmt.Errorf("ttl %s exceeds the maximum of %s", ttl, c.maxTTL)
+	}
+	return ttl, nil
+}
+
+// levelControl is a running admin endpoint or file watcher
+type levelControl interface {
+	stop()
+}
+
+// levelControls holds the running controls, shared by activities with the same configuration
+var levelControls = struct {
+	sync.Mutex
+	byKey map[string]levelControl
+}{byKey: make(map[string]levelControl)}
+
+// startLevelControls starts the admin endpoint and file watcher of a configuration, unless
+// another activity already started them
+func startLevelControls(config *LevelControlConfig, logger log.Logger) error {
+	levelControls.Lock()
+	defer levelControls.Unlock()
+
+	if config.AdminAddress != "" {
+		key := "admin:" + config.AdminAddress
+		if _, exists := levelControls.byKey[key]; !exists {
+			server, err := startLevelAdminServer(config, logger)
+			if err != nil {
+				return err
+			}
+			levelControls.byKey[key] = server
+		}
+	}
+
+	if config.File != "" {
+		key := "file:" + config.File
+		if _, exists := levelControls.byKey[key]; !exists {
+			levelControls.byKey[key] = startLevelFileWatcher(config, logger)
+		}
+	}
+
+	registerShutdownHook()
+	return nil
+}
+
+// stopLevelControls stops every admin endpoint and file watcher
+func stopLevelControls() {
+	levelControls.Lock()
+	controls := levelControls.byKey
+	levelControls.byKey = make(map[string]levelControl)
+	levelControls.Unlock()
+
+	for _, c := range controls {
+		c.stop()
+	}
+}
+
+// levelAdminServer serves the level override endpoint:
+//
+//	GET    /loglevel                   lists the active overrides
+//	PUT    /loglevel                   sets an override from {"level", "flow", "ttl"}
+//	DELETE /loglevel?flow=<name>       removes an override (the global one without flow)
+type levelAdminServer struct {
+	config   *LevelControlConfig
+	logger   log.Logger
+	listener net.Listener
+	server   *http.Server
+}
+
+func startLevelAdminServer(config *LevelControlConfig, logger log.Logger) (*levelAdminServer, error) {
+	listener, err := net.Listen("tcp", config.AdminAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start log level admin endpoint: %w", err)
+	}
+	// Without a token anyone who can reach the endpoint can change levels, so it must
+	// only be reachable from the host
+	if addr, ok := listener.Addr().(*net.TCPAddr); config.AdminToken == "" && (!ok || !addr.IP.IsLoopback()) {
+		_ = listener.Close()
+		return nil, fmt.Errorf("log level admin endpoint on %s requires an adminToken when it is not bound to a loopback address", config.AdminAddress)
+	}
+
+	s := &levelAdminServer{config: config, logger: logger, listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc(levelAdminPath, s.handle)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Log level admin endpoint stopped: %v", err)
+		}
+	}()
+
+	if config.AdminToken == "" {
+		logger.Warnf("Log level admin endpoint on %s has no adminToken; any local process can change log levels", listener.Addr())
+	} else {
+		logger.Infof("Log level admin endpoint listening on %s%s", listener.Addr(), levelAdminPath)
+	}
+	return s, nil
+}
+
+func (s *levelAdminServer) stop() {
+	_ = s.server.Close()
+}
+
+func (s *levelAdminServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.config.AdminToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"overrides": overridesOrEmpty()})
+
+	case http.MethodPut, http.MethodPost:
+		var req struct {
+			Level string `json:"level"`
+			Flow  string `json:"flow"`
+			TTL   string `json:"ttl"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, levelAdminMaxBodyLength)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl, err := s.config.resolveTTL(req.TTL)
+		if err == nil {
+			err = setLevelOverride(req.Flow, req.Level, ttl, OverrideSourceAdmin)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Infof("Log level override set by admin endpoint: %s", describeOverride(req.Flow, req.Level, ttl))
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"overrides": overridesOrEmpty()})
+
+	case http.MethodDelete:
+		flow := r.URL.Query().Get("flow")
+		ClearLevelOverride(flow)
+		s.logger.Infof("Log level override cleared by admin endpoint: %s", describeOverride(flow, "", 0))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func overridesOrEmpty() []LevelOverride {
+	if overrides := GetLevelOverrides(); overrides != nil {
+		return overrides
+	}
+	return []LevelOverride{}
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// describeOverride formats an override for log messages
+func describeOverride(flow, level string, ttl time.Duration) string {
+	target := "all flows"
+	if flow != "" {
+		target = "flow " + flow
+	}
+	if level == "" {
+		return target
+	}
+	return fmt.Sprintf("%s at %s for %s", target, strings.ToUpper(level), ttl)
+}
+
+// levelFile is the content of a watched level file
+type levelFile struct {
+	Level string `json:"level"` // Global level; empty for none
+	TTL   string `json:"ttl"`
+	Flows map[string]struct {
+		Level string `json:"level"`
+		TTL   string `json:"ttl"`
+	} `json:"flows"`
+}
+
+// levelFileWatcher polls a level file and applies it whenever it changes. Override
+// durations count from the file's modification time, so a stale file does not
+// re-apply its levels after a restart.
+type levelFileWatcher struct {
+	config  *LevelControlConfig
+	logger  log.Logger
+	modTime time.Time
+	size    int64
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func startLevelFileWatcher(config *LevelControlConfig, logger log.Logger) *levelFileWatcher {
+	w := &levelFileWatcher{
+		config:  config,
+		logger:  logger,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	w.check()
+	go w.run()
+	return w
+}
+
+func (w *levelFileWatcher) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.config.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *levelFileWatcher) stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// check applies the file when its modification time or size changed. When the file is
+// removed, the overrides it set are cleared.
+func (w *levelFileWatcher) check() {
+	info, err := os.Stat(w.config.File)
+	if err != nil {
+		if !w.modTime.IsZero() {
+			w.modTime, w.size = time.Time{}, 0
+			levelOverrides.Lock()
+			clearLevelOverridesFrom(OverrideSourceFile)
+			levelOverrides.Unlock()
+			w.logger.Infof("Log level file %s removed, file overrides cleared", w.config.File)
+		}
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	if err := w.apply(info.ModTime()); err != nil {
+		w.logger.Warnf("Ignoring log level file %s: %v", w.config.File, err)
+	}
+}
+
+// apply replaces the overrides set by the file with its current content
+func (w *levelFileWatcher) apply(modTime time.Time) error {
+	data, err := os.ReadFile(w.config.File)
+	if err != nil {
+		return err
+	}
+	var content levelFile
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &content); err != nil {
+			return err
+		}
+	}
+
+	type entry struct {
+		flow, level string
+		ttl         time.Duration
+	}
+	var entries []entry
+	if content.Level != "" {
+		ttl, err := w.config.resolveTTL(content.TTL)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{level: content.Level, ttl: ttl})
+	}
+	for flow, f := range content.Flows {
+		if flow == "" || f.Level == "" {
+			continue
+		}
+		ttl, err := w.config.resolveTTL(f.TTL)
+		if err != nil {
+			return fmt.Errorf("flow %s: %w", flow, err)
+		}
+		entries = append(entries, entry{flow: flow, level: f.Level, ttl: ttl})
+	}
+
+	levelOverrides.Lock()
+	defer levelOverrides.Unlock()
+
+	for _, e := range entries {
+		if !validLogLevels[strings.ToUpper(strings.TrimSpace(e.level))] {
+			return fmt.Errorf("invalid log level '%s'", e.level)
+		}
+	}
+
+	clearLevelOverridesFrom(OverrideSourceFile)
+	now := levelOverrides.now()
+	for _, e := range entries {
+		expires := modTime.Add(e.ttl)
+		if !now.Before(expires) {
+			continue
+		}
+		if err := setLevelOverrideLocked(e.flow, e.level, expires, e.ttl, OverrideSourceFile); err != nil {
+			return err
+		}
+		w.logger.Infof("Log level override set by %s: %s", w.config.File, describeOverride(e.flow, e.level, expires.Sub(now).Round(time.Second)))
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package writelog
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useLevelClock clears the level overrides and drives their expiry from a fake clock
+func useLevelClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{t: time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)}
+	reset := func(now func() time.Time) {
+		levelOverrides.Lock()
+		levelOverrides.global = nil
+		levelOverrides.flows = make(map[string]*LevelOverride)
+		levelOverrides.now = now
+		levelOverrides.Unlock()
+	}
+	reset(clock.now)
+	t.Cleanup(func() { reset(time.Now) })
+	return clock
+}
+
+// namedFlowHost is a test activity host with a flow name
+type namedFlowHost struct {
+	*test.TestActivityHost
+	name string
+}
+
+func (h *namedFlowHost) Name() string {
+	return h.name
+}
+
+// namedFlowContext is a test activity context running in a named flow
+type namedFlowContext struct {
+	*test.TestActivityContext
+	host *namedFlowHost
+}
+
+func (c *namedFlowContext) ActivityHost() activity.Host {
+	return c.host
+}
+
+func newNamedFlowContext(md *activity.Metadata, flow string) *namedFlowContext {
+	host := &namedFlowHost{TestActivityHost: &test.TestActivityHost{HostId: "flow-1"}, name: flow}
+	return &namedFlowContext{TestActivityContext: test.NewActivityContextWithAction(md, host.TestActivityHost), host: host}
+}
+
+func TestLevelOverrides(t *testing.T) {
+	clock := useLevelClock(t)
+
+	require.NoError(t, SetLevelOverride("", "debug", time.Minute))
+	require.NoError(t, SetLevelOverride("OrderFlow", "TRACE", 10*time.Minute))
+	assert.Error(t, SetLevelOverride("", "VERBOSE", time.Minute))
+	assert.Error(t, SetLevelOverride("", "INFO", 0))
+
+	level, ok := lookupLevelOverride("OrderFlow")
+	assert.True(t, ok)
+	assert.Equal(t, "TRACE", level, "flow overrides take precedence")
+	level, _ = lookupLevelOverride("BillingFlow")
+	assert.Equal(t, "DEBUG", level)
+
+	overrides := GetLevelOverrides()
+	require.Len(t, overrides, 2)
+	assert.Equal(t, LevelOverride{Level: "DEBUG", Expires: clock.now().Add(time.Minute), Source: OverrideSourceAPI}, overrides[0])
+	assert.Equal(t, "OrderFlow", overrides[1].Flow)
+
+	clock.advance(time.Minute)
+	_, ok = lookupLevelOverride("BillingFlow")
+	assert.False(t, ok, "the global override expired")
+	level, _ = lookupLevelOverride("OrderFlow")
+	assert.Equal(t, "TRACE", level)
+
+	ClearLevelOverride("OrderFlow")
+	_, ok = lookupLevelOverride("OrderFlow")
+	assert.False(t, ok)
+	assert.Empty(t, GetLevelOverrides())
+}
+
+func TestActivity_LevelOverride(t *testing.T) {
+	clock := useLevelClock(t)
+
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{"logLevel": "INFO", "outputFormat": "JSON"}, nil))
+	require.NoError(t, err)
+
+	levelOf := func(flow string, input interface{}) string {
+		return act.(*Activity).determineLogLevel(input, flowName(newNamedFlowContext(act.Metadata(), flow)))
+	}
+
+	assert.Equal(t, "INFO", levelOf("OrderFlow", nil))
+
+	require.NoError(t, SetLevelOverride("OrderFlow", "DEBUG", 5*time.Minute))
+	assert.Equal(t, "DEBUG", levelOf("OrderFlow", nil), "takes effect immediately")
+	assert.Equal(t, "INFO", levelOf("BillingFlow", nil))
+	assert.Equal(t, "ERROR", levelOf("OrderFlow", "error"), "the input level still wins")
+
+	clock.advance(5 * time.Minute)
+	assert.Equal(t, "INFO", levelOf("OrderFlow", nil), "expired")
+}
+
+func TestLevelAdminServer(t *testing.T) {
+	clock := useLevelClock(t)
+
+	config, err := parseLevelControlConfig(map[string]interface{}{
+		"adminAddress": "127.0.0.1:0",
+		"adminToken":   "s3cret",
+		"maxTTL":       "1h",
+	})
+	require.NoError(t, err)
+
+	server, err := startLevelAdminServer(config, log.RootLogger())
+	require.NoError(t, err)
+	defer server.stop()
+	url := "http://" + server.listener.Addr().String() + levelAdminPath
+
+	do := func(method, token, body string, query ...string) *http.Response {
+		req, err := http.NewRequest(method, url+strings.Join(query, ""), strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "wrong", "").StatusCode)
+
+	resp := do(http.MethodPut, "s3cret", `{"level": "debug", "flow": "OrderFlow", "ttl": "10m"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	level, _ := lookupLevelOverride("OrderFlow")
+	assert.Equal(t, "DEBUG", level)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "s3cret", `{"level": "WARN"}`).StatusCode)
+	resp = do(http.MethodGet, "s3cret", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var listed struct {
+		Overrides []LevelOverride `json:"overrides"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	require.Len(t, listed.Overrides, 2)
+	assert.Equal(t, LevelOverride{Level: "WARN", Expires: clock.now().Add(15 * time.Minute), Source: OverrideSourceAdmin}, listed.Overrides[0])
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "s3cret", `{"level": "LOUD"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "s3cret", `{"level": "INFO", "ttl": "2h"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "s3cret", `not json`).StatusCode)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPatch, "s3cret", "").StatusCode)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "s3cret", "").StatusCode)
+	_, ok := lookupLevelOverride("BillingFlow")
+	assert.False(t, ok, "the global override was removed")
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "s3cret", "", "?flow=OrderFlow").StatusCode)
+	assert.Empty(t, GetLevelOverrides())
+}
+
+func TestLevelFileWatcher(t *testing.T) {
+	clock := useLevelClock(t)
+	path := filepath.Join(t.TempDir(), "levels.json")
+
+	config, err := parseLevelControlConfig(map[string]interface{}{"file": path, "pollInterval": "1h"})
+	require.NoError(t, err)
+
+	write := func(content string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	// A file written long ago does not re-apply its levels
+	write(`{"level": "DEBUG", "ttl": "10m"}`, clock.now().Add(-time.Hour))
+	w := startLevelFileWatcher(config, log.RootLogger())
+	defer w.stop()
+	assert.Empty(t, GetLevelOverrides())
+
+	require.NoError(t, SetLevelOverride("AdminFlow", "ERROR", time.Hour))
+	write(`{"level": "debug", "ttl": "10m", "flows": {"OrderFlow": {"level": "TRACE"}}}`, clock.now())
+	w.check()
+	level, _ := lookupLevelOverride("BillingFlow")
+	assert.Equal(t, "DEBUG", level)
+	level, _ = lookupLevelOverride("OrderFlow")
+	assert.Equal(t, "TRACE", level)
+
+	clock.advance(10 * time.Minute)
+	_, ok := lookupLevelOverride("BillingFlow")
+	assert.False(t, ok, "the ttl counts from the file's modification time")
+	level, _ = lookupLevelOverride("OrderFlow")
+	assert.Equal(t, "TRACE", level, "flows without a ttl use the 15m default")
+
+	// Invalid content leaves the current overrides in place
+	write(`{"level": "LOUD"}`, clock.now())
+	w.check()
+	level, _ = lookupLevelOverride("OrderFlow")
+	assert.Equal(t, "TRACE", level)
+
+	// Rewriting the file replaces its overrides, but not those set elsewhere
+	write(`{"flows": {"BillingFlow": {"level": "WARN", "ttl": "1m"}}}`, clock.now().Add(time.Second))
+	w.check()
+	_, ok = lookupLevelOverride("OrderFlow")
+	assert.False(t, ok)
+	level, _ = lookupLevelOverride("BillingFlow")
+	assert.Equal(t, "WARN", level)
+	level, _ = lookupLevelOverride("AdminFlow")
+	assert.Equal(t, "ERROR", level)
+
+	require.NoError(t, os.Remove(path))
+	w.check()
+	_, ok = lookupLevelOverride("BillingFlow")
+	assert.False(t, ok, "removing the file clears its overrides")
+	level, _ = lookupLevelOverride("AdminFlow")
+	assert.Equal(t, "ERROR", level)
+}
+
+func TestLevelAdminServer_RequiresTokenOffLoopback(t *testing.T) {
+	t.Setenv(levelAdminTokenEnv, "")
+	config, err := parseLevelControlConfig(map[string]interface{}{"adminAddress": "0.0.0.0:0"})
+	require.NoError(t, err)
+	_, err = startLevelAdminServer(config, log.RootLogger())
+	assert.ErrorContains(t, err, "requires an adminToken")
+
+	config, err = parseLevelControlConfig(map[string]interface{}{"adminAddress": "127.0.0.1:0"})
+	require.NoError(t, err)
+	server, err := startLevelAdminServer(config, log.RootLogger())
+	require.NoError(t, err, "a loopback endpoint may run without a token")
+	server.stop()
+}
+
+func TestParseLevelControlConfig(t *testing.T) {
+	config, err := parseLevelControlConfig(`{"file": "/tmp/levels.json"}`)
+	require.NoError(t, err)
+	assert.Equal(t, defaultOverrideTTL, config.defaultTTL)
+	assert.Equal(t, defaultOverrideMaxTTL, config.maxTTL)
+	assert.Equal(t, defaultLevelFilePoll, config.pollInterval)
+
+	t.Setenv(levelAdminTokenEnv, "from-env")
+	config, err = parseLevelControlConfig(`{"adminAddress": "127.0.0.1:7071"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", config.AdminToken)
+
+	for _, empty := range []interface{}{nil, "", `{"defaultTTL": "1m"}`} {
+		config, err := parseLevelControlConfig(empty)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", empty)
+	}
+
+	for _, invalid := range []string{
+		`{"file": "x", "defaultTTL": "forever"}`,
+		`{"file": "x", "pollInterval": "-1s"}`,
+		`{"file": "x", "defaultTTL": "2h", "maxTTL": "1h"}`,
+	} {
+		_, err := parseLevelControlConfig(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,310 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SizeLimitsConfig configures the size limits in the sizeLimits setting. Zero disables a limit.
+type SizeLimitsConfig struct {
+	MaxEntryBytes  int `json:"maxEntryBytes,omitempty"`  // Size of the whole entry, measured as JSON
+	MaxFieldLength int `json:"maxFieldLength,omitempty"` // Bytes kept of each string value
+	MaxArrayLength int `json:"maxArrayLength,omitempty"` // Items kept of each array
+	MaxDepth       int `json:"maxDepth,omitempty"`       // Nesting levels kept; top-level fields are at depth 1
+}
+
+// truncatedBytesMarker is appended to truncated strings and replaces removed objects
+const truncatedBytesMarker = "…[truncated %d bytes]"
+
+// truncatedMarkerPattern matches the marker at the end of a string truncated earlier
+var truncatedMarkerPattern = regexp.MustCompile(`…\[truncated (\d+) bytes\]$`)
+
+// parseSizeLimitsConfig reads the sizeLimits setting. It returns nil when no limit is set.
+func parseSizeLimitsConfig(setting interface{}) (*SizeLimitsConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+
+	config := &SizeLimitsConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid sizeLimits setting: %w", err)
+	}
+	if config.MaxEntryBytes < 0 || config.MaxFieldLength < 0 || config.MaxArrayLength < 0 || config.MaxDepth < 0 {
+		return nil, fmt.Errorf("sizeLimits must not be negative")
+	}
+
+	if *config == (SizeLimitsConfig{}) {
+		return nil, nil
+	}
+	return config, nil
+}
+
+// sizeLimiter truncates oversized entries. Fields added by the activity are never truncated.
+type sizeLimiter struct {
+	config   SizeLimitsConfig
+	reserved map[string]bool
+}
+
+func newSizeLimiter(config *SizeLimitsConfig, systemFields []string) *sizeLimiter {
+	l := &sizeLimiter{config: *config, reserved: make(map[string]bool)}
+	for _, f := range append(systemFields, "level", "@timestamp", "log", "ecs", "event", "trace", "span", "correlation", "flogo", auditField) {
+		l.reserved[f] = true
+	}
+	return l
+}
+
+// apply returns the entry within the limits, and sets event.truncated when anything was
+// removed. The caller's data is never mutated.
+func (l *sizeLimiter) apply(entry map[string]interface{}) map[string]interface{} {
+	limited, truncated := l.limitFields(entry)
+	if truncated {
+		markTruncated(limited)
+	}
+	if l.config.MaxEntryBytes > 0 {
+		limited = l.limitEntry(limited)
+	}
+	return limited
+}
+
+// limitFields applies the string, array and depth limits to every field
+func (l *sizeLimiter) limitFields(entry map[string]interface{}) (map[string]interface{}, bool) {
+	if l.config.MaxFieldLength == 0 && l.config.MaxArrayLength == 0 && l.config.MaxDepth == 0 {
+		return entry, false
+	}
+
+	truncated := false
+	var visit treeVisitor
+	visit = func(path []pathStep, value interface{}) (interface{}, treeAction) {
+		if len(path) == 1 && l.reserved[path[0].key] {
+			return value, treeReplace
+		}
+
+		if l.config.MaxDepth > 0 && len(path) >= l.config.MaxDepth && isNonEmptyContainer(value) {
+			truncated = true
+			return fmt.Sprintf(truncatedBytesMarker, jsonSize(value)), treeReplace
+		}
+
+		var items []interface{}
+		switch v := value.(type) {
+		case string:
+			if l.config.MaxFieldLength > 0 && len(v) > l.config.MaxFieldLength {
+				truncated = true
+				return truncateString(v, l.config.MaxFieldLength), treeReplace
+			}
+			return v, treeReplace
+		case []interface{}:
+			items = v
+		case []string:
+			items = make([]interface{}, len(v))
+			for i, item := range v {
+				items[i] = item
+			}
+		case []map[string]interface{}:
+			items = make([]interface{}, len(v))
+			for i, item := range v {
+				items[i] = item
+			}
+		default:
+			return value, treeDescend
+		}
+
+		removed := 0
+		if l.config.MaxArrayLength > 0 && len(items) > l.config.MaxArrayLength {
+			removed = len(items) - l.config.MaxArrayLength
+			items = items[:l.config.MaxArrayLength]
+		}
+		limited, changed := rewriteTree(items, path, visit)
+		if removed == 0 {
+			if !changed {
+				return value, treeReplace
+			}
+			return limited, treeReplace
+		}
+		truncated = true
+		kept := append([]interface{}(nil), limited.([]interface{})...)
+		return append(kept, fmt.Sprintf("…[truncated %d items]", removed)), treeReplace
+	}
+
+	limited, _ := rewriteTree(entry, nil, visit)
+	return limited.(map[string]interface{}), truncated
+}
+
+// limitEntry shrinks an entry larger than maxEntryBytes. The longest strings are
+// shortened first; when that is not enough, the largest top-level fields are replaced
+// by markers.
+func (l *sizeLimiter) limitEntry(entry map[string]interface{}) map[string]interface{} {
+	if jsonSize(entry) <= l.config.MaxEntryBytes {
+		return entry
+	}
+
+	// The flag is set first, so the size includes it
+	entry = copyMap(entry)
+	markTruncated(entry)
+	size := jsonSize(entry)
+
+	type leaf struct {
+		path  string
+		value string
+		size  int
+	}
+	var leaves []leaf
+	rewriteTree(entry, nil, func(path []pathStep, value interface{}) (interface{}, treeAction) {
+		if len(path) == 1 && l.reserved[path[0].key] {
+			return value, treeReplace
+		}
+		if s, ok := value.(string); ok {
+			leaves = append(leaves, leaf{path: pathKey(path), value: s, size: jsonSize(s)})
+			return value, treeReplace
+		}
+		return value, treeDescend
+	})
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].size > leaves[j].size })
+
+	shortened := make(map[string]string)
+	for _, lf := range leaves {
+		if size <= l.config.MaxEntryBytes {
+			break
+		}
+		short := truncateToJSONSize(lf.value, lf.size-(size-l.config.MaxEntryBytes))
+		if saved := lf.size - jsonSize(short); saved > 0 {
+			shortened[lf.path] = short
+			size -= saved
+		}
+	}
+	if len(shortened) > 0 {
+		replaced, _ := rewriteTree(entry, nil, func(path []pathStep, value interface{}) (interface{}, treeAction) {
+			if len(path) == 1 && l.reserved[path[0].key] {
+				return value, treeReplace
+			}
+			if short, ok := shortened[pathKey(path)]; ok {
+				return short, treeReplace
+			}
+			return value, treeDescend
+		})
+		entry = replaced.(map[string]interface{})
+	}
+
+	size = jsonSize(entry)
+	if size <= l.config.MaxEntryBytes {
+		return entry
+	}
+
+	// Many small values: replace whole top-level fields, largest first
+	keys := make([]string, 0, len(entry))
+	sizes := make(map[string]int, len(entry))
+	for k, v := range entry {
+		if !l.reserved[k] {
+			keys = append(keys, k)
+			sizes[k] = jsonSize(v)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if sizes[keys[i]] != sizes[keys[j]] {
+			return sizes[keys[i]] > sizes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	entry = copyMap(entry)
+	for _, k := range keys {
+		if size <= l.config.MaxEntryBytes {
+			break
+		}
+		marker := fmt.Sprintf(truncatedBytesMarker, sizes[k])
+		if saved := sizes[k] - jsonSize(marker); saved > 0 {
+			entry[k] = marker
+			size -= saved
+		}
+	}
+	return entry
+}
+
+// markTruncated sets event.truncated in place. An event field that is not an object is
+// left as is.
+func markTruncated(entry map[string]interface{}) {
+	switch event := entry["event"].(type) {
+	case nil:
+		entry["event"] = map[string]interface{}{"truncated": true}
+	case map[string]interface{}:
+		event = copyMap(event)
+		event["truncated"] = true
+		entry["event"] = event
+	}
+}
+
+// truncateString keeps the first keep bytes of s, cut at a character boundary, followed
+// by a marker with the number of bytes removed. Bytes removed by an earlier truncation
+// are included in the count.
+func truncateString(s string, keep int) string {
+	removed := 0
+	if m := truncatedMarkerPattern.FindStringSubmatchIndex(s); m != nil {
+		removed, _ = strconv.Atoi(s[m[2]:m[3]])
+		s = s[:m[0]]
+	}
+	if keep > len(s) {
+		keep = len(s)
+	}
+	for keep > 0 && keep < len(s) && !utf8.RuneStart(s[keep]) {
+		keep--
+	}
+	return s[:keep] + fmt.Sprintf(truncatedBytesMarker, removed+len(s)-keep)
+}
+
+// truncateToJSONSize truncates s so that, with its marker, it encodes to at most size
+// bytes of JSON, or to the marker alone when that is not possible
+func truncateToJSONSize(s string, size int) string {
+	keep := len(s) - (jsonSize(s) - size) - len(truncatedBytesMarker)
+	for {
+		if keep < 0 {
+			keep = 0
+		}
+		short := truncateString(s, keep)
+		over := jsonSize(short) - size
+		if over <= 0 || keep == 0 {
+			return short
+		}
+		keep -= over
+	}
+}
+
+// isNonEmptyContainer reports whether a value is an object or array with any content
+func isNonEmptyContainer(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	case []map[string]interface{}:
+		return len(v) > 0
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+// jsonSize returns the encoded size of a value, as written by the JSON format
+func jsonSize(value interface{}) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return len(fmt.Sprintf("%v", value))
+	}
+	return len(data)
+}
+
+// pathKey identifies a concrete path in an entry
+func pathKey(path []pathStep) string {
+	var b strings.Builder
+	for _, step := range path {
+		if step.isIndex {
+			b.WriteString("[" + strconv.Itoa(step.index) + "]")
+		} else {
+			b.WriteString("\x00" + step.key)
+		}
+	}
+	return b.String()
+}
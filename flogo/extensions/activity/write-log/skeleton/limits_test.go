@@ -0,0 +1,134 @@
+package writelog
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSizeLimitsConfig(t *testing.T) {
+	config, err := parseSizeLimitsConfig(`{"maxEntryBytes": 65536, "maxDepth": 8}`)
+	require.NoError(t, err)
+	assert.Equal(t, &SizeLimitsConfig{MaxEntryBytes: 65536, MaxDepth: 8}, config)
+
+	for _, empty := range []interface{}{nil, "", "{}"} {
+		config, err := parseSizeLimitsConfig(empty)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", empty)
+	}
+
+	for _, invalid := range []string{`{"maxFieldLength": -1}`, `{"maxDepth": "deep"}`} {
+		_, err := parseSizeLimitsConfig(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSizeLimiter_Fields(t *testing.T) {
+	limiter := newSizeLimiter(&SizeLimitsConfig{MaxFieldLength: 8, MaxArrayLength: 2, MaxDepth: 3}, nil)
+
+	attachment := strings.Repeat("QUJD", 100)
+	nested := map[string]interface{}{"b": map[string]interface{}{"c": map[string]interface{}{"d": 1}}}
+	entry := map[string]interface{}{
+		"level":   "INFO",
+		"message": "short",
+		"order": map[string]interface{}{
+			"attachment": attachment,
+			"items":      []interface{}{"a", "b", "c", "d"},
+			"tags":       []string{"x", "y", "z"},
+		},
+		"a":    nested,
+		"name": "Zoë Zoë Zoë",
+	}
+
+	limited := limiter.apply(entry)
+	order := limited["order"].(map[string]interface{})
+	assert.Equal(t, "QUJDQUJD…[truncated 392 bytes]", order["attachment"])
+	assert.Equal(t, []interface{}{"a", "b", "…[truncated 2 items]"}, order["items"])
+	assert.Equal(t, []interface{}{"x", "y", "…[truncated 1 items]"}, order["tags"])
+	assert.Equal(t, "…[truncated 7 bytes]", limited["a"].(map[string]interface{})["b"].(map[string]interface{})["c"], "deeper values are replaced")
+	assert.Equal(t, "Zoë Zo…[truncated 7 bytes]", limited["name"], "cut at a character boundary")
+	assert.Equal(t, "short", limited["message"])
+	assert.Equal(t, map[string]interface{}{"truncated": true}, limited["event"])
+
+	assert.Equal(t, attachment, entry["order"].(map[string]interface{})["attachment"], "the input is not modified")
+	assert.NotContains(t, entry, "event")
+
+	untouched := limiter.apply(map[string]interface{}{"message": "ok", "tags": []string{"x"}})
+	assert.NotContains(t, untouched, "event")
+}
+
+func TestSizeLimiter_EntrySize(t *testing.T) {
+	limiter := newSizeLimiter(&SizeLimitsConfig{MaxEntryBytes: 1000}, nil)
+
+	entry := map[string]interface{}{
+		"level":   "ERROR",
+		"message": "upload failed",
+		"event":   map[string]interface{}{"action": "upload"},
+		"payload": map[string]interface{}{
+			"file":    strings.Repeat("A", 5000),
+			"preview": strings.Repeat("B", 800),
+			"name":    "invoice.pdf",
+		},
+	}
+	limited := limiter.apply(entry)
+	assert.LessOrEqual(t, jsonSize(limited), 1000)
+
+	payload := limited["payload"].(map[string]interface{})
+	assert.Regexp(t, `^A*…\[truncated \d+ bytes\]$`, payload["file"], "the longest string is shortened first")
+	assert.Equal(t, strings.Repeat("B", 800), payload["preview"])
+	assert.Equal(t, "invoice.pdf", payload["name"])
+	assert.Equal(t, map[string]interface{}{"action": "upload", "truncated": true}, limited["event"])
+
+	// Strings already shortened by maxFieldLength keep a single marker with the total count
+	limiter = newSizeLimiter(&SizeLimitsConfig{MaxEntryBytes: 200, MaxFieldLength: 150}, nil)
+	limited = limiter.apply(map[string]interface{}{"message": strings.Repeat("m", 300)})
+	assert.LessOrEqual(t, jsonSize(limited), 200)
+	message := limited["message"].(string)
+	assert.Equal(t, 1, strings.Count(message, "…[truncated"))
+	m := truncatedMarkerPattern.FindStringSubmatchIndex(message)
+	require.NotNil(t, m)
+	assert.Equal(t, strconv.Itoa(300-m[0]), message[m[2]:m[3]])
+
+	// Many small values are removed by replacing whole top-level fields
+	small := make([]interface{}, 500)
+	for i := range small {
+		small[i] = i
+	}
+	limiter = newSizeLimiter(&SizeLimitsConfig{MaxEntryBytes: 300}, nil)
+	limited = limiter.apply(map[string]interface{}{"message": "batch", "ids": small})
+	assert.LessOrEqual(t, jsonSize(limited), 300)
+	assert.Regexp(t, `^…\[truncated \d+ bytes\]$`, limited["ids"])
+	assert.Equal(t, "batch", limited["message"])
+}
+
+func TestActivity_SizeLimits(t *testing.T) {
+	sinkType, mem := registerMemorySink(t)
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":        "INFO",
+		"outputFormat":    "JSON",
+		"includeFlowInfo": true,
+		"sinks":           `[{"type":"` + sinkType + `"}]`,
+		"sizeLimits":      map[string]interface{}{"maxEntryBytes": 2048, "maxFieldLength": 1024},
+	}, nil))
+	require.NoError(t, err)
+
+	evalMessage(t, act.(*Activity), "INFO", map[string]interface{}{
+		"message":     "order received",
+		"attachments": []interface{}{strings.Repeat("JVBERi0xLjQK", 50000)},
+	})
+	require.Len(t, mem.records, 1)
+	line := mem.records[0].Line
+	assert.LessOrEqual(t, len(line), 2048)
+
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(line), &written))
+	assert.Equal(t, "order received", written["message"])
+	assert.Equal(t, true, written["event"].(map[string]interface{})["truncated"])
+	assert.Contains(t, written["attachments"].([]interface{})[0], "…[truncated ")
+	assert.Contains(t, written, "service", "fields added by the activity are kept")
+}
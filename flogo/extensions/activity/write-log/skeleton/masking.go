@@ -0,0 +1,271 @@
+package writelog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Masking strategy names
+const (
+	StrategyFull             = "full"              // Replace the whole value with maskWith
+	StrategyFirstN           = "first-n"           // Keep the first N characters
+	StrategyLastN            = "last-n"            // Keep the last N characters
+	StrategyHash             = "hash"              // Keyed HMAC-SHA256, stable across log entries
+	StrategyFormatPreserving = "format-preserving" // Mask letters and digits, keep separators and shape
+)
+
+// maskingKeyEnvVar is the fallback source for the HMAC key used by the hash strategy
+const maskingKeyEnvVar = "FLOGO_WRITELOG_MASKING_KEY"
+
+// hashOutputLength is the number of hex characters emitted by the hash strategy (128 bits)
+const hashOutputLength = 32
+
+var emailValuePattern = regexp.MustCompile(`^([^@\s]+)@([^@\s]+\.[^@\s]+)$`)
+
+// MaskStrategyConfig configures how a masked value is rendered
+type MaskStrategyConfig struct {
+	Strategy string `json:"strategy"` // full, first-n, last-n, hash or format-preserving
+	Keep     int    `json:"keep"`     // Characters kept by first-n, last-n and format-preserving
+	MaskWith string `json:"maskWith"` // Replacement text for full masking and the masked part of first-n/last-n
+}
+
+// FieldMaskRule applies a masking strategy to a set of field paths
+type FieldMaskRule struct {
+	Fields []string `json:"fields"`
+	MaskStrategyConfig
+}
+
+// DetectorMaskRule applies a masking strategy to the matches of specific PII detectors
+type DetectorMaskRule struct {
+	Detectors []string `json:"detectors"`
+	MaskStrategyConfig
+}
+
+// maskStrategy is a validated, ready-to-use masking strategy
+type maskStrategy struct {
+	name     string
+	keep     int
+	maskWith string
+	key      []byte
+}
+
+// compile validates the configuration and resolves defaults
+func (c MaskStrategyConfig) compile(defaultMask string, key []byte) (maskStrategy, error) {
+	name := strings.ToLower(strings.TrimSpace(c.Strategy))
+	if name == "" {
+		name = StrategyFull
+	}
+
+	m := maskStrategy{name: name, keep: c.Keep, maskWith: c.MaskWith, key: key}
+	if m.maskWith == "" {
+		m.maskWith = defaultMask
+	}
+
+	if c.Keep < 0 {
+		return m, fmt.Errorf("keep must not be negative (got %d)", c.Keep)
+	}
+
+	switch name {
+	case StrategyFull:
+	case StrategyFirstN, StrategyLastN:
+		if m.keep == 0 {
+			m.keep = 4
+		}
+	case StrategyFormatPreserving:
+	case StrategyHash:
+		if len(key) == 0 {
+			return m, fmt.Errorf("strategy '%s' requires the maskingKey setting or %s environment variable", StrategyHash, maskingKeyEnvVar)
+		}
+	default:
+		return m, fmt.Errorf("unknown masking strategy '%s' (supported: %s, %s, %s, %s, %s)",
+			c.Strategy, StrategyFull, StrategyFirstN, StrategyLastN, StrategyHash, StrategyFormatPreserving)
+	}
+
+	return m, nil
+}
+
+// apply masks a value according to the strategy. nil values stay nil.
+func (m maskStrategy) apply(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return m.applyString(fmt.Sprintf("%v", value))
+}
+
+// applyString masks a string according to the strategy
+func (m maskStrategy) applyString(s string) string {
+	switch m.name {
+	case StrategyFirstN:
+		runes := []rune(s)
+		if m.keep >= len(runes) {
+			return m.maskWith
+		}
+		return string(runes[:m.keep]) + m.maskWith
+	case StrategyLastN:
+		runes := []rune(s)
+		if m.keep >= len(runes) {
+			return m.maskWith
+		}
+		return m.maskWith + string(runes[len(runes)-m.keep:])
+	case StrategyHash:
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(s))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:hashOutputLength]
+	case StrategyFormatPreserving:
+		return formatPreservingMask(s, m.keep)
+	default:
+		return m.maskWith
+	}
+}
+
+// formatPreservingMask masks letters and digits with '*' while keeping separators, so
+// "4111-1111-1111-1234" with keep=4 becomes "****-****-****-1234". Email addresses keep
+// the first character of the local part and the domain: "j***@example.com".
+func formatPreservingMask(s string, keep int) string {
+	if parts := emailValuePattern.FindStringSubmatch(s); parts != nil {
+		first, _ := utf8.DecodeRuneInString(parts[1])
+		return string(first) + "***@" + parts[2]
+	}
+
+	runes := []rune(s)
+
+	// Count alphanumerics from the end so that separators do not count towards keep
+	keepFrom := len(runes)
+	for i, kept := len(runes)-1, 0; i >= 0 && kept < keep; i-- {
+		if isMaskable(runes[i]) {
+			kept++
+			keepFrom = i
+		}
+	}
+
+	masked := 0
+	for i, r := range runes {
+		if i < keepFrom && isMaskable(r) {
+			runes[i] = '*'
+			masked++
+		}
+	}
+
+	// Never reveal the whole value
+	if masked == 0 && len(runes) > 0 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes)
+}
+
+func isMaskable(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// resolveMaskingKey returns the HMAC key from settings, falling back to the environment
+func resolveMaskingKey(setting string) []byte {
+	if setting != "" {
+		return []byte(setting)
+	}
+	if env := os.Getenv(maskingKeyEnvVar); env != "" {
+		return []byte(env)
+	}
+	return nil
+}
+
+// fieldMaskRule is a compiled FieldMaskRule
+type fieldMaskRule struct {
+	paths    []*fieldPath
+	strategy maskStrategy
+}
+
+// buildFieldMaskRules compiles the masking rules of a sensitiveFields configuration.
+// Explicit rules take precedence over the top-level field list. Invalid strategies fall
+// back to full masking so that a configuration mistake never leaks data.
+func (a *Activity) buildFieldMaskRules(config *SensitiveFieldConfig, maskWith string) []fieldMaskRule {
+	var rules []fieldMaskRule
+
+	compile := func(c MaskStrategyConfig, fields []string) {
+		strategy, err := c.compile(maskWith, a.maskingKey)
+		if err != nil {
+			a.logger.Warnf("Invalid masking strategy for fields %v, using full masking: %v", fields, err)
+			strategy = maskStrategy{name: StrategyFull, maskWith: maskWith}
+		}
+		rules = append(rules, fieldMaskRule{paths: a.parseFieldPaths(fields), strategy: strategy})
+	}
+
+	for _, rule := range config.Rules {
+		compile(rule.MaskStrategyConfig, rule.Fields)
+	}
+
+	if fields := config.getEffectiveFields(); len(fields) > 0 {
+		if config.Strategy == "" {
+			// Legacy behavior: maskLength keeps up to three leading characters
+			rules = append(rules, fieldMaskRule{
+				paths:    a.parseFieldPaths(fields),
+				strategy: maskStrategy{name: legacyStrategy, keep: config.MaskLength, maskWith: maskWith},
+			})
+		} else {
+			compile(MaskStrategyConfig{Strategy: config.Strategy, Keep: config.Keep, MaskWith: config.MaskWith}, fields)
+		}
+	}
+
+	return rules
+}
+
+// legacyStrategy reproduces the original maskWith/maskLength behavior
+const legacyStrategy = "legacy"
+
+// maskWithRule masks a value using the compiled rule
+func (a *Activity) maskWithRule(rule fieldMaskRule, value interface{}) interface{} {
+	if rule.strategy.name == legacyStrategy {
+		return a.maskValue(value, rule.strategy.maskWith, rule.strategy.keep)
+	}
+	return rule.strategy.apply(value)
+}
+
+// ValidateSensitiveFields checks a sensitiveFields configuration and returns every problem found
+func ValidateSensitiveFields(sensitiveFields interface{}, maskingKey string) []error {
+	a := &Activity{}
+	config, err := a.parseSensitiveFields(sensitiveFields)
+	if err != nil {
+		return []error{err}
+	}
+	if config == nil {
+		return nil
+	}
+
+	var errs []error
+	key := resolveMaskingKey(maskingKey)
+
+	check := func(c MaskStrategyConfig, fields []string) {
+		if _, err := c.compile("***", key); err != nil {
+			errs = append(errs, fmt.Errorf("fields %v: %w", fields, err))
+		}
+		for _, f := range fields {
+			if _, err := parseFieldPath(f); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, rule := range config.Rules {
+		if len(rule.Fields) == 0 {
+			errs = append(errs, fmt.Errorf("masking rule with strategy '%s' has no fields", rule.Strategy))
+		}
+		check(rule.MaskStrategyConfig, rule.Fields)
+	}
+	if config.Strategy != "" {
+		check(MaskStrategyConfig{Strategy: config.Strategy, Keep: config.Keep, MaskWith: config.MaskWith}, config.getEffectiveFields())
+	} else {
+		for _, f := range config.getEffectiveFields() {
+			if _, err := parseFieldPath(f); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,171 @@
+package writelog
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskStrategy_Apply(t *testing.T) {
+	key := []byte("test-key")
+
+	tests := []struct {
+		name     string
+		config   MaskStrategyConfig
+		input    interface{}
+		expected interface{}
+	}{
+		{"Full", MaskStrategyConfig{}, "secret", "***"},
+		{"Full custom mask", MaskStrategyConfig{Strategy: "full", MaskWith: "[X]"}, "secret", "[X]"},
+		{"First N", MaskStrategyConfig{Strategy: "first-n", Keep: 2}, "secret", "se***"},
+		{"Last 4 default", MaskStrategyConfig{Strategy: "last-n"}, "4111111111111234", "***1234"},
+		{"Last N shorter than keep", MaskStrategyConfig{Strategy: "last-n", Keep: 10}, "abc", "***"},
+		{"Format-preserving card", MaskStrategyConfig{Strategy: "format-preserving", Keep: 4}, "4111-1111-1111-1234", "****-****-****-1234"},
+		{"Format-preserving email", MaskStrategyConfig{Strategy: "format-preserving"}, "john.doe@example.com", "j***@example.com"},
+		{"Format-preserving never reveals everything", MaskStrategyConfig{Strategy: "format-preserving", Keep: 10}, "12-34", "*****"},
+		{"Numbers are masked as strings", MaskStrategyConfig{Strategy: "last-n", Keep: 2}, 123456, "***56"},
+		{"Nil stays nil", MaskStrategyConfig{Strategy: "last-n"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := tt.config.compile("***", key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, strategy.apply(tt.input))
+		})
+	}
+
+	t.Run("Hash is keyed and stable", func(t *testing.T) {
+		s1, err := MaskStrategyConfig{Strategy: "hash"}.compile("***", key)
+		assert.NoError(t, err)
+		s2, err := MaskStrategyConfig{Strategy: "hash"}.compile("***", []byte("other-key"))
+		assert.NoError(t, err)
+
+		h := s1.applyString("jane@example.com")
+		assert.Equal(t, h, s1.applyString("jane@example.com"))
+		assert.NotEqual(t, h, s1.applyString("john@example.com"))
+		assert.NotEqual(t, h, s2.applyString("jane@example.com"))
+		assert.Len(t, h, len("hmac:")+hashOutputLength)
+	})
+}
+
+func TestMaskStrategy_Validation(t *testing.T) {
+	_, err := MaskStrategyConfig{Strategy: "scramble"}.compile("***", nil)
+	assert.Error(t, err)
+
+	_, err = MaskStrategyConfig{Strategy: "hash"}.compile("***", nil)
+	assert.Error(t, err)
+
+	_, err = MaskStrategyConfig{Strategy: "last-n", Keep: -1}.compile("***", nil)
+	assert.Error(t, err)
+
+	errs := ValidateSensitiveFields(map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"fields": []interface{}{"card"}, "strategy": "last-n"},
+			map[string]interface{}{"fields": []interface{}{"email"}, "strategy": "hash"},
+			map[string]interface{}{"strategy": "full"},
+			map[string]interface{}{"fields": []interface{}{"a..b"}, "strategy": "bogus"},
+		},
+	}, "")
+	assert.Len(t, errs, 4)
+
+	assert.Empty(t, ValidateSensitiveFields(map[string]interface{}{
+		"fieldNamesToHide": []interface{}{"email"},
+		"strategy":         "hash",
+	}, "key"))
+}
+
+func TestActivity_MaskingStrategies(t *testing.T) {
+	settings := map[string]interface{}{
+		"logLevel":        "INFO",
+		"includeFlowInfo": false,
+		"outputFormat":    "JSON",
+		"maskingKey":      "correlation-key",
+	}
+
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	assert.NoError(t, err)
+	activity := act.(*Activity)
+
+	data := map[string]interface{}{
+		"card":     "4111-1111-1111-1234",
+		"email":    "jane@example.com",
+		"password": "hunter2",
+		"customer": map[string]interface{}{"ssn": "123-45-6789"},
+	}
+
+	t.Run("Per-field rules", func(t *testing.T) {
+		result := activity.applySensitiveFieldMasking(data, map[string]interface{}{
+			"fieldNamesToHide": []interface{}{"password"},
+			"rules": []interface{}{
+				map[string]interface{}{"fields": []interface{}{"card"}, "strategy": "format-preserving", "keep": 4},
+				map[string]interface{}{"fields": []interface{}{"email"}, "strategy": "hash"},
+				map[string]interface{}{"fields": []interface{}{"**.ssn"}, "strategy": "last-n", "keep": 4, "maskWith": "***-**-"},
+			},
+		})
+
+		assert.Equal(t, "****-****-****-1234", result["card"])
+		assert.Regexp(t, `^hmac:[0-9a-f]{32}$`, result["email"])
+		assert.Equal(t, "***", result["password"])
+		assert.Equal(t, "***-**-6789", result["customer"].(map[string]interface{})["ssn"])
+	})
+
+	t.Run("Default strategy for the field list", func(t *testing.T) {
+		result := activity.applySensitiveFieldMasking(data, map[string]interface{}{
+			"fieldNamesToHide": []interface{}{"card", "email"},
+			"strategy":         "format-preserving",
+			"keep":             4,
+		})
+
+		assert.Equal(t, "****-****-****-1234", result["card"])
+		assert.Equal(t, "j***@example.com", result["email"])
+	})
+
+	t.Run("Invalid strategy falls back to full masking", func(t *testing.T) {
+		result := activity.applySensitiveFieldMasking(data, map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"fields": []interface{}{"card"}, "strategy": "bogus"},
+			},
+		})
+
+		assert.Equal(t, "***", result["card"])
+	})
+
+	t.Run("PII detector rules", func(t *testing.T) {
+		settings := map[string]interface{}{
+			"logLevel":     "INFO",
+			"outputFormat": "JSON",
+			"piiDetection": map[string]interface{}{
+				"detectors": []interface{}{"creditCard", "email"},
+				"rules": []interface{}{
+					map[string]interface{}{"detectors": []interface{}{"creditCard"}, "strategy": "format-preserving", "keep": 4},
+					map[string]interface{}{"detectors": []interface{}{"email"}, "strategy": "format-preserving"},
+				},
+			},
+		}
+
+		act, err := New(test.NewActivityInitContext(settings, nil))
+		assert.NoError(t, err)
+		scanner := act.(*Activity).piiScanner
+
+		assert.Equal(t, "card ****-****-****-1111 for j***@example.com",
+			scanner.scanString("card 4111-1111-1111-1111 for jane@example.com"))
+	})
+
+	t.Run("Invalid PII rules fail initialization", func(t *testing.T) {
+		for _, pii := range []interface{}{
+			map[string]interface{}{"strategy": "hash"},
+			map[string]interface{}{"detectors": []interface{}{"email"}, "rules": []interface{}{
+				map[string]interface{}{"detectors": []interface{}{"phone"}, "strategy": "full"},
+			}},
+			map[string]interface{}{"rules": []interface{}{
+				map[string]interface{}{"detectors": []interface{}{"email"}, "strategy": "nope"},
+			}},
+		} {
+			settings := map[string]interface{}{"logLevel": "INFO", "outputFormat": "JSON", "piiDetection": pii}
+			_, err := New(test.NewActivityInitContext(settings, nil))
+			assert.Error(t, err)
+		}
+	})
+}
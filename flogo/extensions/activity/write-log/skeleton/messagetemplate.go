@@ -0,0 +1,96 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// messageTemplateField holds the raw template of an interpolated message
+const messageTemplateField = "message_template"
+
+// applyMessageTemplate resolves {field} placeholders in the message from the entry's
+// fields. It runs after filtering and masking, so masked values stay masked. The raw
+// template is kept in message_template, so backends can group entries by pattern.
+func applyMessageTemplate(entry map[string]interface{}) map[string]interface{} {
+	template, ok := entry["message"].(string)
+	if !ok || !strings.ContainsAny(template, "{}") {
+		return entry
+	}
+
+	// A message without placeholders is not a template, so its braces are literal
+	message, isTemplate := renderMessageTemplate(template, entry)
+	if !isTemplate {
+		return entry
+	}
+
+	entry["message"] = message
+	entry[messageTemplateField] = template
+	return entry
+}
+
+// renderMessageTemplate replaces each {path} with the value of the field at the dotted
+// path. Placeholders for missing fields are kept as written, and {{ and }} stand for
+// literal braces. The boolean result reports whether the text has any placeholder.
+func renderMessageTemplate(template string, fields map[string]interface{}) (string, bool) {
+	var b strings.Builder
+	isTemplate := false
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if (c == '{' || c == '}') && i+1 < len(template) && template[i+1] == c {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if c != '{' {
+			b.WriteByte(c)
+			continue
+		}
+
+		end := strings.IndexByte(template[i+1:], '}')
+		if end < 0 || !isPlaceholderPath(template[i+1:i+1+end]) {
+			b.WriteByte(c)
+			continue
+		}
+		path := template[i+1 : i+1+end]
+		isTemplate = true
+		if value, ok := lookupField(fields, path); ok {
+			b.WriteString(templateValue(value))
+		} else {
+			b.WriteString("{" + path + "}")
+		}
+		i += end + 1
+	}
+	return b.String(), isTemplate
+}
+
+// isPlaceholderPath reports whether text is a field path such as customer.name or
+// error.code, so JSON and other braces in messages are left alone
+func isPlaceholderPath(text string) bool {
+	if text == "" || text[0] == '.' || text[len(text)-1] == '.' || strings.Contains(text, "..") {
+		return false
+	}
+	for _, r := range text {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '.', r == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// templateValue formats a field value for a message: strings as they are, other values
+// as JSON
+func templateValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,89 @@
+package writelog
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMessageTemplate(t *testing.T) {
+	fields := map[string]interface{}{
+		"orderId":  "A-1001",
+		"customer": map[string]interface{}{"name": "Jane Doe"},
+		"error":    map[string]interface{}{"code": "E42"},
+		"amount":   1250.5,
+		"items":    []interface{}{"sku-1", "sku-2"},
+		"retry":    true,
+	}
+
+	tests := []struct {
+		name       string
+		template   string
+		expected   string
+		isTemplate bool
+	}{
+		{"Nested fields", "Order {orderId} for {customer.name} failed: {error.code}", "Order A-1001 for Jane Doe failed: E42", true},
+		{"Non-string values", "{amount} EUR, items {items}, retry={retry}", `1250.5 EUR, items ["sku-1","sku-2"], retry=true`, true},
+		{"Missing fields are kept", "Order {orderId} shipped to {address.city}", "Order A-1001 shipped to {address.city}", true},
+		{"Escaped braces", "{{orderId}} is {orderId}", "{orderId} is A-1001", true},
+		{"JSON is not a placeholder", `payload {"orderId": 1}`, `payload {"orderId": 1}`, false},
+		{"Unclosed brace", "Order {orderId", "Order {orderId", false},
+		{"Plain text", "no placeholders", "no placeholders", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, isTemplate := renderMessageTemplate(tt.template, fields)
+			assert.Equal(t, tt.expected, message)
+			assert.Equal(t, tt.isTemplate, isTemplate)
+		})
+	}
+}
+
+func TestActivity_MessageTemplate(t *testing.T) {
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"piiDetection": map[string]interface{}{"detectors": []interface{}{"email"}},
+	}, nil))
+	require.NoError(t, err)
+	a := act.(*Activity)
+
+	logObject := map[string]interface{}{
+		"message":  "Payment by {customer.email} with card {card} failed: {error.code}",
+		"customer": map[string]interface{}{"email": "jane@example.com"},
+		"card":     "4111-1111-1111-1234",
+		"error":    map[string]interface{}{"code": "CARD_DECLINED"},
+	}
+	sensitiveFields := map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"fields": []interface{}{"card"}, "strategy": "last-n", "keep": 4},
+		},
+	}
+
+	entry := a.createMainLogEntry(logObject, "ERROR", sensitiveFields, nil)
+	assert.Equal(t, "Payment by [REDACTED:email] with card ***1234 failed: CARD_DECLINED", entry["message"], "values are resolved after masking")
+	assert.Equal(t, logObject["message"], entry[messageTemplateField])
+
+	t.Run("Filtered fields are not resolved", func(t *testing.T) {
+		entry := a.createMainLogEntry(logObject, "ERROR", nil, map[string]interface{}{"exclude": []interface{}{"card"}})
+		assert.Contains(t, entry["message"], "with card {card} failed")
+	})
+
+	t.Run("String log objects are not templates", func(t *testing.T) {
+		entry := a.createMainLogEntry("Processing {batch}", "INFO", nil, nil)
+		assert.Equal(t, "Processing {batch}", entry["message"])
+		assert.NotContains(t, entry, messageTemplateField)
+	})
+
+	t.Run("Messages without placeholders are unchanged", func(t *testing.T) {
+		entry := a.createMainLogEntry(map[string]interface{}{"message": "done"}, "INFO", nil, nil)
+		assert.NotContains(t, entry, messageTemplateField)
+
+		entry = a.createMainLogEntry(map[string]interface{}{"message": "use {{name}} syntax"}, "INFO", nil, nil)
+		assert.Equal(t, "use {{name}} syntax", entry["message"], "braces are only unescaped in templates")
+		assert.NotContains(t, entry, messageTemplateField)
+	})
+}
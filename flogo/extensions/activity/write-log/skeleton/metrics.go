@@ -0,0 +1,444 @@
+package writelog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+const (
+	defaultMetricMaxSeries = 100
+	metricsPath            = "/metrics"
+	metricOverflowValue    = "other"
+	metricMaxLabelLength   = 128
+	metricLabelLevel       = "level"
+	metricLabelFlow        = "flow"
+	metricKindCounter      = "counter"
+	metricKindHistogram    = "histogram"
+)
+
+// defaultMetricBuckets are the Prometheus client default histogram buckets
+var defaultMetricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	metricNamePattern      = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	metricLabelNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// MetricsConfig configures the counters and histograms derived from log entries in the
+// metrics setting
+type MetricsConfig struct {
+	Address    string         `json:"address,omitempty"`    // Prometheus endpoint, e.g. 127.0.0.1:9464
+	MaxSeries  int            `json:"maxSeries,omitempty"`  // Label value combinations kept per metric (default: 100)
+	Counters   []MetricConfig `json:"counters,omitempty"`   // Counters incremented once per entry
+	Histograms []MetricConfig `json:"histograms,omitempty"` // Histograms observing a numeric field
+}
+
+// MetricConfig configures one derived metric
+type MetricConfig struct {
+	Name    string    `json:"name"`
+	Help    string    `json:"help,omitempty"`
+	Labels  []string  `json:"labels,omitempty"`  // "level", "flow" or a field path such as error.code
+	Levels  []string  `json:"levels,omitempty"`  // Levels counted; empty counts every level
+	Field   string    `json:"field,omitempty"`   // Histograms only: the field path observed
+	Buckets []float64 `json:"buckets,omitempty"` // Histograms only: upper bounds (default: Prometheus defaults)
+}
+
+// parseMetricsConfig reads the metrics setting. It returns nil when no metric is defined.
+func parseMetricsConfig(setting interface{}) (*MetricsConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+
+	config := &MetricsConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid metrics setting: %w", err)
+	}
+	if config.MaxSeries < 0 {
+		return nil, fmt.Errorf("metrics maxSeries must not be negative")
+	}
+	if config.MaxSeries == 0 {
+		config.MaxSeries = defaultMetricMaxSeries
+	}
+
+	for _, c := range config.Counters {
+		if c.Field != "" || len(c.Buckets) > 0 {
+			return nil, fmt.Errorf("counter %s: field and buckets apply to histograms only", c.Name)
+		}
+	}
+	for i := range config.Histograms {
+		h := &config.Histograms[i]
+		if strings.TrimSpace(h.Field) == "" {
+			return nil, fmt.Errorf("histogram %s requires a field", h.Name)
+		}
+		if len(h.Buckets) == 0 {
+			h.Buckets = defaultMetricBuckets
+		}
+		for j, b := range h.Buckets {
+			if math.IsNaN(b) || math.IsInf(b, 0) || (j > 0 && b <= h.Buckets[j-1]) {
+				return nil, fmt.Errorf("histogram %s buckets must be finite and increasing", h.Name)
+			}
+		}
+	}
+
+	if len(config.Counters) == 0 && len(config.Histograms) == 0 {
+		if config.Address != "" {
+			return nil, fmt.Errorf("metrics address requires at least one counter or histogram")
+		}
+		return nil, nil
+	}
+	return config, nil
+}
+
+// metricLabel is one label of a derived metric and where its value comes from
+type metricLabel struct {
+	name   string
+	source string // "level", "flow" or a field path
+}
+
+// metricSeries holds the values of one label combination
+type metricSeries struct {
+	labels  []string
+	count   uint64   // Counter value, or the number of observations
+	sum     float64  // Histograms only
+	buckets []uint64 // Histograms only: observations per bucket, not cumulative
+}
+
+// derivedMetric is a counter or histogram shared by every activity defining it
+type derivedMetric struct {
+	name      string
+	help      string
+	kind      string
+	labels    []metricLabel
+	field     string
+	buckets   []float64
+	maxSeries int
+	logger    log.Logger
+
+	mu       sync.Mutex
+	series   map[string]*metricSeries
+	overflow bool
+}
+
+// derivedMetrics holds the metrics of the process by name
+var derivedMetrics = struct {
+	sync.Mutex
+	byName map[string]*derivedMetric
+}{byName: make(map[string]*derivedMetric)}
+
+// acquireMetric returns the metric with the config's name, creating it on first use. A
+// name can only be reused with the same type, labels, field and buckets.
+func acquireMetric(kind string, config MetricConfig, maxSeries int, logger log.Logger) (*derivedMetric, error) {
+	if !metricNamePattern.MatchString(config.Name) {
+		return nil, fmt.Errorf("invalid metric name '%s'", config.Name)
+	}
+
+	labels := make([]metricLabel, 0, len(config.Labels))
+	seen := make(map[string]bool)
+	for _, source := range config.Labels {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			return nil, fmt.Errorf("metric %s: label must not be empty", config.Name)
+		}
+		name := metricLabelNameInvalid.ReplaceAllString(source, "_")
+		if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		if seen[name] || (kind == metricKindHistogram && name == "le") || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("metric %s: invalid or duplicate label '%s'", config.Name, name)
+		}
+		seen[name] = true
+		labels = append(labels, metricLabel{name: name, source: source})
+	}
+
+	m := &derivedMetric{
+		name:      config.Name,
+		help:      config.Help,
+		kind:      kind,
+		labels:    labels,
+		field:     config.Field,
+		buckets:   config.Buckets,
+		maxSeries: maxSeries,
+		logger:    logger,
+		series:    make(map[string]*metricSeries),
+	}
+
+	derivedMetrics.Lock()
+	defer derivedMetrics.Unlock()
+	if existing, ok := derivedMetrics.byName[m.name]; ok {
+		if existing.signature() != m.signature() {
+			return nil, fmt.Errorf("metric %s is already defined with a different type, labels, field or buckets", m.name)
+		}
+		return existing, nil
+	}
+	derivedMetrics.byName[m.name] = m
+	return m, nil
+}
+
+// signature identifies the definition of a metric, apart from its help text
+func (m *derivedMetric) signature() string {
+	return fmt.Sprintf("%s|%v|%s|%v", m.kind, m.labels, m.field, m.buckets)
+}
+
+// observe adds an entry to the metric
+func (m *derivedMetric) observe(rec *Record, flow string) {
+	value := 0.0
+	if m.kind == metricKindHistogram {
+		v, ok := lookupField(rec.Entry, m.field)
+		if !ok {
+			return
+		}
+		if value, ok = toNumber(v); !ok || math.IsNaN(value) {
+			return
+		}
+	}
+
+	values := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		values[i] = metricLabelValue(label.source, rec, flow)
+	}
+	key := strings.Join(values, "\x00")
+
+	m.mu.Lock()
+	s, ok := m.series[key]
+	if !ok {
+		if len(m.series) >= m.maxSeries {
+			// Further combinations share one series, so cardinality stays bounded
+			for i := range values {
+				values[i] = metricOverflowValue
+			}
+			key = strings.Join(values, "\x00")
+			if !m.overflow {
+				m.overflow = true
+				m.logger.Warnf("Metric %s reached %d label combinations; further values are counted as '%s'", m.name, m.maxSeries, metricOverflowValue)
+			}
+		}
+		if s, ok = m.series[key]; !ok {
+			s = &metricSeries{labels: values}
+			if m.kind == metricKindHistogram {
+				s.buckets = make([]uint64, len(m.buckets))
+			}
+			m.series[key] = s
+		}
+	}
+
+	s.count++
+	if m.kind == metricKindHistogram {
+		s.sum += value
+		if i := sort.SearchFloat64s(m.buckets, value); i < len(m.buckets) {
+			s.buckets[i]++
+		}
+	}
+	m.mu.Unlock()
+}
+
+// metricLabelValue returns the value of a label for an entry. Missing fields give an
+// empty value, which Prometheus treats as an absent label.
+func metricLabelValue(source string, rec *Record, flow string) string {
+	var value string
+	switch source {
+	case metricLabelLevel:
+		value = rec.Level
+	case metricLabelFlow:
+		value = flow
+	default:
+		if v, ok := lookupField(rec.Entry, source); ok && v != nil {
+			value = templateValue(v)
+		}
+	}
+	if len(value) > metricMaxLabelLength {
+		value = truncateString(value, metricMaxLabelLength)
+	}
+	return value
+}
+
+// write writes the metric in the Prometheus text format
+func (m *derivedMetric) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(m.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind == metricKindCounter {
+			fmt.Fprintf(w, "%s%s %d\n", m.name, m.formatLabels(s.labels, ""), s.count)
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.formatLabels(s.labels, formatMetricFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.formatLabels(s.labels, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.formatLabels(s.labels, ""), formatMetricFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.formatLabels(s.labels, ""), s.count)
+	}
+}
+
+// formatLabels formats a label set, with the le label of a histogram bucket when set
+func (m *derivedMetric) formatLabels(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(values)+1)
+	for i, label := range m.labels {
+		parts = append(parts, label.name+`="`+escaper.Replace(values[i])+`"`)
+	}
+	if le != "" {
+		parts = append(parts, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteMetrics writes every derived metric in the Prometheus text exposition format
+func WriteMetrics(w io.Writer) error {
+	derivedMetrics.Lock()
+	metrics := make([]*derivedMetric, 0, len(derivedMetrics.byName))
+	for _, m := range derivedMetrics.byName {
+		metrics = append(metrics, m)
+	}
+	derivedMetrics.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler serves the derived metrics for Prometheus, for applications that expose
+// them on their own HTTP server
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteMetrics(w)
+	})
+}
+
+// metricsRecorder updates the metrics of one activity
+type metricsRecorder struct {
+	metrics []*derivedMetric
+	levels  []map[string]bool // Levels counted by each metric; nil counts every level
+}
+
+func newMetricsRecorder(config *MetricsConfig, logger log.Logger) (*metricsRecorder, error) {
+	r := &metricsRecorder{}
+	add := func(kind string, configs []MetricConfig) error {
+		for _, c := range configs {
+			m, err := acquireMetric(kind, c, config.MaxSeries, logger)
+			if err != nil {
+				return err
+			}
+			var levels map[string]bool
+			if len(c.Levels) > 0 {
+				levels = make(map[string]bool, len(c.Levels))
+				for _, level := range c.Levels {
+					levels[strings.ToUpper(level)] = true
+				}
+			}
+			r.metrics = append(r.metrics, m)
+			r.levels = append(r.levels, levels)
+		}
+		return nil
+	}
+	if err := add(metricKindCounter, config.Counters); err != nil {
+		return nil, err
+	}
+	if err := add(metricKindHistogram, config.Histograms); err != nil {
+		return nil, err
+	}
+
+	if config.Address != "" {
+		if err := startMetricsEndpoint(config.Address, logger); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// observe updates the metrics for a log entry
+func (r *metricsRecorder) observe(rec *Record, flow string) {
+	for i, m := range r.metrics {
+		if r.levels[i] == nil || r.levels[i][rec.Level] {
+			m.observe(rec, flow)
+		}
+	}
+}
+
+// metricsEndpoints holds the running Prometheus endpoints by address
+var metricsEndpoints = struct {
+	sync.Mutex
+	byAddress map[string]*http.Server
+}{byAddress: make(map[string]*http.Server)}
+
+// startMetricsEndpoint serves the metrics on the address, unless it is served already
+func startMetricsEndpoint(address string, logger log.Logger) error {
+	metricsEndpoints.Lock()
+	defer metricsEndpoints.Unlock()
+	if _, exists := metricsEndpoints.byAddress[address]; exists {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics endpoint: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, MetricsHandler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Metrics endpoint stopped: %v", err)
+		}
+	}()
+	metricsEndpoints.byAddress[address] = server
+	logger.Infof("Metrics endpoint listening on %s%s", listener.Addr(), metricsPath)
+
+	registerShutdownHook()
+	return nil
+}
+
+// stopMetricsEndpoints closes the Prometheus endpoints. The metrics keep their values.
+func stopMetricsEndpoints() {
+	metricsEndpoints.Lock()
+	servers := metricsEndpoints.byAddress
+	metricsEndpoints.byAddress = make(map[string]*http.Server)
+	metricsEndpoints.Unlock()
+
+	for _, server := range servers {
+		_ = server.Close()
+	}
+}
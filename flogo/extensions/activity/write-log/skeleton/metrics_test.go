@@ -0,0 +1,199 @@
+package writelog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uniqueMetric returns a metric name not used by other tests, as metrics are process-wide
+func uniqueMetric(name string) string {
+	return fmt.Sprintf("%s_%d", name, memorySinkSeq.Add(1))
+}
+
+// metricsOutput returns the exposition lines of the named metrics
+func metricsOutput(t *testing.T, names ...string) string {
+	var b strings.Builder
+	require.NoError(t, WriteMetrics(&b))
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		for _, name := range names {
+			if strings.HasPrefix(line, name+"{") || strings.HasPrefix(line, name+"_") || strings.HasPrefix(line, name+" ") || strings.Contains(line, " "+name+" ") {
+				lines = append(lines, line)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newMetricsActivity(t *testing.T, metrics map[string]interface{}, extra map[string]interface{}) (*Activity, *memorySink) {
+	sinkType, mem := registerMemorySink(t)
+	settings := map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"sinks":        `[{"type":"` + sinkType + `"}]`,
+		"metrics":      metrics,
+	}
+	for k, v := range extra {
+		settings[k] = v
+	}
+	act, err := New(test.NewActivityInitContext(settings, nil))
+	require.NoError(t, err)
+	return act.(*Activity), mem
+}
+
+func TestParseMetricsConfig(t *testing.T) {
+	config, err := parseMetricsConfig(`{"histograms": [{"name": "payment_amount", "field": "amount"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, defaultMetricMaxSeries, config.MaxSeries)
+	assert.Equal(t, defaultMetricBuckets, config.Histograms[0].Buckets)
+
+	for _, empty := range []interface{}{nil, "", "{}"} {
+		config, err := parseMetricsConfig(empty)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", empty)
+	}
+
+	for _, invalid := range []string{
+		`{"address": "127.0.0.1:9464"}`,
+		`{"maxSeries": -1, "counters": [{"name": "a"}]}`,
+		`{"counters": [{"name": "a", "field": "amount"}]}`,
+		`{"histograms": [{"name": "h"}]}`,
+		`{"histograms": [{"name": "h", "field": "x", "buckets": [1, 1]}]}`,
+	} {
+		_, err := parseMetricsConfig(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestActivity_DerivedMetrics(t *testing.T) {
+	entries := uniqueMetric("log_entries_total")
+	errorsByCode := uniqueMetric("log_errors_total")
+	amounts := uniqueMetric("payment_amount")
+
+	act, mem := newMetricsActivity(t, map[string]interface{}{
+		"counters": []interface{}{
+			map[string]interface{}{"name": entries, "help": "Log entries by level", "labels": []interface{}{"level"}},
+			map[string]interface{}{"name": errorsByCode, "labels": []interface{}{"flow", "error.code"}, "levels": []interface{}{"error"}},
+		},
+		"histograms": []interface{}{
+			map[string]interface{}{"name": amounts, "field": "amount", "buckets": []interface{}{10, 100}},
+		},
+	}, nil)
+
+	evalMessage(t, act, "INFO", map[string]interface{}{"message": "paid", "amount": 5})
+	evalMessage(t, act, "INFO", map[string]interface{}{"message": "paid", "amount": 50.5})
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "declined", "amount": 500, "error": map[string]interface{}{"code": "CARD_DECLINED"}})
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "timeout", "error": map[string]interface{}{"code": `say "hi"`}})
+	evalMessage(t, act, "WARN", map[string]interface{}{"message": "slow", "amount": "n/a"})
+	assert.Len(t, mem.records, 5)
+
+	assert.Equal(t, `# HELP `+entries+` Log entries by level
+# TYPE `+entries+` counter
+`+entries+`{level="ERROR"} 2
+`+entries+`{level="INFO"} 2
+`+entries+`{level="WARN"} 1`, metricsOutput(t, entries))
+
+	assert.Equal(t, `# TYPE `+errorsByCode+` counter
+`+errorsByCode+`{flow="",error_code="CARD_DECLINED"} 1
+`+errorsByCode+`{flow="",error_code="say \"hi\""} 1`, metricsOutput(t, errorsByCode))
+
+	assert.Equal(t, `# TYPE `+amounts+` histogram
+`+amounts+`_bucket{le="10"} 1
+`+amounts+`_bucket{le="100"} 2
+`+amounts+`_bucket{le="+Inf"} 3
+`+amounts+`_sum 555.5
+`+amounts+`_count 3`, metricsOutput(t, amounts), "entries without a numeric field are not observed")
+
+	t.Run("Flow label", func(t *testing.T) {
+		tc := newNamedFlowContext(act.Metadata(), "OrderFlow")
+		tc.SetInput("logObject", map[string]interface{}{"message": "failed", "error": map[string]interface{}{"code": "E1"}})
+		tc.SetInput("logLevel", "ERROR")
+		_, err := act.Eval(tc)
+		require.NoError(t, err)
+		assert.Contains(t, metricsOutput(t, errorsByCode), errorsByCode+`{flow="OrderFlow",error_code="E1"} 1`)
+	})
+
+	t.Run("Shared between activities", func(t *testing.T) {
+		other, _ := newMetricsActivity(t, map[string]interface{}{
+			"counters": []interface{}{map[string]interface{}{"name": entries, "labels": []interface{}{"level"}, "levels": []interface{}{"DEBUG"}}},
+		}, nil)
+		evalMessage(t, other, "DEBUG", "one")
+		evalMessage(t, other, "INFO", "not counted by this activity")
+		assert.Contains(t, metricsOutput(t, entries), entries+`{level="DEBUG"} 1`)
+		assert.Contains(t, metricsOutput(t, entries), entries+`{level="INFO"} 2`)
+
+		_, err := New(test.NewActivityInitContext(map[string]interface{}{
+			"logLevel":     "INFO",
+			"outputFormat": "JSON",
+			"metrics":      map[string]interface{}{"counters": []interface{}{map[string]interface{}{"name": entries, "labels": []interface{}{"flow"}}}},
+		}, nil))
+		assert.Error(t, err, "a metric name has one definition")
+	})
+}
+
+func TestDerivedMetrics_Cardinality(t *testing.T) {
+	name := uniqueMetric("order_failures_total")
+	act, _ := newMetricsActivity(t, map[string]interface{}{
+		"maxSeries": 2,
+		"counters":  []interface{}{map[string]interface{}{"name": name, "labels": []interface{}{"orderId"}}},
+	}, nil)
+
+	for i := 1; i <= 5; i++ {
+		evalMessage(t, act, "ERROR", map[string]interface{}{"message": "failed", "orderId": fmt.Sprintf("A-%d", i)})
+	}
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "failed", "orderId": "A-1"})
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "failed", "orderId": strings.Repeat("x", 500)})
+
+	assert.Equal(t, `# TYPE `+name+` counter
+`+name+`{orderId="A-1"} 2
+`+name+`{orderId="A-2"} 1
+`+name+`{orderId="other"} 4`, metricsOutput(t, name))
+}
+
+func TestDerivedMetrics_CountThrottledEntries(t *testing.T) {
+	name := uniqueMetric("debug_entries_total")
+	act, mem := newMetricsActivity(t, map[string]interface{}{
+		"counters": []interface{}{map[string]interface{}{"name": name}},
+	}, map[string]interface{}{"throttle": `{"sampling": {"DEBUG": 0}}`})
+
+	for i := 0; i < 3; i++ {
+		evalMessage(t, act, "DEBUG", "sampled out")
+	}
+	assert.Empty(t, mem.records)
+	assert.Equal(t, "# TYPE "+name+" counter\n"+name+" 3", metricsOutput(t, name))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	name := uniqueMetric("endpoint_entries_total")
+	act, _ := newMetricsActivity(t, map[string]interface{}{
+		"counters": []interface{}{map[string]interface{}{"name": name}},
+	}, nil)
+	evalMessage(t, act, "INFO", "hello")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), name+" 1\n")
+
+	rec = httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, metricsPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	require.NoError(t, startMetricsEndpoint("127.0.0.1:0", log.RootLogger()))
+	require.NoError(t, startMetricsEndpoint("127.0.0.1:0", log.RootLogger()), "an address is served once")
+	metricsEndpoints.Lock()
+	assert.Len(t, metricsEndpoints.byAddress, 1)
+	metricsEndpoints.Unlock()
+	stopMetricsEndpoints()
+}
@@ -0,0 +1,409 @@
+package writelog
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Detector finds sensitive substrings in free text, independent of the field they appear in
+type Detector struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool // Optional check applied to every regex match (e.g. Luhn)
+}
+
+// Built-in detector names
+const (
+	DetectorCreditCard   = "creditCard"
+	DetectorEmail        = "email"
+	DetectorPhone        = "phone"
+	DetectorIBAN         = "iban"
+	DetectorNationalID   = "nationalId"
+	DetectorJWT          = "jwt"
+	DetectorAWSAccessKey = "awsAccessKey"
+)
+
+// builtinDetectorOrder is the order in which built-in detectors run. More specific
+// detectors run first so that, for example, card numbers are not reported as phone numbers.
+var builtinDetectorOrder = []string{
+	DetectorJWT,
+	DetectorAWSAccessKey,
+	DetectorEmail,
+	DetectorIBAN,
+	DetectorCreditCard,
+	DetectorNationalID,
+	DetectorPhone,
+}
+
+var (
+	detectorMu       sync.RWMutex
+	detectorRegistry = map[string]*Detector{
+		DetectorJWT: {
+			Name:    DetectorJWT,
+			Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		},
+		DetectorAWSAccessKey: {
+			Name:    DetectorAWSAccessKey,
+			Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z0-9]{16}\b`),
+		},
+		DetectorEmail: {
+			Name:    DetectorEmail,
+			Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		},
+		DetectorIBAN: {
+			Name:     DetectorIBAN,
+			Pattern:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+			Validate: validIBAN,
+		},
+		DetectorCreditCard: {
+			Name:     DetectorCreditCard,
+			Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			Validate: validLuhn,
+		},
+		DetectorNationalID: {
+			Name: DetectorNationalID,
+			// US SSN (123-45-6789) and UK National Insurance number (AB 12 34 56 C)
+			Pattern:  regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b|\b[A-CEGHJ-PR-TW-Z]{2} ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`),
+			Validate: validNationalID,
+		},
+		DetectorPhone: {
+			Name: DetectorPhone,
+			// International numbers with a leading "+" and North American style (555) 123-4567
+			Pattern:  regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)|\d{1,4})(?:[ .-]?\d{2,4}){2,4}\b|(?:\(\d{3}\)\s?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b`),
+			Validate: validPhone,
+		},
+	}
+)
+
+// RegisterDetector registers an additional content detector that activities can enable by name
+// in the piiDetection setting. validate may be nil.
+func RegisterDetector(name, pattern string, validate func(match string) bool) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("detector name cannot be empty")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern for detector '%s': %w", name, err)
+	}
+
+	detectorMu.Lock()
+	defer detectorMu.Unlock()
+
+	if _, exists := detectorRegistry[name]; exists {
+		return fmt.Errorf("detector '%s' is already registered", name)
+	}
+	detectorRegistry[name] = &Detector{Name: name, Pattern: re, Validate: validate}
+
+	return nil
+}
+
+// getDetector returns a registered detector by name
+func getDetector(name string) (*Detector, bool) {
+	detectorMu.RLock()
+	defer detectorMu.RUnlock()
+
+	d, ok := detectorRegistry[name]
+	return d, ok
+}
+
+// PIIDetectionConfig represents the piiDetection setting
+type PIIDetectionConfig struct {
+	Detectors       []string               `json:"detectors"`       // Detector names to enable; empty or "all" enables every built-in detector
+	CustomDetectors []CustomDetectorConfig `json:"customDetectors"` // Extra regex detectors for this activity
+	MaskWith        string                 `json:"maskWith"`        // Replacement for matches (default: "[REDACTED:<detector>]")
+	Strategy        string                 `json:"strategy"`        // Default masking strategy for matches (default: full)
+	Keep            int                    `json:"keep"`            // Characters kept by the default strategy
+	Rules           []DetectorMaskRule     `json:"rules"`           // Per-detector masking strategies
+	SkipFields      []string               `json:"skipFields"`      // Field paths that are never scanned
+}
+
+// CustomDetectorConfig defines a regex detector in the piiDetection setting
+type CustomDetectorConfig struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// piiScanner holds the compiled content detectors for an activity
+type piiScanner struct {
+	detectors  []*Detector
+	strategy   maskStrategy
+	strategies map[string]maskStrategy
+	skipFields []*fieldPath
+}
+
+// newPIIScanner builds the content scanner from the piiDetection setting
+func newPIIScanner(setting interface{}, maskingKey []byte) (*piiScanner, error) {
+	if setting == nil {
+		return nil, nil
+	}
+	if str, ok := setting.(string); ok && strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+
+	var config PIIDetectionConfig
+	if err := decodeJSONConfig(setting, &config); err != nil {
+		return nil, fmt.Errorf("invalid piiDetection setting: %w", err)
+	}
+
+	scanner := &piiScanner{strategies: make(map[string]maskStrategy)}
+
+	strategy, err := MaskStrategyConfig{Strategy: config.Strategy, Keep: config.Keep, MaskWith: config.MaskWith}.compile("", maskingKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid piiDetection strategy: %w", err)
+	}
+	scanner.strategy = strategy
+
+	names := config.Detectors
+	if len(names) == 0 && len(config.CustomDetectors) == 0 {
+		names = []string{"all"}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if strings.EqualFold(name, "all") {
+			for _, builtin := range builtinDetectorOrder {
+				if !seen[builtin] {
+					d, _ := getDetector(builtin)
+					scanner.detectors = append(scanner.detectors, d)
+					seen[builtin] = true
+				}
+			}
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		d, ok := getDetector(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown PII detector '%s' (available: %s)", name, strings.Join(registeredDetectorNames(), ", "))
+		}
+		scanner.detectors = append(scanner.detectors, d)
+		seen[name] = true
+	}
+
+	// Keep built-in detectors in their intended precedence order
+	sort.SliceStable(scanner.detectors, func(i, j int) bool {
+		return detectorRank(scanner.detectors[i].Name) < detectorRank(scanner.detectors[j].Name)
+	})
+
+	for _, custom := range config.CustomDetectors {
+		if custom.Name == "" || custom.Pattern == "" {
+			return nil, fmt.Errorf("custom detector requires both name and pattern")
+		}
+		re, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for custom detector '%s': %w", custom.Name, err)
+		}
+		scanner.detectors = append(scanner.detectors, &Detector{Name: custom.Name, Pattern: re})
+	}
+
+	for _, rule := range config.Rules {
+		if len(rule.Detectors) == 0 {
+			return nil, fmt.Errorf("piiDetection rule with strategy '%s' has no detectors", rule.Strategy)
+		}
+		strategy, err := rule.MaskStrategyConfig.compile("", maskingKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid piiDetection rule for %v: %w", rule.Detectors, err)
+		}
+		for _, name := range rule.Detectors {
+			if !scanner.hasDetector(name) {
+				return nil, fmt.Errorf("piiDetection rule refers to detector '%s', which is not enabled", name)
+			}
+			scanner.strategies[name] = strategy
+		}
+	}
+
+	for _, raw := range config.SkipFields {
+		p, err := parseFieldPath(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid piiDetection skipFields entry: %w", err)
+		}
+		scanner.skipFields = append(scanner.skipFields, p)
+	}
+
+	return scanner, nil
+}
+
+// detectorRank orders built-in detectors first, in builtinDetectorOrder, followed by registered ones
+func detectorRank(name string) int {
+	for i, builtin := range builtinDetectorOrder {
+		if builtin == name {
+			return i
+		}
+	}
+	return len(builtinDetectorOrder)
+}
+
+// registeredDetectorNames lists all registered detector names, sorted
+func registeredDetectorNames() []string {
+	detectorMu.RLock()
+	defer detectorMu.RUnlock()
+
+	names := make([]string, 0, len(detectorRegistry))
+	for name := range detectorRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scanString masks every detected substring in s
+func (s *piiScanner) scanString(text string) string {
+	for _, d := range s.detectors {
+		text = d.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.Validate != nil && !d.Validate(match) {
+				return match
+			}
+			return s.replacement(d, match)
+		})
+	}
+	return text
+}
+
+// replacement returns the mask for a match found by the given detector
+func (s *piiScanner) replacement(d *Detector, match string) string {
+	strategy, ok := s.strategies[d.Name]
+	if !ok {
+		strategy = s.strategy
+	}
+	if strategy.maskWith == "" {
+		strategy.maskWith = "[REDACTED:" + d.Name + "]"
+	}
+	return strategy.applyString(match)
+}
+
+// hasDetector reports whether a detector is enabled in the scanner
+func (s *piiScanner) hasDetector(name string) bool {
+	for _, d := range s.detectors {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPIIDetection scans string values anywhere in the entry and masks detected PII.
+// System fields added by the activity are not scanned.
+func (a *Activity) applyPIIDetection(entry map[string]interface{}) map[string]interface{} {
+	if a.piiScanner == nil || len(a.piiScanner.detectors) == 0 {
+		return entry
+	}
+
+	systemFields := make(map[string]bool)
+	for _, f := range append(a.getSystemFields(), "ecs", "log", "labels") {
+		systemFields[f] = true
+	}
+	systemFields["level"] = true
+
+	scanned, _ := rewriteTree(entry, nil, func(path []pathStep, value interface{}) (interface{}, treeAction) {
+		if len(path) == 1 && systemFields[path[0].key] {
+			return value, treeReplace
+		}
+		if anyPathMatches(a.piiScanner.skipFields, path) {
+			return value, treeReplace
+		}
+
+		switch v := value.(type) {
+		case string:
+			if masked := a.piiScanner.scanString(v); masked != v {
+				return masked, treeReplace
+			}
+			return v, treeReplace
+		case []string:
+			out := make([]string, len(v))
+			for i, item := range v {
+				out[i] = a.piiScanner.scanString(item)
+			}
+			return out, treeReplace
+		}
+		return value, treeDescend
+	})
+
+	return scanned.(map[string]interface{})
+}
+
+// validLuhn validates a card number candidate with the Luhn checksum
+func validLuhn(candidate string) bool {
+	digits := onlyDigits(candidate)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN validates an IBAN candidate with the ISO 13616 mod-97 check
+func validIBAN(candidate string) bool {
+	iban := strings.ReplaceAll(candidate, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case unicode.IsDigit(r):
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			numeric.WriteString(fmt.Sprintf("%d", r-'A'+10))
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validNationalID rejects SSN candidates that can never be issued
+func validNationalID(candidate string) bool {
+	if !strings.Contains(candidate, "-") {
+		return true // UK NINO, pattern is specific enough
+	}
+	parts := strings.Split(candidate, "-")
+	area, group, serial := parts[0], parts[1], parts[2]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
+
+// validPhone checks that a phone number candidate has a plausible number of digits
+func validPhone(candidate string) bool {
+	n := len(onlyDigits(candidate))
+	return n >= 7 && n <= 15
+}
+
+// onlyDigits strips every non-digit character
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,319 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/engine"
+	"github.com/project-flogo/core/support/log"
+)
+
+// Record is a single log entry handed to sinks
+type Record struct {
+	Time  time.Time              // Time the entry was created
+	Level string                 // Effective log level (TRACE, DEBUG, INFO, WARN, ERROR, FATAL)
+	Entry map[string]interface{} // Structured entry after filtering and masking
+	Line  string                 // Entry rendered in the activity's output format, including any flow suffix
+
+	TraceID string // Trace ID from the flow's tracing context, if any
+	SpanID  string // Span ID from the flow's tracing context, if any
+}
+
+// Sink writes log records to a destination
+type Sink interface {
+	Write(rec *Record) error
+	Flush() error
+	Close() error
+}
+
+// SinkFactory creates a sink from its configuration
+type SinkFactory func(config SinkConfig, logger log.Logger) (Sink, error)
+
+// Sink types
+const (
+	SinkEngine        = "engine"
+	SinkFile          = "file"
+	SinkSyslog        = "syslog"
+	SinkElasticsearch = "elasticsearch"
+	SinkLoki          = "loki"
+	SinkSplunk        = "splunk"
+	SinkOTLP          = "otlp"
+)
+
+// SinkConfig configures one sink in the sinks setting. Only the fields relevant to the
+// sink type are used.
+type SinkConfig struct {
+	Type string `json:"type"`
+
+	// File sink
+	Path        string  `json:"path,omitempty"`
+	MaxSizeMB   float64 `json:"maxSizeMB,omitempty"`   // Rotate when the file would exceed this size
+	RotateEvery string  `json:"rotateEvery,omitempty"` // Rotate after this duration, e.g. "24h"
+	MaxBackups  int     `json:"maxBackups,omitempty"`  // Rotated files to keep (0 = unlimited)
+	MaxAge      string  `json:"maxAge,omitempty"`      // Delete rotated files older than this, e.g. "168h"
+	Compress    bool    `json:"compress,omitempty"`    // Gzip rotated files
+
+	// Syslog sink
+	Network  string `json:"network,omitempty"`  // udp, tcp or tls
+	Address  string `json:"address,omitempty"`  // host:port
+	Facility string `json:"facility,omitempty"` // e.g. local0 (default: user)
+	AppName  string `json:"appName,omitempty"`
+
+	// TLS for syslog and HTTP sinks
+	CAFile             string `json:"caFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+
+	// HTTP bulk sinks
+	URL           string            `json:"url,omitempty"`
+	Index         string            `json:"index,omitempty"`      // Elasticsearch index or Splunk index
+	Token         string            `json:"token,omitempty"`      // Splunk HEC token
+	APIKey        string            `json:"apiKey,omitempty"`     // Elasticsearch API key
+	Username      string            `json:"username,omitempty"`   // Basic auth user
+	Password      string            `json:"password,omitempty"`   // Basic auth password
+	Labels        map[string]string `json:"labels,omitempty"`     // Loki stream labels
+	Source        string            `json:"source,omitempty"`     // Splunk source
+	SourceType    string            `json:"sourcetype,omitempty"` // Splunk sourcetype
+	Headers       map[string]string `json:"headers,omitempty"`
+	BatchSize     int               `json:"batchSize,omitempty"`     // Records per request (default: 100)
+	FlushInterval string            `json:"flushInterval,omitempty"` // Maximum time a record waits in a batch (default: "5s")
+	Timeout       string            `json:"timeout,omitempty"`       // Request timeout (default: "10s")
+
+	// OTLP sink
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"` // e.g. service.name, deployment.environment
+}
+
+// duration parses an optional duration field
+func (c SinkConfig) duration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s' for %s sink: %w", name, value, c.Type, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative for %s sink", name, c.Type)
+	}
+	return d, nil
+}
+
+var (
+	sinkFactoriesMu sync.RWMutex
+	sinkFactories   = map[string]SinkFactory{
+		SinkFile:          newFileSink,
+		SinkSyslog:        newSyslogSink,
+		SinkElasticsearch: newElasticsearchSink,
+		SinkLoki:          newLokiSink,
+		SinkSplunk:        newSplunkSink,
+		SinkOTLP:          newOTLPSink,
+	}
+)
+
+// RegisterSinkFactory registers a custom sink type that can be used in the sinks setting
+func RegisterSinkFactory(sinkType string, factory SinkFactory) error {
+	if sinkType == "" || factory == nil {
+		return fmt.Errorf("sink type and factory are required")
+	}
+
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+
+	if _, exists := sinkFactories[sinkType]; exists || sinkType == SinkEngine {
+		return fmt.Errorf("sink type '%s' is already registered", sinkType)
+	}
+	sinkFactories[sinkType] = factory
+
+	return nil
+}
+
+// openSinks is the process-wide set of sinks, shared by every activity instance with the
+// same sink configuration so that, for example, two activities never rotate the same file
+var openSinks = struct {
+	sync.Mutex
+	byKey map[string]Sink
+}{byKey: make(map[string]Sink)}
+
+var shutdownHookOnce sync.Once
+
+// registerShutdownHook makes the engine drain async writers and close sinks when it stops
+func registerShutdownHook() {
+	shutdownHookOnce.Do(func() {
+		engine.LifeCycle(&sinkLifecycle{})
+	})
+}
+
+// acquireSink returns the shared sink for a configuration, creating it on first use
+func acquireSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	keyBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sink configuration: %w", err)
+	}
+	key := string(keyBytes)
+
+	openSinks.Lock()
+	defer openSinks.Unlock()
+
+	if sink, exists := openSinks.byKey[key]; exists {
+		return sink, nil
+	}
+
+	sinkFactoriesMu.RLock()
+	factory, ok := sinkFactories[config.Type]
+	sinkFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink type '%s' (available: %s)", config.Type, strings.Join(sinkTypes(), ", "))
+	}
+
+	sink, err := factory(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	openSinks.byKey[key] = sink
+	registerShutdownHook()
+
+	return sink, nil
+}
+
+// sinkTypes lists the available sink types, sorted
+func sinkTypes() []string {
+	sinkFactoriesMu.RLock()
+	defer sinkFactoriesMu.RUnlock()
+
+	types := []string{SinkEngine}
+	for t := range sinkFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// CloseSinks writes pending duplicate summaries and drains the async writers, then
+// flushes and closes every shared sink. It is called automatically on engine shutdown.
+func CloseSinks() error {
+	flushDedupers()
+	stopAsyncWriters()
+
+	openSinks.Lock()
+	sinks := openSinks.byKey
+	openSinks.byKey = make(map[string]Sink)
+	openSinks.Unlock()
+
+	var errs []string
+	for key, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sinkLifecycle stops the level controls and closes the shared sinks when the Flogo engine stops
+type sinkLifecycle struct{}
+
+func (s *sinkLifecycle) Start() error {
+	return nil
+}
+
+func (s *sinkLifecycle) Stop() error {
+	stopLevelControls()
+	stopMetricsEndpoints()
+	return CloseSinks()
+}
+
+// engineSink writes records through the Flogo engine logger of an activity
+type engineSink struct {
+	activity *Activity
+}
+
+func (s *engineSink) Write(rec *Record) error {
+	s.activity.logAtLevel(rec.Level, rec.Line)
+	return nil
+}
+
+func (s *engineSink) Flush() error {
+	return nil
+}
+
+func (s *engineSink) Close() error {
+	return nil
+}
+
+// buildSinks creates the sinks configured in the sinks setting. The engine sink is
+// per activity; all other sinks are shared process-wide.
+func (a *Activity) buildSinks(setting interface{}) ([]Sink, error) {
+	if setting == nil {
+		return nil, nil
+	}
+	if str, ok := setting.(string); ok && strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+
+	var configs []SinkConfig
+	if err := decodeJSONConfig(setting, &configs); err != nil {
+		return nil, fmt.Errorf("invalid sinks setting: %w", err)
+	}
+
+	sinks := make([]Sink, 0, len(configs))
+	for _, config := range configs {
+		config.Type = strings.ToLower(strings.TrimSpace(config.Type))
+		if config.Type == SinkEngine {
+			sinks = append(sinks, &engineSink{activity: a})
+			continue
+		}
+
+		sink, err := acquireSink(config, a.logger)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// emit hands a record to the async writer, or writes it directly when writing is synchronous
+func (a *Activity) emit(rec *Record) {
+	if a.async != nil && a.async.enqueue(asyncItem{rec: rec, sinks: a.sinks, logger: a.logger}) {
+		return
+	}
+	a.writeSinks(rec)
+}
+
+// writeSinks writes a record to the configured sinks, or to the engine logger when none are configured
+func (a *Activity) writeSinks(rec *Record) {
+	if len(a.sinks) == 0 {
+		a.logAtLevel(rec.Level, rec.Line)
+		return
+	}
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(rec); err != nil {
+			a.logger.Warnf("Failed to write log entry to sink: %v", err)
+		}
+	}
+}
+
+// syslogSeverity maps a log level to an RFC 5424 severity
+func syslogSeverity(level string) int {
+	switch strings.ToUpper(level) {
+	case "FATAL":
+		return 2
+	case "ERROR":
+		return 3
+	case "WARN", "WARNING":
+		return 4
+	case "INFO":
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,312 @@
+package writelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+// backupTimeFormat is embedded in rotated file names; it sorts chronologically
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// fileSink appends records to a file and rotates it by size and/or age
+type fileSink struct {
+	mu          sync.Mutex
+	path        string
+	maxSize     int64
+	rotateEvery time.Duration
+	maxBackups  int
+	maxAge      time.Duration
+	compress    bool
+	logger      log.Logger
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	housekeeping   sync.WaitGroup
+	housekeepingMu sync.Mutex // Serializes compression and retention between rotations
+	now            func() time.Time
+}
+
+func newFileSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("file sink requires a path")
+	}
+	if config.MaxSizeMB < 0 || config.MaxBackups < 0 {
+		return nil, fmt.Errorf("file sink maxSizeMB and maxBackups must not be negative")
+	}
+
+	rotateEvery, err := config.duration("rotateEvery", config.RotateEvery, 0)
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := config.duration("maxAge", config.MaxAge, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{
+		path:        config.Path,
+		maxSize:     int64(config.MaxSizeMB * 1024 * 1024),
+		rotateEvery: rotateEvery,
+		maxBackups:  config.MaxBackups,
+		maxAge:      maxAge,
+		compress:    config.Compress,
+		logger:      logger,
+		now:         time.Now,
+	}, nil
+}
+
+func (s *fileSink) Write(rec *Record) error {
+	line := rec.Line + "\n"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.shouldRotate(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.WriteString(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write to log file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *fileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	s.mu.Unlock()
+
+	// Wait for background compression and retention to finish
+	s.housekeeping.Wait()
+	return err
+}
+
+// open opens the log file for appending, creating parent directories as needed
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory for %s: %w", s.path, err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", s.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", s.path, err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.openedAt = s.now()
+	return nil
+}
+
+// shouldRotate reports whether the file must be rotated before writing n more bytes
+func (s *fileSink) shouldRotate(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.maxSize > 0 && s.size+n > s.maxSize {
+		return true
+	}
+	return s.rotateEvery > 0 && s.now().Sub(s.openedAt) >= s.rotateEvery
+}
+
+// rotate renames the current file to a timestamped backup and opens a fresh one
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", s.path, err)
+	}
+	s.file = nil
+
+	backup := s.backupName(s.now())
+	if err := os.Rename(s.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", s.path, err)
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	s.housekeeping.Add(1)
+	go func() {
+		defer s.housekeeping.Done()
+		s.processBackup(backup)
+	}()
+
+	return nil
+}
+
+// backupName returns a unique name for a rotated file, e.g. app-2025-08-04T10-30-45.123.log
+func (s *fileSink) backupName(t time.Time) string {
+	dir, prefix, ext := s.nameParts()
+	base := filepath.Join(dir, prefix+"-"+t.UTC().Format(backupTimeFormat))
+
+	name := base + ext
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+	return name
+}
+
+// nameParts splits the log path into directory, file name prefix and extension
+func (s *fileSink) nameParts() (string, string, string) {
+	dir := filepath.Dir(s.path)
+	name := filepath.Base(s.path)
+	ext := filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext), ext
+}
+
+// processBackup compresses a rotated file and applies the retention policy
+func (s *fileSink) processBackup(backup string) {
+	s.housekeepingMu.Lock()
+	defer s.housekeepingMu.Unlock()
+
+	if s.compress {
+		if err := gzipFile(backup); err != nil && s.logger != nil {
+			s.logger.Warnf("Failed to compress rotated log file %s: %v", backup, err)
+		}
+	}
+
+	if err := s.removeExpiredBackups(); err != nil && s.logger != nil {
+		s.logger.Warnf("Failed to apply log retention for %s: %v", s.path, err)
+	}
+}
+
+// backups returns the rotated files for this sink, newest first
+func (s *fileSink) backups() ([]string, error) {
+	dir, prefix, _ := s.nameParts()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix+"-") {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, backupTimestamp(name, prefix)); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(dir, name))
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// backupTimestamp extracts the timestamp portion of a rotated file name
+func backupTimestamp(name, prefix string) string {
+	ts := strings.TrimPrefix(name, prefix+"-")
+	if len(ts) > len(backupTimeFormat) {
+		ts = ts[:len(backupTimeFormat)]
+	}
+	return ts
+}
+
+// removeExpiredBackups deletes rotated files beyond maxBackups or older than maxAge
+func (s *fileSink) removeExpiredBackups() error {
+	if s.maxBackups == 0 && s.maxAge == 0 {
+		return nil
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+
+	_, prefix, _ := s.nameParts()
+	cutoff := s.now().Add(-s.maxAge)
+
+	for i, backup := range backups {
+		expired := s.maxBackups > 0 && i >= s.maxBackups
+		if !expired && s.maxAge > 0 {
+			ts, _ := time.Parse(backupTimeFormat, backupTimestamp(filepath.Base(backup), prefix))
+			expired = ts.Before(cutoff)
+		}
+		if expired {
+			if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gzipFile compresses a file to file.gz and removes the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
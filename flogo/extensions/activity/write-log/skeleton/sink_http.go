@@ -0,0 +1,434 @@
+package writelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultHTTPTimeout   = 10 * time.Second
+)
+
+// bulkEncoder turns a batch of records into a request body for a specific backend
+type bulkEncoder interface {
+	path() string
+	contentType() string
+	encode(records []*Record) ([]byte, error)
+	authorize(req *http.Request)
+	checkResponse(status int, body []byte) error
+}
+
+// httpBulkSink batches records and ships them to an HTTP bulk API. A batch is sent when it
+// reaches batchSize records or when flushInterval has passed since the first buffered record.
+// Batches are queued and sent outside mu, one at a time and in order, so a slow backend does
+// not block writers that only add to the batch.
+type httpBulkSink struct {
+	mu            sync.Mutex // guards batch and pending
+	sendMu        sync.Mutex // held while sending pending batches
+	url           string
+	client        *http.Client
+	encoder       bulkEncoder
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	logger        log.Logger
+
+	batch   []*Record
+	pending [][]*Record // full batches waiting to be sent
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newHTTPBulkSink(config SinkConfig, encoder bulkEncoder, logger log.Logger) (*httpBulkSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("%s sink requires a url", config.Type)
+	}
+	parsed, err := url.Parse(config.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s' for %s sink", config.URL, config.Type)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = encoder.path()
+	}
+
+	if config.BatchSize < 0 {
+		return nil, fmt.Errorf("batchSize must not be negative for %s sink", config.Type)
+	}
+	batchSize := config.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+
+	flushInterval, err := config.duration("flushInterval", config.FlushInterval, defaultFlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := config.duration("timeout", config.Timeout, defaultHTTPTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if parsed.Scheme == "https" {
+		tlsConfig, err := buildTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	s := &httpBulkSink{
+		url:           parsed.String(),
+		client:        &http.Client{Timeout: timeout, Transport: transport},
+		encoder:       encoder,
+		headers:       config.Headers,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        logger,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go s.flushLoop()
+
+	return s, nil
+}
+
+func (s *httpBulkSink) Write(rec *Record) error {
+	s.mu.Lock()
+	s.batch = append(s.batch, rec)
+	full := len(s.batch) >= s.batchSize
+	if full {
+		s.queueLocked()
+	}
+	s.mu.Unlock()
+
+	if full {
+		return s.sendPending()
+	}
+	return nil
+}
+
+func (s *httpBulkSink) Flush() error {
+	s.mu.Lock()
+	s.queueLocked()
+	s.mu.Unlock()
+
+	return s.sendPending()
+}
+
+func (s *httpBulkSink) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+		<-s.done
+	}
+	return s.Flush()
+}
+
+// flushLoop sends partial batches every flushInterval
+func (s *httpBulkSink) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && s.logger != nil {
+				s.logger.Warnf("Failed to flush log batch: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// queueLocked moves the buffered batch to the batches waiting to be sent
+func (s *httpBulkSink) queueLocked() {
+	if len(s.batch) > 0 {
+		s.pending = append(s.pending, s.batch)
+		s.batch = nil
+	}
+}
+
+// sendPending sends the queued batches in order. Only one goroutine sends at a time; a
+// caller that waited for another one returns once the batches it queued have been sent.
+// It returns the first error; later batches are still sent.
+func (s *httpBulkSink) sendPending() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	var firstErr error
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			return firstErr
+		}
+		records := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		if err := s.send(records); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// send posts a batch. The batch is dropped on failure so that a backend outage cannot
+// grow memory without bound.
+func (s *httpBulkSink) send(records []*Record) error {
+	body, err := s.encoder.encode(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode log batch: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.encoder.contentType())
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	s.encoder.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %d log entries to %s: %w", len(records), s.url, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := s.encoder.checkResponse(resp.StatusCode, respBody); err != nil {
+		return fmt.Errorf("log backend rejected %d entries: %w", len(records), err)
+	}
+	return nil
+}
+
+// checkStatus reports non-2xx responses
+func checkStatus(status int, body []byte) error {
+	if status < 200 || status > 299 {
+		return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// documentFor returns the structured entry with an @timestamp, as expected by document stores
+func documentFor(rec *Record) map[string]interface{} {
+	if _, exists := rec.Entry["@timestamp"]; exists {
+		return rec.Entry
+	}
+	doc := copyMap(rec.Entry)
+	doc["@timestamp"] = rec.Time.UTC().Format(time.RFC3339Nano)
+	return doc
+}
+
+// elasticsearchEncoder writes the Elasticsearch _bulk NDJSON format
+type elasticsearchEncoder struct {
+	index    string
+	apiKey   string
+	username string
+	password string
+}
+
+func newElasticsearchSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	index := config.Index
+	if index == "" {
+		index = "flogo-logs"
+	}
+	return newHTTPBulkSink(config, &elasticsearchEncoder{
+		index:    index,
+		apiKey:   config.APIKey,
+		username: config.Username,
+		password: config.Password,
+	}, logger)
+}
+
+func (e *elasticsearchEncoder) path() string        { return "/_bulk" }
+func (e *elasticsearchEncoder) contentType() string { return "application/x-ndjson" }
+
+func (e *elasticsearchEncoder) encode(records []*Record) ([]byte, error) {
+	action, err := json.Marshal(map[string]interface{}{"create": map[string]interface{}{"_index": e.index}})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, rec := range records {
+		doc, err := json.Marshal(documentFor(rec))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(doc)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *elasticsearchEncoder) authorize(req *http.Request) {
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	} else if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+}
+
+func (e *elasticsearchEncoder) checkResponse(status int, body []byte) error {
+	if err := checkStatus(status, body); err != nil {
+		return err
+	}
+
+	// _bulk returns 200 even when individual items fail
+	var result struct {
+		Errors bool                                `json:"errors"`
+		Items  []map[string]map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || !result.Errors {
+		return nil
+	}
+
+	failed := 0
+	var firstErr interface{}
+	for _, item := range result.Items {
+		for _, outcome := range item {
+			if e, ok := outcome["error"]; ok {
+				failed++
+				if firstErr == nil {
+					firstErr = e
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%d bulk items failed, first error: %v", failed, firstErr)
+}
+
+// lokiEncoder writes the Loki push API JSON format, one stream per level
+type lokiEncoder struct {
+	labels   map[string]string
+	username string
+	password string
+}
+
+func newLokiSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	labels := map[string]string{"service_name": "flogo"}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	return newHTTPBulkSink(config, &lokiEncoder{
+		labels:   labels,
+		username: config.Username,
+		password: config.Password,
+	}, logger)
+}
+
+func (e *lokiEncoder) path() string        { return "/loki/api/v1/push" }
+func (e *lokiEncoder) contentType() string { return "application/json" }
+
+func (e *lokiEncoder) encode(records []*Record) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	byLevel := make(map[string]*stream)
+	for _, rec := range records {
+		level := strings.ToLower(rec.Level)
+		s, ok := byLevel[level]
+		if !ok {
+			labels := make(map[string]string, len(e.labels)+1)
+			for k, v := range e.labels {
+				labels[k] = v
+			}
+			labels["level"] = level
+			s = &stream{Stream: labels}
+			byLevel[level] = s
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(rec.Time.UnixNano(), 10), rec.Line})
+	}
+
+	levels := make([]string, 0, len(byLevel))
+	for level := range byLevel {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	streams := make([]*stream, 0, len(levels))
+	for _, level := range levels {
+		streams = append(streams, byLevel[level])
+	}
+
+	return json.Marshal(map[string]interface{}{"streams": streams})
+}
+
+func (e *lokiEncoder) authorize(req *http.Request) {
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+}
+
+func (e *lokiEncoder) checkResponse(status int, body []byte) error {
+	return checkStatus(status, body)
+}
+
+// splunkEncoder writes Splunk HTTP Event Collector events
+type splunkEncoder struct {
+	token  string
+	events *hecEventBuilder
+}
+
+func newSplunkSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	if config.Token == "" {
+		return nil, fmt.Errorf("splunk sink requires a token")
+	}
+	return newHTTPBulkSink(config, &splunkEncoder{
+		token: config.Token,
+		events: newHECEventBuilder(hecOptions{
+			Source:     config.Source,
+			SourceType: config.SourceType,
+			Index:      config.Index,
+		}),
+	}, logger)
+}
+
+func (e *splunkEncoder) path() string        { return "/services/collector/event" }
+func (e *splunkEncoder) contentType() string { return "application/json" }
+
+func (e *splunkEncoder) encode(records []*Record) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		data, err := json.Marshal(e.events.event(rec))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *splunkEncoder) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Splunk "+e.token)
+}
+
+func (e *splunkEncoder) checkResponse(status int, body []byte) error {
+	return checkStatus(status, body)
+}
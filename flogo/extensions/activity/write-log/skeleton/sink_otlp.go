@@ -0,0 +1,286 @@
+package writelog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+const otlpScopeName = "flogo-activity-write-log"
+
+// otlpEncoder writes OTLP/HTTP JSON log export requests
+// (https://opentelemetry.io/docs/specs/otlp/#otlphttp)
+type otlpEncoder struct {
+	resource []otlpKeyValue
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue is the JSON encoding of an OTLP AnyValue; exactly one field is set
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"` // int64 values are strings in OTLP JSON
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKvlist     `json:"kvlistValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKvlist struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+// newOTLPSink creates a sink that exports OpenTelemetry log records. The endpoint defaults to
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with /v1/logs appended.
+func newOTLPSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	if config.URL == "" {
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"); endpoint != "" {
+			config.URL = endpoint
+		} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			config.URL = strings.TrimSuffix(endpoint, "/") + "/v1/logs"
+		}
+	}
+
+	return newHTTPBulkSink(config, &otlpEncoder{resource: otlpResource(config.ResourceAttributes)}, logger)
+}
+
+// otlpResource builds the resource attributes from OTEL_RESOURCE_ATTRIBUTES, OTEL_SERVICE_NAME
+// and the sink configuration, in increasing order of precedence
+func otlpResource(configured map[string]string) []otlpKeyValue {
+	attrs := map[string]string{"service.name": defaultServiceName()}
+
+	for _, pair := range strings.Split(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(k) != "" {
+			attrs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		attrs["service.name"] = name
+	}
+	for k, v := range configured {
+		attrs[k] = v
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resource := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		resource = append(resource, otlpKeyValue{Key: k, Value: toOTLPValue(attrs[k])})
+	}
+	return resource
+}
+
+func (e *otlpEncoder) path() string        { return "/v1/logs" }
+func (e *otlpEncoder) contentType() string { return "application/json" }
+
+func (e *otlpEncoder) encode(records []*Record) ([]byte, error) {
+	logRecords := make([]otlpLogRecord, 0, len(records))
+	for _, rec := range records {
+		logRecords = append(logRecords, e.logRecord(rec))
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": e.resource},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]interface{}{"name": otlpScopeName, "version": "1.0.0"},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	})
+}
+
+// logRecord converts a record to an OTLP log record. The message becomes the body, trace
+// and span IDs become the record's trace context, and every other field an attribute.
+func (e *otlpEncoder) logRecord(rec *Record) otlpLogRecord {
+	ts := strconv.FormatInt(rec.Time.UnixNano(), 10)
+	out := otlpLogRecord{
+		TimeUnixNano:         ts,
+		ObservedTimeUnixNano: ts,
+		SeverityNumber:       otlpSeverity(rec.Level),
+		SeverityText:         strings.ToUpper(rec.Level),
+		TraceID:              otlpID(rec.TraceID, 16),
+		SpanID:               otlpID(rec.SpanID, 8),
+	}
+
+	if msg, ok := rec.Entry["message"]; ok {
+		out.Body = toOTLPValue(msg)
+	} else {
+		out.Body = toOTLPValue(rec.Line)
+	}
+
+	keys := make([]string, 0, len(rec.Entry))
+	for k := range rec.Entry {
+		switch k {
+		case "message", "level", "@timestamp":
+			continue
+		case "trace":
+			// Already carried by traceId/spanId when they are valid OTLP identifiers
+			if out.TraceID != "" {
+				continue
+			}
+		case "span":
+			if out.SpanID != "" {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		out.Attributes = append(out.Attributes, otlpKeyValue{Key: k, Value: toOTLPValue(rec.Entry[k])})
+	}
+
+	return out
+}
+
+func (e *otlpEncoder) authorize(req *http.Request) {}
+
+func (e *otlpEncoder) checkResponse(status int, body []byte) error {
+	if err := checkStatus(status, body); err != nil {
+		return err
+	}
+
+	var result struct {
+		PartialSuccess struct {
+			RejectedLogRecords json.Number `json:"rejectedLogRecords"`
+			ErrorMessage       string      `json:"errorMessage"`
+		} `json:"partialSuccess"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil
+	}
+	if rejected, _ := result.PartialSuccess.RejectedLogRecords.Int64(); rejected > 0 {
+		return fmt.Errorf("%d log records rejected: %s", rejected, result.PartialSuccess.ErrorMessage)
+	}
+	return nil
+}
+
+// otlpSeverity maps a log level to the OpenTelemetry severity number
+func otlpSeverity(level string) int {
+	switch strings.ToUpper(level) {
+	case "TRACE":
+		return 1
+	case "DEBUG":
+		return 5
+	case "INFO":
+		return 9
+	case "WARN", "WARNING":
+		return 13
+	case "ERROR":
+		return 17
+	case "FATAL":
+		return 21
+	default:
+		return 0
+	}
+}
+
+// otlpID returns id as lowercase hex if it is a valid, non-zero identifier of n bytes.
+// Shorter hex IDs, such as 64-bit Jaeger trace IDs, are left-padded with zeros.
+func otlpID(id string, n int) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" || len(id) > n*2 {
+		return ""
+	}
+	id = strings.Repeat("0", n*2-len(id)) + id
+
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return ""
+	}
+	for _, c := range b {
+		if c != 0 {
+			return id
+		}
+	}
+	return ""
+}
+
+// toOTLPValue converts a log entry value to an OTLP AnyValue
+func toOTLPValue(v interface{}) otlpAnyValue {
+	switch val := v.(type) {
+	case nil:
+		return otlpAnyValue{}
+	case string:
+		return otlpAnyValue{StringValue: &val}
+	case bool:
+		return otlpAnyValue{BoolValue: &val}
+	case int:
+		s := strconv.FormatInt(int64(val), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int32:
+		s := strconv.FormatInt(int64(val), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float32:
+		f := float64(val)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		f := val
+		return otlpAnyValue{DoubleValue: &f}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		kv := &otlpKvlist{Values: make([]otlpKeyValue, 0, len(keys))}
+		for _, k := range keys {
+			kv.Values = append(kv.Values, otlpKeyValue{Key: k, Value: toOTLPValue(val[k])})
+		}
+		return otlpAnyValue{KvlistValue: kv}
+	case []interface{}:
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, 0, len(val))}
+		for _, item := range val {
+			arr.Values = append(arr.Values, toOTLPValue(item))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	case []string:
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, 0, len(val))}
+		for _, item := range val {
+			arr.Values = append(arr.Values, toOTLPValue(item))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	default:
+		s := fmt.Sprintf("%v", val)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
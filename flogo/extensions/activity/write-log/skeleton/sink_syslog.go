@@ -0,0 +1,219 @@
+package writelog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+)
+
+// syslogFacilities maps facility names to RFC 5424 facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const syslogDialTimeout = 5 * time.Second
+
+// syslogSink sends RFC 5424 messages over UDP, TCP or TLS. Stream transports use
+// octet-counting framing (RFC 6587).
+type syslogSink struct {
+	mu        sync.Mutex
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	facility  int
+	hostname  string
+	appName   string
+	procID    string
+
+	conn net.Conn
+}
+
+func newSyslogSink(config SinkConfig, logger log.Logger) (Sink, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("syslog sink requires an address")
+	}
+
+	network := strings.ToLower(config.Network)
+	if network == "" {
+		network = "udp"
+	}
+	if network != "udp" && network != "tcp" && network != "tls" {
+		return nil, fmt.Errorf("unsupported syslog network '%s' (supported: udp, tcp, tls)", config.Network)
+	}
+
+	facility := syslogFacilities["user"]
+	if config.Facility != "" {
+		f, ok := syslogFacilities[strings.ToLower(config.Facility)]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility '%s'", config.Facility)
+		}
+		facility = f
+	}
+
+	s := &syslogSink{
+		network:  network,
+		address:  config.Address,
+		facility: facility,
+		hostname: syslogHeaderField(hostnameOrDefault(), 255),
+		appName:  syslogHeaderField(config.AppName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if s.appName == "-" {
+		s.appName = "flogo"
+	}
+
+	if network == "tls" {
+		tlsConfig, err := buildTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		s.tlsConfig = tlsConfig
+	}
+
+	return s, nil
+}
+
+func (s *syslogSink) Write(rec *Record) error {
+	msg := s.format(rec)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Retry once on a fresh connection if the existing one has gone away
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = s.conn.Write(s.frame(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return fmt.Errorf("failed to send syslog message to %s://%s: %w", s.network, s.address, err)
+}
+
+func (s *syslogSink) Flush() error {
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) connect() error {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+// format renders an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslogSink) format(rec *Record) string {
+	pri := s.facility*8 + syslogSeverity(rec.Level)
+	ts := rec.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		pri,
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		s.appName,
+		s.procID,
+		syslogHeaderField(strings.ToUpper(rec.Level), 32),
+		rec.Line)
+}
+
+// frame applies the transport framing for the message
+func (s *syslogSink) frame(msg string) []byte {
+	if s.network == "udp" {
+		return []byte(msg)
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
+
+// syslogHeaderField sanitizes a header field: printable US-ASCII without spaces,
+// limited in length, and "-" when empty
+func syslogHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// hostnameOrDefault returns the local hostname for syslog headers
+func hostnameOrDefault() string {
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return ""
+}
+
+// buildTLSConfig creates a client TLS configuration from a sink configuration
+func buildTLSConfig(config SinkConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		ServerName:         config.ServerName,
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
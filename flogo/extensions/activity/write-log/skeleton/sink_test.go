@@ -0,0 +1,586 @@
+package writelog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecord(level, line string) *Record {
+	return &Record{
+		Time:  time.Date(2025, 8, 4, 10, 30, 45, 0, time.UTC),
+		Level: level,
+		Entry: map[string]interface{}{"level": level, "message": line},
+		Line:  line,
+	}
+}
+
+// fakeClock is a manually advanced clock, safe to read from housekeeping goroutines
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestFileSink_SizeRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	sink, err := newFileSink(SinkConfig{Type: SinkFile, Path: path, MaxSizeMB: 100.0 / (1024 * 1024), MaxBackups: 2, Compress: true}, nil)
+	require.NoError(t, err)
+
+	fs := sink.(*fileSink)
+	clock := &fakeClock{t: time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)}
+	fs.now = clock.now
+
+	line := strings.Repeat("x", 59) // 60 bytes with newline: every write after the first rotates
+	for i := 0; i < 5; i++ {
+		clock.advance(time.Second)
+		require.NoError(t, sink.Write(testRecord("INFO", line)))
+	}
+	require.NoError(t, sink.Close())
+
+	backups, err := fs.backups()
+	require.NoError(t, err)
+	assert.Len(t, backups, 2, "retention keeps maxBackups rotated files")
+	for _, b := range backups {
+		assert.True(t, strings.HasSuffix(b, ".log.gz"), b)
+
+		f, err := os.Open(b)
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		content, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		f.Close()
+		assert.Equal(t, line+"\n", string(content))
+	}
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, line+"\n", string(current))
+}
+
+func TestFileSink_TimeRotationAndMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flow.log")
+
+	sink, err := newFileSink(SinkConfig{Type: SinkFile, Path: path, RotateEvery: "1h", MaxAge: "90m"}, nil)
+	require.NoError(t, err)
+
+	fs := sink.(*fileSink)
+	clock := &fakeClock{t: time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)}
+	fs.now = clock.now
+
+	require.NoError(t, sink.Write(testRecord("INFO", "first")))
+	clock.advance(30 * time.Minute)
+	require.NoError(t, sink.Write(testRecord("INFO", "second")))
+	clock.advance(31 * time.Minute)
+	require.NoError(t, sink.Write(testRecord("INFO", "third"))) // rotates at 11:01
+	clock.advance(61 * time.Minute)
+	require.NoError(t, sink.Write(testRecord("INFO", "fourth"))) // rotates at 12:02
+	clock.advance(61 * time.Minute)
+	require.NoError(t, sink.Write(testRecord("INFO", "fifth"))) // rotates at 13:03, 11:01 backup expires
+	require.NoError(t, sink.Close())
+
+	backups, err := fs.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Contains(t, backups[0], "flow-2025-08-04T13-03-00.000.log")
+	assert.Contains(t, backups[1], "flow-2025-08-04T12-02-00.000.log")
+
+	content, err := os.ReadFile(backups[1])
+	require.NoError(t, err)
+	assert.Equal(t, "third\n", string(content))
+}
+
+func TestFileSink_Validation(t *testing.T) {
+	_, err := newFileSink(SinkConfig{Type: SinkFile}, nil)
+	assert.Error(t, err)
+	_, err = newFileSink(SinkConfig{Type: SinkFile, Path: "x.log", RotateEvery: "soon"}, nil)
+	assert.Error(t, err)
+	_, err = newFileSink(SinkConfig{Type: SinkFile, Path: "x.log", MaxBackups: -1}, nil)
+	assert.Error(t, err)
+}
+
+func TestSyslogSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := newSyslogSink(SinkConfig{Type: SinkSyslog, Network: "udp", Address: conn.LocalAddr().String(), Facility: "local0", AppName: "order service"}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("INFO", `{"message":"hello"}`)))
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<134>1 2025-08-04T10:30:45.000000Z "), msg)
+	fields := strings.SplitN(msg, " ", 8)
+	require.Len(t, fields, 8)
+	assert.Equal(t, "orderservice", fields[3])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), fields[4])
+	assert.Equal(t, "INFO", fields[5])
+	assert.Equal(t, "-", fields[6])
+	assert.Equal(t, `{"message":"hello"}`, fields[7])
+}
+
+func TestSyslogSink_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received <- readOctetFrames(conn, 2)
+	}()
+
+	sink, err := newSyslogSink(SinkConfig{Type: SinkSyslog, Network: "tcp", Address: ln.Addr().String()}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(testRecord("ERROR", "first failure")))
+	require.NoError(t, sink.Write(testRecord("DEBUG", "second")))
+	require.NoError(t, sink.Close())
+
+	select {
+	case msgs := <-received:
+		require.Len(t, msgs, 2)
+		assert.True(t, strings.HasPrefix(msgs[0], "<11>1 "), msgs[0]) // user.err
+		assert.True(t, strings.HasSuffix(msgs[0], " - first failure"), msgs[0])
+		assert.True(t, strings.HasPrefix(msgs[1], "<15>1 "), msgs[1]) // user.debug
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for syslog messages")
+	}
+}
+
+func TestSyslogSink_TLS(t *testing.T) {
+	certPEM, cert := selfSignedCert(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0600))
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received <- readOctetFrames(conn, 1)
+	}()
+
+	sink, err := newSyslogSink(SinkConfig{Type: SinkSyslog, Network: "tls", Address: ln.Addr().String(), CAFile: caFile, Facility: "auth"}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("WARN", "over tls")))
+
+	select {
+	case msgs := <-received:
+		require.Len(t, msgs, 1)
+		assert.True(t, strings.HasPrefix(msgs[0], "<36>1 "), msgs[0]) // auth.warning
+		assert.True(t, strings.HasSuffix(msgs[0], " - over tls"))
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for TLS syslog message")
+	}
+
+	_, err = newSyslogSink(SinkConfig{Type: SinkSyslog, Network: "tls", Address: "x:1", CAFile: filepath.Join(t.TempDir(), "missing.pem")}, nil)
+	assert.Error(t, err)
+}
+
+func TestSyslogSink_Validation(t *testing.T) {
+	_, err := newSyslogSink(SinkConfig{Type: SinkSyslog}, nil)
+	assert.Error(t, err)
+	_, err = newSyslogSink(SinkConfig{Type: SinkSyslog, Address: "x:514", Network: "sctp"}, nil)
+	assert.Error(t, err)
+	_, err = newSyslogSink(SinkConfig{Type: SinkSyslog, Address: "x:514", Facility: "nope"}, nil)
+	assert.Error(t, err)
+}
+
+// readOctetFrames reads RFC 6587 octet-counted frames from a stream
+func readOctetFrames(r io.Reader, count int) []string {
+	reader := bufio.NewReader(r)
+	var msgs []string
+	for len(msgs) < count {
+		lenStr, err := reader.ReadString(' ')
+		if err != nil {
+			return msgs
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(lenStr))
+		if err != nil {
+			return msgs
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return msgs
+		}
+		msgs = append(msgs, string(buf))
+	}
+	return msgs
+}
+
+func selfSignedCert(t *testing.T) ([]byte, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	return certPEM, cert
+}
+
+// captureServer records every request body received
+type captureServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	paths    []string
+	bodies   []string
+	headers  []http.Header
+	response string
+}
+
+func newCaptureServer(response string) *captureServer {
+	c := &captureServer{response: response}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		c.paths = append(c.paths, r.URL.Path)
+		c.bodies = append(c.bodies, string(body))
+		c.headers = append(c.headers, r.Header.Clone())
+		c.mu.Unlock()
+		_, _ = w.Write([]byte(c.response))
+	}))
+	return c
+}
+
+func (c *captureServer) requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.bodies)
+}
+
+func TestHTTPSink_Elasticsearch(t *testing.T) {
+	server := newCaptureServer(`{"errors":false,"items":[]}`)
+	defer server.Close()
+
+	sink, err := newElasticsearchSink(SinkConfig{Type: SinkElasticsearch, URL: server.URL, Index: "orders", BatchSize: 2, APIKey: "k3y"}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("INFO", "one")))
+	assert.Equal(t, 0, server.requests(), "batch is not sent before it is full")
+	require.NoError(t, sink.Write(testRecord("ERROR", "two")))
+	require.Equal(t, 1, server.requests())
+
+	assert.Equal(t, "/_bulk", server.paths[0])
+	assert.Equal(t, "application/x-ndjson", server.headers[0].Get("Content-Type"))
+	assert.Equal(t, "ApiKey k3y", server.headers[0].Get("Authorization"))
+
+	lines := strings.Split(strings.TrimSuffix(server.bodies[0], "\n"), "\n")
+	require.Len(t, lines, 4)
+	assert.JSONEq(t, `{"create":{"_index":"orders"}}`, lines[0])
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &doc))
+	assert.Equal(t, "two", doc["message"])
+	assert.Equal(t, "2025-08-04T10:30:45Z", doc["@timestamp"])
+}
+
+func TestHTTPSink_ElasticsearchItemErrors(t *testing.T) {
+	server := newCaptureServer(`{"errors":true,"items":[{"create":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`)
+	defer server.Close()
+
+	sink, err := newElasticsearchSink(SinkConfig{Type: SinkElasticsearch, URL: server.URL, BatchSize: 1}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Write(testRecord("INFO", "bad"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapper_parsing_exception")
+}
+
+func TestHTTPSink_Loki(t *testing.T) {
+	server := newCaptureServer("")
+	defer server.Close()
+
+	sink, err := newLokiSink(SinkConfig{Type: SinkLoki, URL: server.URL, Labels: map[string]string{"app": "orders"}}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("INFO", "a")))
+	require.NoError(t, sink.Write(testRecord("ERROR", "b")))
+	require.NoError(t, sink.Write(testRecord("INFO", "c")))
+	require.NoError(t, sink.Flush())
+	require.Equal(t, 1, server.requests())
+	assert.Equal(t, "/loki/api/v1/push", server.paths[0])
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &push))
+	require.Len(t, push.Streams, 2)
+	assert.Equal(t, map[string]string{"app": "orders", "service_name": "flogo", "level": "error"}, push.Streams[0].Stream)
+	assert.Equal(t, "info", push.Streams[1].Stream["level"])
+	require.Len(t, push.Streams[1].Values, 2)
+	assert.Equal(t, strconv.FormatInt(testRecord("INFO", "").Time.UnixNano(), 10), push.Streams[1].Values[0][0])
+	assert.Equal(t, "c", push.Streams[1].Values[1][1])
+}
+
+func TestHTTPSink_SplunkHEC(t *testing.T) {
+	server := newCaptureServer(`{"text":"Success","code":0}`)
+	defer server.Close()
+
+	sink, err := newSplunkSink(SinkConfig{Type: SinkSplunk, URL: server.URL, Token: "abc", Index: "main", Source: "flogo", FlushInterval: "20ms"}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("WARN", "slow")))
+	assert.Eventually(t, func() bool { return server.requests() == 1 }, 2*time.Second, 10*time.Millisecond, "flush interval sends partial batches")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "/services/collector/event", server.paths[0])
+	assert.Equal(t, "Splunk abc", server.headers[0].Get("Authorization"))
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &event))
+	assert.Equal(t, "main", event["index"])
+	assert.Equal(t, "flogo", event["source"])
+	assert.Equal(t, "_json", event["sourcetype"])
+	assert.Equal(t, float64(testRecord("WARN", "").Time.Unix()), event["time"])
+	assert.Equal(t, "slow", event["event"].(map[string]interface{})["message"])
+
+	_, err = newSplunkSink(SinkConfig{Type: SinkSplunk, URL: server.URL}, nil)
+	assert.Error(t, err, "token is required")
+}
+
+func TestHTTPSink_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := newLokiSink(SinkConfig{Type: SinkLoki, URL: server.URL, BatchSize: 1}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Write(testRecord("INFO", "x"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestHTTPSink_SlowBackendDoesNotBlockWriters(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		<-release
+	}))
+	defer server.Close()
+
+	sink, err := newLokiSink(SinkConfig{Type: SinkLoki, URL: server.URL, BatchSize: 2}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(testRecord("INFO", "a")))
+	sent := make(chan error, 1)
+	go func() { sent <- sink.Write(testRecord("INFO", "b")) }()
+	first := <-received
+
+	// While the full batch is being sent, other writers only add to the next batch
+	written := make(chan error, 1)
+	go func() { written <- sink.Write(testRecord("INFO", "c")) }()
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Write waited for the HTTP request of another batch")
+	}
+
+	// Batches are sent one at a time, in order
+	go func() { sent <- sink.Write(testRecord("INFO", "d")) }()
+	select {
+	case <-received:
+		t.Fatal("A second batch was sent while the first was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-sent)
+	require.NoError(t, <-sent)
+	second := <-received
+	assert.Contains(t, first, `"b"`)
+	assert.Contains(t, second, `"c"`)
+	assert.Contains(t, second, `"d"`)
+}
+
+type memorySink struct {
+	mu      sync.Mutex
+	records []*Record
+}
+
+func (m *memorySink) Write(rec *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	return nil
+}
+func (m *memorySink) Flush() error { return nil }
+func (m *memorySink) Close() error { return nil }
+
+var memorySinkSeq atomic.Int64
+
+// registerMemorySink registers a uniquely named sink type backed by a new memorySink
+func registerMemorySink(t *testing.T) (string, *memorySink) {
+	mem := &memorySink{}
+	sinkType := fmt.Sprintf("memory-test-%d", memorySinkSeq.Add(1))
+	require.NoError(t, RegisterSinkFactory(sinkType, func(SinkConfig, log.Logger) (Sink, error) {
+		return mem, nil
+	}))
+	return sinkType, mem
+}
+
+func TestActivity_Sinks(t *testing.T) {
+	t.Run("File sink through Eval", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "logs", "orders.log")
+		settings := map[string]interface{}{
+			"logLevel":     "INFO",
+			"outputFormat": "JSON",
+			"sinks":        []interface{}{map[string]interface{}{"type": "file", "path": path}},
+		}
+
+		act, err := New(test.NewActivityInitContext(settings, nil))
+		require.NoError(t, err)
+
+		tc := test.NewActivityContext(act.Metadata())
+		tc.SetInput("logObject", map[string]interface{}{"message": "to file", "orderId": "o-1"})
+		_, err = act.Eval(tc)
+		require.NoError(t, err)
+
+		// A second activity with the same configuration shares the sink
+		act2, err := New(test.NewActivityInitContext(settings, nil))
+		require.NoError(t, err)
+		assert.Same(t, act.(*Activity).sinks[0], act2.(*Activity).sinks[0])
+
+		require.NoError(t, CloseSinks())
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(content, &entry))
+		assert.Equal(t, "to file", entry["message"])
+		assert.Equal(t, "o-1", entry["orderId"])
+	})
+
+	t.Run("Custom sink factory and engine sink", func(t *testing.T) {
+		sinkType, mem := registerMemorySink(t)
+		assert.Error(t, RegisterSinkFactory(sinkType, func(SinkConfig, log.Logger) (Sink, error) { return nil, nil }))
+		assert.Error(t, RegisterSinkFactory(SinkFile, func(SinkConfig, log.Logger) (Sink, error) { return nil, nil }))
+		assert.Error(t, RegisterSinkFactory("memory", nil))
+
+		settings := map[string]interface{}{
+			"logLevel":     "INFO",
+			"outputFormat": "LOGFMT",
+			"sinks":        fmt.Sprintf(`[{"type":%q},{"type":"engine"}]`, sinkType),
+		}
+		act, err := New(test.NewActivityInitContext(settings, nil))
+		require.NoError(t, err)
+		assert.IsType(t, &engineSink{}, act.(*Activity).sinks[1])
+
+		tc := test.NewActivityContext(act.Metadata())
+		tc.SetInput("logObject", "hello sinks")
+		tc.SetInput("logLevel", "warn")
+		_, err = act.Eval(tc)
+		require.NoError(t, err)
+
+		require.Len(t, mem.records, 1)
+		assert.Equal(t, "WARN", mem.records[0].Level)
+		assert.Equal(t, `level=WARN message="hello sinks"`, mem.records[0].Line)
+		assert.Equal(t, "hello sinks", mem.records[0].Entry["message"])
+	})
+
+	t.Run("Invalid sink configuration fails initialization", func(t *testing.T) {
+		for _, sinks := range []interface{}{
+			[]interface{}{map[string]interface{}{"type": "carrier-pigeon"}},
+			[]interface{}{map[string]interface{}{"type": "file"}},
+			[]interface{}{map[string]interface{}{"type": "loki", "url": "not a url"}},
+			"{not json",
+		} {
+			settings := map[string]interface{}{"logLevel": "INFO", "outputFormat": "JSON", "sinks": sinks}
+			_, err := New(test.NewActivityInitContext(settings, nil))
+			assert.Error(t, err, "%v", sinks)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package writelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupeWindow  = 10 * time.Second
+	defaultDedupeMaxKeys = 1000
+)
+
+// ThrottleConfig configures sampling, rate limiting and duplicate suppression in the
+// throttle setting
+type ThrottleConfig struct {
+	Sampling  map[string]float64 `json:"sampling,omitempty"`  // Fraction of entries kept per level, e.g. {"DEBUG": 0.1}
+	RateLimit *RateLimitConfig   `json:"rateLimit,omitempty"` // Token bucket shared by all levels
+	Dedupe    *DedupeConfig      `json:"dedupe,omitempty"`    // Duplicate suppression
+}
+
+// RateLimitConfig configures the token bucket rate limit
+type RateLimitConfig struct {
+	PerSecond float64 `json:"perSecond"`       // Sustained entries per second
+	Burst     int     `json:"burst,omitempty"` // Bucket size (default: perSecond, rounded up)
+}
+
+// DedupeConfig configures duplicate suppression. Entries are duplicates when they have the
+// same level, message and values for the configured fields.
+type DedupeConfig struct {
+	Window  string   `json:"window,omitempty"`  // Suppression window (default: "10s")
+	Fields  []string `json:"fields,omitempty"`  // Field paths added to the duplicate key, e.g. error.code
+	MaxKeys int      `json:"maxKeys,omitempty"` // Distinct entries tracked at once (default: 1000)
+}
+
+// parseThrottleConfig reads the throttle setting. It returns nil when no control is configured.
+func parseThrottleConfig(setting interface{}) (*ThrottleConfig, error) {
+	if setting == nil {
+		return nil, nil
+	}
+	if s, ok := setting.(string); ok && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	config := &ThrottleConfig{}
+	if err := decodeJSONConfig(setting, config); err != nil {
+		return nil, fmt.Errorf("invalid throttle setting: %w", err)
+	}
+
+	sampling := make(map[string]float64, len(config.Sampling))
+	for level, rate := range config.Sampling {
+		if rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return nil, fmt.Errorf("throttle sampling rate for %s must be between 0 and 1", level)
+		}
+		sampling[strings.ToUpper(level)] = rate
+	}
+	config.Sampling = sampling
+
+	if rl := config.RateLimit; rl != nil {
+		if rl.PerSecond <= 0 || rl.Burst < 0 {
+			return nil, fmt.Errorf("throttle rateLimit perSecond must be positive and burst must not be negative")
+		}
+		if rl.Burst == 0 {
+			rl.Burst = int(math.Ceil(rl.PerSecond))
+		}
+	}
+
+	if dd := config.Dedupe; dd != nil {
+		if dd.MaxKeys < 0 {
+			return nil, fmt.Errorf("throttle dedupe maxKeys must not be negative")
+		}
+		if dd.MaxKeys == 0 {
+			dd.MaxKeys = defaultDedupeMaxKeys
+		}
+		if dd.Window == "" {
+			dd.Window = defaultDedupeWindow.String()
+		}
+		if d, err := time.ParseDuration(dd.Window); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid throttle dedupe window '%s'", dd.Window)
+		}
+		for _, field := range dd.Fields {
+			if strings.TrimSpace(field) == "" {
+				return nil, fmt.Errorf("throttle dedupe fields must not be empty")
+			}
+		}
+	}
+
+	if len(config.Sampling) == 0 && config.RateLimit == nil && config.Dedupe == nil {
+		return nil, nil
+	}
+	return config, nil
+}
+
+// throttler applies the throttle controls of one activity. It is safe for concurrent use.
+type throttler struct {
+	sampling map[string]float64
+	random   func() float64
+	now      func() time.Time
+
+	// summarize emits the "repeated N times" entry for a suppressed record
+	summarize func(rec *Record, repeated int, first, last time.Time)
+	// warn reports entries dropped by the rate limit
+	warn func(format string, args ...interface{})
+
+	mu          sync.Mutex
+	rate, burst float64
+	tokens      float64
+	refilled    time.Time
+	rateDropped int
+
+	dedupe *deduper
+}
+
+func newThrottler(config *ThrottleConfig) *throttler {
+	t := &throttler{
+		sampling: config.Sampling,
+		random:   rand.Float64,
+		now:      time.Now,
+	}
+	if rl := config.RateLimit; rl != nil {
+		t.rate = rl.PerSecond
+		t.burst = float64(rl.Burst)
+		t.tokens = t.burst
+	}
+	if dd := config.Dedupe; dd != nil {
+		window, _ := time.ParseDuration(dd.Window)
+		t.dedupe = &deduper{
+			owner:   t,
+			window:  window,
+			fields:  dd.Fields,
+			maxKeys: dd.MaxKeys,
+			seen:    make(map[string]*dedupeState),
+		}
+		registerDeduper(t.dedupe)
+	}
+	return t
+}
+
+// sample reports whether an entry at the level is kept by probabilistic sampling
+func (t *throttler) sample(level string) bool {
+	rate, ok := t.sampling[strings.ToUpper(level)]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return t.random() < rate
+}
+
+// admit reports whether a built record is written. Duplicates are suppressed first, so
+// they don't use up the rate limit.
+func (t *throttler) admit(rec *Record) bool {
+	if t.dedupe != nil && !t.dedupe.admit(rec) {
+		return false
+	}
+	return t.allow()
+}
+
+// allow takes a token from the rate limit bucket
+func (t *throttler) allow() bool {
+	if t.rate == 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	if !t.refilled.IsZero() {
+		t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.refilled).Seconds()*t.rate)
+	}
+	t.refilled = now
+
+	if t.tokens < 1 {
+		t.rateDropped++
+		t.mu.Unlock()
+		return false
+	}
+	t.tokens--
+	dropped := t.rateDropped
+	t.rateDropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 && t.warn != nil {
+		t.warn("Rate limit dropped %d log entries", dropped)
+	}
+	return true
+}
+
+// dedupeState tracks one distinct entry during its suppression window
+type dedupeState struct {
+	rec      *Record // The first record, which was written
+	first    time.Time
+	last     time.Time
+	repeated int // Duplicates suppressed since the first record
+}
+
+// deduper suppresses duplicate records and emits one summary per window
+type deduper struct {
+	owner   *throttler
+	window  time.Duration
+	fields  []string
+	maxKeys int
+
+	mu      sync.Mutex
+	seen    map[string]*dedupeState
+	pending *time.Timer // Sweeps suppressed entries when no further records arrive
+}
+
+// admit reports whether the record is written, or counts it as a duplicate
+func (d *deduper) admit(rec *Record) bool {
+	key := d.key(rec)
+	now := d.owner.now()
+
+	d.mu.Lock()
+	summaries := d.expire(now)
+
+	admitted := true
+	if state, ok := d.seen[key]; ok {
+		state.repeated++
+		state.last = now
+		admitted = false
+		if d.pending == nil {
+			d.pending = time.AfterFunc(d.window, d.sweep)
+		}
+	} else if len(d.seen) < d.maxKeys {
+		d.seen[key] = &dedupeState{rec: rec, first: now, last: now}
+	}
+	d.mu.Unlock()
+
+	d.emit(summaries)
+	return admitted
+}
+
+// key builds the duplicate key from the level, message and configured fields
+func (d *deduper) key(rec *Record) string {
+	msg, _ := entryMessage(rec.Entry)
+
+	var b strings.Builder
+	b.WriteString(rec.Level)
+	b.WriteByte(0)
+	b.WriteString(msg)
+	for _, field := range d.fields {
+		b.WriteByte(0)
+		if v, ok := lookupField(rec.Entry, field); ok {
+			data, _ := json.Marshal(v)
+			b.Write(data)
+		}
+	}
+	return b.String()
+}
+
+// expire removes entries whose window has ended and returns those with suppressed
+// duplicates. The caller must hold the lock.
+func (d *deduper) expire(now time.Time) []*dedupeState {
+	var summaries []*dedupeState
+	for key, state := range d.seen {
+		if now.Sub(state.first) < d.window {
+			continue
+		}
+		delete(d.seen, key)
+		if state.repeated > 0 {
+			summaries = append(summaries, state)
+		}
+	}
+	return summaries
+}
+
+// sweep emits the summaries of ended windows, and reschedules itself while duplicates
+// are still being suppressed
+func (d *deduper) sweep() {
+	d.mu.Lock()
+	d.pending = nil
+	summaries := d.expire(d.owner.now())
+	for _, state := range d.seen {
+		if state.repeated > 0 {
+			d.pending = time.AfterFunc(d.window, d.sweep)
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	d.emit(summaries)
+}
+
+// flush emits the summaries of every suppressed entry, whether or not its window has ended
+func (d *deduper) flush() {
+	d.mu.Lock()
+	if d.pending != nil {
+		d.pending.Stop()
+		d.pending = nil
+	}
+	var summaries []*dedupeState
+	for _, state := range d.seen {
+		if state.repeated > 0 {
+			summaries = append(summaries, state)
+		}
+	}
+	d.seen = make(map[string]*dedupeState)
+	d.mu.Unlock()
+
+	d.emit(summaries)
+}
+
+func (d *deduper) emit(summaries []*dedupeState) {
+	if d.owner.summarize == nil {
+		return
+	}
+	for _, state := range summaries {
+		d.owner.summarize(state.rec, state.repeated, state.first, state.last)
+	}
+}
+
+// dedupers holds the active dedupers, so pending summaries are written on shutdown
+var dedupers = struct {
+	sync.Mutex
+	set map[*deduper]struct{}
+}{set: make(map[*deduper]struct{})}
+
+func registerDeduper(d *deduper) {
+	dedupers.Lock()
+	dedupers.set[d] = struct{}{}
+	dedupers.Unlock()
+	registerShutdownHook()
+}
+
+// flushDedupers writes the summaries of all suppressed entries
+func flushDedupers() {
+	dedupers.Lock()
+	set := dedupers.set
+	dedupers.set = make(map[*deduper]struct{})
+	dedupers.Unlock()
+
+	for d := range set {
+		d.flush()
+	}
+}
+
+// emitRepeatSummary writes the "repeated N times" entry for a suppressed record
+func (a *Activity) emitRepeatSummary(rec *Record, repeated int, first, last time.Time) {
+	entry := copyMap(rec.Entry)
+	msg, _ := entryMessage(entry)
+	entry["message"] = fmt.Sprintf("%s (repeated %d times)", msg, repeated)
+
+	repeat := map[string]interface{}{
+		"count": repeated,
+		"first": first.UTC().Format(time.RFC3339Nano),
+		"last":  last.UTC().Format(time.RFC3339Nano),
+	}
+	if a.ecs != nil {
+		a.ecs.addCustom(entry, "repeat", repeat)
+	} else {
+		entry["repeat"] = repeat
+	}
+
+	a.write(nil, &Record{
+		Time:    last,
+		Level:   rec.Level,
+		Entry:   entry,
+		TraceID: rec.TraceID,
+		SpanID:  rec.SpanID,
+	})
+}
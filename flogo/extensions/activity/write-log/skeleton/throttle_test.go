@@ -0,0 +1,186 @@
+package writelog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThrottleConfig(t *testing.T) {
+	config, err := parseThrottleConfig(`{"sampling": {"debug": 0.1}, "rateLimit": {"perSecond": 2.5}, "dedupe": {}}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"DEBUG": 0.1}, config.Sampling)
+	assert.Equal(t, 3, config.RateLimit.Burst)
+	assert.Equal(t, "10s", config.Dedupe.Window)
+	assert.Equal(t, defaultDedupeMaxKeys, config.Dedupe.MaxKeys)
+
+	for _, empty := range []interface{}{nil, "", "{}"} {
+		config, err := parseThrottleConfig(empty)
+		assert.NoError(t, err)
+		assert.Nil(t, config, "%v", empty)
+	}
+
+	for _, invalid := range []string{
+		`{"sampling": {"INFO": 1.5}}`,
+		`{"rateLimit": {"perSecond": 0}}`,
+		`{"rateLimit": {"perSecond": 5, "burst": -1}}`,
+		`{"dedupe": {"window": "soon"}}`,
+		`{"dedupe": {"fields": [""]}}`,
+		`[1, 2]`,
+	} {
+		_, err := parseThrottleConfig(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestThrottler_Sampling(t *testing.T) {
+	th := newThrottler(&ThrottleConfig{Sampling: map[string]float64{"DEBUG": 0.25, "TRACE": 0}})
+	roll := 0.0
+	th.random = func() float64 { return roll }
+
+	roll = 0.2
+	assert.True(t, th.sample("debug"))
+	assert.False(t, th.sample("TRACE"))
+	roll = 0.3
+	assert.False(t, th.sample("DEBUG"))
+	assert.True(t, th.sample("ERROR"), "levels without a rate are always kept")
+}
+
+func TestThrottler_RateLimit(t *testing.T) {
+	th := newThrottler(&ThrottleConfig{RateLimit: &RateLimitConfig{PerSecond: 2, Burst: 3}})
+	clock := &fakeClock{t: time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)}
+	th.now = clock.now
+	var warnings []string
+	th.warn = func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, th.allow(), "burst entry %d", i)
+	}
+	assert.False(t, th.allow())
+	assert.False(t, th.allow())
+
+	clock.advance(250 * time.Millisecond)
+	assert.False(t, th.allow(), "half a token")
+
+	clock.advance(250 * time.Millisecond)
+	assert.True(t, th.allow())
+	assert.Equal(t, []string{"Rate limit dropped 3 log entries"}, warnings)
+	assert.False(t, th.allow())
+
+	clock.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, th.allow(), "the bucket refills up to the burst only")
+	}
+	assert.False(t, th.allow())
+}
+
+func newThrottledActivity(t *testing.T, throttle string) (*Activity, *memorySink, *fakeClock) {
+	sinkType, mem := registerMemorySink(t)
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"sinks":        `[{"type":"` + sinkType + `"}]`,
+		"throttle":     throttle,
+	}, nil))
+	require.NoError(t, err)
+
+	a := act.(*Activity)
+	clock := &fakeClock{t: time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)}
+	a.throttle.now = clock.now
+	return a, mem, clock
+}
+
+func evalMessage(t *testing.T, act *Activity, level string, logObject interface{}) {
+	tc := test.NewActivityContext(act.Metadata())
+	tc.SetInput("logObject", logObject)
+	tc.SetInput("logLevel", level)
+	_, err := act.Eval(tc)
+	require.NoError(t, err)
+}
+
+func TestActivity_DuplicateSuppression(t *testing.T) {
+	defer CloseSinks()
+	act, mem, clock := newThrottledActivity(t, `{"dedupe": {"window": "10s", "fields": ["orderId"]}}`)
+
+	for i := 0; i < 5; i++ {
+		evalMessage(t, act, "ERROR", map[string]interface{}{"message": "payment failed", "orderId": "A"})
+		clock.advance(time.Second)
+	}
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "payment failed", "orderId": "B"})
+	evalMessage(t, act, "WARN", map[string]interface{}{"message": "payment failed", "orderId": "A"})
+	require.Len(t, mem.records, 3, "one entry per level, message and orderId")
+
+	clock.advance(5 * time.Second)
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "payment failed", "orderId": "A"})
+	require.Len(t, mem.records, 5)
+
+	summary := mem.records[3]
+	assert.Equal(t, "ERROR", summary.Level)
+	assert.Equal(t, "payment failed (repeated 4 times)", summary.Entry["message"])
+	assert.Equal(t, "A", summary.Entry["orderId"])
+	assert.Equal(t, map[string]interface{}{
+		"count": 4,
+		"first": "2025-08-04T10:00:00Z",
+		"last":  "2025-08-04T10:00:04Z",
+	}, summary.Entry["repeat"])
+	assert.Contains(t, summary.Line, "repeated 4 times")
+	assert.Equal(t, "payment failed", mem.records[4].Entry["message"], "a new window starts with a written entry")
+
+	// Pending summaries are written on shutdown
+	evalMessage(t, act, "ERROR", map[string]interface{}{"message": "payment failed", "orderId": "A"})
+	require.Len(t, mem.records, 5)
+	require.NoError(t, CloseSinks())
+	require.Len(t, mem.records, 6)
+	assert.Equal(t, "payment failed (repeated 1 times)", mem.records[5].Entry["message"])
+}
+
+func TestActivity_ThrottleConcurrentEval(t *testing.T) {
+	defer CloseSinks()
+	act, mem, _ := newThrottledActivity(t, `{"dedupe": {"window": "1h"}, "rateLimit": {"perSecond": 1, "burst": 5}}`)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				evalMessage(t, act, "ERROR", "disk full")
+				evalMessage(t, act, "INFO", fmt.Sprintf("request %d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Len(t, mem.records, 5, "the burst is shared by all goroutines")
+
+	act.throttle.dedupe.flush()
+	require.Len(t, mem.records, 6, "summaries are not rate limited")
+	assert.Equal(t, "disk full (repeated 999 times)", mem.records[5].Entry["message"])
+}
+
+func TestActivity_ThrottleStrictECS(t *testing.T) {
+	sinkType, mem := registerMemorySink(t)
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"ecsMode":      "strict",
+		"sinks":        `[{"type":"` + sinkType + `"}]`,
+		"throttle":     map[string]interface{}{"dedupe": map[string]interface{}{}},
+	}, nil))
+	require.NoError(t, err)
+	a := act.(*Activity)
+
+	evalMessage(t, a, "ERROR", "timeout")
+	evalMessage(t, a, "ERROR", "timeout")
+	a.throttle.dedupe.flush()
+	require.Len(t, mem.records, 2)
+
+	labels := mem.records[1].Entry["labels"].(map[string]interface{})
+	assert.Equal(t, "1", labels["repeat_count"])
+	assert.NotContains(t, mem.records[0].Entry["labels"], "repeat_count", "the first entry is not modified")
+}
@@ -0,0 +1,74 @@
+package writelog
+
+import (
+	"fmt"
+
+	"github.com/project-flogo/core/activity"
+)
+
+// correlationScopeNames are the flow attributes checked for a correlation ID when the
+// correlationId input is not mapped. The MySQL binlog trigger outputs correlationID.
+var correlationScopeNames = []string{"correlationID", "correlationId", "correlation_id"}
+
+// traceCorrelation holds the identifiers that join a log entry to its trace
+type traceCorrelation struct {
+	traceID       string
+	spanID        string
+	correlationID string
+}
+
+// resolveTraceCorrelation reads the trace and span IDs from the flow's tracing context and
+// resolves the correlation ID from the correlationId input or the flow scope
+func resolveTraceCorrelation(ctx activity.Context) traceCorrelation {
+	var tc traceCorrelation
+	if ctx == nil {
+		return tc
+	}
+
+	if tracingCtx := ctx.GetTracingContext(); tracingCtx != nil {
+		tc.traceID = tracingCtx.TraceID()
+		tc.spanID = tracingCtx.SpanID()
+	}
+
+	// Priority 1: the correlationId input
+	if correlationInput := ctx.GetInput("correlationId"); correlationInput != nil {
+		if id := fmt.Sprintf("%v", correlationInput); id != "" {
+			tc.correlationID = id
+			return tc
+		}
+	}
+
+	// Priority 2: a correlation ID attribute in the flow scope, e.g. mapped from the trigger output
+	if host := ctx.ActivityHost(); host != nil {
+		if scope := host.Scope(); scope != nil {
+			for _, name := range correlationScopeNames {
+				if value, exists := scope.GetValue(name); exists && value != nil {
+					if id := fmt.Sprintf("%v", value); id != "" {
+						tc.correlationID = id
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return tc
+}
+
+// addTo adds trace.id, span.id and correlation.id to the entry. Fields already present
+// in the user's log object take precedence.
+func (tc traceCorrelation) addTo(entry map[string]interface{}) {
+	setID := func(field, id string) {
+		if id == "" {
+			return
+		}
+		if _, exists := entry[field]; exists {
+			return
+		}
+		entry[field] = map[string]interface{}{"id": id}
+	}
+
+	setID("trace", tc.traceID)
+	setID("span", tc.spanID)
+	setID("correlation", tc.correlationID)
+}
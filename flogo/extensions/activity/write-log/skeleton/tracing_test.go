@@ -0,0 +1,209 @@
+package writelog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/support/test"
+	"github.com/project-flogo/core/support/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTracingContext is a minimal trace.TracingContext with fixed IDs
+type fakeTracingContext struct {
+	traceID, spanID string
+}
+
+func (f *fakeTracingContext) TraceObject() interface{}                  { return nil }
+func (f *fakeTracingContext) SetTags(tags map[string]interface{}) bool  { return true }
+func (f *fakeTracingContext) SetTag(key string, value interface{}) bool { return true }
+func (f *fakeTracingContext) LogKV(kvs map[string]interface{}) bool     { return true }
+func (f *fakeTracingContext) TraceID() string                           { return f.traceID }
+func (f *fakeTracingContext) SpanID() string                            { return f.spanID }
+
+// tracedContext is a test activity context with a tracing context
+type tracedContext struct {
+	*test.TestActivityContext
+	tracing trace.TracingContext
+}
+
+func (c *tracedContext) GetTracingContext() trace.TracingContext {
+	return c.tracing
+}
+
+func newTracedContext(md *activity.Metadata, scope map[string]interface{}, tracing trace.TracingContext) *tracedContext {
+	host := &test.TestActivityHost{HostId: "flow-1", HostData: data.NewSimpleScope(scope, nil)}
+	return &tracedContext{TestActivityContext: test.NewActivityContextWithAction(md, host), tracing: tracing}
+}
+
+func TestActivity_TraceCorrelation(t *testing.T) {
+	sinkType, mem := registerMemorySink(t)
+	defer CloseSinks()
+
+	act, err := New(test.NewActivityInitContext(map[string]interface{}{
+		"logLevel":     "INFO",
+		"outputFormat": "JSON",
+		"sinks":        `[{"type":"` + sinkType + `"}]`,
+	}, nil))
+	require.NoError(t, err)
+
+	tracing := &fakeTracingContext{traceID: "4bf92f3577b34da6a3ce929d0e0e4736", spanID: "00f067aa0ba902b7"}
+
+	t.Run("Trace and span IDs from the tracing context", func(t *testing.T) {
+		tc := newTracedContext(act.Metadata(), nil, tracing)
+		tc.SetInput("logObject", map[string]interface{}{"message": "order received"})
+		_, err := act.Eval(tc)
+		require.NoError(t, err)
+
+		rec := mem.records[len(mem.records)-1]
+		assert.Equal(t, tracing.traceID, rec.TraceID)
+		assert.Equal(t, tracing.spanID, rec.SpanID)
+
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(rec.Line), &entry))
+		assert.Equal(t, map[string]interface{}{"id": tracing.traceID}, entry["trace"])
+		assert.Equal(t, map[string]interface{}{"id": tracing.spanID}, entry["span"])
+		assert.NotContains(t, entry, "correlation")
+	})
+
+	t.Run("Correlation ID from the flow scope", func(t *testing.T) {
+		tc := newTracedContext(act.Metadata(), map[string]interface{}{"correlationID": "mysql-evt-42"}, tracing)
+		tc.SetInput("logObject", "row changed")
+		_, err := act.Eval(tc)
+		require.NoError(t, err)
+
+		rec := mem.records[len(mem.records)-1]
+		assert.Equal(t, map[string]interface{}{"id": "mysql-evt-42"}, rec.Entry["correlation"])
+	})
+
+	t.Run("Correlation ID input takes precedence", func(t *testing.T) {
+		tc := newTracedContext(act.Metadata(), map[string]interface{}{"correlation_id": "from-scope"}, nil)
+		tc.SetInput("logObject", "notification")
+		tc.SetInput("correlationId", "from-input")
+		_, err := act.Eval(tc)
+		require.NoError(t, err)
+
+		rec := mem.records[len(mem.records)-1]
+		assert.Equal(t, map[string]interface{}{"id": "from-input"}, rec.Entry["correlation"])
+		assert.NotContains(t, rec.Entry, "trace", "no trace fields without a tracing context")
+		assert.Empty(t, rec.TraceID)
+	})
+
+	t.Run("User-provided trace fields are kept", func(t *testing.T) {
+		tc := newTracedContext(act.Metadata(), nil, tracing)
+		tc.SetInput("logObject", map[string]interface{}{"message": "upstream", "trace": map[string]interface{}{"id": "upstream-trace"}})
+		_, err := act.Eval(tc)
+		require.NoError(t, err)
+
+		rec := mem.records[len(mem.records)-1]
+		assert.Equal(t, map[string]interface{}{"id": "upstream-trace"}, rec.Entry["trace"])
+		assert.Equal(t, map[string]interface{}{"id": tracing.spanID}, rec.Entry["span"])
+	})
+
+	t.Run("Flattened formats", func(t *testing.T) {
+		kv, err := New(test.NewActivityInitContext(map[string]interface{}{"logLevel": "INFO", "outputFormat": "LOGFMT"}, nil))
+		require.NoError(t, err)
+
+		tc := newTracedContext(kv.Metadata(), map[string]interface{}{"correlationId": "c-1"}, tracing)
+		line := kv.(*Activity).formatLogEntry(tc, "hello", "INFO", nil, nil)
+		assert.Equal(t, `correlation.id=c-1 level=INFO message=hello span.id=00f067aa0ba902b7 trace.id=4bf92f3577b34da6a3ce929d0e0e4736`, line)
+	})
+}
+
+func TestOTLPSink(t *testing.T) {
+	server := newCaptureServer(`{}`)
+	defer server.Close()
+
+	sink, err := newOTLPSink(SinkConfig{
+		Type:               SinkOTLP,
+		URL:                server.URL,
+		Headers:            map[string]string{"X-Tenant": "orders"},
+		ResourceAttributes: map[string]string{"service.name": "order-service", "deployment.environment": "test"},
+	}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	rec := &Record{
+		Time:    time.Unix(1754303445, 123),
+		Level:   "ERROR",
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+		Entry: map[string]interface{}{
+			"level":       "ERROR",
+			"message":     "payment failed",
+			"trace":       map[string]interface{}{"id": "4bf92f3577b34da6a3ce929d0e0e4736"},
+			"span":        map[string]interface{}{"id": "00f067aa0ba902b7"},
+			"correlation": map[string]interface{}{"id": "c-9"},
+			"amount":      12.5,
+			"attempt":     3,
+			"tags":        []interface{}{"card", true},
+		},
+	}
+	require.NoError(t, sink.Write(rec))
+	require.NoError(t, sink.Flush())
+	require.Equal(t, 1, server.requests())
+
+	assert.Equal(t, "/v1/logs", server.paths[0])
+	assert.Equal(t, "application/json", server.headers[0].Get("Content-Type"))
+	assert.Equal(t, "orders", server.headers[0].Get("X-Tenant"))
+
+	assert.JSONEq(t, `{
+		"resourceLogs": [{
+			"resource": {"attributes": [
+				{"key": "deployment.environment", "value": {"stringValue": "test"}},
+				{"key": "service.name", "value": {"stringValue": "order-service"}}
+			]},
+			"scopeLogs": [{
+				"scope": {"name": "flogo-activity-write-log", "version": "1.0.0"},
+				"logRecords": [{
+					"timeUnixNano": "1754303445000000123",
+					"observedTimeUnixNano": "1754303445000000123",
+					"severityNumber": 17,
+					"severityText": "ERROR",
+					"body": {"stringValue": "payment failed"},
+					"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+					"spanId": "00f067aa0ba902b7",
+					"attributes": [
+						{"key": "amount", "value": {"doubleValue": 12.5}},
+						{"key": "attempt", "value": {"intValue": "3"}},
+						{"key": "correlation", "value": {"kvlistValue": {"values": [{"key": "id", "value": {"stringValue": "c-9"}}]}}},
+						{"key": "tags", "value": {"arrayValue": {"values": [{"stringValue": "card"}, {"boolValue": true}]}}}
+					]
+				}]
+			}]
+		}]
+	}`, server.bodies[0])
+}
+
+func TestOTLPSink_EndpointAndPartialSuccess(t *testing.T) {
+	server := newCaptureServer(`{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"too old"}}`)
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL+"/otel/")
+	t.Setenv("OTEL_SERVICE_NAME", "from-env")
+
+	sink, err := newOTLPSink(SinkConfig{Type: SinkOTLP, BatchSize: 1}, nil)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Write(&Record{Time: time.Now(), Level: "INFO", Line: "plain", Entry: map[string]interface{}{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 log records rejected: too old")
+
+	assert.Equal(t, "/otel/v1/logs", server.paths[0])
+	assert.Contains(t, server.bodies[0], `{"key":"service.name","value":{"stringValue":"from-env"}}`)
+	assert.Contains(t, server.bodies[0], `"body":{"stringValue":"plain"}`)
+	assert.NotContains(t, server.bodies[0], "traceId")
+}
+
+func TestOTLPID(t *testing.T) {
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", otlpID("4BF92F3577B34DA6A3CE929D0E0E4736", 16))
+	assert.Equal(t, "0000000000000000a3ce929d0e0e4736", otlpID("a3ce929d0e0e4736", 16), "64-bit trace IDs are padded")
+	assert.Empty(t, otlpID("not-hex", 16))
+	assert.Empty(t, otlpID("00000000000000000000000000000000", 16))
+	assert.Empty(t, otlpID("4bf92f3577b34da6a3ce929d0e0e47360", 16))
+}